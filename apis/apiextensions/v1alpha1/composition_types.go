@@ -19,11 +19,17 @@ package v1alpha1
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"net/url"
 	"reflect"
+	"regexp"
+	"sync"
 
 	"k8s.io/apimachinery/pkg/runtime"
 
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
@@ -31,11 +37,23 @@ import (
 )
 
 const (
-	errMathNoMultiplier   = "no input is given"
+	errMathNoOperation    = "math transform requires a value to multiply by or add"
 	errMathInputNonNumber = "input is required to be a number for math transformer"
+	errRequiredField      = "cannot read the required source field of the patch"
+	errParseDefault       = "cannot parse the default value of the patch"
 )
 
 var (
+	errMathMultiplyOverflow = func(a, b int64) string {
+		return fmt.Sprintf("cannot multiply %d by %d: the result overflows a 64 bit integer", a, b)
+	}
+	errMathAddOverflow = func(a, b int64) string {
+		return fmt.Sprintf("cannot add %d to %d: the result overflows a 64 bit integer", b, a)
+	}
+	errMathFloatOverflow = func(f float64) string {
+		return fmt.Sprintf("cannot transform %g: the result overflows a 64 bit float", f)
+	}
+
 	errTransformAtIndex    = func(i int) string { return fmt.Sprintf("transform at index %d returned error", i) }
 	errTypeNotSupported    = func(s string) string { return fmt.Sprintf("transform type %s is not supported", s) }
 	errConfigMissing       = func(s string) string { return fmt.Sprintf("given type %s requires configuration", s) }
@@ -44,6 +62,23 @@ var (
 	errMapNotFound         = func(s string, m map[string]string) string {
 		return fmt.Sprintf("given value %s is not found in %v", s, m)
 	}
+
+	errParseJSONAnnotation     = func(k string) string { return fmt.Sprintf("cannot parse annotation %q as JSON", k) }
+	errJSONAnnotationNotObject = func(k string) string { return fmt.Sprintf("annotation %q is not a JSON object", k) }
+	errEscapeNotSupported      = func(e StringEscape) string { return fmt.Sprintf("string escape %q is not supported", e) }
+	errDefaultType             = func(d, path, t string) string {
+		return fmt.Sprintf("default value of the patch is of type %s, but the value at %s is of type %s", d, path, t)
+	}
+	errStringTypeNotSupported = func(t StringTransformType) string {
+		return fmt.Sprintf("string transform type %q is not supported", t)
+	}
+	errStringInputNonString = func(t StringTransformType, in interface{}) string {
+		return fmt.Sprintf("input is required to be a string for %s string transform, not %T", t, in)
+	}
+	errStringNoReplace = func(t StringTransformType) string {
+		return fmt.Sprintf("%s string transform requires a regular expression to replace", t)
+	}
+	errStringCompileReplace = func(re string) string { return fmt.Sprintf("cannot compile regular expression %q", re) }
 )
 
 // CompositionSpec specifies the desired state of the definition.
@@ -62,6 +97,25 @@ type CompositionSpec struct {
 	// this composition will be created.
 	// +optional
 	WriteConnectionSecretsToNamespace *string `json:"writeConnectionSecretsToNamespace,omitempty"`
+
+	// ConnectionSecretMetadata specifies labels and annotations to add to the
+	// connection secrets of composite resources that use this composition, for
+	// example so that tools can discover them.
+	// +optional
+	ConnectionSecretMetadata *ConnectionSecretMetadata `json:"connectionSecretMetadata,omitempty"`
+}
+
+// ConnectionSecretMetadata is the metadata of a published connection secret.
+type ConnectionSecretMetadata struct {
+	// Labels to add to the connection secret.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations to add to the connection secret. These take precedence over
+	// any annotations propagated from the connection secrets of composed
+	// resources.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 // TypeReference is used to refer to a type for declaring compatibility.
@@ -76,9 +130,24 @@ type TypeReference struct {
 // ComposedTemplate is used to provide information about how the composed resource
 // should be processed.
 type ComposedTemplate struct {
+	// Name of the template. Patches of the templates listed after this one
+	// may use it to read values from the resource composed from this
+	// template. Names must be unique within a composition.
+	// +optional
+	Name *string `json:"name,omitempty"`
+
 	// Base is the target resource that the patches will be applied on.
 	Base runtime.RawExtension `json:"base"`
 
+	// BaseMergeMode determines how the base is combined with an existing
+	// composed resource. "Replace" replaces the composed resource with the
+	// base, while "Merge" merges the base into it using JSON merge patch
+	// semantics so that fields the base doesn't specify, for example defaults
+	// populated by a provider, are left untouched. Defaults to "Replace".
+	// +kubebuilder:validation:Enum=Replace;Merge
+	// +optional
+	BaseMergeMode *BaseMergeMode `json:"baseMergeMode,omitempty"`
+
 	// Patches will be applied as overlay to the base resource.
 	// +optional
 	Patches []Patch `json:"patches,omitempty"`
@@ -88,6 +157,22 @@ type ComposedTemplate struct {
 	// +optional
 	ConnectionDetails []ConnectionDetail `json:"connectionDetails,omitempty"`
 
+	// ConnectionDetailsFromCompositeFieldPath is the path of an object in the
+	// composite resource, typically in its spec, that maps the names of
+	// additional connection secret keys to propagate to the keys of this
+	// target resource's connection secret they are read from. This allows a
+	// claim to choose some of the connection details that are published to it.
+	// ConnectionDetails take precedence over keys of the same name.
+	// +optional
+	ConnectionDetailsFromCompositeFieldPath *string `json:"connectionDetailsFromCompositeFieldPath,omitempty"`
+
+	// ConnectionSecretKeyFilter overrides the connection secret keys that may
+	// be propagated from this target resource. Keys that are explicitly allowed
+	// are propagated even if they are denied globally, while keys that are
+	// explicitly denied are never propagated.
+	// +optional
+	ConnectionSecretKeyFilter *ConnectionSecretKeyFilter `json:"connectionSecretKeyFilter,omitempty"`
+
 	// ReadinessChecks allows users to define custom readiness checks. All checks
 	// have to return true in order for resource to be considered ready. The
 	// default readiness check is to have the "Ready" condition to be "True".
@@ -98,8 +183,84 @@ type ComposedTemplate struct {
 	// connection secret
 	// +optional
 	ConnectionSecretRef *ConnectionSecretRef `json:"connectionSecretRef,omitempty"`
+
+	// AdditionalConnectionSecretRefs define the paths of additional
+	// connection secrets of the target resource, for example a secret
+	// written by a separate credentials operator. Their keys are merged in
+	// order with those of the connection secret, with later secrets taking
+	// precedence. Secrets that don't exist are skipped.
+	// +optional
+	AdditionalConnectionSecretRefs []ConnectionSecretRef `json:"additionalConnectionSecretRefs,omitempty"`
+
+	// ConnectionConfigMapRefs define the paths of ConfigMaps that the target
+	// resource publishes non-sensitive connection details to, for example
+	// endpoints and ports. Their keys are merged in order, and are read by
+	// FromConnectionSecretKey like the keys of connection secrets, which take
+	// precedence. ConfigMaps that don't exist are skipped.
+	// +optional
+	ConnectionConfigMapRefs []ConnectionSecretRef `json:"connectionConfigMapRefs,omitempty"`
+
+	// NamePrefixOverride is used to generate the name of the composed resource
+	// instead of the name prefix of the composite resource. This allows
+	// composed resources of the same composite resource to have
+	// distinguishable names, for example "mycomposite-db-" and
+	// "mycomposite-cache-".
+	// +optional
+	NamePrefixOverride *string `json:"namePrefixOverride,omitempty"`
+
+	// SpecTemplate is a Go text/template that is rendered with the entire
+	// composite resource as its context, for example to derive fields using
+	// conditionals that patches and transforms can't express. It must render
+	// a JSON object, which is merged into the spec of the composed resource.
+	// Only the builtin functions of the template language are available.
+	// +optional
+	SpecTemplate *string `json:"specTemplate,omitempty"`
+
+	// PropagateCompositionLabels determines whether the composed resource is
+	// labelled with the name prefix of the composite resource and the name and
+	// namespace of its claim. The labels are only needed when the composed
+	// resource is itself a composite resource, so leaf resources may opt out
+	// by setting it to false. Defaults to true. Labels that are listed in
+	// PropagateLabels are propagated regardless.
+	// +optional
+	PropagateCompositionLabels *bool `json:"propagateCompositionLabels,omitempty"`
+
+	// PropagateLabels lists the keys of additional labels of the composite
+	// resource to propagate to the composed resource, for example labels that
+	// identify the team or cost center that owns it. Labels the composite
+	// resource does not have are not propagated.
+	// +optional
+	PropagateLabels []string `json:"propagateLabels,omitempty"`
+
+	// PropagateAnnotations lists the keys of annotations of the composite
+	// resource to propagate to the composed resource, for example annotations
+	// read by policy engines. Annotations the composite resource does not have,
+	// or that the base template already sets, are not propagated.
+	// +optional
+	PropagateAnnotations []string `json:"propagateAnnotations,omitempty"`
+
+	// PropagateExternalName determines whether the external name annotation
+	// of the composite resource is propagated to the composed resource, so
+	// that the composed resource adopts an existing external resource. An
+	// external name the composed resource already has, or that the base
+	// template sets, is never overwritten. Defaults to false.
+	// +optional
+	PropagateExternalName *bool `json:"propagateExternalName,omitempty"`
 }
 
+// A BaseMergeMode determines how the base of a ComposedTemplate is combined
+// with an existing composed resource.
+type BaseMergeMode string
+
+// Supported base merge modes.
+const (
+	// BaseMergeModeReplace replaces the composed resource with the base.
+	BaseMergeModeReplace BaseMergeMode = "Replace"
+
+	// BaseMergeModeMerge merges the base into the composed resource.
+	BaseMergeModeMerge BaseMergeMode = "Merge"
+)
+
 // TypeReadinessCheck is used for readiness check types
 type TypeReadinessCheck string
 
@@ -108,6 +269,91 @@ const (
 	ReadinessCheckNonEmpty     TypeReadinessCheck = "NonEmpty"
 	ReadinessCheckMatchString  TypeReadinessCheck = "MatchString"
 	ReadinessCheckMatchInteger TypeReadinessCheck = "MatchInteger"
+	ReadinessCheckWebhook      TypeReadinessCheck = "Webhook"
+
+	// ReadinessCheckReadyAndNonEmpty passes when the composed resource has a
+	// Ready condition with status True and the field at FieldPath is not
+	// empty.
+	ReadinessCheckReadyAndNonEmpty TypeReadinessCheck = "ReadyAndNonEmpty"
+
+	// ReadinessCheckMatchFieldPath passes when the value at FieldPath is equal
+	// to the value at MatchFieldPath, for example when a provider has echoed
+	// the desired spec into the status of the composed resource.
+	ReadinessCheckMatchFieldPath TypeReadinessCheck = "MatchFieldPath"
+
+	// ReadinessCheckMatchCompositionRevision passes when the value at
+	// FieldPath, typically an annotation, is equal to the composition revision
+	// of the composite resource. This allows a composite resource to wait
+	// until its composed resources have been updated to its latest revision.
+	ReadinessCheckMatchCompositionRevision TypeReadinessCheck = "MatchCompositionRevision"
+
+	// ReadinessCheckNoFinalizers passes when none of the Finalizers are
+	// present in the metadata.finalizers of the composed resource. FieldPath
+	// is ignored.
+	ReadinessCheckNoFinalizers TypeReadinessCheck = "NoFinalizers"
+
+	// ReadinessCheckMatchBool passes when the boolean value at FieldPath is
+	// equal to MatchBool.
+	ReadinessCheckMatchBool TypeReadinessCheck = "MatchBool"
+
+	// ReadinessCheckMatchRegex passes when the string value at FieldPath
+	// matches the regular expression MatchRegex.
+	ReadinessCheckMatchRegex TypeReadinessCheck = "MatchRegex"
+
+	// ReadinessCheckMatchCondition passes when the condition of the composed
+	// resource described by MatchCondition has the expected status, for
+	// example when a composed composite resource is Synced. FieldPath is
+	// ignored.
+	ReadinessCheckMatchCondition TypeReadinessCheck = "MatchCondition"
+
+	// ReadinessCheckObservedGeneration passes when the integer at FieldPath,
+	// status.observedGeneration if FieldPath is omitted, matches the
+	// generation of the composed resource, and the generation has not changed
+	// since the check was last evaluated. Use ConsecutiveSuccesses to require
+	// that the generation remains stable for several reconciles.
+	ReadinessCheckObservedGeneration TypeReadinessCheck = "ObservedGeneration"
+
+	// ReadinessCheckGreaterThan passes when the integer at FieldPath is
+	// greater than MatchInteger. It does not pass if the field is absent.
+	ReadinessCheckGreaterThan TypeReadinessCheck = "GreaterThan"
+
+	// ReadinessCheckLessThan passes when the integer at FieldPath is less
+	// than MatchInteger. It does not pass if the field is absent.
+	ReadinessCheckLessThan TypeReadinessCheck = "LessThan"
+
+	// ReadinessCheckGroup passes when the checks of the group described by
+	// Group pass, combined according to its LogicOp. FieldPath is ignored.
+	ReadinessCheckGroup TypeReadinessCheck = "Group"
+
+	// ReadinessCheckMatchFloat passes when the number at FieldPath is within
+	// Tolerance of MatchFloat. It does not pass if the field is absent.
+	ReadinessCheckMatchFloat TypeReadinessCheck = "MatchFloat"
+
+	// ReadinessCheckNonEmptyCollection passes when the value at FieldPath is
+	// an array or object with at least one element, for example a list of
+	// endpoints. It does not pass if the field is absent.
+	ReadinessCheckNonEmptyCollection TypeReadinessCheck = "NonEmptyCollection"
+
+	// ReadinessCheckMatchAll passes when every string value at FieldPath is
+	// equal to MatchString. FieldPath may use [*] to match every element of an
+	// array or object, for example status.conditions[*].status. It does not
+	// pass if FieldPath matches no values.
+	ReadinessCheckMatchAll TypeReadinessCheck = "MatchAll"
+
+	// ReadinessCheckMatchAny passes when at least one string value at
+	// FieldPath is equal to MatchString. FieldPath may use [*] to match every
+	// element of an array or object. It does not pass if FieldPath matches no
+	// values.
+	ReadinessCheckMatchAny TypeReadinessCheck = "MatchAny"
+)
+
+// LogicOp is a logical operator used to combine readiness checks.
+type LogicOp string
+
+// The possible values for a logical operator.
+const (
+	LogicOpAnd LogicOp = "And"
+	LogicOpOr  LogicOp = "Or"
 )
 
 // ReadinessCheck is used to indicate how to tell whether a resource is ready
@@ -117,23 +363,203 @@ type ReadinessCheck struct {
 	FieldPath string `json:"fieldPath"`
 
 	// Type indicates the type of probe you'd like to use.
-	// +kubebuilder:validation:Enum="MatchString";"MatchInteger";"NonEmpty"
+	// +kubebuilder:validation:Enum="MatchString";"MatchInteger";"NonEmpty";"Webhook";"ReadyAndNonEmpty";"MatchFieldPath";"MatchCompositionRevision";"NoFinalizers";"MatchBool";"MatchRegex";"MatchCondition";"ObservedGeneration";"GreaterThan";"LessThan";"Group";"MatchFloat";"NonEmptyCollection";"MatchAll";"MatchAny"
 	Type TypeReadinessCheck `json:"type"`
 
-	// MatchString is the value you'd like to match if you're using "MatchString" type.
+	// MatchString is the value you'd like to match if you're using
+	// "MatchString", "MatchAll", or "MatchAny" type.
 	// +optional
 	MatchString string `json:"matchString,omitempty"`
 
-	// MatchInt is the value you'd like to match if you're using "MatchInt" type.
+	// MatchStrings are acceptable values you'd like to match if you're using
+	// "MatchString" type. The check passes if the value of the field matches
+	// any of them.
+	// +optional
+	MatchStrings []string `json:"matchStrings,omitempty"`
+
+	// MatchStringsFromCompositeFieldPath is the path of an array field of the
+	// composite resource whose values are used as MatchStrings, for example
+	// the zones requested by the composite resource. The check does not pass
+	// if the array is absent or empty.
+	// +optional
+	MatchStringsFromCompositeFieldPath string `json:"matchStringsFromCompositeFieldPath,omitempty"`
+
+	// MatchInt is the value you'd like to match if you're using "MatchInt" type,
+	// or the value to compare to if you're using "GreaterThan" or "LessThan"
+	// type.
 	// +optional
 	MatchInteger int64 `json:"matchInteger,omitempty"`
+
+	// MatchFloat is the value you'd like to match if you're using
+	// "MatchFloat" type.
+	// +optional
+	MatchFloat float64 `json:"matchFloat,omitempty"`
+
+	// Tolerance is the largest difference between the value at FieldPath and
+	// MatchFloat for which they are considered equal if you're using
+	// "MatchFloat" type. Values must be exactly equal if it is omitted.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Tolerance float64 `json:"tolerance,omitempty"`
+
+	// MatchBool is the value you'd like to match if you're using "MatchBool"
+	// type.
+	// +optional
+	MatchBool bool `json:"matchBool,omitempty"`
+
+	// MatchRegex is the regular expression you'd like the value to match if
+	// you're using "MatchRegex" type, for example "^Running".
+	// +optional
+	MatchRegex string `json:"matchRegex,omitempty"`
+
+	// MatchFieldPath is the path of the field whose value must be equal to
+	// the value at FieldPath if you're using "MatchFieldPath" type.
+	// +optional
+	MatchFieldPath string `json:"matchFieldPath,omitempty"`
+
+	// Finalizers that must not be present on the composed resource if you're
+	// using "NoFinalizers" type, for example temporary finalizers that a
+	// provider adds while it updates an external resource in place.
+	// +optional
+	Finalizers []string `json:"finalizers,omitempty"`
+
+	// AsQuantity causes the value of the field to be parsed as a Kubernetes
+	// resource quantity (e.g. "100Gi") if you're using "MatchInteger",
+	// "GreaterThan", or "LessThan" type.
+	// The value of the quantity is then compared to MatchInteger.
+	// +optional
+	AsQuantity bool `json:"asQuantity,omitempty"`
+
+	// IgnoreErrors causes the composed resource to be considered not ready,
+	// rather than the readiness check to return an error, when this check
+	// cannot be evaluated, for example because the field has a momentarily
+	// malformed value.
+	// +optional
+	IgnoreErrors bool `json:"ignoreErrors,omitempty"`
+
+	// Negate inverts the result of the check, for example to consider a
+	// composed resource ready only while the value at FieldPath does not
+	// match "Failed". Checks that match the value at FieldPath never pass
+	// while the field is absent, even if they are negated.
+	// +optional
+	Negate bool `json:"negate,omitempty"`
+
+	// TerminalAfterSeconds causes the composed resource to be considered to
+	// have failed terminally, rather than merely not ready, once this check
+	// has continuously failed for the given number of seconds.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TerminalAfterSeconds *int64 `json:"terminalAfterSeconds,omitempty"`
+
+	// TimeoutSeconds causes the composed resource to be considered to have
+	// failed terminally if this check has not passed once the given number of
+	// seconds have elapsed since the composed resource was created. Unlike
+	// TerminalAfterSeconds it is measured from the creation timestamp of the
+	// composed resource, so it is not reset when Crossplane restarts.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TimeoutSeconds *int64 `json:"timeoutSeconds,omitempty"`
+
+	// ConsecutiveSuccesses is the number of reconciles in a row in which this
+	// check must pass before the composed resource is considered ready. Any
+	// failure resets the count. Checks pass immediately if it is omitted.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ConsecutiveSuccesses int `json:"consecutiveSuccesses,omitempty"`
+
+	// Webhook configures the webhook that is called if you're using "Webhook"
+	// type.
+	// +optional
+	Webhook *WebhookReadinessCheck `json:"webhook,omitempty"`
+
+	// MatchCondition is the condition you'd like to match if you're using
+	// "MatchCondition" type.
+	// +optional
+	MatchCondition *MatchConditionReadinessCheck `json:"matchCondition,omitempty"`
+
+	// Group is the group of readiness checks that must pass if you're using
+	// "Group" type.
+	// +optional
+	Group *GroupReadinessCheck `json:"group,omitempty"`
+}
+
+// A GroupReadinessCheck combines several readiness checks, for example to
+// consider a composed resource ready if either of two fields is set.
+type GroupReadinessCheck struct {
+	// LogicOp combines the checks of the group. All checks must pass if it
+	// is "And", while any check must pass if it is "Or". Defaults to "And".
+	// A group without checks always passes.
+	// +kubebuilder:validation:Enum=And;Or
+	// +optional
+	LogicOp LogicOp `json:"logicOp,omitempty"`
+
+	// Checks of the group. Only the first failing check of an "And" group,
+	// or the first passing check of an "Or" group, is evaluated; ignoring
+	// errors and negation apply per check, while consecutive successes,
+	// terminal failures and timeouts apply only to the group as a whole.
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Checks []ReadinessCheck `json:"checks,omitempty"`
+}
+
+// A MatchConditionReadinessCheck checks the status of a condition of a
+// composed resource. A condition that the composed resource does not have is
+// considered to have status Unknown.
+type MatchConditionReadinessCheck struct {
+	// Type of the condition, for example "Synced".
+	Type v1alpha1.ConditionType `json:"type"`
+
+	// Status the condition must have. Defaults to "True".
+	// +kubebuilder:validation:Enum=True;False;Unknown
+	// +optional
+	Status corev1.ConditionStatus `json:"status,omitempty"`
+}
+
+// A WebhookReadinessCheck delegates the readiness check of a composed resource
+// to a webhook. The composed resource is POSTed to the webhook as JSON, and
+// the webhook is expected to respond with a JSON object whose boolean "ready"
+// field indicates whether the composed resource is ready.
+type WebhookReadinessCheck struct {
+	// URL of the webhook.
+	URL string `json:"url"`
+
+	// CABundle is a PEM encoded CA bundle used to validate the webhook's
+	// serving certificate. The system trust roots are used if unset.
+	// +optional
+	CABundle []byte `json:"caBundle,omitempty"`
+
+	// TimeoutSeconds is the time after which each call to the webhook times
+	// out. Defaults to 10 seconds.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=30
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+
+	// Retries is the number of times a failed call to the webhook is retried.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=5
+	// +optional
+	Retries *int32 `json:"retries,omitempty"`
+
+	// NotReadyOnError causes the composed resource to be considered not ready,
+	// rather than the readiness check to return an error, when the webhook
+	// cannot be called successfully.
+	// +optional
+	NotReadyOnError bool `json:"notReadyOnError,omitempty"`
 }
 
 // ConnectionSecretRef is used to define the path for custom secrets generated by composed resources
 // not following the Crossplane resources conventions
 type ConnectionSecretRef struct {
-	NamePath      string `json:"namePath"`
-	NamespacePath string `json:"namespacePath"`
+	NamePath string `json:"namePath"`
+
+	// NamespacePath is the path of the field the namespace of the secret is
+	// read from. If it is omitted the secret is presumed to be in the
+	// namespace of the claim the composed resource belongs to, if any, or
+	// else the namespace of the composed resource.
+	// +optional
+	NamespacePath string `json:"namespacePath,omitempty"`
 }
 
 // Patch is used to patch the field on the base resource at ToFieldPath
@@ -141,9 +567,34 @@ type ConnectionSecretRef struct {
 // transformers.
 type Patch struct {
 
+	// Type determines the direction of the patch. "FromCompositeFieldPath"
+	// (the default) patches the composed resource using a field of the
+	// composite resource, while "ToCompositeFieldPath" patches the composite
+	// resource using a field of the composed resource, for example to
+	// surface an address assigned to the composed resource in the status of
+	// the composite resource.
+	// +kubebuilder:validation:Enum=FromCompositeFieldPath;ToCompositeFieldPath
+	// +optional
+	Type PatchType `json:"type,omitempty"`
+
 	// FromFieldPath is the path of the field on the upstream resource whose value
-	// to be used as input.
-	FromFieldPath string `json:"fromFieldPath"`
+	// to be used as input. Required unless FromJSONAnnotation is set.
+	// +optional
+	FromFieldPath string `json:"fromFieldPath,omitempty"`
+
+	// FromJSONAnnotation reads the input from an annotation of the upstream
+	// resource whose value is a JSON document. Supercedes FromFieldPath when
+	// set.
+	// +optional
+	FromJSONAnnotation *JSONAnnotationSource `json:"fromJSONAnnotation,omitempty"`
+
+	// FromComposed is the name of the template whose composed resource is
+	// read from instead of the composite resource, for example to patch the
+	// ID of one composed resource into another. Resources are composed in
+	// the order their templates are listed, so the named template must be
+	// listed before the template of this patch.
+	// +optional
+	FromComposed *string `json:"fromComposed,omitempty"`
 
 	// ToFieldPath is the path of the field on the base resource whose value will
 	// be changed with the result of transforms. Leave empty if you'd like to
@@ -155,6 +606,131 @@ type Patch struct {
 	// input to be transformed.
 	// +optional
 	Transforms []Transform `json:"transforms,omitempty"`
+
+	// Default is written to ToFieldPath when the field the patch reads from
+	// does not exist, for example to avoid falling back to a provider's
+	// default. It is not transformed, and must be of the same type as any
+	// existing value at ToFieldPath. A patch with a default is never skipped
+	// or failed because the field it reads from does not exist.
+	// +optional
+	Default *v1beta1.JSON `json:"default,omitempty"`
+
+	// Policy configures the specifics of patching behaviour.
+	// +optional
+	Policy *PatchPolicy `json:"policy,omitempty"`
+
+	// Order optionally names this patch and declares the patches that must be
+	// applied before it. Patches are applied in the order they are listed
+	// unless they declare such dependencies.
+	// +optional
+	Order *PatchOrder `json:"order,omitempty"`
+}
+
+// A PatchType determines the direction of a patch.
+type PatchType string
+
+// Supported patch types.
+const (
+	// PatchTypeFromCompositeFieldPath patches the composed resource using a
+	// field of the composite resource.
+	PatchTypeFromCompositeFieldPath PatchType = "FromCompositeFieldPath"
+
+	// PatchTypeToCompositeFieldPath patches the composite resource using a
+	// field of the composed resource.
+	PatchTypeToCompositeFieldPath PatchType = "ToCompositeFieldPath"
+)
+
+// A PatchOrder declares where a patch is applied relative to other patches.
+type PatchOrder struct {
+	// Name of this patch, used by other patches to declare that they must be
+	// applied after it. Names must be unique within a composed template.
+	Name string `json:"name"`
+
+	// After lists the names of the patches that must be applied before this
+	// one.
+	// +optional
+	After []string `json:"after,omitempty"`
+}
+
+// A JSONAnnotationSource reads a patch input from an annotation whose value is
+// a JSON document.
+type JSONAnnotationSource struct {
+	// Key of the annotation.
+	Key string `json:"key"`
+
+	// FieldPath of the value within the parsed JSON document that is used as
+	// input. The whole document is used if omitted.
+	// +optional
+	FieldPath string `json:"fieldPath,omitempty"`
+}
+
+// A ToFieldPathPolicy determines how a patch writes to its ToFieldPath.
+type ToFieldPathPolicy string
+
+// Supported ToFieldPath patch policies.
+const (
+	// ToFieldPathPolicyReplace always replaces the value at ToFieldPath.
+	ToFieldPathPolicyReplace ToFieldPathPolicy = "Replace"
+
+	// ToFieldPathPolicySetIfEmpty sets the value at ToFieldPath only if the
+	// field is absent or empty.
+	ToFieldPathPolicySetIfEmpty ToFieldPathPolicy = "SetIfEmpty"
+)
+
+// A FromFieldPathPolicy determines what happens when the field a patch reads
+// from does not exist.
+type FromFieldPathPolicy string
+
+// Supported FromFieldPath patch policies.
+const (
+	// FromFieldPathPolicyOptional skips the patch if its source field does
+	// not exist.
+	FromFieldPathPolicyOptional FromFieldPathPolicy = "Optional"
+
+	// FromFieldPathPolicyRequired fails the patch if its source field does
+	// not exist.
+	FromFieldPathPolicyRequired FromFieldPathPolicy = "Required"
+)
+
+// An ErrorPolicy determines what happens when a patch cannot be applied.
+type ErrorPolicy string
+
+// Supported patch error policies.
+const (
+	// ErrorPolicyFail fails the reconcile of the composite resource.
+	ErrorPolicyFail ErrorPolicy = "Fail"
+
+	// ErrorPolicyDegrade marks the composite resource as degraded but
+	// continues to reconcile it.
+	ErrorPolicyDegrade ErrorPolicy = "Degrade"
+)
+
+// A PatchPolicy configures the specifics of patching behaviour.
+type PatchPolicy struct {
+	// Error specifies what happens when the patch cannot be applied. "Fail"
+	// (the default) fails the reconcile of the composite resource, while
+	// "Degrade" marks it as degraded and continues to apply the remaining
+	// patches, for example to tolerate a transiently missing source.
+	// +kubebuilder:validation:Enum=Fail;Degrade
+	// +optional
+	Error *ErrorPolicy `json:"error,omitempty"`
+
+	// FromFieldPath specifies what happens when the field the patch reads
+	// from does not exist. "Optional" (the default) skips the patch, for
+	// example to tolerate a field that is not yet set early in the lifecycle
+	// of the composite resource, while "Required" fails the patch according
+	// to its error policy.
+	// +kubebuilder:validation:Enum=Optional;Required
+	// +optional
+	FromFieldPath *FromFieldPathPolicy `json:"fromFieldPath,omitempty"`
+
+	// ToFieldPath specifies how to patch the value at ToFieldPath. "Replace"
+	// (the default) always replaces the existing value, while "SetIfEmpty"
+	// writes the value only if the field is absent or empty, preserving any
+	// value set by a provider or user on subsequent reconciles.
+	// +kubebuilder:validation:Enum=Replace;SetIfEmpty
+	// +optional
+	ToFieldPath *ToFieldPathPolicy `json:"toFieldPath,omitempty"`
 }
 
 // Apply runs transformers and patches the target resource.
@@ -164,40 +740,169 @@ func (c *Patch) Apply(from, to runtime.Object) error {
 		return err
 	}
 
-	in, err := fieldpath.Pave(fromMap).GetValue(c.FromFieldPath)
+	in, err := c.input(fromMap)
+	if fieldpath.IsNotFound(err) && c.Default != nil {
+		return c.patch(to, c.setDefault)
+	}
 	if fieldpath.IsNotFound(err) {
 		// A composition may want to opportunistically patch from a field path
 		// that may or may not exist in the composite, for example by patching
 		// {fromFieldPath: metadata.labels, toFieldPath: metadata.labels}. We
-		// don't consider a reference to a non-existent path to be an issue; if
-		// the relevant toFieldPath is required by the composed resource we'll
-		// report that fact when we attempt to reconcile the composite.
-		return nil
+		// don't consider a reference to a non-existent path to be an issue
+		// unless the patch requires it; if the relevant toFieldPath is
+		// required by the composed resource we'll report that fact when we
+		// attempt to reconcile the composite.
+		if !c.required() {
+			return nil
+		}
+		return errors.Wrap(err, errRequiredField)
 	}
 	if err != nil {
 		return err
 	}
-	out := in
-	for i, f := range c.Transforms {
-		if out, err = f.Transform(out); err != nil {
-			return errors.Wrap(err, errTransformAtIndex(i))
-		}
+	out, err := ApplyTransforms(c.Transforms, in)
+	if err != nil {
+		return err
 	}
+	return c.patch(to, func(p *fieldpath.Paved) error { return c.set(p, out) })
+}
 
+// patch the supplied target resource using the supplied function.
+func (c *Patch) patch(to runtime.Object, fn func(p *fieldpath.Paved) error) error {
+	// The input may be an object or array within the content of an
+	// unstructured source. Setting it marshals it to and from JSON, so the
+	// target never aliases the source and may be safely mutated.
 	if u, ok := to.(interface{ UnstructuredContent() map[string]interface{} }); ok {
-		return fieldpath.Pave(u.UnstructuredContent()).SetValue(c.ToFieldPath, out)
+		return fn(fieldpath.Pave(u.UnstructuredContent()))
 	}
 
 	toMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(to)
 	if err != nil {
 		return err
 	}
-	if err := fieldpath.Pave(toMap).SetValue(c.ToFieldPath, out); err != nil {
+	if err := fn(fieldpath.Pave(toMap)); err != nil {
 		return err
 	}
 	return runtime.DefaultUnstructuredConverter.FromUnstructured(toMap, to)
 }
 
+// setDefault sets the default value of the patch at ToFieldPath according to
+// the patch policy, if it is of the same type as any existing value there.
+func (c *Patch) setDefault(to *fieldpath.Paved) error {
+	var d interface{}
+	if err := json.Unmarshal(c.Default.Raw, &d); err != nil {
+		return errors.Wrap(err, errParseDefault)
+	}
+	current, err := to.GetValue(c.ToFieldPath)
+	if err != nil && !fieldpath.IsNotFound(err) {
+		return err
+	}
+	if err == nil && current != nil && d != nil && JSONType(current) != JSONType(d) {
+		return errors.New(errDefaultType(JSONType(d), c.ToFieldPath, JSONType(current)))
+	}
+	return c.set(to, d)
+}
+
+// JSONType returns a description of the JSON type of the supplied value, for
+// use in error messages. Integers and floating point numbers are both
+// considered numbers.
+func JSONType(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case int64, float64, int:
+		return "number"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// input returns the value of the supplied object that is used as the input of
+// the patch.
+func (c *Patch) input(from map[string]interface{}) (interface{}, error) {
+	if c.FromJSONAnnotation == nil {
+		return fieldpath.Pave(from).GetValue(c.FromFieldPath)
+	}
+
+	key := c.FromJSONAnnotation.Key
+	raw, err := fieldpath.Pave(from).GetString(fmt.Sprintf("metadata.annotations[%s]", key))
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+		return nil, errors.Wrap(err, errParseJSONAnnotation(key))
+	}
+	if c.FromJSONAnnotation.FieldPath == "" {
+		return doc, nil
+	}
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, errors.New(errJSONAnnotationNotObject(key))
+	}
+	return fieldpath.Pave(obj).GetValue(c.FromJSONAnnotation.FieldPath)
+}
+
+// required returns true if the source field of the patch must exist.
+func (c *Patch) required() bool {
+	return c.Policy != nil && c.Policy.FromFieldPath != nil && *c.Policy.FromFieldPath == FromFieldPathPolicyRequired
+}
+
+// set the supplied value at ToFieldPath according to the patch policy.
+func (c *Patch) set(to *fieldpath.Paved, value interface{}) error {
+	if c.Policy == nil || c.Policy.ToFieldPath == nil || *c.Policy.ToFieldPath != ToFieldPathPolicySetIfEmpty {
+		return to.SetValue(c.ToFieldPath, value)
+	}
+	current, err := to.GetValue(c.ToFieldPath)
+	if err != nil && !fieldpath.IsNotFound(err) {
+		return err
+	}
+	if !isEmpty(current) {
+		return nil
+	}
+	return to.SetValue(c.ToFieldPath, value)
+}
+
+// isEmpty returns true if the supplied value is nil, an empty string, or an
+// empty array or object.
+func isEmpty(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case string:
+		return t == ""
+	case []interface{}:
+		return len(t) == 0
+	case map[string]interface{}:
+		return len(t) == 0
+	default:
+		return false
+	}
+}
+
+// ApplyTransforms pipes the supplied input through the supplied transforms in
+// the order they are listed and returns the output of the last transform. It
+// is used both to patch composed resources and to derive connection details.
+func ApplyTransforms(ts []Transform, in interface{}) (interface{}, error) {
+	out := in
+	for i, t := range ts {
+		var err error
+		if out, err = t.Transform(out); err != nil {
+			return nil, errors.Wrap(err, errTransformAtIndex(i))
+		}
+	}
+	return out, nil
+}
+
 // TransformType is type of the transform function to be chosen.
 type TransformType string
 
@@ -224,6 +929,13 @@ type Transform struct {
 	// +optional
 	Map *MapTransform `json:"map,omitempty"`
 
+	// MissingKey determines what a map transform does with input that is not
+	// a key of its map. "Error" (the default) returns an error, while
+	// "Fallthrough" returns the input unchanged.
+	// +kubebuilder:validation:Enum=Error;Fallthrough
+	// +optional
+	MissingKey *MapMissingKeyPolicy `json:"missingKey,omitempty"`
+
 	// String is used to transform the input into a string or a different kind
 	// of string. Note that the input does not necessarily need to be a string.
 	// +optional
@@ -239,6 +951,13 @@ func (t *Transform) Transform(input interface{}) (interface{}, error) {
 	case TransformTypeMath:
 		transformer = t.Math
 	case TransformTypeMap:
+		if t.Map != nil && t.fallthroughMissingKey() {
+			if k, ok := input.(string); ok {
+				if _, found := t.Map.Pairs[k]; !found {
+					return input, nil
+				}
+			}
+		}
 		transformer = t.Map
 	case TransformTypeString:
 		transformer = t.String
@@ -252,29 +971,87 @@ func (t *Transform) Transform(input interface{}) (interface{}, error) {
 	return out, errors.Wrap(err, errTransformWithType(string(t.Type)))
 }
 
+func (t *Transform) fallthroughMissingKey() bool {
+	return t.MissingKey != nil && *t.MissingKey == MapMissingKeyFallthrough
+}
+
 // MathTransform conducts mathematical operations on the input with the given
-// configuration in its properties.
+// configuration in its properties. The input is multiplied before it is added
+// to if both operations are configured. Integer inputs produce integer outputs,
+// while floating point inputs produce floating point outputs.
 type MathTransform struct {
 	// Multiply the value.
 	// +optional
 	Multiply *int64 `json:"multiply,omitempty"`
+
+	// Add to the value, after multiplying it if Multiply is also set.
+	// +optional
+	Add *int64 `json:"add,omitempty"`
 }
 
 // Resolve runs the Math transform.
 func (m *MathTransform) Resolve(input interface{}) (interface{}, error) {
-	if m.Multiply == nil {
-		return nil, errors.New(errMathNoMultiplier)
+	if m.Multiply == nil && m.Add == nil {
+		return nil, errors.New(errMathNoOperation)
 	}
 	switch i := input.(type) {
 	case int64:
-		return *m.Multiply * i, nil
+		return m.resolveInteger(i)
 	case int:
-		return *m.Multiply * int64(i), nil
+		return m.resolveInteger(int64(i))
+	case float64:
+		return m.resolveFloat(i)
 	default:
 		return nil, errors.New(errMathInputNonNumber)
 	}
 }
 
+func (m *MathTransform) resolveInteger(i int64) (interface{}, error) {
+	if m.Multiply != nil {
+		r := i * *m.Multiply
+		if i != 0 && (r/i != *m.Multiply || (i == -1 && *m.Multiply == math.MinInt64)) {
+			return nil, errors.New(errMathMultiplyOverflow(i, *m.Multiply))
+		}
+		i = r
+	}
+	if m.Add != nil {
+		if (*m.Add > 0 && i > math.MaxInt64-*m.Add) || (*m.Add < 0 && i < math.MinInt64-*m.Add) {
+			return nil, errors.New(errMathAddOverflow(i, *m.Add))
+		}
+		i += *m.Add
+	}
+	return i, nil
+}
+
+func (m *MathTransform) resolveFloat(f float64) (interface{}, error) {
+	out := f
+	if m.Multiply != nil {
+		out *= float64(*m.Multiply)
+	}
+	if m.Add != nil {
+		out += float64(*m.Add)
+	}
+	if math.IsInf(out, 0) {
+		return nil, errors.New(errMathFloatOverflow(f))
+	}
+	return out, nil
+}
+
+// A MapMissingKeyPolicy determines what a map transform does with input that
+// is not a key of its map.
+type MapMissingKeyPolicy string
+
+// Supported map missing key policies.
+const (
+	// MapMissingKeyError returns an error if the input is not a key of the
+	// map.
+	MapMissingKeyError MapMissingKeyPolicy = "Error"
+
+	// MapMissingKeyFallthrough returns the input unchanged if it is not a key
+	// of the map.
+	MapMissingKeyFallthrough MapMissingKeyPolicy = "Fallthrough"
+)
+
 // MapTransform returns a value for the input from the given map.
 type MapTransform struct {
 	// TODO(negz): Are Pairs really optional if a MapTransform was specified?
@@ -315,16 +1092,153 @@ func (m *MapTransform) Resolve(input interface{}) (interface{}, error) {
 	}
 }
 
+// A StringEscape determines how a string is escaped.
+type StringEscape string
+
+// Supported string escapes.
+const (
+	// StringEscapeURLQuery escapes a string so that it can be safely placed
+	// inside a URL query, for example a password in a connection string.
+	StringEscapeURLQuery StringEscape = "URLQueryEscape"
+
+	// StringEscapeURLPath escapes a string so that it can be safely placed
+	// inside a URL path segment.
+	StringEscapeURLPath StringEscape = "URLPathEscape"
+)
+
+// Escape the supplied string.
+func (e StringEscape) Escape(s string) (string, error) {
+	switch e {
+	case StringEscapeURLQuery:
+		return url.QueryEscape(s), nil
+	case StringEscapeURLPath:
+		return url.PathEscape(s), nil
+	default:
+		return "", errors.New(errEscapeNotSupported(e))
+	}
+}
+
+// A StringTransformType determines how a StringTransform transforms its input.
+type StringTransformType string
+
+// Supported string transform types.
+const (
+	// StringTransformFormat formats the input using a Go format string. The
+	// input need not be a string.
+	StringTransformFormat StringTransformType = "Format"
+
+	// StringTransformPrefix prepends a prefix to the input string.
+	StringTransformPrefix StringTransformType = "Prefix"
+
+	// StringTransformSuffix appends a suffix to the input string.
+	StringTransformSuffix StringTransformType = "Suffix"
+
+	// StringTransformReplace replaces each match of a regular expression in
+	// the input string.
+	StringTransformReplace StringTransformType = "Replace"
+)
+
 // A StringTransform returns a string given the supplied input.
 type StringTransform struct {
-	// Format the input using a Go format string. See
-	// https://golang.org/pkg/fmt/ for details.
-	Format string `json:"fmt"`
+	// Type of the string transform. Transforms other than Format require their
+	// input to be a string. Defaults to Format.
+	// +kubebuilder:validation:Enum=Format;Prefix;Suffix;Replace
+	// +optional
+	Type StringTransformType `json:"type,omitempty"`
+
+	// Format the input using a Go format string if you're using "Format"
+	// type. See https://golang.org/pkg/fmt/ for details.
+	// +optional
+	Format string `json:"fmt,omitempty"`
+
+	// Escape the input before it is formatted, for example so that it can be
+	// safely embedded in a URL or connection string. The input is formatted
+	// as a string once escaped.
+	// +kubebuilder:validation:Enum=URLQueryEscape;URLPathEscape
+	// +optional
+	Escape *StringEscape `json:"escape,omitempty"`
+
+	// Prefix is prepended to the input if you're using "Prefix" type.
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+
+	// Suffix is appended to the input if you're using "Suffix" type.
+	// +optional
+	Suffix string `json:"suffix,omitempty"`
+
+	// Replace configures the replacement if you're using "Replace" type.
+	// +optional
+	Replace *StringReplace `json:"replace,omitempty"`
+}
+
+// A StringReplace replaces each match of a regular expression in a string.
+type StringReplace struct {
+	// Regexp to match, using RE2 syntax. See
+	// https://github.com/google/re2/wiki/Syntax for details.
+	Regexp string `json:"regexp"`
+
+	// Replacement for each match of Regexp. It may refer to submatches of
+	// Regexp, for example $1 or ${name}. See
+	// https://golang.org/pkg/regexp/#Regexp.Expand for details.
+	// +optional
+	Replacement string `json:"replacement,omitempty"`
 }
 
 // Resolve runs the String transform.
 func (s *StringTransform) Resolve(input interface{}) (interface{}, error) {
-	return fmt.Sprintf(s.Format, input), nil
+	if s.Type == "" || s.Type == StringTransformFormat {
+		return s.format(input)
+	}
+	in, ok := input.(string)
+	if !ok {
+		return nil, errors.New(errStringInputNonString(s.Type, input))
+	}
+	switch s.Type {
+	case StringTransformPrefix:
+		return s.Prefix + in, nil
+	case StringTransformSuffix:
+		return in + s.Suffix, nil
+	case StringTransformReplace:
+		if s.Replace == nil {
+			return nil, errors.New(errStringNoReplace(s.Type))
+		}
+		re, err := compileReplace(s.Replace.Regexp)
+		if err != nil {
+			return nil, errors.Wrap(err, errStringCompileReplace(s.Replace.Regexp))
+		}
+		return re.ReplaceAllString(in, s.Replace.Replacement), nil
+	default:
+		return nil, errors.New(errStringTypeNotSupported(s.Type))
+	}
+}
+
+// replaceRegexps caches the compiled regular expressions of Replace string
+// transforms, which would otherwise be compiled every time a patch is applied.
+var replaceRegexps sync.Map
+
+// compileReplace compiles the supplied regular expression, or returns it from
+// the cache if it was previously compiled.
+func compileReplace(expr string) (*regexp.Regexp, error) {
+	if re, ok := replaceRegexps.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	replaceRegexps.Store(expr, re)
+	return re, nil
+}
+
+func (s *StringTransform) format(input interface{}) (interface{}, error) {
+	if s.Escape == nil {
+		return fmt.Sprintf(s.Format, input), nil
+	}
+	escaped, err := s.Escape.Escape(fmt.Sprint(input))
+	if err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf(s.Format, escaped), nil
 }
 
 // ConnectionDetail includes the information about the propagation of the connection
@@ -336,11 +1250,67 @@ type ConnectionDetail struct {
 	// +optional
 	Name *string `json:"name,omitempty"`
 
+	// KeyPrefix is prepended to the key of the connection secret of the
+	// composition instance that this connection detail is propagated to,
+	// for example "db-" to avoid collisions between the connection details of
+	// different target resources.
+	// +optional
+	KeyPrefix string `json:"keyPrefix,omitempty"`
+
+	// PublishWhenReady causes this connection detail to be propagated only
+	// once the target resource is ready, for example an endpoint that is not
+	// valid until the resource has been provisioned.
+	// +optional
+	PublishWhenReady bool `json:"publishWhenReady,omitempty"`
+
 	// FromConnectionSecretKey is the key that will be used to fetch the value
-	// from the given target resource.
+	// from the given target resource. The key may be a Go template that is
+	// rendered using the composite resource, for example
+	// "password-{{ .metadata.labels.region }}".
 	// +optional
 	FromConnectionSecretKey *string `json:"fromConnectionSecretKey,omitempty"`
 
+	// FromFieldPath is the path of the field of the target resource whose
+	// value will be propagated, for example "status.atProvider.endpoint".
+	// Name must be set. The value must be a string, number, or boolean.
+	// Supercedes FromConnectionSecretKey when set.
+	// +optional
+	FromFieldPath *string `json:"fromFieldPath,omitempty"`
+
+	// FromCompositeFieldPath is the path of the field of the composition
+	// instance whose value will be propagated, for example "spec.region".
+	// Name must be set. The value must be a string, number, or boolean.
+	// Supercedes FromFieldPath and FromConnectionSecretKey when set.
+	// +optional
+	FromCompositeFieldPath *string `json:"fromCompositeFieldPath,omitempty"`
+
+	// Transforms are applied to the value read from FromConnectionSecretKey
+	// or FromFieldPath in the order they are listed, using the same functions
+	// as patches. Values are transformed after they are base64 decoded and
+	// before they are escaped.
+	// +optional
+	Transforms []Transform `json:"transforms,omitempty"`
+
+	// DecodeBase64 causes the value read from FromConnectionSecretKey to be
+	// base64 decoded before it is propagated, for secrets whose values are
+	// base64 encoded twice.
+	// +optional
+	DecodeBase64 bool `json:"decodeBase64,omitempty"`
+
+	// EncodeBase64 causes the value read from FromConnectionSecretKey to be
+	// base64 encoded before it is propagated, for consumers that expect
+	// base64 encoded values. Values are encoded after they are escaped.
+	// +optional
+	EncodeBase64 bool `json:"encodeBase64,omitempty"`
+
+	// Escape the value read from FromConnectionSecretKey before it is
+	// propagated, for example so that it can be safely embedded in a URL or
+	// connection string by its consumer. Values are escaped after they are
+	// base64 decoded.
+	// +kubebuilder:validation:Enum=URLQueryEscape;URLPathEscape
+	// +optional
+	Escape *StringEscape `json:"escape,omitempty"`
+
 	// Value that will be propagated to the connection secret of the composition
 	// instance. Typically you should use FromConnectionSecretKey instead, but
 	// an explicit value may be set to inject a fixed, non-sensitive connection
@@ -350,6 +1320,20 @@ type ConnectionDetail struct {
 	Value *string `json:"value,omitempty"`
 }
 
+// A ConnectionSecretKeyFilter overrides the global filter that determines
+// which connection secret keys may be propagated from a target resource.
+type ConnectionSecretKeyFilter struct {
+	// Allow lists keys that may be propagated even if they are denied
+	// globally.
+	// +optional
+	Allow []string `json:"allow,omitempty"`
+
+	// Deny lists keys that must not be propagated. Deny takes precedence
+	// over Allow.
+	// +optional
+	Deny []string `json:"deny,omitempty"`
+}
+
 // CompositionStatus shows the observed state of the composition.
 type CompositionStatus struct {
 	v1alpha1.ConditionedStatus `json:",inline"`
@@ -32,6 +32,10 @@ const (
 	// A TypeOffered XRD has created the CRD for its composite resource claim
 	// and started a controller to reconcile instances of said claim.
 	TypeOffered runtimev1alpha1.ConditionType = "Offered"
+
+	// A TypeDegraded composite resource could not apply one or more patches
+	// whose error policy is to degrade rather than fail.
+	TypeDegraded runtimev1alpha1.ConditionType = "Degraded"
 )
 
 // Reasons a resource is or is not established or offered.
@@ -43,6 +47,12 @@ const (
 	ReasonTerminatingClaim     runtimev1alpha1.ConditionReason = "TerminatingCompositeResourceClaim"
 )
 
+// Reasons a composite resource is or is not degraded.
+const (
+	ReasonPatchFailed    runtimev1alpha1.ConditionReason = "PatchFailed"
+	ReasonPatchesApplied runtimev1alpha1.ConditionReason = "PatchesApplied"
+)
+
 // WatchingComposite indicates that Crossplane has defined and is watching for a
 // new kind of composite resource.
 func WatchingComposite() runtimev1alpha1.Condition {
@@ -86,3 +96,26 @@ func TerminatingClaim() runtimev1alpha1.Condition {
 		Reason:             ReasonTerminatingClaim,
 	}
 }
+
+// Degraded indicates that Crossplane could not apply one or more patches to
+// the resources composed by a composite resource, but continued to reconcile
+// it.
+func Degraded() runtimev1alpha1.Condition {
+	return runtimev1alpha1.Condition{
+		Type:               TypeDegraded,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonPatchFailed,
+	}
+}
+
+// NotDegraded indicates that Crossplane applied all patches to the resources
+// composed by a composite resource.
+func NotDegraded() runtimev1alpha1.Condition {
+	return runtimev1alpha1.Condition{
+		Type:               TypeDegraded,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonPatchesApplied,
+	}
+}
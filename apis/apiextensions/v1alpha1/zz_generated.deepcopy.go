@@ -55,7 +55,17 @@ func (in *CRDSpecTemplate) DeepCopy() *CRDSpecTemplate {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ComposedTemplate) DeepCopyInto(out *ComposedTemplate) {
 	*out = *in
+	if in.Name != nil {
+		in, out := &in.Name, &out.Name
+		*out = new(string)
+		**out = **in
+	}
 	in.Base.DeepCopyInto(&out.Base)
+	if in.BaseMergeMode != nil {
+		in, out := &in.BaseMergeMode, &out.BaseMergeMode
+		*out = new(BaseMergeMode)
+		**out = **in
+	}
 	if in.Patches != nil {
 		in, out := &in.Patches, &out.Patches
 		*out = make([]Patch, len(*in))
@@ -70,16 +80,68 @@ func (in *ComposedTemplate) DeepCopyInto(out *ComposedTemplate) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.ConnectionDetailsFromCompositeFieldPath != nil {
+		in, out := &in.ConnectionDetailsFromCompositeFieldPath, &out.ConnectionDetailsFromCompositeFieldPath
+		*out = new(string)
+		**out = **in
+	}
+	if in.ConnectionSecretKeyFilter != nil {
+		in, out := &in.ConnectionSecretKeyFilter, &out.ConnectionSecretKeyFilter
+		*out = new(ConnectionSecretKeyFilter)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.ReadinessChecks != nil {
 		in, out := &in.ReadinessChecks, &out.ReadinessChecks
 		*out = make([]ReadinessCheck, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	if in.ConnectionSecretRef != nil {
 		in, out := &in.ConnectionSecretRef, &out.ConnectionSecretRef
 		*out = new(ConnectionSecretRef)
 		**out = **in
 	}
+	if in.AdditionalConnectionSecretRefs != nil {
+		in, out := &in.AdditionalConnectionSecretRefs, &out.AdditionalConnectionSecretRefs
+		*out = make([]ConnectionSecretRef, len(*in))
+		copy(*out, *in)
+	}
+	if in.ConnectionConfigMapRefs != nil {
+		in, out := &in.ConnectionConfigMapRefs, &out.ConnectionConfigMapRefs
+		*out = make([]ConnectionSecretRef, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamePrefixOverride != nil {
+		in, out := &in.NamePrefixOverride, &out.NamePrefixOverride
+		*out = new(string)
+		**out = **in
+	}
+	if in.SpecTemplate != nil {
+		in, out := &in.SpecTemplate, &out.SpecTemplate
+		*out = new(string)
+		**out = **in
+	}
+	if in.PropagateCompositionLabels != nil {
+		in, out := &in.PropagateCompositionLabels, &out.PropagateCompositionLabels
+		*out = new(bool)
+		**out = **in
+	}
+	if in.PropagateLabels != nil {
+		in, out := &in.PropagateLabels, &out.PropagateLabels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PropagateAnnotations != nil {
+		in, out := &in.PropagateAnnotations, &out.PropagateAnnotations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PropagateExternalName != nil {
+		in, out := &in.PropagateExternalName, &out.PropagateExternalName
+		*out = new(bool)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComposedTemplate.
@@ -278,6 +340,11 @@ func (in *CompositionSpec) DeepCopyInto(out *CompositionSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.ConnectionSecretMetadata != nil {
+		in, out := &in.ConnectionSecretMetadata, &out.ConnectionSecretMetadata
+		*out = new(ConnectionSecretMetadata)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CompositionSpec.
@@ -319,6 +386,28 @@ func (in *ConnectionDetail) DeepCopyInto(out *ConnectionDetail) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.FromFieldPath != nil {
+		in, out := &in.FromFieldPath, &out.FromFieldPath
+		*out = new(string)
+		**out = **in
+	}
+	if in.FromCompositeFieldPath != nil {
+		in, out := &in.FromCompositeFieldPath, &out.FromCompositeFieldPath
+		*out = new(string)
+		**out = **in
+	}
+	if in.Transforms != nil {
+		in, out := &in.Transforms, &out.Transforms
+		*out = make([]Transform, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Escape != nil {
+		in, out := &in.Escape, &out.Escape
+		*out = new(StringEscape)
+		**out = **in
+	}
 	if in.Value != nil {
 		in, out := &in.Value, &out.Value
 		*out = new(string)
@@ -336,6 +425,60 @@ func (in *ConnectionDetail) DeepCopy() *ConnectionDetail {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConnectionSecretKeyFilter) DeepCopyInto(out *ConnectionSecretKeyFilter) {
+	*out = *in
+	if in.Allow != nil {
+		in, out := &in.Allow, &out.Allow
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Deny != nil {
+		in, out := &in.Deny, &out.Deny
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConnectionSecretKeyFilter.
+func (in *ConnectionSecretKeyFilter) DeepCopy() *ConnectionSecretKeyFilter {
+	if in == nil {
+		return nil
+	}
+	out := new(ConnectionSecretKeyFilter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConnectionSecretMetadata) DeepCopyInto(out *ConnectionSecretMetadata) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConnectionSecretMetadata.
+func (in *ConnectionSecretMetadata) DeepCopy() *ConnectionSecretMetadata {
+	if in == nil {
+		return nil
+	}
+	out := new(ConnectionSecretMetadata)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ConnectionSecretRef) DeepCopyInto(out *ConnectionSecretRef) {
 	*out = *in
@@ -392,6 +535,43 @@ func (in *CustomResourceValidation) DeepCopy() *CustomResourceValidation {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GroupReadinessCheck) DeepCopyInto(out *GroupReadinessCheck) {
+	*out = *in
+	if in.Checks != nil {
+		in, out := &in.Checks, &out.Checks
+		*out = make([]ReadinessCheck, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GroupReadinessCheck.
+func (in *GroupReadinessCheck) DeepCopy() *GroupReadinessCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(GroupReadinessCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JSONAnnotationSource) DeepCopyInto(out *JSONAnnotationSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JSONAnnotationSource.
+func (in *JSONAnnotationSource) DeepCopy() *JSONAnnotationSource {
+	if in == nil {
+		return nil
+	}
+	out := new(JSONAnnotationSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MapTransform) DeepCopyInto(out *MapTransform) {
 	*out = *in
@@ -414,6 +594,21 @@ func (in *MapTransform) DeepCopy() *MapTransform {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MatchConditionReadinessCheck) DeepCopyInto(out *MatchConditionReadinessCheck) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MatchConditionReadinessCheck.
+func (in *MatchConditionReadinessCheck) DeepCopy() *MatchConditionReadinessCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(MatchConditionReadinessCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MathTransform) DeepCopyInto(out *MathTransform) {
 	*out = *in
@@ -422,6 +617,11 @@ func (in *MathTransform) DeepCopyInto(out *MathTransform) {
 		*out = new(int64)
 		**out = **in
 	}
+	if in.Add != nil {
+		in, out := &in.Add, &out.Add
+		*out = new(int64)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MathTransform.
@@ -437,6 +637,16 @@ func (in *MathTransform) DeepCopy() *MathTransform {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Patch) DeepCopyInto(out *Patch) {
 	*out = *in
+	if in.FromJSONAnnotation != nil {
+		in, out := &in.FromJSONAnnotation, &out.FromJSONAnnotation
+		*out = new(JSONAnnotationSource)
+		**out = **in
+	}
+	if in.FromComposed != nil {
+		in, out := &in.FromComposed, &out.FromComposed
+		*out = new(string)
+		**out = **in
+	}
 	if in.Transforms != nil {
 		in, out := &in.Transforms, &out.Transforms
 		*out = make([]Transform, len(*in))
@@ -444,6 +654,21 @@ func (in *Patch) DeepCopyInto(out *Patch) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Default != nil {
+		in, out := &in.Default, &out.Default
+		*out = new(v1beta1.JSON)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Policy != nil {
+		in, out := &in.Policy, &out.Policy
+		*out = new(PatchPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Order != nil {
+		in, out := &in.Order, &out.Order
+		*out = new(PatchOrder)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Patch.
@@ -456,9 +681,94 @@ func (in *Patch) DeepCopy() *Patch {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PatchOrder) DeepCopyInto(out *PatchOrder) {
+	*out = *in
+	if in.After != nil {
+		in, out := &in.After, &out.After
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PatchOrder.
+func (in *PatchOrder) DeepCopy() *PatchOrder {
+	if in == nil {
+		return nil
+	}
+	out := new(PatchOrder)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PatchPolicy) DeepCopyInto(out *PatchPolicy) {
+	*out = *in
+	if in.Error != nil {
+		in, out := &in.Error, &out.Error
+		*out = new(ErrorPolicy)
+		**out = **in
+	}
+	if in.FromFieldPath != nil {
+		in, out := &in.FromFieldPath, &out.FromFieldPath
+		*out = new(FromFieldPathPolicy)
+		**out = **in
+	}
+	if in.ToFieldPath != nil {
+		in, out := &in.ToFieldPath, &out.ToFieldPath
+		*out = new(ToFieldPathPolicy)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PatchPolicy.
+func (in *PatchPolicy) DeepCopy() *PatchPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(PatchPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ReadinessCheck) DeepCopyInto(out *ReadinessCheck) {
 	*out = *in
+	if in.MatchStrings != nil {
+		in, out := &in.MatchStrings, &out.MatchStrings
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Finalizers != nil {
+		in, out := &in.Finalizers, &out.Finalizers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TerminalAfterSeconds != nil {
+		in, out := &in.TerminalAfterSeconds, &out.TerminalAfterSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.TimeoutSeconds != nil {
+		in, out := &in.TimeoutSeconds, &out.TimeoutSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Webhook != nil {
+		in, out := &in.Webhook, &out.Webhook
+		*out = new(WebhookReadinessCheck)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MatchCondition != nil {
+		in, out := &in.MatchCondition, &out.MatchCondition
+		*out = new(MatchConditionReadinessCheck)
+		**out = **in
+	}
+	if in.Group != nil {
+		in, out := &in.Group, &out.Group
+		*out = new(GroupReadinessCheck)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReadinessCheck.
@@ -471,9 +781,34 @@ func (in *ReadinessCheck) DeepCopy() *ReadinessCheck {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StringReplace) DeepCopyInto(out *StringReplace) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StringReplace.
+func (in *StringReplace) DeepCopy() *StringReplace {
+	if in == nil {
+		return nil
+	}
+	out := new(StringReplace)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StringTransform) DeepCopyInto(out *StringTransform) {
 	*out = *in
+	if in.Escape != nil {
+		in, out := &in.Escape, &out.Escape
+		*out = new(StringEscape)
+		**out = **in
+	}
+	if in.Replace != nil {
+		in, out := &in.Replace, &out.Replace
+		*out = new(StringReplace)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StringTransform.
@@ -499,10 +834,15 @@ func (in *Transform) DeepCopyInto(out *Transform) {
 		*out = new(MapTransform)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.MissingKey != nil {
+		in, out := &in.MissingKey, &out.MissingKey
+		*out = new(MapMissingKeyPolicy)
+		**out = **in
+	}
 	if in.String != nil {
 		in, out := &in.String, &out.String
 		*out = new(StringTransform)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 }
 
@@ -530,3 +870,33 @@ func (in *TypeReference) DeepCopy() *TypeReference {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookReadinessCheck) DeepCopyInto(out *WebhookReadinessCheck) {
+	*out = *in
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	if in.TimeoutSeconds != nil {
+		in, out := &in.TimeoutSeconds, &out.TimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Retries != nil {
+		in, out := &in.Retries, &out.Retries
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookReadinessCheck.
+func (in *WebhookReadinessCheck) DeepCopy() *WebhookReadinessCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookReadinessCheck)
+	in.DeepCopyInto(out)
+	return out
+}
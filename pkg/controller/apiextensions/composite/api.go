@@ -18,18 +18,29 @@ package composite
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"math/rand"
+	"sort"
 	"time"
 
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kunstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
 	"github.com/crossplane/crossplane-runtime/pkg/event"
 	"github.com/crossplane/crossplane-runtime/pkg/meta"
 	"github.com/crossplane/crossplane-runtime/pkg/reconciler/managed"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composite"
 
 	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
 	"github.com/crossplane/crossplane/pkg/controller/apiextensions/composite/composed"
@@ -38,6 +49,7 @@ import (
 // Error strings.
 const (
 	errApplySecret = "cannot apply connection secret"
+	errGetSecret   = "cannot get connection secret"
 
 	errNoCompatibleComposition  = "no compatible composition has been found"
 	errListCompositions         = "cannot list compositions"
@@ -51,6 +63,11 @@ const (
 	reasonCompositionSelection event.Reason = "CompositionSelection"
 )
 
+// AnnotationKeyConnectionDetailsHash is the key of the annotation used to
+// record the hash of the connection details that were last published to a
+// connection secret.
+const AnnotationKeyConnectionDetailsHash = "crossplane.io/connection-details-hash"
+
 // APIFilteredSecretPublisher publishes ConnectionDetails content after filtering
 // it through a set of permitted keys.
 type APIFilteredSecretPublisher struct {
@@ -67,21 +84,31 @@ func NewAPIFilteredSecretPublisher(c client.Client, filter []string) *APIFiltere
 // PublishConnection publishes the supplied ConnectionDetails to the Secret
 // referenced in the resource.
 func (a *APIFilteredSecretPublisher) PublishConnection(ctx context.Context, o resource.ConnectionSecretOwner, c managed.ConnectionDetails) error {
+	return a.PublishAnnotatedConnection(ctx, o, c, nil)
+}
+
+// PublishAnnotatedConnection publishes the supplied ConnectionDetails to the
+// Secret referenced in the resource, annotated with the supplied annotations.
+func (a *APIFilteredSecretPublisher) PublishAnnotatedConnection(ctx context.Context, o resource.ConnectionSecretOwner, c managed.ConnectionDetails, annotations map[string]string) error {
+	return a.PublishConnectionWithMetadata(ctx, o, c, v1alpha1.ConnectionSecretMetadata{Annotations: annotations})
+}
+
+// PublishConnectionWithMetadata publishes the supplied ConnectionDetails to
+// the Secret referenced in the resource, with the supplied labels and
+// annotations.
+func (a *APIFilteredSecretPublisher) PublishConnectionWithMetadata(ctx context.Context, o resource.ConnectionSecretOwner, c managed.ConnectionDetails, md v1alpha1.ConnectionSecretMetadata) error {
 	// This resource does not want to expose a connection secret.
 	if o.GetWriteConnectionSecretToReference() == nil {
 		return nil
 	}
 
 	s := resource.ConnectionSecretFor(o, o.GetObjectKind().GroupVersionKind())
-	m := map[string]bool{}
-	// TODO(muvaf): Should empty filter allow all keys?
-	for _, key := range a.filter {
-		m[key] = true
+	s.Data = filterConnectionDetails(a.filter, c)
+	if len(md.Labels) > 0 {
+		meta.AddLabels(s, md.Labels)
 	}
-	for key, val := range c {
-		if _, ok := m[key]; ok {
-			s.Data[key] = val
-		}
+	if len(md.Annotations) > 0 {
+		meta.AddAnnotations(s, md.Annotations)
 	}
 
 	return errors.Wrap(a.client.Apply(ctx, s, resource.ConnectionSecretMustBeControllableBy(o.GetUID())), errApplySecret)
@@ -94,6 +121,189 @@ func (a *APIFilteredSecretPublisher) UnpublishConnection(_ context.Context, _ re
 	return nil
 }
 
+// An APIHashingSecretPublisher publishes ConnectionDetails content after
+// filtering it through a set of permitted keys. It records a hash of the
+// published content on the connection secret, and only applies the secret
+// when the live secret does not match the content, for example because the
+// connection secret of a composed resource was rotated, or because the live
+// secret was edited or deleted.
+type APIHashingSecretPublisher struct {
+	client resource.ClientApplicator
+	filter []string
+}
+
+// NewAPIHashingSecretPublisher returns a ConnectionPublisher that only
+// publishes connection secret keys that are included in the supplied filter,
+// and only when the live connection secret does not match them.
+func NewAPIHashingSecretPublisher(c client.Client, filter []string) *APIHashingSecretPublisher {
+	return &APIHashingSecretPublisher{
+		client: resource.ClientApplicator{Client: c, Applicator: resource.NewAPIPatchingApplicator(c)},
+		filter: filter,
+	}
+}
+
+// PublishConnection publishes the supplied ConnectionDetails to the Secret
+// referenced in the resource if the live Secret does not match them.
+func (a *APIHashingSecretPublisher) PublishConnection(ctx context.Context, o resource.ConnectionSecretOwner, c managed.ConnectionDetails) error {
+	return a.PublishConnectionWithMetadata(ctx, o, c, v1alpha1.ConnectionSecretMetadata{})
+}
+
+// PublishAnnotatedConnection publishes the supplied ConnectionDetails to the
+// Secret referenced in the resource, annotated with the supplied annotations,
+// if the live Secret does not match them.
+func (a *APIHashingSecretPublisher) PublishAnnotatedConnection(ctx context.Context, o resource.ConnectionSecretOwner, c managed.ConnectionDetails, annotations map[string]string) error {
+	return a.PublishConnectionWithMetadata(ctx, o, c, v1alpha1.ConnectionSecretMetadata{Annotations: annotations})
+}
+
+// PublishConnectionWithMetadata publishes the supplied ConnectionDetails to
+// the Secret referenced in the resource, with the supplied labels and
+// annotations, if the live Secret does not match them.
+func (a *APIHashingSecretPublisher) PublishConnectionWithMetadata(ctx context.Context, o resource.ConnectionSecretOwner, c managed.ConnectionDetails, md v1alpha1.ConnectionSecretMetadata) error {
+	// This resource does not want to expose a connection secret.
+	ref := o.GetWriteConnectionSecretToReference()
+	if ref == nil {
+		return nil
+	}
+
+	s := resource.ConnectionSecretFor(o, o.GetObjectKind().GroupVersionKind())
+	s.Data = filterConnectionDetails(a.filter, c)
+	if len(md.Labels) > 0 {
+		meta.AddLabels(s, md.Labels)
+	}
+	meta.AddAnnotations(s, md.Annotations)
+	meta.AddAnnotations(s, map[string]string{AnnotationKeyConnectionDetailsHash: HashConnectionDetails(s.Data)})
+
+	current := &corev1.Secret{}
+	err := a.client.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, current)
+	if resource.IgnoreNotFound(err) != nil {
+		return errors.Wrap(err, errGetSecret)
+	}
+	if err == nil && published(o, current, s) {
+		return nil
+	}
+
+	return errors.Wrap(a.client.Apply(ctx, s, resource.ConnectionSecretMustBeControllableBy(o.GetUID())), errApplySecret)
+}
+
+// UnpublishConnection is no-op since PublishConnection only creates resources
+// that will be garbage collected by Kubernetes when the managed resource is
+// deleted.
+func (a *APIHashingSecretPublisher) UnpublishConnection(_ context.Context, _ resource.ConnectionSecretOwner, _ managed.ConnectionDetails) error {
+	return nil
+}
+
+// published returns true if the supplied live connection secret is controlled
+// by the supplied owner, and its hash annotation and the keys, labels and
+// annotations of the supplied desired connection secret all match. The live
+// secret is compared key by key, because publishing is additive and it may
+// have keys that are no longer published.
+func published(o resource.ConnectionSecretOwner, live, desired *corev1.Secret) bool {
+	if c := metav1.GetControllerOf(live); c == nil || c.UID != o.GetUID() {
+		return false
+	}
+	hash := desired.GetAnnotations()[AnnotationKeyConnectionDetailsHash]
+	if live.GetAnnotations()[AnnotationKeyConnectionDetailsHash] != hash {
+		return false
+	}
+	data := make(managed.ConnectionDetails, len(desired.Data))
+	for k := range desired.Data {
+		if v, ok := live.Data[k]; ok {
+			data[k] = v
+		}
+	}
+	if HashConnectionDetails(data) != hash {
+		return false
+	}
+	return subset(desired.GetLabels(), live.GetLabels()) && subset(desired.GetAnnotations(), live.GetAnnotations())
+}
+
+// subset returns true if every key of a has the same value in b.
+func subset(a, b map[string]string) bool {
+	for k, v := range a {
+		if got, ok := b[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// EnqueueRequestsForConnectionSecret returns an EventHandler that enqueues a
+// request for each composite resource of the supplied kind that composes the
+// resource that controls a secret, for example the connection secret of a
+// composed resource. This allows rotated connection secrets to be published
+// promptly. Composite resources are listed using the supplied reader, which
+// should be backed by a cache.
+func EnqueueRequestsForConnectionSecret(c client.Reader, of resource.CompositeKind) handler.EventHandler {
+	return &handler.EnqueueRequestsFromMapFunc{ToRequests: &connectionSecretMapper{client: c, of: of}}
+}
+
+type connectionSecretMapper struct {
+	client client.Reader
+	of     resource.CompositeKind
+}
+
+// Map the supplied secret to the composite resources that compose the
+// resource that controls it.
+func (m *connectionSecretMapper) Map(o handler.MapObject) []reconcile.Request {
+	ref := metav1.GetControllerOf(o.Meta)
+	if ref == nil {
+		return nil
+	}
+
+	gvk := schema.GroupVersionKind(m.of)
+	l := &kunstructured.UnstructuredList{}
+	l.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	if err := m.client.List(context.Background(), l); err != nil {
+		return nil
+	}
+
+	reqs := []reconcile.Request{}
+	for i := range l.Items {
+		cp := composite.Unstructured{Unstructured: l.Items[i]}
+		for _, r := range cp.GetResourceReferences() {
+			if r.APIVersion == ref.APIVersion && r.Kind == ref.Kind && r.Name == ref.Name {
+				reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: cp.GetNamespace(), Name: cp.GetName()}})
+				break
+			}
+		}
+	}
+	return reqs
+}
+
+// HashConnectionDetails returns a hash of the supplied ConnectionDetails that
+// does not depend on the order in which they were added.
+func HashConnectionDetails(c managed.ConnectionDetails) string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		// Keys and values are prefixed with their length so that different
+		// sets of connection details can't produce the same input.
+		_, _ = fmt.Fprintf(h, "%d:%s%d:", len(k), k, len(c[k]))
+		_, _ = h.Write(c[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func filterConnectionDetails(filter []string, c managed.ConnectionDetails) map[string][]byte {
+	m := map[string]bool{}
+	// TODO(muvaf): Should empty filter allow all keys?
+	for _, key := range filter {
+		m[key] = true
+	}
+	data := map[string][]byte{}
+	for key, val := range c {
+		if _, ok := m[key]; ok {
+			data[key] = val
+		}
+	}
+	return data
+}
+
 // NewCompositionSelectorChain returns a new CompositionSelectorChain.
 func NewCompositionSelectorChain(list ...CompositionSelector) *CompositionSelectorChain {
 	return &CompositionSelectorChain{list: list}
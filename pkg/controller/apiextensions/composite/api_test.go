@@ -20,19 +20,26 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kunstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
 	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
 	"github.com/crossplane/crossplane-runtime/pkg/reconciler/managed"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
 	"github.com/crossplane/crossplane-runtime/pkg/resource/fake"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composite"
 	"github.com/crossplane/crossplane-runtime/pkg/test"
 
 	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
@@ -52,10 +59,12 @@ func TestPublishConnection(t *testing.T) {
 	}
 
 	type args struct {
-		applicator resource.Applicator
-		o          resource.ConnectionSecretOwner
-		filter     []string
-		c          managed.ConnectionDetails
+		applicator  resource.Applicator
+		o           resource.ConnectionSecretOwner
+		filter      []string
+		c           managed.ConnectionDetails
+		annotations map[string]string
+		md          *v1alpha1.ConnectionSecretMetadata
 	}
 
 	cases := map[string]struct {
@@ -93,19 +102,265 @@ func TestPublishConnection(t *testing.T) {
 				filter: []string{"onlyme"},
 			},
 		},
+		"SuccessWithAnnotations": {
+			reason: "Annotations propagated from composed resources should be added to the connection secret",
+			args: args{
+				applicator: resource.ApplyFn(func(_ context.Context, o runtime.Object, _ ...resource.ApplyOption) error {
+					want := resource.ConnectionSecretFor(owner, owner.GetObjectKind().GroupVersionKind())
+					want.Data = managed.ConnectionDetails{"onlyme": {41}}
+					want.SetAnnotations(map[string]string{"example.org/encrypted": "true"})
+					if diff := cmp.Diff(want, o); diff != "" {
+						t.Errorf("-want, +got:\n%s", diff)
+					}
+					return nil
+				}),
+				o:           owner,
+				c:           managed.ConnectionDetails{"cool": {42}, "onlyme": {41}},
+				filter:      []string{"onlyme"},
+				annotations: map[string]string{"example.org/encrypted": "true"},
+			},
+		},
+		"SuccessWithMetadata": {
+			reason: "Labels and annotations specified by the composition should be added to the connection secret",
+			args: args{
+				applicator: resource.ApplyFn(func(_ context.Context, o runtime.Object, _ ...resource.ApplyOption) error {
+					want := resource.ConnectionSecretFor(owner, owner.GetObjectKind().GroupVersionKind())
+					want.Data = managed.ConnectionDetails{"onlyme": {41}}
+					want.SetLabels(map[string]string{"example.org/composite": "cool"})
+					want.SetAnnotations(map[string]string{"example.org/owner": "platform"})
+					if diff := cmp.Diff(want, o); diff != "" {
+						t.Errorf("-want, +got:\n%s", diff)
+					}
+					return nil
+				}),
+				o:      owner,
+				c:      managed.ConnectionDetails{"cool": {42}, "onlyme": {41}},
+				filter: []string{"onlyme"},
+				md: &v1alpha1.ConnectionSecretMetadata{
+					Labels:      map[string]string{"example.org/composite": "cool"},
+					Annotations: map[string]string{"example.org/owner": "platform"},
+				},
+			},
+		},
 	}
 
 	for name, tc := range cases {
 		t.Run(name, func(t *testing.T) {
 			a := &APIFilteredSecretPublisher{tc.args.applicator, tc.args.filter}
+			var got error
+			switch {
+			case tc.args.md != nil:
+				got = a.PublishConnectionWithMetadata(context.Background(), tc.args.o, tc.args.c, *tc.args.md)
+			case tc.args.annotations != nil:
+				got = a.PublishAnnotatedConnection(context.Background(), tc.args.o, tc.args.c, tc.args.annotations)
+			default:
+				got = a.PublishConnection(context.Background(), tc.args.o, tc.args.c)
+			}
+			if diff := cmp.Diff(tc.err, got, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nPublish(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestHashingPublishConnection(t *testing.T) {
+	owner := &fake.MockConnectionSecretOwner{
+		Ref: &runtimev1alpha1.SecretReference{
+			Namespace: "coolnamespace",
+			Name:      "coolsecret",
+		},
+	}
+	owner.SetUID("cool-uid")
+	published := managed.ConnectionDetails{"onlyme": {41}}
+	live := func(data managed.ConnectionDetails, hash string) test.ObjectFn {
+		return func(o runtime.Object) error {
+			s := resource.ConnectionSecretFor(owner, owner.GetObjectKind().GroupVersionKind())
+			s.Data = data
+			s.SetAnnotations(map[string]string{AnnotationKeyConnectionDetailsHash: hash})
+			s.DeepCopyInto(o.(*corev1.Secret))
+			return nil
+		}
+	}
+	mustNotApply := resource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...resource.ApplyOption) error {
+		t.Errorf("unchanged connection secret should not be applied")
+		return nil
+	})
+	applied := false
+	mustApply := resource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...resource.ApplyOption) error {
+		applied = true
+		return nil
+	})
+
+	type args struct {
+		client resource.ClientApplicator
+		o      resource.ConnectionSecretOwner
+		filter []string
+		c      managed.ConnectionDetails
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		apply  bool
+		err    error
+	}{
+		"ResourceDoesNotPublishSecret": {
+			reason: "A managed resource with a nil GetWriteConnectionSecretToReference should not publish a secret",
+			args: args{
+				o: &fake.MockConnectionSecretOwner{},
+			},
+		},
+		"GetError": {
+			reason: "An error getting the current connection secret should be returned",
+			args: args{
+				client: resource.ClientApplicator{Client: &test.MockClient{MockGet: test.NewMockGetFn(errBoom)}},
+				o:      owner,
+			},
+			err: errors.Wrap(errBoom, errGetSecret),
+		},
+		"Unchanged": {
+			reason: "The connection secret should not be applied if the live secret matches its content",
+			args: args{
+				client: resource.ClientApplicator{
+					Client:     &test.MockClient{MockGet: test.NewMockGetFn(nil, live(managed.ConnectionDetails{"onlyme": {41}, "old": {40}}, HashConnectionDetails(published)))},
+					Applicator: mustNotApply,
+				},
+				o:      owner,
+				c:      managed.ConnectionDetails{"cool": {42}, "onlyme": {41}},
+				filter: []string{"onlyme"},
+			},
+		},
+		"Edited": {
+			reason: "The connection secret should be applied if the live secret was edited, even though its hash annotation matches",
+			args: args{
+				client: resource.ClientApplicator{
+					Client:     &test.MockClient{MockGet: test.NewMockGetFn(nil, live(managed.ConnectionDetails{"onlyme": {0}}, HashConnectionDetails(published)))},
+					Applicator: mustApply,
+				},
+				o:      owner,
+				c:      published,
+				filter: []string{"onlyme"},
+			},
+			apply: true,
+		},
+		"Rotated": {
+			reason: "The connection secret should be applied with the new hash if its content has changed",
+			args: args{
+				client: resource.ClientApplicator{
+					Client: &test.MockClient{MockGet: test.NewMockGetFn(nil, live(published, HashConnectionDetails(published)))},
+					Applicator: resource.ApplyFn(func(_ context.Context, o runtime.Object, _ ...resource.ApplyOption) error {
+						rotated := managed.ConnectionDetails{"onlyme": {43}}
+						want := resource.ConnectionSecretFor(owner, owner.GetObjectKind().GroupVersionKind())
+						want.Data = rotated
+						want.SetAnnotations(map[string]string{AnnotationKeyConnectionDetailsHash: HashConnectionDetails(rotated)})
+						if diff := cmp.Diff(want, o); diff != "" {
+							t.Errorf("-want, +got:\n%s", diff)
+						}
+						return nil
+					}),
+				},
+				o:      owner,
+				c:      managed.ConnectionDetails{"cool": {42}, "onlyme": {43}},
+				filter: []string{"onlyme"},
+			},
+		},
+		"NotYetPublished": {
+			reason: "The connection secret should be applied if it does not yet exist",
+			args: args{
+				client: resource.ClientApplicator{
+					Client:     &test.MockClient{MockGet: test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, ""))},
+					Applicator: resource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...resource.ApplyOption) error { return errBoom }),
+				},
+				o: owner,
+				c: published,
+			},
+			err: errors.Wrap(errBoom, errApplySecret),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			applied = false
+			a := &APIHashingSecretPublisher{client: tc.args.client, filter: tc.args.filter}
 			got := a.PublishConnection(context.Background(), tc.args.o, tc.args.c)
 			if diff := cmp.Diff(tc.err, got, test.EquateErrors()); diff != "" {
 				t.Errorf("\n%s\nPublish(...): -want, +got:\n%s", tc.reason, diff)
 			}
+			if tc.apply && !applied {
+				t.Errorf("\n%s\nPublish(...): connection secret was not applied", tc.reason)
+			}
+		})
+	}
+}
+
+func TestConnectionSecretMapper(t *testing.T) {
+	of := resource.CompositeKind{Group: "example.org", Version: "v1", Kind: "XDatabase"}
+	controlled := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "conn"}}
+	meta.AddOwnerReference(controlled, meta.AsController(&runtimev1alpha1.TypedReference{APIVersion: "db.example.org/v1", Kind: "Instance", Name: "cool-db"}))
+	withRefs := func(name string, refs ...corev1.ObjectReference) kunstructured.Unstructured {
+		cp := composite.New()
+		cp.SetName(name)
+		cp.SetResourceReferences(refs)
+		return cp.Unstructured
+	}
+	list := func(cps ...kunstructured.Unstructured) test.MockListFn {
+		return func(_ context.Context, obj runtime.Object, _ ...client.ListOption) error {
+			if diff := cmp.Diff("XDatabaseList", obj.GetObjectKind().GroupVersionKind().Kind); diff != "" {
+				t.Errorf("List(...): -want, +got:\n%s", diff)
+			}
+			obj.(*kunstructured.UnstructuredList).Items = cps
+			return nil
+		}
+	}
+
+	cases := map[string]struct {
+		reason string
+		client client.Reader
+		s      *corev1.Secret
+		want   []reconcile.Request
+	}{
+		"Uncontrolled": {
+			reason: "A secret without a controller should not be mapped to any composite resource",
+			s:      &corev1.Secret{},
+		},
+		"ListError": {
+			reason: "A secret should not be mapped to any composite resource if they can't be listed",
+			client: &test.MockClient{MockList: test.NewMockListFn(errBoom)},
+			s:      controlled,
+		},
+		"Composed": {
+			reason: "A secret should be mapped to the composite resources that compose its controller",
+			client: &test.MockClient{MockList: list(
+				withRefs("cool-xr", corev1.ObjectReference{APIVersion: "db.example.org/v1", Kind: "Instance", Name: "cool-db"}),
+				withRefs("other-xr", corev1.ObjectReference{APIVersion: "db.example.org/v1", Kind: "Instance", Name: "other-db"}),
+			)},
+			s:    controlled,
+			want: []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "cool-xr"}}},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			m := &connectionSecretMapper{client: tc.client, of: of}
+			got := m.Map(handler.MapObject{Meta: tc.s, Object: tc.s})
+			if diff := cmp.Diff(tc.want, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("\n%s\nMap(...): -want, +got:\n%s", tc.reason, diff)
+			}
 		})
 	}
 }
 
+func TestHashConnectionDetails(t *testing.T) {
+	a := HashConnectionDetails(managed.ConnectionDetails{"a": []byte("b"), "c": []byte("d")})
+	b := HashConnectionDetails(managed.ConnectionDetails{"c": []byte("d"), "a": []byte("b")})
+	if a != b {
+		t.Errorf("HashConnectionDetails(...): hash should not depend on key order")
+	}
+	c := HashConnectionDetails(managed.ConnectionDetails{"a": []byte("bc"), "": []byte("d")})
+	if a == c {
+		t.Errorf("HashConnectionDetails(...): different connection details should have different hashes")
+	}
+}
+
 func TestConfigure(t *testing.T) {
 	cs := fake.ConnectionSecretWriterTo{Ref: &runtimev1alpha1.SecretReference{
 		Name:      "foo",
@@ -18,16 +18,36 @@ package composed
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
 
+	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	kresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/cache"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
 	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	"github.com/crossplane/crossplane-runtime/pkg/meta"
 	"github.com/crossplane/crossplane-runtime/pkg/reconciler/managed"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
@@ -37,10 +57,59 @@ import (
 )
 
 const (
-	errUnmarshal  = "cannot unmarshal base template"
-	errFmtPatch   = "cannot apply the patch at index %d"
-	errGetSecret  = "cannot get connection secret of composed resource"
-	errNamePrefix = "name prefix is not found in labels"
+	errUnmarshal      = "cannot unmarshal base template"
+	errMarshal        = "cannot marshal composed resource"
+	errMergeBase      = "cannot merge base template into composed resource"
+	errPreserveStatus = "cannot preserve status of composed resource"
+	errMarshalCP      = "cannot marshal composite resource"
+	errFmtPatch       = "cannot apply the patch at index %d"
+	errGetSecret      = "cannot get connection secret of composed resource"
+	errGetConfigMap   = "cannot get connection ConfigMap of composed resource"
+	errListEvents     = "cannot list events of composed resource"
+	errIndexedUnnamed = "cannot name instances of a template by index unless it is named or overrides its name prefix"
+
+	errReadinessGate       = "cannot determine whether composed resource is ready to publish connection details"
+	errFmtRenderKey        = "cannot render connection secret key %q"
+	errFmtDecodeBase64     = "cannot base64 decode connection secret key %q"
+	errFmtEscape           = "cannot escape connection secret key %q"
+	errFmtTransform        = "cannot transform connection secret key %q"
+	errFmtLabelTags        = "cannot set tags at %s from composite resource labels"
+	errFmtMatchStrings     = "readiness check at index %d: cannot get match strings from composite resource"
+	errFmtWebhookCheck     = "readiness check at index %d: webhook readiness check failed"
+	errFmtCompileRegex     = "readiness check at index %d: cannot compile regular expression %q"
+	errFmtNoMatchCondition = "readiness check at index %d: a condition to match is required"
+	errFmtCompareInteger   = "readiness check at index %d: cannot compare the value of field %q to %d"
+	errFmtNoGroup          = "readiness check at index %d: a group of checks is required"
+	errFmtMatchFloat       = "readiness check at index %d: cannot match the value of field %q to %g"
+	errFmtParseQuantity    = "cannot parse value at %s as a quantity"
+	errFmtNotQuantity      = "%s: not a quantity"
+	errFmtNotNumber        = "%s: not a number"
+	errFmtNotInteger       = "value of field %q is a %s, not an integer"
+	errFmtQuotedInteger    = "value of field %q is a string, not an integer; set asQuantity to parse it"
+	errFmtNotCollection    = "value of field %q is a %s, not an array or object"
+	errFmtExpandWildcards  = "cannot expand wildcards of field path %q"
+
+	errFmtInvalidSecretName       = "invalid connection secret name %q at path %s: %s"
+	errFmtInvalidSecretNamespace  = "invalid connection secret namespace %q at path %s: %s"
+	errFmtInvalidImpliedNamespace = "invalid implied connection secret namespace %q: %s"
+	errFmtSecretRefNotScalar      = "connection secret reference at path %s is a %s, not a string, number, or boolean"
+	errFmtSelectConnection        = "cannot select connection details from composite resource field path %s"
+	errFmtInvalidConnectionKey    = "invalid connection secret key %q: %s"
+	errFmtConnectionFieldPath     = "cannot derive connection detail from field path %s"
+	errFmtConnectionCompositePath = "cannot derive connection detail from composite resource field path %s"
+	errFmtConnectionValue         = "connection detail must be a string, number, or boolean, not %T"
+
+	errParseSpecTemplate   = "cannot parse spec template"
+	errExecuteSpecTemplate = "cannot execute spec template"
+	errSpecTemplateObject  = "spec template must render a JSON object"
+	errMergeSpecTemplate   = "cannot merge rendered spec template into composed resource"
+
+	errSortPatches                = "cannot determine the order in which to apply patches"
+	errPatchCycle                 = "patches depend on each other in a cycle"
+	errFmtDuplicatePatch          = "more than one patch is named %q"
+	errFmtUnknownPatch            = "the patch at index %d must be applied after unknown patch %q"
+	errFmtNoSibling               = "cannot read from composed resource %q, whose template must be named and listed before this one"
+	errFmtToCompositeFromComposed = "a patch of type ToCompositeFieldPath cannot read from composed resource %q"
 )
 
 // Label keys.
@@ -50,6 +119,70 @@ const (
 	LabelKeyClaimNamespace        = "crossplane.io/claim-namespace"
 )
 
+// AnnotationKeyForceRecreate is the key of an annotation that triggers
+// composed resources to be reconciled again when its value changes, similar
+// to restarting a Deployment. When set on a composite resource its value is
+// stamped onto all of its composed resources, taking precedence over any value
+// set by the base template.
+const AnnotationKeyForceRecreate = "crossplane.io/force-recreate"
+
+// AnnotationKeyCompositionRevision is the key of the annotation in which the
+// composition revision of a composite resource is recorded. Composed resources
+// may carry the same annotation to indicate the revision they were last
+// updated to.
+const AnnotationKeyCompositionRevision = "crossplane.io/composition-revision"
+
+// AnnotationKeyCompositionResourceName is the key of the annotation in which
+// the name of the template a composed resource was composed from is recorded.
+// Only composed resources whose template is named carry it.
+const AnnotationKeyCompositionResourceName = "crossplane.io/composition-resource-name"
+
+// ErrMissingNamePrefix indicates that a composite resource does not yet have
+// the label that determines the name prefix of its composed resources. The
+// label is set when the composite resource is first reconciled, so callers
+// should typically requeue rather than report an error. A *MissingLabelError
+// for that label matches it when tested using errors.Is.
+var ErrMissingNamePrefix = errors.New("name prefix is not found in labels")
+
+// A MissingLabelError is returned when a composite resource is missing a label
+// that is required in order to compose resources.
+type MissingLabelError struct {
+	// Composite is the name of the composite resource.
+	Composite string
+
+	// Key of the missing label.
+	Key string
+}
+
+// Error returns a description of the missing label.
+func (e *MissingLabelError) Error() string {
+	return fmt.Sprintf("composite resource %q is missing the required label %q, which should be set to the prefix used to name its composed resources", e.Composite, e.Key)
+}
+
+// Is returns true if the target is ErrMissingNamePrefix and the missing label
+// is the one that determines the name prefix of composed resources.
+func (e *MissingLabelError) Is(target error) bool {
+	return target == ErrMissingNamePrefix && e.Key == LabelKeyNamePrefixForComposed
+}
+
+// IsMissingLabel returns true if the supplied error is, or wraps, a
+// *MissingLabelError.
+func IsMissingLabel(err error) bool {
+	var e *MissingLabelError
+	return errors.As(err, &e)
+}
+
+// ValidateNamePrefix returns a *MissingLabelError if the supplied composite
+// resource does not have the label that determines the name prefix of its
+// composed resources. It allows the problem to be surfaced before any
+// composed resource is configured.
+func ValidateNamePrefix(cp resource.Composite) error {
+	if cp.GetLabels()[LabelKeyNamePrefixForComposed] != "" {
+		return nil
+	}
+	return &MissingLabelError{Composite: cp.GetName(), Key: LabelKeyNamePrefixForComposed}
+}
+
 // ConfigureFn is a function that implements Configurator interface.
 type ConfigureFn func(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error
 
@@ -58,199 +191,2480 @@ func (c ConfigureFn) Configure(cp resource.Composite, cd resource.Composed, t v1
 	return c(cp, cd, t)
 }
 
+// A BaseMergeMode determines how the base template of a composed resource is
+// combined with its existing content.
+type BaseMergeMode = v1alpha1.BaseMergeMode
+
+// Base merge modes.
+const (
+	// BaseMergeModeReplace replaces the existing content of the composed
+	// resource with the base template.
+	BaseMergeModeReplace = v1alpha1.BaseMergeModeReplace
+
+	// BaseMergeModeMerge merges the base template into the existing content of
+	// the composed resource using JSON merge patch semantics, so that fields
+	// that are not specified by the base template are left untouched.
+	BaseMergeModeMerge = v1alpha1.BaseMergeModeMerge
+)
+
+// mergeBase returns true if the base of the supplied template should be merged
+// into the existing composed resource rather than replace it.
+func mergeBase(t v1alpha1.ComposedTemplate) bool {
+	return t.BaseMergeMode != nil && *t.BaseMergeMode == BaseMergeModeMerge
+}
+
+// A ConfiguratorOption configures a DefaultConfigurator.
+type ConfiguratorOption func(*DefaultConfigurator)
+
+// WithLabelTags configures a DefaultConfigurator to copy the labels of the
+// composite resource into the string map at the supplied field path of each
+// composed resource, for example "spec.forProvider.tags", so that the external
+// resources are tagged with the claim, team, environment etc. Only the labels
+// with the supplied keys are copied, or all labels if no keys are supplied.
+// Tags that are already present, for example because they are specified by
+// the base template, take precedence over labels with the same key.
+func WithLabelTags(path string, keys ...string) ConfiguratorOption {
+	return func(c *DefaultConfigurator) {
+		c.tagsPath = path
+		c.tagKeys = keys
+	}
+}
+
+// WithConfiguratorLogger configures a DefaultConfigurator to log each step
+// of configuring a composed resource at debug level.
+func WithConfiguratorLogger(l logging.Logger) ConfiguratorOption {
+	return func(c *DefaultConfigurator) {
+		c.log = l
+	}
+}
+
+// NewDefaultConfigurator returns a DefaultConfigurator.
+func NewDefaultConfigurator(o ...ConfiguratorOption) *DefaultConfigurator {
+	c := &DefaultConfigurator{}
+	for _, fn := range o {
+		fn(c)
+	}
+	return c
+}
+
 // DefaultConfigurator configures the composed resource with given raw template
-// and metadata information from composite resource.
-type DefaultConfigurator struct{}
+// and metadata information from composite resource. The base template replaces
+// the existing composed resource unless the template specifies otherwise.
+type DefaultConfigurator struct {
+	tagsPath string
+	tagKeys  []string
+	schemas  SchemaFetcher
+	record   event.Recorder
+	names    NameGenerator
+	log      logging.Logger
+
+	maxNameLength int
+}
+
+// Configure applies the raw template and sets name and generateName. The
+// finalizers and status of an existing composed resource are preserved.
+func (c *DefaultConfigurator) Configure(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error {
+	return c.configure(context.Background(), cp, cd, t, 0)
+}
+
+// ConfigureWithContext configures the composed resource like Configure, using
+// the supplied context to fetch anything the configuration depends on, such
+// as the schema of the composed resource.
+func (c *DefaultConfigurator) ConfigureWithContext(ctx context.Context, cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error {
+	return c.configure(ctx, cp, cd, t, 0)
+}
 
-// Configure applies the raw template and sets name and generateName.
-func (*DefaultConfigurator) Configure(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error {
+// configure configures the composed resource like Configure, reserving the
+// supplied number of characters for a suffix that will be appended to any
+// name set by the NameGenerator.
+func (c *DefaultConfigurator) configure(ctx context.Context, cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate, reserved int) error {
 	// Any existing name will be overwritten when we unmarshal the template. We
 	// store it here so that we can reset it after unmarshalling.
 	name := cd.GetName()
 	namespace := cd.GetNamespace()
-	// PD -  support for namespaced objects - use the claim namespace
+
+	// Other controllers may rely on the finalizers of an existing composed
+	// resource, and its status is owned by its own controller, so we restore
+	// both after unmarshalling. Finalizers specified by the template are kept.
+	finalizers := cd.GetFinalizers()
+	externalName := meta.GetExternalName(cd)
+	status, err := getStatus(cd)
+	if err != nil {
+		return err
+	}
+	if err := c.base(cd, t); err != nil {
+		return err
+	}
+	for _, f := range finalizers {
+		meta.AddFinalizer(cd, f)
+	}
+	if err := setStatus(cd, status); err != nil {
+		return err
+	}
+	log := orNop(c.log).WithValues(
+		"kind", cd.GetObjectKind().GroupVersionKind().String(),
+		"template", templateName(t),
+		"prefix", namePrefix(cp, t),
+	)
+	log.Debug("Applied base template to composed resource")
+	// PD -  support for namespaced objects - use the namespace of the base
+	// template if it specifies one, otherwise the claim namespace.
+	if namespace == "" {
+		namespace = cd.GetNamespace()
+	}
 	if namespace == "" {
 		namespace = cp.GetLabels()[LabelKeyClaimNamespace]
 	}
-	if err := json.Unmarshal(t.Base.Raw, cd); err != nil {
-		return errors.Wrap(err, errUnmarshal)
+	if err := c.spec(cp, cd, t); err != nil {
+		return err
+	}
+	if err := c.prune(ctx, cp, cd); err != nil {
+		return err
 	}
-	if cp.GetLabels()[LabelKeyNamePrefixForComposed] == "" {
-		return errors.New(errNamePrefix)
+	if err := ValidateNamePrefix(cp); err != nil {
+		return err
 	}
 	// This label will be used if composed resource is yet another composite.
-	meta.AddLabels(cd, map[string]string{
-		LabelKeyNamePrefixForComposed: cp.GetLabels()[LabelKeyNamePrefixForComposed],
-		LabelKeyClaimName:             cp.GetLabels()[LabelKeyClaimName],
-		LabelKeyClaimNamespace:        cp.GetLabels()[LabelKeyClaimNamespace],
-	})
+	if t.PropagateCompositionLabels == nil || *t.PropagateCompositionLabels {
+		meta.AddLabels(cd, map[string]string{
+			LabelKeyNamePrefixForComposed: cp.GetLabels()[LabelKeyNamePrefixForComposed],
+			LabelKeyClaimName:             cp.GetLabels()[LabelKeyClaimName],
+			LabelKeyClaimNamespace:        cp.GetLabels()[LabelKeyClaimNamespace],
+		})
+	}
+	propagateLabels(cp, cd, t.PropagateLabels)
+	propagateAnnotations(cp, cd, t.PropagateAnnotations)
+	if t.PropagateExternalName != nil && *t.PropagateExternalName {
+		propagateExternalName(cp, cd, externalName)
+	}
+	if v, ok := cp.GetAnnotations()[AnnotationKeyForceRecreate]; ok {
+		meta.AddAnnotations(cd, map[string]string{AnnotationKeyForceRecreate: v})
+	}
+	if t.Name != nil {
+		meta.AddAnnotations(cd, map[string]string{AnnotationKeyCompositionResourceName: *t.Name})
+	}
+	if err := c.tags(cp, cd); err != nil {
+		return err
+	}
 	// Unmarshalling the template will overwrite any existing fields, so we must
-	// restore the existing name, if any. We also set generate name in case we
+	// restore the existing name, if any. We also generate a name in case we
 	// haven't yet named this composed resource.
-	cd.SetGenerateName(cp.GetLabels()[LabelKeyNamePrefixForComposed] + "-")
 	cd.SetName(name)
 	cd.SetNamespace(namespace)
+	n := c.names
+	if n == nil {
+		n = GeneratePrefixedName
+	}
+	if err := n.GenerateName(cp, cd, t); err != nil {
+		return err
+	}
+	if name == "" {
+		c.shortenNames(cd, reserved)
+	}
+	log.Debug("Configured composed resource", "name", cd.GetName(), "generate-name", cd.GetGenerateName())
 	return nil
 }
 
-// OverlayFn is a function that implements OverlayApplicator interface.
-type OverlayFn func(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error
-
-// Overlay calls OverlayFn.
-func (o OverlayFn) Overlay(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error {
-	return o(cp, cd, t)
+// getStatus returns a copy of the status of the supplied composed resource,
+// or nil if it has none.
+func getStatus(cd resource.Composed) (interface{}, error) {
+	if u, ok := cd.(interface{ UnstructuredContent() map[string]interface{} }); ok {
+		return runtime.DeepCopyJSONValue(u.UnstructuredContent()["status"]), nil
+	}
+	m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cd)
+	if err != nil {
+		return nil, errors.Wrap(err, errPreserveStatus)
+	}
+	return m["status"], nil
 }
 
-// DefaultOverlayApplicator applies patches to the composed resource using the
-// values on Composite resource and field bindings in ComposedTemplate.
-type DefaultOverlayApplicator struct{}
-
-// Overlay applies patches to composed resource.
-func (*DefaultOverlayApplicator) Overlay(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error {
-	for i, p := range t.Patches {
-		if err := p.Apply(cp, cd); err != nil {
-			return errors.Wrapf(err, errFmtPatch, i)
+// setStatus sets the status of the supplied composed resource, removing it if
+// the supplied status is nil. Unstructured composed resources are modified in
+// place, while typed composed resources are round-tripped through their
+// unstructured form.
+func setStatus(cd resource.Composed, status interface{}) error {
+	var content map[string]interface{}
+	u, unstructured := cd.(interface{ UnstructuredContent() map[string]interface{} })
+	if unstructured {
+		content = u.UnstructuredContent()
+	} else {
+		m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cd)
+		if err != nil {
+			return errors.Wrap(err, errPreserveStatus)
 		}
+		content = m
 	}
-	return nil
+	if reflect.DeepEqual(content["status"], status) {
+		return nil
+	}
+	delete(content, "status")
+	if status != nil {
+		content["status"] = status
+	}
+	if unstructured {
+		return nil
+	}
+	return errors.Wrap(runtime.DefaultUnstructuredConverter.FromUnstructured(content, cd), errPreserveStatus)
 }
 
-// FetchFn is a function that implements the ConnectionDetailsFetcher interface.
-type FetchFn func(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (managed.ConnectionDetails, error)
-
-// Fetch calls FetchFn.
-func (f FetchFn) Fetch(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (managed.ConnectionDetails, error) {
-	return f(ctx, cd, t)
+// templateName returns the name of the supplied template, or an empty string
+// if it is unnamed.
+func templateName(t v1alpha1.ComposedTemplate) string {
+	if t.Name == nil {
+		return ""
+	}
+	return *t.Name
 }
 
-// APIConnectionDetailsFetcher fetches the connection secret of given composed
-// resource if it has a connection secret reference.
-type APIConnectionDetailsFetcher struct {
-	client client.Client
+// orNop returns the supplied logger, or a logger that discards everything if
+// it is nil.
+func orNop(l logging.Logger) logging.Logger {
+	if l == nil {
+		return logging.NewNopLogger()
+	}
+	return l
 }
 
-// Fetch returns the connection secret details of composed resource.
-func (cdf *APIConnectionDetailsFetcher) Fetch(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (managed.ConnectionDetails, error) {
-	// PD -  support for custom connection secrets
-	sref, err := getWriteConnectionSecretToReference(cd, t)
-	if err != nil {
-		return nil, err
+// ConfigureIndexed configures the composed resource like Configure, but names
+// it deterministically using the name of its template and the supplied
+// instance index, for example "prefix-database-0", rather than generating a
+// name. This keeps the name of each instance of a template that is composed
+// many times stable across reconciles, regardless of how many instances of
+// other templates there are. Templates that override their name prefix are
+// named using it instead, for example "override-0". The index is appended to
+// names set by the NameGenerator, so that instances don't collide.
+func (c *DefaultConfigurator) ConfigureIndexed(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate, i int) error {
+	named := cd.GetName() != ""
+	suffix := fmt.Sprintf("-%d", i)
+	if err := c.configure(context.Background(), cp, cd, t, len(suffix)); err != nil {
+		return err
 	}
-	if sref == nil {
-		return nil, nil
+	if named {
+		return nil
+	}
+	prefix := cd.GetName()
+	if prefix == "" {
+		p, err := indexedNamePrefix(cp, t)
+		if err != nil {
+			return err
+		}
+		prefix = c.shortenName(p, len(suffix))
 	}
+	cd.SetName(prefix + suffix)
+	return nil
+}
 
-	conn := managed.ConnectionDetails{}
+// indexedNamePrefix returns the prefix of the names of the instances of the
+// supplied template. Instances of different templates must not share a prefix,
+// so the template must either be named or override its name prefix.
+func indexedNamePrefix(cp resource.Composite, t v1alpha1.ComposedTemplate) (string, error) {
+	if t.NamePrefixOverride != nil && *t.NamePrefixOverride != "" {
+		return *t.NamePrefixOverride, nil
+	}
+	if templateName(t) == "" {
+		return "", errors.New(errIndexedUnnamed)
+	}
+	return cp.GetLabels()[LabelKeyNamePrefixForComposed] + "-" + templateName(t), nil
+}
 
-	// It's possible that the composed resource does want to write a
-	// connection secret but has not yet. We presume this isn't an issue and
-	// that we'll propagate any connection details during a future
-	// iteration.
-	s := &corev1.Secret{}
-	nn := types.NamespacedName{Namespace: sref.Namespace, Name: sref.Name}
-	if err := cdf.client.Get(ctx, nn, s); client.IgnoreNotFound(err) != nil {
-		return nil, errors.Wrap(err, errGetSecret)
+func namePrefix(cp resource.Composite, t v1alpha1.ComposedTemplate) string {
+	if t.NamePrefixOverride != nil && *t.NamePrefixOverride != "" {
+		return *t.NamePrefixOverride
 	}
+	return cp.GetLabels()[LabelKeyNamePrefixForComposed]
+}
 
-	for _, d := range t.ConnectionDetails {
-		if d.Name != nil && d.Value != nil {
-			conn[*d.Name] = []byte(*d.Value)
-			continue
+// propagateLabels adds the labels of the supplied composite resource with the
+// supplied keys to the supplied composed resource. Keys the composite resource
+// has no label for are skipped.
+func propagateLabels(cp resource.Composite, cd resource.Composed, keys []string) {
+	add := make(map[string]string, len(keys))
+	for _, k := range keys {
+		if v, ok := cp.GetLabels()[k]; ok {
+			add[k] = v
 		}
+	}
+	meta.AddLabels(cd, add)
+}
 
-		if d.FromConnectionSecretKey == nil {
+// propagateAnnotations adds the annotations of the supplied composite resource
+// with the supplied keys to the supplied composed resource. Keys the composite
+// resource has no annotation for, or that the composed resource is already
+// annotated with by its base template, are skipped.
+func propagateAnnotations(cp resource.Composite, cd resource.Composed, keys []string) {
+	add := make(map[string]string, len(keys))
+	for _, k := range keys {
+		if _, set := cd.GetAnnotations()[k]; set {
 			continue
 		}
+		if v, ok := cp.GetAnnotations()[k]; ok {
+			add[k] = v
+		}
+	}
+	if len(add) > 0 {
+		meta.AddAnnotations(cd, add)
+	}
+}
 
-		if len(s.Data[*d.FromConnectionSecretKey]) == 0 {
-			continue
+// propagateExternalName sets the external name of the supplied composed
+// resource to that of the supplied composite resource. The external name the
+// composed resource had before it was configured takes precedence, followed by
+// any external name set by its base template.
+func propagateExternalName(cp resource.Composite, cd resource.Composed, existing string) {
+	name := existing
+	if name == "" {
+		name = meta.GetExternalName(cd)
+	}
+	if name == "" {
+		name = meta.GetExternalName(cp)
+	}
+	if name != "" {
+		meta.SetExternalName(cd, name)
+	}
+}
+
+// tags merges the configured labels of the supplied composite resource into
+// the tags of the supplied composed resource.
+func (c *DefaultConfigurator) tags(cp resource.Composite, cd resource.Composed) error {
+	if c.tagsPath == "" {
+		return nil
+	}
+	labels := cp.GetLabels()
+	add := make(map[string]string, len(labels))
+	for k, v := range labels {
+		if len(c.tagKeys) == 0 || contains(c.tagKeys, k) {
+			add[k] = v
 		}
+	}
+	if len(add) == 0 {
+		return nil
+	}
 
-		key := *d.FromConnectionSecretKey
-		if d.Name != nil {
-			key = *d.Name
+	// Unstructured composed resources are modified in place, while typed
+	// composed resources are round-tripped through their unstructured form.
+	var content map[string]interface{}
+	u, unstructured := cd.(interface{ UnstructuredContent() map[string]interface{} })
+	if unstructured {
+		content = u.UnstructuredContent()
+	} else {
+		m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cd)
+		if err != nil {
+			return errors.Wrapf(err, errFmtLabelTags, c.tagsPath)
 		}
+		content = m
+	}
+	paved := fieldpath.Pave(content)
+	tags, err := paved.GetStringObject(c.tagsPath)
+	if resource.Ignore(fieldpath.IsNotFound, err) != nil {
+		return errors.Wrapf(err, errFmtLabelTags, c.tagsPath)
+	}
+	merged := make(map[string]interface{}, len(add)+len(tags))
+	for k, v := range add {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	if err := paved.SetValue(c.tagsPath, merged); err != nil {
+		return errors.Wrapf(err, errFmtLabelTags, c.tagsPath)
+	}
+	if unstructured {
+		return nil
+	}
+	return errors.Wrapf(runtime.DefaultUnstructuredConverter.FromUnstructured(content, cd), errFmtLabelTags, c.tagsPath)
+}
 
-		conn[key] = s.Data[*d.FromConnectionSecretKey]
+// base combines the base template with the supplied composed resource using
+// the merge mode of the template.
+func (c *DefaultConfigurator) base(cd resource.Composed, t v1alpha1.ComposedTemplate) error {
+	if !mergeBase(t) {
+		return errors.Wrap(json.Unmarshal(t.Base.Raw, cd), errUnmarshal)
 	}
 
-	return conn, nil
+	// The live composed resource is authoritative for any fields that the
+	// base template does not specify, for example defaults populated by a
+	// provider.
+	existing, err := json.Marshal(cd)
+	if err != nil {
+		return errors.Wrap(err, errMarshal)
+	}
+	merged, err := jsonpatch.MergePatch(existing, t.Base.Raw)
+	if err != nil {
+		return errors.Wrap(err, errMergeBase)
+	}
+	return errors.Wrap(json.Unmarshal(merged, cd), errUnmarshal)
 }
 
-// PD - gets the secret reference when a connection custom secret path is defined
-func getWriteConnectionSecretToReference(cd resource.Composed, t v1alpha1.ComposedTemplate) (*runtimev1alpha1.SecretReference, error) {
-	if t.ConnectionSecretRef == nil {
-		return cd.GetWriteConnectionSecretToReference(), nil
+// spec renders the spec template of the supplied template, if any, and merges
+// the resulting JSON object into the spec of the supplied composed resource.
+// The template is executed without any functions beyond the builtins of the
+// template language, so it cannot access files or the network. References to
+// fields the composite resource does not have evaluate to false in
+// conditionals.
+func (c *DefaultConfigurator) spec(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error {
+	if t.SpecTemplate == nil {
+		return nil
 	}
-
-	u, ok := cd.(*runtimecomposed.Unstructured)
-	if !ok {
-		return nil, errors.New("composed resource has to be Unstructured type")
+	tmpl, err := template.New("spec").Parse(*t.SpecTemplate)
+	if err != nil {
+		return errors.Wrap(err, errParseSpecTemplate)
+	}
+	raw, err := json.Marshal(cp)
+	if err != nil {
+		return errors.Wrap(err, errMarshalCP)
+	}
+	content := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &content); err != nil {
+		return errors.Wrap(err, errMarshalCP)
+	}
+	rendered := &strings.Builder{}
+	if err := tmpl.Execute(rendered, content); err != nil {
+		return errors.Wrap(err, errExecuteSpecTemplate)
+	}
+	spec := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(rendered.String()), &spec); err != nil {
+		return errors.Wrap(err, errSpecTemplateObject)
 	}
-	paved := fieldpath.Pave(u.UnstructuredContent())
 
-	name, err := paved.GetValue(t.ConnectionSecretRef.NamePath)
+	patch, err := json.Marshal(map[string]interface{}{"spec": spec})
 	if err != nil {
-		return nil, errors.New("Secret name not found at path: " + t.ConnectionSecretRef.NamePath)
+		return errors.Wrap(err, errMergeSpecTemplate)
 	}
-	namespace, err := paved.GetValue(t.ConnectionSecretRef.NamespacePath)
+	existing, err := json.Marshal(cd)
 	if err != nil {
-		return nil, errors.New("Secret namespace not found at path: " + t.ConnectionSecretRef.NamespacePath)
+		return errors.Wrap(err, errMarshal)
 	}
-	if name == "" || namespace == "" {
-		return nil, nil
+	merged, err := jsonpatch.MergePatch(existing, patch)
+	if err != nil {
+		return errors.Wrap(err, errMergeSpecTemplate)
 	}
-	return &runtimev1alpha1.SecretReference{Name: name.(string), Namespace: namespace.(string)}, nil
+	return errors.Wrap(json.Unmarshal(merged, cd), errMergeSpecTemplate)
 }
 
-// DefaultReadinessChecker is a readiness checker which returns whether the composed
-// resource is ready or not.
-type DefaultReadinessChecker struct{}
+// OverlayFn is a function that implements OverlayApplicator interface.
+type OverlayFn func(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error
 
-// IsReady returns whether the composed resource is ready.
-func (*DefaultReadinessChecker) IsReady(_ context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (bool, error) { // nolint:gocyclo
-	// NOTE(muvaf): The cyclomatic complexity of this function comes from the
-	// mandatory repetitiveness of the switch clause, which is not really complex
-	// in reality. Though beware of adding additional complexity besides that.
+// Overlay calls OverlayFn.
+func (o OverlayFn) Overlay(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error {
+	return o(cp, cd, t)
+}
 
-	if len(t.ReadinessChecks) == 0 {
-		return resource.IsConditionTrue(cd.GetCondition(runtimev1alpha1.TypeReady)), nil
+// An OverlayApplicatorOption configures a DefaultOverlayApplicator.
+type OverlayApplicatorOption func(*DefaultOverlayApplicator)
+
+// WithCollectedPatchErrors configures a DefaultOverlayApplicator to apply all
+// patches even if some of them fail, and to return an error listing every
+// patch that failed rather than only the first. This lets authors fix all of
+// the misconfigured patches of a template at once, at the cost of applying
+// patches that would otherwise have been skipped.
+func WithCollectedPatchErrors() OverlayApplicatorOption {
+	return func(a *DefaultOverlayApplicator) {
+		a.collect = true
+	}
+}
+
+// WithOverlayApplicatorLogger configures a DefaultOverlayApplicator to log
+// each patch it applies at debug level.
+func WithOverlayApplicatorLogger(l logging.Logger) OverlayApplicatorOption {
+	return func(a *DefaultOverlayApplicator) {
+		a.log = l
+	}
+}
+
+// NewDefaultOverlayApplicator returns a DefaultOverlayApplicator that stops at
+// the first patch that fails to apply, unless configured otherwise.
+func NewDefaultOverlayApplicator(o ...OverlayApplicatorOption) *DefaultOverlayApplicator {
+	a := &DefaultOverlayApplicator{}
+	for _, fn := range o {
+		fn(a)
+	}
+	return a
+}
+
+// DefaultOverlayApplicator applies patches to the composed resource using the
+// values on Composite resource and field bindings in ComposedTemplate.
+type DefaultOverlayApplicator struct {
+	collect bool
+	log     logging.Logger
+}
+
+// Overlay applies patches to composed resource. Patches are applied in the
+// order they are listed, except that a patch is always applied after the
+// patches its Order declares it must follow. Patches whose type is
+// ToCompositeFieldPath are skipped; they read the observed state of the
+// composed resource, so they are applied by PatchComposite once the composed
+// resource has been applied. Failed patches whose error policy is Degrade
+// don't stop the remaining patches from being applied; they are instead
+// returned as a *DegradedError once all patches have been applied.
+func (a *DefaultOverlayApplicator) Overlay(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error {
+	return a.OverlayWithSiblings(cp, cd, t, nil)
+}
+
+// OverlayWithSiblings applies patches to composed resource like Overlay, except
+// that patches that read FromComposed read from the supplied siblings rather
+// than from the composite resource. When configured to collect patch errors it
+// applies every patch and returns an aggregate of the errors of all failed
+// patches whose error policy is not Degrade.
+func (a *DefaultOverlayApplicator) OverlayWithSiblings(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate, s Siblings) error {
+	order, err := SortPatches(t.Patches)
+	if err != nil {
+		return errors.Wrap(err, errSortPatches)
+	}
+	log := orNop(a.log).WithValues(
+		"kind", cd.GetObjectKind().GroupVersionKind().String(),
+		"template", templateName(t),
+	)
+	var failed, degraded []error
+	for _, i := range order {
+		if t.Patches[i].Type == v1alpha1.PatchTypeToCompositeFieldPath {
+			continue
+		}
+		err := applyPatch(t.Patches[i], cp, cd, s)
+		if err == nil {
+			log.Debug("Applied patch", "index", i, "type", t.Patches[i].Type)
+			continue
+		}
+		log.Debug("Cannot apply patch", "index", i, "type", t.Patches[i].Type, "error", err)
+		if degrades(t.Patches[i]) {
+			degraded = append(degraded, errors.Wrapf(err, errFmtPatch, i))
+			continue
+		}
+		if !a.collect {
+			return errors.Wrapf(err, errFmtPatch, i)
+		}
+		failed = append(failed, errors.Wrapf(err, errFmtPatch, i))
+	}
+	if len(failed) > 0 {
+		return utilerrors.NewAggregate(failed)
 	}
-	// TODO(muvaf): We can probably get rid of resource.Composed interface and fake.Composed
-	// structs and use *runtimecomposed.Unstructured everywhere including tests.
-	u, ok := cd.(*runtimecomposed.Unstructured)
+	if len(degraded) > 0 {
+		return &DegradedError{Errors: degraded}
+	}
+	return nil
+}
+
+// DryRun applies patches to a copy of the supplied composed resource, leaving
+// the composed resource unchanged, in order to validate them. Unlike Overlay
+// it does not stop at the first patch that fails to apply, regardless of its
+// error policy. It returns an aggregate of the errors of every patch that
+// failed, or nil if all patches could be applied. Patches that read
+// FromComposed read from the supplied siblings, which may be nil.
+func (*DefaultOverlayApplicator) DryRun(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate, s Siblings) error {
+	order, err := SortPatches(t.Patches)
+	if err != nil {
+		return errors.Wrap(err, errSortPatches)
+	}
+	// Patches only read from the composite resource, so we need only copy the
+	// composed resource. We copy it to an unstructured composed resource
+	// because the DeepCopyObject method of some composed resources does not
+	// return a resource.Composed.
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cd)
+	if err != nil {
+		return errors.Wrap(err, errMarshal)
+	}
+	cpy := runtimecomposed.New(func(u *runtimecomposed.Unstructured) { u.Object = runtime.DeepCopyJSON(obj) })
+	var errs []error
+	for _, i := range order {
+		if err := applyPatch(t.Patches[i], cp, cpy, s); err != nil {
+			errs = append(errs, errors.Wrapf(err, errFmtPatch, i))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// PatchComposite applies the patches of the supplied template whose type is
+// ToCompositeFieldPath, in the order Overlay would apply them, skipping all
+// other patches. The observed state of a composed resource is typically only
+// known once it has been applied, so this allows the composite resource to be
+// patched using it. Callers must persist the composite resource afterward.
+func PatchComposite(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error {
+	order, err := SortPatches(t.Patches)
+	if err != nil {
+		return errors.Wrap(err, errSortPatches)
+	}
+	var degraded []error
+	for _, i := range order {
+		if t.Patches[i].Type != v1alpha1.PatchTypeToCompositeFieldPath {
+			continue
+		}
+		err := applyPatch(t.Patches[i], cp, cd, nil)
+		if err == nil {
+			continue
+		}
+		if !degrades(t.Patches[i]) {
+			return errors.Wrapf(err, errFmtPatch, i)
+		}
+		degraded = append(degraded, errors.Wrapf(err, errFmtPatch, i))
+	}
+	if len(degraded) > 0 {
+		return &DegradedError{Errors: degraded}
+	}
+	return nil
+}
+
+// applyPatch applies the supplied patch to the supplied composed resource. The
+// patch reads from the composite resource unless it reads from a sibling. A
+// patch whose type is ToCompositeFieldPath instead reads from the composed
+// resource and applies to the composite resource.
+func applyPatch(p v1alpha1.Patch, cp resource.Composite, cd resource.Composed, s Siblings) error {
+	if p.Type == v1alpha1.PatchTypeToCompositeFieldPath {
+		if p.FromComposed != nil {
+			return errors.Errorf(errFmtToCompositeFromComposed, *p.FromComposed)
+		}
+		return p.Apply(cd, cp)
+	}
+	if p.FromComposed == nil {
+		return p.Apply(cp, cd)
+	}
+	from, ok := s[*p.FromComposed]
 	if !ok {
-		return false, errors.New("composed resource has to be Unstructured type")
+		return errors.Errorf(errFmtNoSibling, *p.FromComposed)
 	}
-	paved := fieldpath.Pave(u.UnstructuredContent())
+	return p.Apply(from, cd)
+}
 
-	for i, check := range t.ReadinessChecks {
-		var ready bool
-		switch check.Type {
-		case v1alpha1.ReadinessCheckNonEmpty:
-			_, err := paved.GetValue(check.FieldPath)
-			if resource.Ignore(fieldpath.IsNotFound, err) != nil {
-				return false, err
-			}
-			ready = !fieldpath.IsNotFound(err)
-		case v1alpha1.ReadinessCheckMatchString:
-			val, err := paved.GetString(check.FieldPath)
-			if resource.Ignore(fieldpath.IsNotFound, err) != nil {
-				return false, err
+// degrades returns true if the supplied patch should degrade rather than fail
+// the reconcile when it cannot be applied.
+func degrades(p v1alpha1.Patch) bool {
+	return p.Policy != nil && p.Policy.Error != nil && *p.Policy.Error == v1alpha1.ErrorPolicyDegrade
+}
+
+// SortPatches returns the indexes of the supplied patches in the order in
+// which they should be applied. Patches that do not depend on one another
+// retain their relative order in the slice. An error is returned if a patch
+// name is duplicated, if a patch depends on an unknown patch, or if patch
+// dependencies form a cycle.
+func SortPatches(ps []v1alpha1.Patch) ([]int, error) {
+	names := make(map[string]int)
+	for i, p := range ps {
+		if p.Order == nil {
+			continue
+		}
+		if _, ok := names[p.Order.Name]; ok {
+			return nil, errors.Errorf(errFmtDuplicatePatch, p.Order.Name)
+		}
+		names[p.Order.Name] = i
+	}
+
+	// pending[i] is the number of patches that must be applied before patch
+	// i, and dependents[i] the patches that are waiting on patch i.
+	pending := make([]int, len(ps))
+	dependents := make([][]int, len(ps))
+	for i, p := range ps {
+		if p.Order == nil {
+			continue
+		}
+		for _, name := range p.Order.After {
+			j, ok := names[name]
+			if !ok {
+				return nil, errors.Errorf(errFmtUnknownPatch, i, name)
 			}
-			ready = !fieldpath.IsNotFound(err) && val == check.MatchString
-		case v1alpha1.ReadinessCheckMatchInteger:
-			val, err := paved.GetInteger(check.FieldPath)
-			if err != nil {
-				return false, err
+			pending[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	order := make([]int, 0, len(ps))
+	applied := make([]bool, len(ps))
+	for len(order) < len(ps) {
+		// Always pick the first unblocked patch in slice order so that
+		// the result is deterministic and falls back to slice order.
+		next := -1
+		for i := range ps {
+			if !applied[i] && pending[i] == 0 {
+				next = i
+				break
 			}
-			ready = !fieldpath.IsNotFound(err) && val == check.MatchInteger
-		default:
-			return false, errors.New(fmt.Sprintf("readiness check at index %d: an unknown type is chosen", i))
 		}
-		if !ready {
-			return false, nil
+		if next == -1 {
+			return nil, errors.New(errPatchCycle)
+		}
+		applied[next] = true
+		order = append(order, next)
+		for _, d := range dependents[next] {
+			pending[d]--
 		}
 	}
-	return true, nil
+	return order, nil
+}
+
+// FetchFn is a function that implements the ConnectionDetailsFetcher interface.
+type FetchFn func(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (managed.ConnectionDetails, error)
+
+// Fetch calls FetchFn.
+func (f FetchFn) Fetch(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (managed.ConnectionDetails, error) {
+	return f(ctx, cd, t)
+}
+
+// A FetcherOption configures an APIConnectionDetailsFetcher.
+type FetcherOption func(*APIConnectionDetailsFetcher)
+
+// WithPropagatedAnnotations configures the keys of the connection secret
+// annotations that should be propagated, for example annotations indicating
+// that the secret's content is encrypted at rest.
+func WithPropagatedAnnotations(keys ...string) FetcherOption {
+	return func(cdf *APIConnectionDetailsFetcher) {
+		cdf.annotations = keys
+	}
+}
+
+// WithDeniedConnectionSecretKeys configures connection secret keys that
+// should not be propagated unless they are explicitly allowed by the
+// ConnectionSecretKeyFilter of a template.
+func WithDeniedConnectionSecretKeys(keys ...string) FetcherOption {
+	return func(cdf *APIConnectionDetailsFetcher) {
+		cdf.denied = keys
+	}
+}
+
+// WithPaver configures the Paver used to get the values of composed resources
+// at the custom connection secret paths of a template.
+func WithPaver(p Paver) FetcherOption {
+	return func(cdf *APIConnectionDetailsFetcher) {
+		cdf.paver = p
+	}
+}
+
+// WithReadinessGate configures the ReadinessProber used to determine whether
+// connection details that should only be published once the composed resource
+// is ready may be fetched.
+func WithReadinessGate(rp ReadinessProber) FetcherOption {
+	return func(cdf *APIConnectionDetailsFetcher) {
+		cdf.readiness = rp
+	}
+}
+
+// WithDefaultSecretNamespace configures the fetcher to default the namespace
+// of connection secrets whose reference omits one to the namespace of the
+// claim of the composite resource, as recorded by the claim namespace label of
+// the composed resource, or else to the namespace of the composed resource.
+// This spares templates from having to patch the namespace of each secret.
+// Explicitly specified namespaces take precedence.
+func WithDefaultSecretNamespace() FetcherOption {
+	return func(cdf *APIConnectionDetailsFetcher) {
+		cdf.defaultNamespace = true
+	}
+}
+
+// WithSecretNamespaceOverride configures the fetcher to fetch connection
+// secrets from the supplied namespace, regardless of the namespace referenced
+// by the composed resource or found at the connection secret paths of its
+// template. This is useful when composed resources report the namespace their
+// connection secrets are written to, but the secrets are looked up elsewhere.
+func WithSecretNamespaceOverride(namespace string) FetcherOption {
+	return func(cdf *APIConnectionDetailsFetcher) {
+		cdf.namespaceOverride = namespace
+	}
+}
+
+// WithExternalNameKey configures the fetcher to publish the external name of
+// each composed resource, i.e. the name or ID of the real external resource,
+// as a connection detail with the supplied key. Nothing is published for
+// composed resources that have no external name, and explicitly configured
+// connection details with the same key take precedence.
+func WithExternalNameKey(key string) FetcherOption {
+	return func(cdf *APIConnectionDetailsFetcher) {
+		cdf.externalNameKey = key
+	}
+}
+
+// WithSecretReader configures the fetcher to get connection secrets using the
+// supplied reader rather than the client it was created with. Supplying a
+// reader that bypasses the cache of the client, for example the API reader of
+// a controller manager, avoids caching every secret in the namespaces that
+// connection secrets are written to. The client is still used for all other
+// requests.
+func WithSecretReader(r client.Reader) FetcherOption {
+	return func(cdf *APIConnectionDetailsFetcher) {
+		cdf.secrets = r
+	}
+}
+
+// NewAPIConnectionDetailsFetcher returns an APIConnectionDetailsFetcher that
+// fetches connection secrets using the supplied client.
+func NewAPIConnectionDetailsFetcher(c client.Client, o ...FetcherOption) *APIConnectionDetailsFetcher {
+	cdf := &APIConnectionDetailsFetcher{client: c, paver: PaveUnstructured, readiness: &DefaultReadinessChecker{}}
+	for _, fn := range o {
+		fn(cdf)
+	}
+	return cdf
+}
+
+// APIConnectionDetailsFetcher fetches the connection secret of given composed
+// resource if it has a connection secret reference.
+type APIConnectionDetailsFetcher struct {
+	client            client.Client
+	secrets           client.Reader
+	paver             Paver
+	readiness         ReadinessProber
+	annotations       []string
+	denied            []string
+	externalNameKey   string
+	defaultNamespace  bool
+	namespaceOverride string
+}
+
+// secretReader returns the reader used to get connection secrets.
+func (cdf *APIConnectionDetailsFetcher) secretReader() client.Reader {
+	if cdf.secrets != nil {
+		return cdf.secrets
+	}
+	return cdf.client
+}
+
+// FetchAnnotations returns the annotations of the connection secret of the
+// composed resource that are configured to be propagated.
+func (cdf *APIConnectionDetailsFetcher) FetchAnnotations(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (map[string]string, error) {
+	if len(cdf.annotations) == 0 {
+		return nil, nil
+	}
+	sref, err := cdf.secretReference(cd, t)
+	if resource.Ignore(IsSecretReferenceNotSet, err) != nil {
+		return nil, err
+	}
+	if sref == nil {
+		return nil, nil
+	}
+
+	s := &corev1.Secret{}
+	nn := types.NamespacedName{Namespace: sref.Namespace, Name: sref.Name}
+	if err := getSecret(ctx, cdf.secretReader(), nn, s); client.IgnoreNotFound(err) != nil {
+		return nil, errors.Wrap(err, errGetSecret)
+	}
+
+	a := map[string]string{}
+	for _, k := range cdf.annotations {
+		if v, ok := s.GetAnnotations()[k]; ok {
+			a[k] = v
+		}
+	}
+	return a, nil
+}
+
+// Fetch returns the connection secret details of composed resource. Connection
+// details that are read from the composite resource are omitted. If a
+// configured connection secret reference is not yet set the details that could
+// be fetched are returned along with a *SecretReferenceNotSetError.
+func (cdf *APIConnectionDetailsFetcher) Fetch(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (managed.ConnectionDetails, error) {
+	return cdf.FetchFromComposite(ctx, nil, cd, t)
+}
+
+// FetchFromComposite returns the connection secret details of composed
+// resource, including those read from the supplied composite resource. The
+// composite resource may be nil, in which case connection details that are
+// read from it are omitted. If a configured connection secret reference is not
+// yet set the details that could be fetched are returned along with a
+// *SecretReferenceNotSetError.
+func (cdf *APIConnectionDetailsFetcher) FetchFromComposite(ctx context.Context, cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) (managed.ConnectionDetails, error) {
+	// There is nothing to fetch, so we don't resolve or get any connection
+	// secrets.
+	if len(t.ConnectionDetails) == 0 {
+		return cdf.withExternalName(cd, nil), nil
+	}
+
+	// PD -  support for custom connection secrets
+	// A secret reference that is not yet set doesn't prevent us from fetching
+	// the details we can, but we return it so callers can tell that details
+	// may be missing.
+	srefs, notSet := cdf.secretReferences(cd, t)
+	if resource.Ignore(IsSecretReferenceNotSet, notSet) != nil {
+		return nil, notSet
+	}
+	crefs, err := cdf.references(cd, t.ConnectionConfigMapRefs)
+	if resource.Ignore(IsSecretReferenceNotSet, err) != nil {
+		return nil, err
+	}
+	if notSet == nil {
+		notSet = err
+	}
+	if len(srefs) == 0 && len(crefs) == 0 && !fromFieldPaths(t) {
+		return cdf.withExternalName(cd, nil), notSet
+	}
+
+	conn := managed.ConnectionDetails{}
+
+	// It's possible that the composed resource does want to write a
+	// connection secret or ConfigMap but has not yet. We presume this isn't
+	// an issue and that we'll propagate any connection details during a
+	// future iteration. The keys of later ConfigMaps and secrets take
+	// precedence, and the keys of secrets take precedence over those of
+	// ConfigMaps.
+	s := &corev1.Secret{Data: map[string][]byte{}}
+	for _, cref := range crefs {
+		cm := &corev1.ConfigMap{}
+		nn := types.NamespacedName{Namespace: cref.Namespace, Name: cref.Name}
+		if err := cdf.client.Get(ctx, nn, cm); client.IgnoreNotFound(err) != nil {
+			return nil, errors.Wrap(err, errGetConfigMap)
+		}
+		for k, v := range cm.BinaryData {
+			s.Data[k] = v
+		}
+		for k, v := range cm.Data {
+			s.Data[k] = []byte(v)
+		}
+	}
+	for _, sref := range srefs {
+		ss := &corev1.Secret{}
+		nn := types.NamespacedName{Namespace: sref.Namespace, Name: sref.Name}
+		if err := getSecret(ctx, cdf.secretReader(), nn, ss); client.IgnoreNotFound(err) != nil {
+			return nil, errors.Wrap(err, errGetSecret)
+		}
+		for k, v := range ss.Data {
+			s.Data[k] = v
+		}
+	}
+
+	ready, err := cdf.ready(ctx, cd, t)
+	if err != nil {
+		return nil, errors.Wrap(err, errReadinessGate)
+	}
+
+	for _, d := range t.ConnectionDetails {
+		if d.PublishWhenReady && !ready {
+			continue
+		}
+
+		if d.Name != nil && d.Value != nil {
+			conn[d.KeyPrefix+*d.Name] = []byte(*d.Value)
+			continue
+		}
+
+		if d.Name != nil && d.FromCompositeFieldPath != nil {
+			if cp == nil {
+				continue
+			}
+			v, err := fromCompositeFieldPath(cp, d)
+			if err != nil {
+				return nil, err
+			}
+			if v != nil {
+				conn[d.KeyPrefix+*d.Name] = v
+			}
+			continue
+		}
+
+		if d.Name != nil && d.FromFieldPath != nil {
+			v, err := cdf.fromFieldPath(cd, d)
+			if err != nil {
+				return nil, err
+			}
+			if v != nil {
+				conn[d.KeyPrefix+*d.Name] = v
+			}
+			continue
+		}
+
+		if d.FromConnectionSecretKey == nil {
+			continue
+		}
+
+		if !cdf.permitted(*d.FromConnectionSecretKey, t.ConnectionSecretKeyFilter) {
+			continue
+		}
+
+		if len(s.Data[*d.FromConnectionSecretKey]) == 0 {
+			continue
+		}
+
+		key := d.KeyPrefix + *d.FromConnectionSecretKey
+		if d.Name != nil {
+			key = d.KeyPrefix + *d.Name
+		}
+
+		v := s.Data[*d.FromConnectionSecretKey]
+		if d.DecodeBase64 {
+			decoded, err := base64.StdEncoding.DecodeString(string(v))
+			if err != nil {
+				return nil, errors.Wrapf(err, errFmtDecodeBase64, *d.FromConnectionSecretKey)
+			}
+			v = decoded
+		}
+		if len(d.Transforms) > 0 {
+			out, err := v1alpha1.ApplyTransforms(d.Transforms, string(v))
+			if err != nil {
+				return nil, errors.Wrapf(err, errFmtTransform, *d.FromConnectionSecretKey)
+			}
+			if v, err = connectionValue(out); err != nil {
+				return nil, errors.Wrapf(err, errFmtTransform, *d.FromConnectionSecretKey)
+			}
+		}
+		if d.Escape != nil {
+			escaped, err := d.Escape.Escape(string(v))
+			if err != nil {
+				return nil, errors.Wrapf(err, errFmtEscape, *d.FromConnectionSecretKey)
+			}
+			v = []byte(escaped)
+		}
+		if d.EncodeBase64 {
+			v = []byte(base64.StdEncoding.EncodeToString(v))
+		}
+
+		conn[key] = v
+	}
+
+	return cdf.withExternalName(cd, conn), notSet
+}
+
+// fromFieldPath returns the value of the supplied connection detail, read from
+// its FromFieldPath of the supplied composed resource. A nil value is returned
+// if the composed resource does not have the field.
+func (cdf *APIConnectionDetailsFetcher) fromFieldPath(cd resource.Composed, d v1alpha1.ConnectionDetail) ([]byte, error) {
+	p := cdf.paver
+	if p == nil {
+		p = PaveUnstructured
+	}
+	paved, err := p.Pave(cd)
+	if err != nil {
+		return nil, err
+	}
+	v, err := fieldPathValue(paved, *d.FromFieldPath, d)
+	return v, errors.Wrapf(err, errFmtConnectionFieldPath, *d.FromFieldPath)
+}
+
+// fromCompositeFieldPath returns the value of the supplied connection detail,
+// read from its FromCompositeFieldPath of the supplied composite resource. A
+// nil value is returned if the composite resource does not have the field.
+func fromCompositeFieldPath(cp resource.Composite, d v1alpha1.ConnectionDetail) ([]byte, error) {
+	paved, err := fieldpath.PaveObject(cp)
+	if err != nil {
+		return nil, errors.Wrap(err, errMarshalCP)
+	}
+	v, err := fieldPathValue(paved, *d.FromCompositeFieldPath, d)
+	return v, errors.Wrapf(err, errFmtConnectionCompositePath, *d.FromCompositeFieldPath)
+}
+
+// fieldPathValue returns the transformed and escaped value at the supplied
+// field path as the value of the supplied connection detail, or nil if there
+// is no value at the field path.
+func fieldPathValue(paved *fieldpath.Paved, path string, d v1alpha1.ConnectionDetail) ([]byte, error) {
+	in, err := paved.GetValue(path)
+	if fieldpath.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	out, err := v1alpha1.ApplyTransforms(d.Transforms, in)
+	if err != nil {
+		return nil, err
+	}
+	v, err := connectionValue(out)
+	if err != nil || d.Escape == nil {
+		return v, err
+	}
+	escaped, err := d.Escape.Escape(string(v))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(escaped), nil
+}
+
+// connectionValue returns the supplied value as a connection detail. Only
+// strings, numbers, and booleans may be connection details.
+func connectionValue(v interface{}) ([]byte, error) {
+	switch t := v.(type) {
+	case string:
+		return []byte(t), nil
+	case []byte:
+		return t, nil
+	case bool, int, int64, float64:
+		return []byte(fmt.Sprint(t)), nil
+	default:
+		return nil, errors.Errorf(errFmtConnectionValue, v)
+	}
+}
+
+// fromFieldPaths returns true if any of the connection details of the supplied
+// template are read from a field path.
+func fromFieldPaths(t v1alpha1.ComposedTemplate) bool {
+	for _, d := range t.ConnectionDetails {
+		if d.FromFieldPath != nil || d.FromCompositeFieldPath != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// secretNamespace returns the namespace that connection secret references
+// that omit one should default to, if configured to do so.
+func (cdf *APIConnectionDetailsFetcher) secretNamespace(cd resource.Composed) string {
+	if !cdf.defaultNamespace {
+		return ""
+	}
+	return impliedNamespace(cd)
+}
+
+// impliedNamespace returns the namespace of the claim the supplied composed
+// resource belongs to, if any, or else the namespace of the composed resource.
+func impliedNamespace(cd resource.Composed) string {
+	if ns := cd.GetLabels()[LabelKeyClaimNamespace]; ns != "" {
+		return ns
+	}
+	return cd.GetNamespace()
+}
+
+// secretReferences returns the references to the connection secret and the
+// additional connection secrets of the supplied composed resource, in the
+// order their keys should be merged. Secrets that can't yet be referenced are
+// omitted. If a configured secret reference is not yet set the references that
+// are set are returned along with a *SecretReferenceNotSetError.
+func (cdf *APIConnectionDetailsFetcher) secretReferences(cd resource.Composed, t v1alpha1.ComposedTemplate) ([]runtimev1alpha1.SecretReference, error) {
+	refs := make([]runtimev1alpha1.SecretReference, 0, len(t.AdditionalConnectionSecretRefs)+1)
+	var notSet error
+	sref, err := cdf.secretReference(cd, t)
+	if IsSecretReferenceNotSet(err) {
+		notSet = err
+	} else if err != nil {
+		return nil, err
+	}
+	if sref != nil {
+		refs = append(refs, *sref)
+	}
+	additional, err := cdf.references(cd, t.AdditionalConnectionSecretRefs)
+	if resource.Ignore(IsSecretReferenceNotSet, err) != nil {
+		return nil, err
+	}
+	if notSet == nil {
+		notSet = err
+	}
+	return append(refs, additional...), notSet
+}
+
+// references resolves the supplied paths of the supplied composed resource
+// to references, in the namespace they are overridden to. Paths that are not
+// yet set are omitted, and the first *SecretReferenceNotSetError is returned
+// along with the references that are set.
+func (cdf *APIConnectionDetailsFetcher) references(cd resource.Composed, paths []v1alpha1.ConnectionSecretRef) ([]runtimev1alpha1.SecretReference, error) {
+	refs := make([]runtimev1alpha1.SecretReference, 0, len(paths))
+	var notSet error
+	for i := range paths {
+		ref, err := cdf.secretReference(cd, v1alpha1.ComposedTemplate{ConnectionSecretRef: &paths[i]})
+		if IsSecretReferenceNotSet(err) {
+			if notSet == nil {
+				notSet = err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ref != nil {
+			refs = append(refs, *ref)
+		}
+	}
+	return refs, notSet
+}
+
+// secretReference returns the reference to the connection secret of the
+// supplied composed resource, if any, in the namespace it is overridden to.
+func (cdf *APIConnectionDetailsFetcher) secretReference(cd resource.Composed, t v1alpha1.ComposedTemplate) (*runtimev1alpha1.SecretReference, error) {
+	if cdf.namespaceOverride == "" {
+		return getWriteConnectionSecretToReference(cdf.paver, cd, t, cdf.secretNamespace(cd))
+	}
+
+	// The override doubles as the default namespace so that a namespace that
+	// is missing from a custom connection secret path isn't an error.
+	sref, err := getWriteConnectionSecretToReference(cdf.paver, cd, t, cdf.namespaceOverride)
+	if err != nil || sref == nil {
+		return sref, err
+	}
+	return &runtimev1alpha1.SecretReference{Name: sref.Name, Namespace: cdf.namespaceOverride}, nil
+}
+
+// withExternalName adds the external name of the supplied composed resource
+// to the supplied connection details, if configured to do so.
+func (cdf *APIConnectionDetailsFetcher) withExternalName(cd resource.Composed, conn managed.ConnectionDetails) managed.ConnectionDetails {
+	if cdf.externalNameKey == "" {
+		return conn
+	}
+	name := meta.GetExternalName(cd)
+	if name == "" {
+		return conn
+	}
+	if _, ok := conn[cdf.externalNameKey]; ok {
+		return conn
+	}
+	if conn == nil {
+		conn = managed.ConnectionDetails{}
+	}
+	conn[cdf.externalNameKey] = []byte(name)
+	return conn
+}
+
+// ready returns true if the composed resource is ready. Readiness is only
+// determined if any of the template's connection details should not be
+// published until the composed resource is ready.
+func (cdf *APIConnectionDetailsFetcher) ready(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (bool, error) {
+	for _, d := range t.ConnectionDetails {
+		if d.PublishWhenReady && cdf.readiness == nil {
+			return (&DefaultReadinessChecker{}).IsReady(ctx, cd, t)
+		}
+		if d.PublishWhenReady {
+			return cdf.readiness.IsReady(ctx, cd, t)
+		}
+	}
+	return true, nil
+}
+
+// permitted returns true if the supplied connection secret key may be
+// propagated. Keys denied by the template's filter are never permitted. Keys
+// allowed by the template's filter are permitted even if they are denied
+// globally. All other keys are permitted unless they are denied globally.
+func (cdf *APIConnectionDetailsFetcher) permitted(key string, f *v1alpha1.ConnectionSecretKeyFilter) bool {
+	if f != nil && contains(f.Deny, key) {
+		return false
+	}
+	if f != nil && contains(f.Allow, key) {
+		return true
+	}
+	return !contains(cdf.denied, key)
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// RenderConnectionSecretKeys returns a copy of the supplied template in which
+// each FromConnectionSecretKey that is a Go template has been rendered using
+// the content of the supplied composite resource. For example the key
+// "password-{{ .metadata.labels.region }}" could be rendered as
+// "password-us-east-1". Static keys are left unchanged.
+func RenderConnectionSecretKeys(cp resource.Composite, t v1alpha1.ComposedTemplate) (v1alpha1.ComposedTemplate, error) {
+	out := *t.DeepCopy()
+	var content map[string]interface{}
+	for i, d := range out.ConnectionDetails {
+		if d.FromConnectionSecretKey == nil || !strings.Contains(*d.FromConnectionSecretKey, "{{") {
+			continue
+		}
+		if content == nil {
+			raw, err := json.Marshal(cp)
+			if err != nil {
+				return out, errors.Wrap(err, errMarshalCP)
+			}
+			if err := json.Unmarshal(raw, &content); err != nil {
+				return out, errors.Wrap(err, errMarshalCP)
+			}
+		}
+		tmpl, err := template.New("key").Option("missingkey=error").Parse(*d.FromConnectionSecretKey)
+		if err != nil {
+			return out, errors.Wrapf(err, errFmtRenderKey, *d.FromConnectionSecretKey)
+		}
+		key := &strings.Builder{}
+		if err := tmpl.Execute(key, content); err != nil {
+			return out, errors.Wrapf(err, errFmtRenderKey, *d.FromConnectionSecretKey)
+		}
+		out.ConnectionDetails[i].FromConnectionSecretKey = pointer.StringPtr(key.String())
+	}
+	selected, err := selectConnectionDetails(cp, out)
+	if err != nil {
+		return out, err
+	}
+	out.ConnectionDetails = append(out.ConnectionDetails, selected...)
+	return out, nil
+}
+
+// selectConnectionDetails returns the connection details that the supplied
+// composite resource selects at the ConnectionDetailsFromCompositeFieldPath of
+// the supplied template, sorted by name. Keys that are already published by
+// the template's ConnectionDetails are omitted.
+func selectConnectionDetails(cp resource.Composite, t v1alpha1.ComposedTemplate) ([]v1alpha1.ConnectionDetail, error) {
+	if t.ConnectionDetailsFromCompositeFieldPath == nil {
+		return nil, nil
+	}
+	path := *t.ConnectionDetailsFromCompositeFieldPath
+	paved, err := fieldpath.PaveObject(cp)
+	if err != nil {
+		return nil, errors.Wrap(err, errMarshalCP)
+	}
+	keys, err := paved.GetStringObject(path)
+	if fieldpath.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, errFmtSelectConnection, path)
+	}
+
+	published := map[string]bool{}
+	for _, d := range t.ConnectionDetails {
+		switch {
+		case d.Name != nil:
+			published[*d.Name] = true
+		case d.FromConnectionSecretKey != nil:
+			published[*d.FromConnectionSecretKey] = true
+		}
+	}
+
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	selected := make([]v1alpha1.ConnectionDetail, 0, len(names))
+	for _, name := range names {
+		from := keys[name]
+		for _, key := range []string{name, from} {
+			if msgs := validation.IsConfigMapKey(key); len(msgs) > 0 {
+				return nil, errors.Wrapf(errors.Errorf(errFmtInvalidConnectionKey, key, strings.Join(msgs, ", ")), errFmtSelectConnection, path)
+			}
+		}
+		if published[name] {
+			continue
+		}
+		selected = append(selected, v1alpha1.ConnectionDetail{Name: pointer.StringPtr(name), FromConnectionSecretKey: pointer.StringPtr(from)})
+	}
+	return selected, nil
+}
+
+// ConnectionSecretReferences are the connection secrets that a composite
+// resource depends on.
+type ConnectionSecretReferences struct {
+	// Resolved references to connection secrets.
+	Resolved []runtimev1alpha1.SecretReference
+
+	// Pending contains the indices of templates whose connection secret can't
+	// yet be resolved, for example because their composed resource has not
+	// yet been created or its custom connection secret paths are not yet set.
+	Pending []int
+}
+
+// ResolveConnectionSecretReferences resolves the connection secret of each
+// composed resource, using the template at the same index. A template without
+// a corresponding composed resource is considered pending. Composed resources
+// that don't publish a connection secret are omitted.
+func ResolveConnectionSecretReferences(cds []resource.Composed, ts []v1alpha1.ComposedTemplate) ConnectionSecretReferences {
+	refs := ConnectionSecretReferences{}
+	seen := map[runtimev1alpha1.SecretReference]bool{}
+	for i, t := range ts {
+		if i >= len(cds) || cds[i] == nil {
+			refs.Pending = append(refs.Pending, i)
+			continue
+		}
+		ref, err := getWriteConnectionSecretToReference(PaveUnstructured, cds[i], t, "")
+		if err != nil {
+			refs.Pending = append(refs.Pending, i)
+			continue
+		}
+		if ref == nil || seen[*ref] {
+			continue
+		}
+		seen[*ref] = true
+		refs.Resolved = append(refs.Resolved, *ref)
+	}
+	return refs
+}
+
+// RenderReadinessChecks returns a copy of the supplied template in which the
+// MatchStrings of each readiness check that reads them from the composite
+// resource have been set to the values of the relevant composite array field.
+// MatchStrings are empty if the field is absent. The MatchString of each
+// MatchCompositionRevision check is set to the composition revision of the
+// composite resource.
+func RenderReadinessChecks(cp resource.Composite, t v1alpha1.ComposedTemplate) (v1alpha1.ComposedTemplate, error) {
+	out := *t.DeepCopy()
+	var paved *fieldpath.Paved
+	for i, check := range out.ReadinessChecks {
+		if check.Type == v1alpha1.ReadinessCheckMatchCompositionRevision {
+			out.ReadinessChecks[i].MatchString = cp.GetAnnotations()[AnnotationKeyCompositionRevision]
+			continue
+		}
+		if check.MatchStringsFromCompositeFieldPath == "" {
+			continue
+		}
+		if paved == nil {
+			p, err := fieldpath.PaveObject(cp)
+			if err != nil {
+				return out, errors.Wrap(err, errMarshalCP)
+			}
+			paved = p
+		}
+		values, err := paved.GetStringArray(check.MatchStringsFromCompositeFieldPath)
+		if resource.Ignore(fieldpath.IsNotFound, err) != nil {
+			return out, errors.Wrapf(err, errFmtMatchStrings, i)
+		}
+		out.ReadinessChecks[i].MatchStrings = append([]string{}, values...)
+	}
+	return out, nil
+}
+
+// PD - gets the secret reference when a connection custom secret path is defined
+// The supplied default namespace, if any, is used when the reference omits one.
+func getWriteConnectionSecretToReference(p Paver, cd resource.Composed, t v1alpha1.ComposedTemplate, defaultNamespace string) (*runtimev1alpha1.SecretReference, error) {
+	if t.ConnectionSecretRef == nil {
+		ref := cd.GetWriteConnectionSecretToReference()
+		if ref == nil || ref.Namespace != "" || defaultNamespace == "" {
+			return ref, nil
+		}
+		return &runtimev1alpha1.SecretReference{Name: ref.Name, Namespace: defaultNamespace}, nil
+	}
+
+	if p == nil {
+		p = PaveUnstructured
+	}
+	paved, err := p.Pave(cd)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := secretReferenceValue(paved, t.ConnectionSecretRef.NamePath)
+	if fieldpath.IsNotFound(err) {
+		return nil, errors.New("Secret name not found at path: " + t.ConnectionSecretRef.NamePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	namespace := impliedNamespace(cd)
+	if t.ConnectionSecretRef.NamespacePath != "" {
+		namespace, err = secretReferenceValue(paved, t.ConnectionSecretRef.NamespacePath)
+		if fieldpath.IsNotFound(err) && defaultNamespace == "" {
+			return nil, errors.New("Secret namespace not found at path: " + t.ConnectionSecretRef.NamespacePath)
+		}
+		if resource.Ignore(fieldpath.IsNotFound, err) != nil {
+			return nil, err
+		}
+	}
+	if strings.TrimSpace(namespace) == "" {
+		namespace = defaultNamespace
+	}
+	ref := NormalizeSecretReference(runtimev1alpha1.SecretReference{Name: name, Namespace: namespace})
+	if ref.Name == "" || ref.Namespace == "" {
+		return nil, &SecretReferenceNotSetError{NamePath: t.ConnectionSecretRef.NamePath, NamespacePath: t.ConnectionSecretRef.NamespacePath}
+	}
+	if err := ValidateSecretReference(ref, t.ConnectionSecretRef); err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+// secretReferenceValue returns the value at the supplied field path as a
+// string. Numbers and booleans are formatted as strings, for example a name
+// derived from a numeric ID, while other values return an error.
+func secretReferenceValue(paved *fieldpath.Paved, path string) (string, error) {
+	v, err := paved.GetValue(path)
+	if err != nil {
+		return "", err
+	}
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case int64:
+		return strconv.FormatInt(t, 10), nil
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	}
+	return "", errors.Errorf(errFmtSecretRefNotScalar, path, v1alpha1.JSONType(v))
+}
+
+// NormalizeSecretReference returns the supplied SecretReference with any
+// leading or trailing whitespace removed from its name and namespace.
+func NormalizeSecretReference(ref runtimev1alpha1.SecretReference) runtimev1alpha1.SecretReference {
+	return runtimev1alpha1.SecretReference{Name: strings.TrimSpace(ref.Name), Namespace: strings.TrimSpace(ref.Namespace)}
+}
+
+// ValidateSecretReference returns an error if the name or namespace of the
+// supplied SecretReference, which was resolved using the supplied paths, is
+// not a legal Kubernetes identifier. The error names the path that produced
+// the invalid value, if it was not implied.
+func ValidateSecretReference(ref runtimev1alpha1.SecretReference, paths *v1alpha1.ConnectionSecretRef) error {
+	if msgs := validation.IsDNS1123Subdomain(ref.Name); len(msgs) > 0 {
+		return errors.Errorf(errFmtInvalidSecretName, ref.Name, paths.NamePath, strings.Join(msgs, "; "))
+	}
+	msgs := validation.IsDNS1123Label(ref.Namespace)
+	if len(msgs) > 0 && paths.NamespacePath == "" {
+		return errors.Errorf(errFmtInvalidImpliedNamespace, ref.Namespace, strings.Join(msgs, "; "))
+	}
+	if len(msgs) > 0 {
+		return errors.Errorf(errFmtInvalidSecretNamespace, ref.Namespace, paths.NamespacePath, strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// IsReadyFn is a function that implements the ReadinessProber interface.
+type IsReadyFn func(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (bool, error)
+
+// IsReady calls IsReadyFn.
+func (fn IsReadyFn) IsReady(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (bool, error) {
+	return fn(ctx, cd, t)
+}
+
+// A TerminalError indicates that a composed resource has failed in a way that
+// it is not expected to recover from.
+type TerminalError struct {
+	// Composed is the name of the composed resource.
+	Composed string
+
+	// Check is the index of the readiness check that has failed.
+	Check int
+
+	// Duration for which the readiness check has failed.
+	Duration time.Duration
+
+	// TimedOut is true if the readiness check did not pass within its timeout,
+	// in which case Duration is the age of the composed resource.
+	TimedOut bool
+}
+
+// Error returns a description of the terminal failure.
+func (e *TerminalError) Error() string {
+	if e.TimedOut {
+		return fmt.Sprintf("composed resource %q has failed terminally: readiness check at index %d has not passed and timed out after %s", e.Composed, e.Check, e.Duration)
+	}
+	return fmt.Sprintf("composed resource %q has failed terminally: readiness check at index %d has failed for %s", e.Composed, e.Check, e.Duration)
+}
+
+// IsTerminal returns true if the supplied error is, or wraps, a
+// *TerminalError.
+func IsTerminal(err error) bool {
+	var e *TerminalError
+	return errors.As(err, &e)
+}
+
+// A SecretReferenceNotSetError indicates that a composed resource has a
+// configured connection secret reference, but that its name or namespace
+// resolved to an empty string. This is typically because the composed resource
+// has not yet populated the fields they are read from.
+type SecretReferenceNotSetError struct {
+	// NamePath is the field path the name of the secret is read from.
+	NamePath string
+
+	// NamespacePath is the field path the namespace of the secret is read
+	// from.
+	NamespacePath string
+}
+
+// Error returns a description of the unset secret reference.
+func (e *SecretReferenceNotSetError) Error() string {
+	if e.NamespacePath == "" {
+		return fmt.Sprintf("connection secret reference is not yet set: name path %s or the implied namespace resolved to an empty string", e.NamePath)
+	}
+	return fmt.Sprintf("connection secret reference is not yet set: name path %s or namespace path %s resolved to an empty string", e.NamePath, e.NamespacePath)
+}
+
+// IsSecretReferenceNotSet returns true if the supplied error is, or wraps, a
+// *SecretReferenceNotSetError.
+func IsSecretReferenceNotSet(err error) bool {
+	var e *SecretReferenceNotSetError
+	return errors.As(err, &e)
+}
+
+// A DegradedError indicates that one or more patches whose error policy is
+// Degrade could not be applied to a composed resource. All other patches were
+// applied.
+type DegradedError struct {
+	// Errors encountered applying each failed patch.
+	Errors []error
+}
+
+// Error returns a description of the failed patches.
+func (e *DegradedError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// IsDegraded returns true if the supplied error is, or wraps, a
+// *DegradedError.
+func IsDegraded(err error) bool {
+	var e *DegradedError
+	return errors.As(err, &e)
+}
+
+// A ReadinessCheckerOption configures a DefaultReadinessChecker.
+type ReadinessCheckerOption func(*DefaultReadinessChecker)
+
+// WithReadinessPaver configures the Paver used to get the values of composed
+// resources that readiness checks are evaluated against.
+func WithReadinessPaver(p Paver) ReadinessCheckerOption {
+	return func(c *DefaultReadinessChecker) {
+		c.paver = p
+	}
+}
+
+// NewDefaultReadinessChecker returns a DefaultReadinessChecker that tracks how
+// long each readiness check has been failing, in order to support readiness
+// checks that fail terminally.
+func NewDefaultReadinessChecker(o ...ReadinessCheckerOption) *DefaultReadinessChecker {
+	c := &DefaultReadinessChecker{paver: PaveUnstructured, failures: newFailureTracker(time.Now), successes: newSuccessTracker(), generations: newGenerationTracker(), regexps: newRegexpCache()}
+	for _, fn := range o {
+		fn(c)
+	}
+	return c
+}
+
+// DefaultReadinessChecker is a readiness checker which returns whether the composed
+// resource is ready or not.
+type DefaultReadinessChecker struct {
+	paver       Paver
+	failures    *failureTracker
+	successes   *successTracker
+	generations *generationTracker
+	regexps     *regexpCache
+}
+
+// IsReady returns whether the composed resource is ready.
+func (c *DefaultReadinessChecker) IsReady(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (bool, error) {
+	ready, _, err := c.CheckReadyWithReason(ctx, cd, t)
+	return ready, err
+}
+
+// CheckReadyWithReason returns whether the composed resource is ready and, if
+// it is not, why. The reason describes the first readiness check that did not
+// pass, including the value it observed.
+func (c *DefaultReadinessChecker) CheckReadyWithReason(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (bool, string, error) {
+	if len(t.ReadinessChecks) == 0 {
+		rc := cd.GetCondition(runtimev1alpha1.TypeReady)
+		if resource.IsConditionTrue(rc) {
+			return true, "", nil
+		}
+		return false, conditionReason(rc), nil
+	}
+	p := c.paver
+	if p == nil {
+		p = PaveUnstructured
+	}
+	paved, err := p.Pave(cd)
+	if err != nil {
+		return false, "", err
+	}
+
+	for i, check := range t.ReadinessChecks {
+		passed, err := isReady(ctx, cd, paved, i, check, c.generations, c.regexps)
+		if err != nil && !check.IgnoreErrors {
+			return false, "", err
+		}
+		passed = err == nil && negate(paved, check, passed)
+		if terr := c.failures.track(cd, i, check, passed); terr != nil {
+			return false, "", terr
+		}
+		if terr := timeout(cd, i, check, passed, c.now()); terr != nil {
+			return false, "", terr
+		}
+		if n, ready := c.successes.count(cd, i, check, passed); !ready {
+			// Subsequent checks were not evaluated, so we can't tell whether
+			// they have been failing since they were last tracked, nor can
+			// they have passed consecutively.
+			c.failures.forget(cd, i+1, len(t.ReadinessChecks))
+			c.successes.forget(cd, i+1, len(t.ReadinessChecks))
+			c.generations.forget(cd, i+1, len(t.ReadinessChecks))
+			return false, notReadyReason(paved, i, check, passed, n, err), nil
+		}
+	}
+	return true, "", nil
+}
+
+// CountPassedChecks returns how many of the readiness checks of the supplied
+// template the composed resource passes, and how many checks there are, so
+// that callers can report how close composed resources are to being ready.
+// Unlike CheckReadyWithReason it evaluates every check, even after one fails.
+// A check counts as passed when it passes this evaluation, regardless of how
+// many consecutive successes it requires, and nothing is tracked. If
+// the template has no readiness checks the Ready condition of the composed
+// resource is counted as its only check.
+func (c *DefaultReadinessChecker) CountPassedChecks(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (int, int, error) {
+	if len(t.ReadinessChecks) == 0 {
+		if resource.IsConditionTrue(cd.GetCondition(runtimev1alpha1.TypeReady)) {
+			return 1, 1, nil
+		}
+		return 0, 1, nil
+	}
+	p := c.paver
+	if p == nil {
+		p = PaveUnstructured
+	}
+	paved, err := p.Pave(cd)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	passed := 0
+	for i, check := range t.ReadinessChecks {
+		ready, err := isReady(ctx, cd, paved, i, check, nil, c.regexps)
+		if err != nil && !check.IgnoreErrors {
+			return 0, 0, err
+		}
+		if err == nil && negate(paved, check, ready) {
+			passed++
+		}
+	}
+	return passed, len(t.ReadinessChecks), nil
+}
+
+// now returns the current time according to the clock used to track failing
+// readiness checks.
+func (c *DefaultReadinessChecker) now() time.Time {
+	if c.failures == nil {
+		return time.Now()
+	}
+	return c.failures.now()
+}
+
+// timeout returns a *TerminalError if the supplied readiness check has not
+// passed and its timeout has elapsed since the supplied composed resource was
+// created. Composed resources that have not yet been created never time out.
+func timeout(cd resource.Composed, i int, check v1alpha1.ReadinessCheck, ready bool, now time.Time) error {
+	created := cd.GetCreationTimestamp()
+	if ready || check.TimeoutSeconds == nil || created.IsZero() {
+		return nil
+	}
+	// Creation timestamps are only precise to the second.
+	age := now.Sub(created.Time).Truncate(time.Second)
+	if age < time.Duration(*check.TimeoutSeconds)*time.Second {
+		return nil
+	}
+	return &TerminalError{Composed: cd.GetName(), Check: i, Duration: age, TimedOut: true}
+}
+
+// conditionReason explains why the supplied Ready condition is not true.
+func conditionReason(c runtimev1alpha1.Condition) string {
+	reason := fmt.Sprintf("condition %s is %s", c.Type, c.Status)
+	if c.Reason != "" {
+		reason = fmt.Sprintf("%s with reason %s", reason, c.Reason)
+	}
+	if c.Message != "" {
+		reason = fmt.Sprintf("%s: %s", reason, c.Message)
+	}
+	return reason
+}
+
+// notReadyReason explains why the readiness check at the supplied index did
+// not pass. Checks may pass yet not be ready because they have passed only n
+// of the required number of reconciles in a row, and may fail with an error
+// that they were configured to ignore.
+func notReadyReason(paved *fieldpath.Paved, i int, check v1alpha1.ReadinessCheck, passed bool, n int, err error) string {
+	prefix := fmt.Sprintf("readiness check at index %d (%s)", i, check.Type)
+	switch {
+	case passed:
+		return fmt.Sprintf("%s passed %d of %d required consecutive reconciles", prefix, n, check.ConsecutiveSuccesses)
+	case err != nil:
+		return fmt.Sprintf("%s: %s", prefix, err)
+	}
+
+	expected := expectation(check)
+	if expected == "" {
+		return fmt.Sprintf("%s did not pass", prefix)
+	}
+	if check.Negate {
+		expected = "not " + expected
+	}
+	v, err := observedValue(paved, check)
+	if err != nil {
+		return fmt.Sprintf("%s expected %s at %s but it was not set", prefix, expected, check.FieldPath)
+	}
+	observed, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%s expected %s at %s", prefix, expected, check.FieldPath)
+	}
+	return fmt.Sprintf("%s expected %s at %s but saw %s", prefix, expected, check.FieldPath, observed)
+}
+
+// expectation describes the value the supplied readiness check expects at its
+// field path, or returns an empty string if the check does not expect a
+// particular value there.
+func expectation(check v1alpha1.ReadinessCheck) string {
+	switch check.Type {
+	case v1alpha1.ReadinessCheckNonEmpty, v1alpha1.ReadinessCheckReadyAndNonEmpty:
+		return "a non-empty value"
+	case v1alpha1.ReadinessCheckNonEmptyCollection:
+		return "a non-empty array or object"
+	case v1alpha1.ReadinessCheckMatchAll:
+		return fmt.Sprintf("every value to be %q", check.MatchString)
+	case v1alpha1.ReadinessCheckMatchAny:
+		return fmt.Sprintf("at least one value to be %q", check.MatchString)
+	case v1alpha1.ReadinessCheckMatchString:
+		return strconv.Quote(check.MatchString)
+	case v1alpha1.ReadinessCheckMatchInteger:
+		return strconv.FormatInt(check.MatchInteger, 10)
+	case v1alpha1.ReadinessCheckMatchFloat:
+		if check.Tolerance > 0 {
+			return fmt.Sprintf("%g within %g", check.MatchFloat, check.Tolerance)
+		}
+		return strconv.FormatFloat(check.MatchFloat, 'g', -1, 64)
+	case v1alpha1.ReadinessCheckMatchBool:
+		return strconv.FormatBool(check.MatchBool)
+	case v1alpha1.ReadinessCheckMatchRegex:
+		return fmt.Sprintf("a match for %q", check.MatchRegex)
+	case v1alpha1.ReadinessCheckGreaterThan:
+		return fmt.Sprintf("a value greater than %d", check.MatchInteger)
+	case v1alpha1.ReadinessCheckLessThan:
+		return fmt.Sprintf("a value less than %d", check.MatchInteger)
+	}
+	return ""
+}
+
+// observedValue returns the value at the field path of the supplied readiness
+// check. The values of checks that match wildcard field paths are returned in
+// the order the wildcards were expanded.
+func observedValue(paved *fieldpath.Paved, check v1alpha1.ReadinessCheck) (interface{}, error) {
+	if check.Type != v1alpha1.ReadinessCheckMatchAll && check.Type != v1alpha1.ReadinessCheckMatchAny {
+		return paved.GetValue(check.FieldPath)
+	}
+	paths, err := expandWildcards(paved, check.FieldPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, errors.Errorf("%s: no such field", check.FieldPath)
+	}
+	values := make([]interface{}, 0, len(paths))
+	for _, p := range paths {
+		v, err := paved.GetValue(p)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// negate inverts the supplied result of a readiness check if the check is
+// negated. Checks that match the value at their field path never pass while
+// that field is absent, so that a negated check doesn't consider a composed
+// resource ready before it has reported the value it is checked for.
+func negate(paved *fieldpath.Paved, check v1alpha1.ReadinessCheck, ready bool) bool {
+	if !check.Negate {
+		return ready
+	}
+	switch check.Type {
+	case v1alpha1.ReadinessCheckMatchString,
+		v1alpha1.ReadinessCheckMatchInteger,
+		v1alpha1.ReadinessCheckMatchFloat,
+		v1alpha1.ReadinessCheckMatchBool,
+		v1alpha1.ReadinessCheckMatchRegex,
+		v1alpha1.ReadinessCheckMatchFieldPath,
+		v1alpha1.ReadinessCheckGreaterThan,
+		v1alpha1.ReadinessCheckLessThan:
+		if _, err := paved.GetValue(check.FieldPath); err != nil {
+			return false
+		}
+	case v1alpha1.ReadinessCheckMatchAll, v1alpha1.ReadinessCheckMatchAny:
+		if paths, err := expandWildcards(paved, check.FieldPath); err != nil || len(paths) == 0 {
+			return false
+		}
+	}
+	return !ready
+}
+
+// groupReady returns true if the checks of the supplied group pass, combined
+// according to its logical operator. Checks of the group are reported at the
+// index of the group.
+func groupReady(ctx context.Context, cd resource.Composed, paved *fieldpath.Paved, i int, g *v1alpha1.GroupReadinessCheck, generations *generationTracker, regexps *regexpCache) (bool, error) {
+	if g == nil {
+		return false, errors.Errorf(errFmtNoGroup, i)
+	}
+	if len(g.Checks) == 0 {
+		return true, nil
+	}
+
+	// An And group fails at its first failing check, and an Or group passes
+	// at its first passing check.
+	or := g.LogicOp == v1alpha1.LogicOpOr
+	for _, check := range g.Checks {
+		ready, err := isReady(ctx, cd, paved, i, check, generations, regexps)
+		if err != nil && !check.IgnoreErrors {
+			return false, err
+		}
+		if ready = err == nil && negate(paved, check, ready); ready == or {
+			return or, nil
+		}
+	}
+	return !or, nil
+}
+
+// observedGeneration returns true if the generation of the supplied composed
+// resource has been observed, and has not changed since this readiness check
+// was last evaluated.
+func observedGeneration(cd resource.Composed, paved *fieldpath.Paved, i int, check v1alpha1.ReadinessCheck, generations *generationTracker) (bool, error) {
+	path := check.FieldPath
+	if path == "" {
+		path = "status.observedGeneration"
+	}
+	unchanged := generations.observe(cd, i)
+
+	observed, err := paved.GetInteger(path)
+	if resource.Ignore(fieldpath.IsNotFound, err) != nil {
+		return false, err
+	}
+	return !fieldpath.IsNotFound(err) && observed == cd.GetGeneration() && unchanged, nil
+}
+
+// A regexpCache caches compiled regular expressions so that readiness checks
+// don't compile them on every reconcile.
+type regexpCache struct {
+	mx      sync.RWMutex
+	regexps map[string]*regexp.Regexp
+}
+
+func newRegexpCache() *regexpCache {
+	return &regexpCache{regexps: map[string]*regexp.Regexp{}}
+}
+
+// compile the supplied regular expression, or return it from the cache if it
+// was previously compiled. Nothing is cached by a nil regexpCache.
+func (c *regexpCache) compile(expr string) (*regexp.Regexp, error) {
+	if c == nil {
+		return regexp.Compile(expr)
+	}
+	c.mx.RLock()
+	re, ok := c.regexps[expr]
+	c.mx.RUnlock()
+	if ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	c.mx.Lock()
+	c.regexps[expr] = re
+	c.mx.Unlock()
+	return re, nil
+}
+
+// A checkKey identifies a readiness check of a composed resource.
+type checkKey struct {
+	uid   types.UID
+	check int
+}
+
+// A failureTracker tracks when each readiness check of a composed resource
+// started failing. Like a changeTracker it tracks only a bounded number of
+// readiness checks, and forgets those that are no longer tracked.
+type failureTracker struct {
+	now   func() time.Time
+	since *cache.LRUExpireCache
+}
+
+func newFailureTracker(now func() time.Time) *failureTracker {
+	return &failureTracker{now: now, since: cache.NewLRUExpireCache(maxTracked)}
+}
+
+// track whether the supplied readiness check passed, returning a
+// *TerminalError if it has failed for longer than it is allowed to. Nothing is
+// tracked by a nil failureTracker.
+func (f *failureTracker) track(cd resource.Composed, i int, check v1alpha1.ReadinessCheck, ready bool) error {
+	if f == nil || check.TerminalAfterSeconds == nil {
+		return nil
+	}
+
+	k := checkKey{uid: cd.GetUID(), check: i}
+	if ready {
+		f.since.Remove(k)
+		return nil
+	}
+	v, ok := f.since.Get(k)
+	if !ok {
+		f.since.Add(k, f.now(), trackedTTL)
+		return nil
+	}
+
+	// Track the failing check again so that it isn't forgotten while it
+	// continues to fail.
+	since := v.(time.Time)
+	f.since.Add(k, since, trackedTTL)
+	failing := f.now().Sub(since)
+	if failing < time.Duration(*check.TerminalAfterSeconds)*time.Second {
+		return nil
+	}
+	return &TerminalError{Composed: cd.GetName(), Check: i, Duration: failing}
+}
+
+// forget when readiness checks in the range [from, to) started failing.
+func (f *failureTracker) forget(cd resource.Composed, from, to int) {
+	if f == nil {
+		return
+	}
+	for i := from; i < to; i++ {
+		f.since.Remove(checkKey{uid: cd.GetUID(), check: i})
+	}
+}
+
+// A successTracker tracks the number of reconciles in a row in which each
+// readiness check of a composed resource has passed. Counts are kept in memory
+// rather than on the composed resource, whose annotations may be overwritten
+// when it is applied.
+type successTracker struct {
+	counts *cache.LRUExpireCache
+}
+
+func newSuccessTracker() *successTracker {
+	return &successTracker{counts: cache.NewLRUExpireCache(maxTracked)}
+}
+
+// count whether the supplied readiness check passed, returning the number of
+// reconciles in a row in which it has passed and whether that is often enough.
+// The count stops increasing once it is sufficient. Nothing is counted by a
+// nil successTracker, so checks are ready as soon as they pass.
+func (s *successTracker) count(cd resource.Composed, i int, check v1alpha1.ReadinessCheck, ready bool) (int, bool) {
+	if s == nil || check.ConsecutiveSuccesses < 1 {
+		return 0, ready
+	}
+
+	k := checkKey{uid: cd.GetUID(), check: i}
+	if !ready {
+		s.counts.Remove(k)
+		return 0, false
+	}
+	n := 1
+	if v, ok := s.counts.Get(k); ok {
+		n = v.(int) + 1
+	}
+	if n > check.ConsecutiveSuccesses {
+		n = check.ConsecutiveSuccesses
+	}
+	s.counts.Add(k, n, trackedTTL)
+	return n, n >= check.ConsecutiveSuccesses
+}
+
+// forget how many reconciles in a row readiness checks in the range [from, to)
+// have passed.
+func (s *successTracker) forget(cd resource.Composed, from, to int) {
+	if s == nil {
+		return
+	}
+	for i := from; i < to; i++ {
+		s.counts.Remove(checkKey{uid: cd.GetUID(), check: i})
+	}
+}
+
+// A generationTracker tracks the generation of each composed resource that was
+// last seen by each of its ObservedGeneration readiness checks. Generations are
+// kept in memory rather than on the composed resource, whose annotations may
+// be overwritten when it is applied.
+type generationTracker struct {
+	generations *cache.LRUExpireCache
+}
+
+func newGenerationTracker() *generationTracker {
+	return &generationTracker{generations: cache.NewLRUExpireCache(maxTracked)}
+}
+
+// observe records the generation of the supplied composed resource as seen by
+// the readiness check at the supplied index, returning true if it is unchanged
+// since the check was last evaluated. Nothing is recorded by a nil
+// generationTracker, so generations are always considered unchanged.
+func (g *generationTracker) observe(cd resource.Composed, i int) bool {
+	if g == nil {
+		return true
+	}
+	k := checkKey{uid: cd.GetUID(), check: i}
+	v, ok := g.generations.Get(k)
+	g.generations.Add(k, cd.GetGeneration(), trackedTTL)
+	return ok && v.(int64) == cd.GetGeneration()
+}
+
+// forget the generations last seen by readiness checks in the range [from, to).
+func (g *generationTracker) forget(cd resource.Composed, from, to int) {
+	if g == nil {
+		return
+	}
+	for i := from; i < to; i++ {
+		g.generations.Remove(checkKey{uid: cd.GetUID(), check: i})
+	}
+}
+
+func isReady(ctx context.Context, cd resource.Composed, paved *fieldpath.Paved, i int, check v1alpha1.ReadinessCheck, generations *generationTracker, regexps *regexpCache) (bool, error) { // nolint:gocyclo
+	// NOTE(muvaf): The cyclomatic complexity of this function comes from the
+	// mandatory repetitiveness of the switch clause, which is not really complex
+	// in reality. Though beware of adding additional complexity besides that.
+
+	switch check.Type {
+	case v1alpha1.ReadinessCheckNonEmpty:
+		_, err := paved.GetValue(check.FieldPath)
+		if resource.Ignore(fieldpath.IsNotFound, err) != nil {
+			return false, err
+		}
+		return !fieldpath.IsNotFound(err), nil
+	case v1alpha1.ReadinessCheckNonEmptyCollection:
+		val, err := paved.GetValue(check.FieldPath)
+		if fieldpath.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		n, err := asCollection(check.FieldPath, val)
+		return n > 0, err
+	case v1alpha1.ReadinessCheckMatchAll, v1alpha1.ReadinessCheckMatchAny:
+		return matchWildcard(paved, check)
+	case v1alpha1.ReadinessCheckReadyAndNonEmpty:
+		_, err := paved.GetValue(check.FieldPath)
+		if resource.Ignore(fieldpath.IsNotFound, err) != nil {
+			return false, err
+		}
+		return !fieldpath.IsNotFound(err) && resource.IsConditionTrue(cd.GetCondition(runtimev1alpha1.TypeReady)), nil
+	case v1alpha1.ReadinessCheckMatchFieldPath:
+		val, err := paved.GetValue(check.FieldPath)
+		if resource.Ignore(fieldpath.IsNotFound, err) != nil {
+			return false, err
+		}
+		if fieldpath.IsNotFound(err) {
+			return false, nil
+		}
+		want, err := paved.GetValue(check.MatchFieldPath)
+		if resource.Ignore(fieldpath.IsNotFound, err) != nil {
+			return false, err
+		}
+		return !fieldpath.IsNotFound(err) && reflect.DeepEqual(val, want), nil
+	case v1alpha1.ReadinessCheckMatchString:
+		val, err := paved.GetString(check.FieldPath)
+		if resource.Ignore(fieldpath.IsNotFound, err) != nil {
+			return false, err
+		}
+		if check.MatchStrings != nil || check.MatchStringsFromCompositeFieldPath != "" {
+			return !fieldpath.IsNotFound(err) && contains(check.MatchStrings, val), nil
+		}
+		return !fieldpath.IsNotFound(err) && val == check.MatchString, nil
+	case v1alpha1.ReadinessCheckMatchCompositionRevision:
+		// MatchString is rendered from the composite resource. Composite
+		// resources that don't record a revision are not using revisions.
+		if check.MatchString == "" {
+			return true, nil
+		}
+		val, err := paved.GetString(check.FieldPath)
+		if resource.Ignore(fieldpath.IsNotFound, err) != nil {
+			return false, err
+		}
+		return !fieldpath.IsNotFound(err) && val == check.MatchString, nil
+	case v1alpha1.ReadinessCheckNoFinalizers:
+		present, err := paved.GetStringArray("metadata.finalizers")
+		if resource.Ignore(fieldpath.IsNotFound, err) != nil {
+			return false, err
+		}
+		for _, f := range present {
+			if contains(check.Finalizers, f) {
+				return false, nil
+			}
+		}
+		return true, nil
+	case v1alpha1.ReadinessCheckMatchRegex:
+		re, err := regexps.compile(check.MatchRegex)
+		if err != nil {
+			return false, errors.Wrapf(err, errFmtCompileRegex, i, check.MatchRegex)
+		}
+		val, err := paved.GetString(check.FieldPath)
+		if resource.Ignore(fieldpath.IsNotFound, err) != nil {
+			return false, err
+		}
+		return !fieldpath.IsNotFound(err) && re.MatchString(val), nil
+	case v1alpha1.ReadinessCheckMatchCondition:
+		if check.MatchCondition == nil {
+			return false, errors.Errorf(errFmtNoMatchCondition, i)
+		}
+		want := check.MatchCondition.Status
+		if want == "" {
+			want = corev1.ConditionTrue
+		}
+		// Resources without a status report an empty condition, rather than
+		// one with status Unknown.
+		got := cd.GetCondition(check.MatchCondition.Type).Status
+		if got == "" {
+			got = corev1.ConditionUnknown
+		}
+		return got == want, nil
+	case v1alpha1.ReadinessCheckObservedGeneration:
+		return observedGeneration(cd, paved, i, check, generations)
+	case v1alpha1.ReadinessCheckMatchBool:
+		val, err := paved.GetBool(check.FieldPath)
+		if resource.Ignore(fieldpath.IsNotFound, err) != nil {
+			return false, err
+		}
+		return !fieldpath.IsNotFound(err) && val == check.MatchBool, nil
+	case v1alpha1.ReadinessCheckMatchInteger:
+		val, err := getInteger(paved, check)
+		if fieldpath.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return val == check.MatchInteger, nil
+	case v1alpha1.ReadinessCheckGreaterThan, v1alpha1.ReadinessCheckLessThan:
+		val, err := getInteger(paved, check)
+		if fieldpath.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, errors.Wrapf(err, errFmtCompareInteger, i, check.FieldPath, check.MatchInteger)
+		}
+		if check.Type == v1alpha1.ReadinessCheckGreaterThan {
+			return val > check.MatchInteger, nil
+		}
+		return val < check.MatchInteger, nil
+	case v1alpha1.ReadinessCheckMatchFloat:
+		val, err := getNumber(paved, check.FieldPath)
+		if fieldpath.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, errors.Wrapf(err, errFmtMatchFloat, i, check.FieldPath, check.MatchFloat)
+		}
+		return math.Abs(val-check.MatchFloat) <= check.Tolerance, nil
+	case v1alpha1.ReadinessCheckGroup:
+		return groupReady(ctx, cd, paved, i, check.Group, generations, regexps)
+	case v1alpha1.ReadinessCheckWebhook:
+		r, err := webhookReady(ctx, paved, check.Webhook)
+		if err != nil && (check.Webhook == nil || !check.Webhook.NotReadyOnError) {
+			return false, errors.Wrapf(err, errFmtWebhookCheck, i)
+		}
+		return err == nil && r, nil
+	default:
+		return false, errors.New(fmt.Sprintf("readiness check at index %d: an unknown type is chosen", i))
+	}
+}
+
+// DefaultEventWindow is the default period within which a Warning event must
+// have last occurred in order to be considered by the EventReadinessChecker.
+const DefaultEventWindow = 5 * time.Minute
+
+// NewEventReadinessChecker returns an EventReadinessChecker that considers a
+// composed resource to be not ready if it was considered ready by the supplied
+// ReadinessProber, but has a recent Warning event with one of the supplied
+// reasons. Events are listed using the supplied reader, which should not be
+// backed by a cache, for example the API reader of a controller manager.
+// Listing events through a cache would start an informer that caches every
+// event in the cluster.
+func NewEventReadinessChecker(c client.Reader, rp ReadinessProber, reasons []string) *EventReadinessChecker {
+	r := make(map[string]bool, len(reasons))
+	for _, reason := range reasons {
+		r[reason] = true
+	}
+	return &EventReadinessChecker{client: c, prober: rp, reasons: r, window: DefaultEventWindow}
+}
+
+// An EventReadinessChecker inspects the Warning events recorded for a composed
+// resource in order to surface failures that are not reflected in its status,
+// for example a provider failing to create the external resource.
+type EventReadinessChecker struct {
+	client  client.Reader
+	prober  ReadinessProber
+	reasons map[string]bool
+	window  time.Duration
+}
+
+// IsReady returns whether the composed resource is ready.
+func (c *EventReadinessChecker) IsReady(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (bool, error) {
+	ready, err := c.prober.IsReady(ctx, cd, t)
+	if err != nil || !ready {
+		return ready, err
+	}
+
+	// A composed resource that has not yet been created can't have events.
+	if cd.GetUID() == "" {
+		return true, nil
+	}
+
+	// Events of cluster scoped resources are recorded in the default namespace.
+	ns := cd.GetNamespace()
+	if ns == "" {
+		ns = metav1.NamespaceDefault
+	}
+
+	// The API server only returns the events of the composed resource.
+	l := &corev1.EventList{}
+	if err := c.client.List(ctx, l, client.InNamespace(ns), client.MatchingFields{fieldInvolvedObjectUID: string(cd.GetUID())}); err != nil {
+		return false, errors.Wrap(err, errListEvents)
+	}
+
+	since := time.Now().Add(-c.window)
+	for _, e := range l.Items {
+		if e.InvolvedObject.UID != cd.GetUID() || e.Type != corev1.EventTypeWarning || !c.reasons[e.Reason] {
+			continue
+		}
+		if lastObserved(e).Before(since) {
+			continue
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// fieldInvolvedObjectUID is the field selector of the UID of the object an
+// event was recorded for.
+const fieldInvolvedObjectUID = "involvedObject.uid"
+
+// lastObserved returns when the supplied event last occurred. Events recorded
+// using the events.k8s.io API set their event time and, once they recur, their
+// series rather than their last timestamp.
+func lastObserved(e corev1.Event) time.Time {
+	if e.Series != nil && !e.Series.LastObservedTime.IsZero() {
+		return e.Series.LastObservedTime.Time
+	}
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp.Time
+	}
+	return e.EventTime.Time
+}
+
+// getNumber returns the numeric value at the supplied field path. Integers are
+// converted to floating point numbers, because numbers that happen to be whole
+// are unmarshalled as integers.
+func getNumber(paved *fieldpath.Paved, path string) (float64, error) {
+	v, err := paved.GetValue(path)
+	if err != nil {
+		return 0, err
+	}
+	switch t := v.(type) {
+	case float64:
+		return t, nil
+	case int64:
+		return float64(t), nil
+	default:
+		return 0, errors.Errorf(errFmtNotNumber, path)
+	}
+}
+
+// asInteger returns the supplied value of the supplied field path if it is an
+// integer, or an error describing the type of the value if it is not.
+func asInteger(path string, v interface{}) (int64, error) {
+	switch t := v.(type) {
+	case int64:
+		return t, nil
+	case string:
+		if _, err := strconv.ParseInt(t, 10, 64); err == nil {
+			return 0, errors.Errorf(errFmtQuotedInteger, path)
+		}
+	}
+	return 0, errors.Errorf(errFmtNotInteger, path, v1alpha1.JSONType(v))
+}
+
+// asCollection returns the number of elements of the supplied value at the
+// supplied field path, or an error if it is not an array or object.
+func asCollection(path string, v interface{}) (int, error) {
+	switch t := v.(type) {
+	case []interface{}:
+		return len(t), nil
+	case map[string]interface{}:
+		return len(t), nil
+	}
+	return 0, errors.Errorf(errFmtNotCollection, path, v1alpha1.JSONType(v))
+}
+
+// matchWildcard returns true if every (MatchAll) or any (MatchAny) string
+// value at the possibly wildcarded field path of the supplied readiness check
+// is equal to its MatchString. It returns false if the field path matches no
+// values, for example because it expands an empty array.
+func matchWildcard(paved *fieldpath.Paved, check v1alpha1.ReadinessCheck) (bool, error) {
+	paths, err := expandWildcards(paved, check.FieldPath)
+	if err != nil {
+		return false, errors.Wrapf(err, errFmtExpandWildcards, check.FieldPath)
+	}
+	if len(paths) == 0 {
+		return false, nil
+	}
+	matched := 0
+	for _, p := range paths {
+		val, err := paved.GetString(p)
+		if resource.Ignore(fieldpath.IsNotFound, err) != nil {
+			return false, err
+		}
+		if !fieldpath.IsNotFound(err) && val == check.MatchString {
+			matched++
+		}
+	}
+	if check.Type == v1alpha1.ReadinessCheckMatchAny {
+		return matched > 0, nil
+	}
+	return matched == len(paths), nil
+}
+
+// expandWildcards returns the field paths the supplied field path expands to
+// by replacing each [*] segment with every index of an array, or every key of
+// an object, at that position. Keys of objects are expanded in sorted order.
+// Prefixes that do not exist expand to no field paths, and a field path
+// without wildcards expands to itself.
+func expandWildcards(paved *fieldpath.Paved, path string) ([]string, error) {
+	segments, err := fieldpath.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	expanded := []fieldpath.Segments{{}}
+	for _, s := range segments {
+		if s.Type != fieldpath.SegmentField || s.Field != "*" {
+			for i := range expanded {
+				expanded[i] = append(expanded[i], s)
+			}
+			continue
+		}
+		next := make([]fieldpath.Segments, 0, len(expanded))
+		for _, prefix := range expanded {
+			v, err := valueAt(paved, prefix)
+			if fieldpath.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			switch t := v.(type) {
+			case []interface{}:
+				for i := range t {
+					next = append(next, append(append(fieldpath.Segments{}, prefix...), fieldpath.Segment{Type: fieldpath.SegmentIndex, Index: uint(i)}))
+				}
+			case map[string]interface{}:
+				keys := make([]string, 0, len(t))
+				for k := range t {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					next = append(next, append(append(fieldpath.Segments{}, prefix...), fieldpath.Field(k)))
+				}
+			default:
+				return nil, errors.Errorf(errFmtNotCollection, prefix.String(), v1alpha1.JSONType(v))
+			}
+		}
+		expanded = next
+	}
+	paths := make([]string, len(expanded))
+	for i, s := range expanded {
+		paths[i] = s.String()
+	}
+	return paths, nil
+}
+
+// valueAt returns the value at the supplied segments, which may be empty to
+// address the whole object.
+func valueAt(paved *fieldpath.Paved, s fieldpath.Segments) (interface{}, error) {
+	if len(s) == 0 {
+		return paved.UnstructuredContent(), nil
+	}
+	return paved.GetValue(s.String())
+}
+
+// getInteger returns the integer value at the field path of the supplied
+// readiness check, optionally parsing it as a resource quantity.
+func getInteger(paved *fieldpath.Paved, check v1alpha1.ReadinessCheck) (int64, error) {
+	v, err := paved.GetValue(check.FieldPath)
+	if err != nil {
+		return 0, err
+	}
+	if !check.AsQuantity {
+		return asInteger(check.FieldPath, v)
+	}
+	var raw string
+	switch t := v.(type) {
+	case int64:
+		return t, nil
+	case float64:
+		raw = strconv.FormatFloat(t, 'f', -1, 64)
+	case string:
+		raw = t
+	default:
+		return 0, errors.Errorf(errFmtNotQuantity, check.FieldPath)
+	}
+	q, err := kresource.ParseQuantity(raw)
+	if err != nil {
+		return 0, errors.Wrapf(err, errFmtParseQuantity, check.FieldPath)
+	}
+
+	// Value rounds fractional quantities up to the nearest integer.
+	return q.Value(), nil
 }
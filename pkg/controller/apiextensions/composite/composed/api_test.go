@@ -18,22 +18,35 @@ package composed
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	runtimecomposed "github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composed"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composite"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
 	v1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	kresource "k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
 	"github.com/crossplane/crossplane-runtime/pkg/reconciler/managed"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
 	"github.com/crossplane/crossplane-runtime/pkg/resource/fake"
@@ -44,10 +57,69 @@ import (
 
 var errBoom = errors.New("boom")
 
+func TestValidateNamePrefix(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		cp     resource.Composite
+		want   error
+	}{
+		"Present": {
+			reason: "A composite resource with the name prefix label should be valid",
+			cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{Name: "cool", Labels: map[string]string{
+				LabelKeyNamePrefixForComposed: "cool",
+			}}},
+		},
+		"Absent": {
+			reason: "A composite resource without the name prefix label should be invalid",
+			cp:     &fake.Composite{ObjectMeta: metav1.ObjectMeta{Name: "cool"}},
+			want:   &MissingLabelError{Composite: "cool", Key: LabelKeyNamePrefixForComposed},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateNamePrefix(tc.cp)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nValidateNamePrefix(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want != nil, IsMissingLabel(errors.Wrap(err, "wrapped"))); diff != "" {
+				t.Errorf("\n%s\nIsMissingLabel(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want != nil, errors.Is(errors.Wrap(err, "wrapped"), ErrMissingNamePrefix)); diff != "" {
+				t.Errorf("\n%s\nerrors.Is(..., ErrMissingNamePrefix): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
 func TestConfigure(t *testing.T) {
 
 	tmpl, _ := json.Marshal(&fake.Managed{})
 
+	labels := map[string]string{
+		LabelKeyNamePrefixForComposed: "ola",
+		LabelKeyClaimName:             "rola",
+		LabelKeyClaimNamespace:        "rolans",
+	}
+	withSpec := func(spec map[string]interface{}, o ...func(*runtimecomposed.Unstructured)) *runtimecomposed.Unstructured {
+		cd := runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+			r.Object = map[string]interface{}{"apiVersion": "example.org/v1", "kind": "Thing", "spec": spec}
+		})
+		for _, fn := range o {
+			fn(cd)
+		}
+		return cd
+	}
+	named := func(r *runtimecomposed.Unstructured) { r.SetName("cd") }
+	configured := func(r *runtimecomposed.Unstructured) {
+		r.SetLabels(labels)
+		r.SetGenerateName("ola-")
+		r.SetName("cd")
+		r.SetNamespace("rolans")
+	}
+	sparse := []byte(`{"apiVersion":"example.org/v1","kind":"Thing","spec":{"field":"new"}}`)
+	merge := v1alpha1.BaseMergeModeMerge
+	replace := v1alpha1.BaseMergeModeReplace
+
 	type args struct {
 		cp resource.Composite
 		cd resource.Composed
@@ -65,6 +137,7 @@ func TestConfigure(t *testing.T) {
 		"InvalidTemplate": {
 			reason: "Invalid template should not be accepted",
 			args: args{
+				cp: &fake.Composite{},
 				cd: &fake.Composed{},
 				t:  v1alpha1.ComposedTemplate{Base: runtime.RawExtension{Raw: []byte("olala")}},
 			},
@@ -82,7 +155,7 @@ func TestConfigure(t *testing.T) {
 			},
 			want: want{
 				cd:  &fake.Composed{ObjectMeta: metav1.ObjectMeta{Name: "cd"}},
-				err: errors.New(errNamePrefix),
+				err: &MissingLabelError{Key: LabelKeyNamePrefixForComposed},
 			},
 		},
 		"Success": {
@@ -97,301 +170,4586 @@ func TestConfigure(t *testing.T) {
 				t:  v1alpha1.ComposedTemplate{Base: runtime.RawExtension{Raw: tmpl}},
 			},
 			want: want{
-				cd: &fake.Composed{ObjectMeta: metav1.ObjectMeta{Name: "cd", GenerateName: "ola-", Labels: map[string]string{
+				cd: &fake.Composed{ObjectMeta: metav1.ObjectMeta{Name: "cd", GenerateName: "ola-", Namespace: "rolans", Labels: map[string]string{
 					LabelKeyNamePrefixForComposed: "ola",
 					LabelKeyClaimName:             "rola",
 					LabelKeyClaimNamespace:        "rolans",
 				}}},
 			},
 		},
-	}
-	for name, tc := range cases {
-		t.Run(name, func(t *testing.T) {
-			c := &DefaultConfigurator{}
-			err := c.Configure(tc.args.cp, tc.args.cd, tc.args.t)
-			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
-				t.Errorf("\n%s\nConfigure(...): -want, +got:\n%s", tc.reason, diff)
-			}
-			if diff := cmp.Diff(tc.want.cd, tc.args.cd); diff != "" {
-				t.Errorf("\n%s\nConfigure(...): -want, +got:\n%s", tc.reason, diff)
-			}
-		})
-	}
-}
-
-func TestFetch(t *testing.T) {
-
-	sref := &runtimev1alpha1.SecretReference{Name: "foo", Namespace: "bar"}
-	s := &v1.Secret{
-		Data: map[string][]byte{
-			"foo": []byte("a"),
-			"bar": []byte("b"),
-		},
-	}
-
-	type args struct {
-		kube client.Client
-		cd   resource.Composed
-		t    v1alpha1.ComposedTemplate
-	}
-	type want struct {
-		conn managed.ConnectionDetails
-		err  error
-	}
-	cases := map[string]struct {
-		reason string
-		args
-		want
-	}{
-		"DoesNotPublish": {
-			reason: "Should not fail if composed resource doesn't publish a connection secret",
+		"NamedTemplate": {
+			reason: "The name of the template should be recorded in an annotation",
 			args: args{
-				cd: &fake.Composed{},
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: labels}},
+				cd: &fake.Composed{ObjectMeta: metav1.ObjectMeta{Name: "cd"}},
+				t:  v1alpha1.ComposedTemplate{Name: pointer.StringPtr("database"), Base: runtime.RawExtension{Raw: tmpl}},
+			},
+			want: want{
+				cd: &fake.Composed{ObjectMeta: metav1.ObjectMeta{
+					Name:         "cd",
+					Namespace:    "rolans",
+					GenerateName: "ola-",
+					Labels:       labels,
+					Annotations:  map[string]string{AnnotationKeyCompositionResourceName: "database"},
+				}},
 			},
 		},
-		"SecretNotPublishedYet": {
-			reason: "Should not fail if composed resource has yet to publish the secret",
+		"PropagateLabels": {
+			reason: "Labels of the composite listed by the template should be propagated, while missing labels should be skipped",
 			args: args{
-				kube: &test.MockClient{MockGet: test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, ""))},
-				cd: &fake.Composed{
-					ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: sref},
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+					LabelKeyNamePrefixForComposed: "ola",
+					"example.org/team":            "platform",
+					"example.org/unlisted":        "nope",
+				}}},
+				cd: &fake.Composed{},
+				t: v1alpha1.ComposedTemplate{
+					Base:            runtime.RawExtension{Raw: tmpl},
+					PropagateLabels: []string{"example.org/team", "example.org/cost-center"},
 				},
-				t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
-					{
-						FromConnectionSecretKey: pointer.StringPtr("bar"),
-					},
-					{
-						Name:  pointer.StringPtr("fixed"),
-						Value: pointer.StringPtr("value"),
-					},
-				}},
 			},
 			want: want{
-				conn: managed.ConnectionDetails{
-					"fixed": []byte("value"),
-				},
+				cd: &fake.Composed{ObjectMeta: metav1.ObjectMeta{GenerateName: "ola-", Labels: map[string]string{
+					LabelKeyNamePrefixForComposed: "ola",
+					LabelKeyClaimName:             "",
+					LabelKeyClaimNamespace:        "",
+					"example.org/team":            "platform",
+				}}},
 			},
 		},
-		"SecretGetFailed": {
-			reason: "Should fail if secret retrieval results in some error other than NotFound",
+		"SkipCompositionLabels": {
+			reason: "Composition labels should not be propagated to composed resources that opt out, unless they are explicitly listed",
 			args: args{
-				kube: &test.MockClient{MockGet: test.NewMockGetFn(errBoom)},
-				cd: &fake.Composed{
-					ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: sref},
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: labels}},
+				cd: &fake.Composed{},
+				t: v1alpha1.ComposedTemplate{
+					Base:                       runtime.RawExtension{Raw: tmpl},
+					PropagateCompositionLabels: pointer.BoolPtr(false),
+					PropagateLabels:            []string{LabelKeyClaimName},
 				},
 			},
 			want: want{
-				err: errors.Wrap(errBoom, errGetSecret),
+				cd: &fake.Composed{ObjectMeta: metav1.ObjectMeta{GenerateName: "ola-", Namespace: "rolans", Labels: map[string]string{
+					LabelKeyClaimName: "rola",
+				}}},
 			},
 		},
-		"Success": {
-			reason: "Should publish only the selected set of secret keys",
+		"PropagateAnnotations": {
+			reason: "Annotations of the composite listed by the template should be propagated, unless the base template sets them",
 			args: args{
-				kube: &test.MockClient{MockGet: func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
-					if sobj, ok := obj.(*v1.Secret); ok {
-						if key.Name == sref.Name && key.Namespace == sref.Namespace {
-							s.DeepCopyInto(sobj)
-							return nil
-						}
-					}
-					t.Errorf("wrong secret is queried")
-					return errBoom
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{LabelKeyNamePrefixForComposed: "ola"},
+					Annotations: map[string]string{
+						"example.com/owner":       "platform",
+						"example.com/environment": "prod",
+						"example.com/unlisted":    "nope",
+					},
 				}},
-				cd: &fake.Composed{
-					ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: sref},
+				cd: &fake.Composed{},
+				t: v1alpha1.ComposedTemplate{
+					Base: runtime.RawExtension{Raw: func() []byte {
+						b, _ := json.Marshal(&fake.Managed{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"example.com/environment": "dev"}}})
+						return b
+					}()},
+					PropagateAnnotations: []string{"example.com/owner", "example.com/environment", "example.com/missing"},
 				},
-				t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
-					{
-						FromConnectionSecretKey: pointer.StringPtr("bar"),
-					},
-					{
-						FromConnectionSecretKey: pointer.StringPtr("none"),
-					},
-					{
-						Name:                    pointer.StringPtr("convfoo"),
-						FromConnectionSecretKey: pointer.StringPtr("foo"),
-					},
-					{
-						Name:  pointer.StringPtr("fixed"),
-						Value: pointer.StringPtr("value"),
-					},
-					{
-						// Entries with only a name are silently ignored.
-						Name: pointer.StringPtr("missingvalue"),
+			},
+			want: want{
+				cd: &fake.Composed{ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "ola-",
+					Labels: map[string]string{
+						LabelKeyNamePrefixForComposed: "ola",
+						LabelKeyClaimName:             "",
+						LabelKeyClaimNamespace:        "",
 					},
-					{
-						// Entries with only a value are silently ignored.
-						Value: pointer.StringPtr("missingname"),
+					Annotations: map[string]string{
+						"example.com/owner":       "platform",
+						"example.com/environment": "dev",
 					},
 				}},
 			},
-			want: want{
-				conn: managed.ConnectionDetails{
-					"convfoo": s.Data["foo"],
-					"bar":     s.Data["bar"],
-					"fixed":   []byte("value"),
+		},
+		"PropagateExternalName": {
+			reason: "The external name of the composite should be propagated if the template opts in",
+			args: args{
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{
+					Labels:      map[string]string{LabelKeyNamePrefixForComposed: "ola"},
+					Annotations: map[string]string{meta.AnnotationKeyExternalName: "existing-bucket"},
+				}},
+				cd: &fake.Composed{},
+				t: v1alpha1.ComposedTemplate{
+					Base:                  runtime.RawExtension{Raw: tmpl},
+					PropagateExternalName: pointer.BoolPtr(true),
 				},
 			},
+			want: want{
+				cd: &fake.Composed{ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "ola-",
+					Labels: map[string]string{
+						LabelKeyNamePrefixForComposed: "ola",
+						LabelKeyClaimName:             "",
+						LabelKeyClaimNamespace:        "",
+					},
+					Annotations: map[string]string{meta.AnnotationKeyExternalName: "existing-bucket"},
+				}},
+			},
 		},
-	}
-	for name, tc := range cases {
-		t.Run(name, func(t *testing.T) {
-			c := &APIConnectionDetailsFetcher{client: tc.args.kube}
-			conn, err := c.Fetch(context.Background(), tc.args.cd, tc.args.t)
-			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
-				t.Errorf("\n%s\nFetch(...): -want, +got:\n%s", tc.reason, diff)
-			}
-			if diff := cmp.Diff(tc.want.conn, conn); diff != "" {
-				t.Errorf("\n%s\nFetch(...): -want, +got:\n%s", tc.reason, diff)
-			}
-		})
-	}
-}
-
-func TestIsReady(t *testing.T) {
-	type args struct {
-		cd *runtimecomposed.Unstructured
-		t  v1alpha1.ComposedTemplate
-	}
-	type want struct {
-		ready bool
-		err   error
-	}
-	cases := map[string]struct {
-		reason string
-		args
-		want
-	}{
-		"NoCustomCheck": {
-			reason: "If no custom check is given, Ready condition should be used",
+		"PreserveExternalName": {
+			reason: "The external name a composed resource already has should not be overwritten by that of the base template or the composite",
 			args: args{
-				cd: runtimecomposed.New(runtimecomposed.WithConditions(runtimev1alpha1.Available())),
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{
+					Labels:      map[string]string{LabelKeyNamePrefixForComposed: "ola"},
+					Annotations: map[string]string{meta.AnnotationKeyExternalName: "existing-bucket"},
+				}},
+				cd: withSpec(nil, named, func(r *runtimecomposed.Unstructured) {
+					meta.SetExternalName(r, "cd-abc12")
+				}),
+				t: v1alpha1.ComposedTemplate{
+					Base:                  runtime.RawExtension{Raw: []byte(`{"apiVersion":"example.org/v1","kind":"Thing","metadata":{"annotations":{"crossplane.io/external-name":"from-template"}},"spec":{"field":"new"}}`)},
+					PropagateExternalName: pointer.BoolPtr(true),
+				},
 			},
 			want: want{
-				ready: true,
+				cd: withSpec(map[string]interface{}{"field": "new"}, func(r *runtimecomposed.Unstructured) {
+					r.SetLabels(map[string]string{
+						LabelKeyNamePrefixForComposed: "ola",
+						LabelKeyClaimName:             "",
+						LabelKeyClaimNamespace:        "",
+					})
+					r.SetGenerateName("ola-")
+					r.SetName("cd")
+					meta.SetExternalName(r, "cd-abc12")
+				}),
 			},
 		},
-		"NonEmptyErr": {
-			reason: "If the value cannot be fetched due to fieldPath being misconfigured, error should be returned",
+		"NamePrefixOverride": {
+			reason: "The name prefix override of the template should be used for generateName",
 			args: args{
-				cd: runtimecomposed.New(),
-				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "NonEmpty", FieldPath: "metadata..uid"}}},
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+					LabelKeyNamePrefixForComposed: "ola",
+				}}},
+				cd: &fake.Composed{},
+				t: v1alpha1.ComposedTemplate{
+					Base:               runtime.RawExtension{Raw: tmpl},
+					NamePrefixOverride: pointer.StringPtr("ola-db"),
+				},
 			},
 			want: want{
-				err: errors.Wrapf(errors.New("unexpected '.' at position 9"), "cannot parse path %q", "metadata..uid"),
+				cd: &fake.Composed{ObjectMeta: metav1.ObjectMeta{GenerateName: "ola-db-", Labels: map[string]string{
+					LabelKeyNamePrefixForComposed: "ola",
+					LabelKeyClaimName:             "",
+					LabelKeyClaimNamespace:        "",
+				}}},
 			},
 		},
-		"NonEmptyFalse": {
-			reason: "If the field does not have value, NonEmpty check should return false",
+		"EmptyNamePrefixOverride": {
+			reason: "The name prefix label should be used for generateName if the override is empty",
 			args: args{
-				cd: runtimecomposed.New(),
-				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "NonEmpty", FieldPath: "metadata.uid"}}},
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+					LabelKeyNamePrefixForComposed: "ola",
+				}}},
+				cd: &fake.Composed{},
+				t: v1alpha1.ComposedTemplate{
+					Base:               runtime.RawExtension{Raw: tmpl},
+					NamePrefixOverride: pointer.StringPtr(""),
+				},
 			},
 			want: want{
-				ready: false,
+				cd: &fake.Composed{ObjectMeta: metav1.ObjectMeta{GenerateName: "ola-", Labels: map[string]string{
+					LabelKeyNamePrefixForComposed: "ola",
+					LabelKeyClaimName:             "",
+					LabelKeyClaimNamespace:        "",
+				}}},
 			},
 		},
-		"NonEmptyTrue": {
-			reason: "If the field does have a value, NonEmpty check should return true",
+		"ReplaceBase": {
+			reason: "The base template should replace the existing content of the composed resource by default",
 			args: args{
-				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
-					r.SetUID("olala")
-				}),
-				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "NonEmpty", FieldPath: "metadata.uid"}}},
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: labels}},
+				cd: withSpec(map[string]interface{}{"default": "provider", "field": "old"}, named),
+				t:  v1alpha1.ComposedTemplate{Base: runtime.RawExtension{Raw: sparse}},
 			},
 			want: want{
-				ready: true,
+				cd: withSpec(map[string]interface{}{"field": "new"}, configured),
 			},
 		},
-		"MatchStringErr": {
-			reason: "If the value cannot be fetched due to fieldPath being misconfigured, error should be returned",
+		"ClaimNamespace": {
+			reason: "A composed resource whose template does not specify a namespace should be created in the claim namespace",
 			args: args{
-				cd: runtimecomposed.New(),
-				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchString", FieldPath: "metadata..uid"}}},
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: labels}},
+				cd: withSpec(map[string]interface{}{}),
+				t:  v1alpha1.ComposedTemplate{Base: runtime.RawExtension{Raw: sparse}},
 			},
 			want: want{
-				err: errors.Wrapf(errors.New("unexpected '.' at position 9"), "cannot parse path %q", "metadata..uid"),
+				cd: withSpec(map[string]interface{}{"field": "new"}, func(r *runtimecomposed.Unstructured) {
+					r.SetLabels(labels)
+					r.SetGenerateName("ola-")
+					r.SetNamespace("rolans")
+				}),
 			},
 		},
-		"MatchStringFalse": {
-			reason: "If the value of the field does not match, it should return false",
+		"TemplateNamespace": {
+			reason: "A namespace specified by the base template should take precedence over the claim namespace",
 			args: args{
-				cd: runtimecomposed.New(),
-				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchString", FieldPath: "metadata.uid", MatchString: "olala"}}},
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: labels}},
+				cd: withSpec(map[string]interface{}{}, named),
+				t:  v1alpha1.ComposedTemplate{Base: runtime.RawExtension{Raw: []byte(`{"apiVersion":"example.org/v1","kind":"Thing","metadata":{"namespace":"shared"},"spec":{"field":"new"}}`)}},
 			},
 			want: want{
-				ready: false,
+				cd: withSpec(map[string]interface{}{"field": "new"}, configured, func(r *runtimecomposed.Unstructured) {
+					r.SetNamespace("shared")
+				}),
 			},
 		},
-		"MatchStringTrue": {
-			reason: "If the value of the field does match, it should return true",
+		"ExistingNamespace": {
+			reason: "The name and namespace of an existing composed resource should be preserved",
 			args: args{
-				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
-					r.SetUID("olala")
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: labels}},
+				cd: withSpec(map[string]interface{}{}, named, func(r *runtimecomposed.Unstructured) {
+					r.SetNamespace("existing")
 				}),
-				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchString", FieldPath: "metadata.uid", MatchString: "olala"}}},
+				t: v1alpha1.ComposedTemplate{Base: runtime.RawExtension{Raw: []byte(`{"apiVersion":"example.org/v1","kind":"Thing","metadata":{"namespace":"shared"},"spec":{"field":"new"}}`)}},
 			},
 			want: want{
-				ready: true,
+				cd: withSpec(map[string]interface{}{"field": "new"}, configured, func(r *runtimecomposed.Unstructured) {
+					r.SetNamespace("existing")
+				}),
 			},
 		},
-		"MatchIntegerErr": {
-			reason: "If the value cannot be fetched due to fieldPath being misconfigured, error should be returned",
+		"MergeBase": {
+			reason: "The base template should be merged into the existing content of the composed resource in merge mode",
 			args: args{
-				cd: runtimecomposed.New(),
-				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchInteger", FieldPath: "metadata..uid"}}},
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: labels}},
+				cd: withSpec(map[string]interface{}{"default": "provider", "field": "old"}, named),
+				t:  v1alpha1.ComposedTemplate{Base: runtime.RawExtension{Raw: sparse}, BaseMergeMode: &merge},
 			},
 			want: want{
-				err: errors.Wrapf(errors.New("unexpected '.' at position 9"), "cannot parse path %q", "metadata..uid"),
+				cd: withSpec(map[string]interface{}{"default": "provider", "field": "new"}, configured),
 			},
 		},
-		"MatchIntegerFalse": {
-			reason: "If the value of the field does not match, it should return false",
+		"PreserveFinalizersAndStatus": {
+			reason: "The finalizers and status of an existing composed resource should survive being configured again",
 			args: args{
-				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
-					r.Object = map[string]interface{}{
-						"spec": map[string]interface{}{
-							"someNum": int64(6),
-						},
-					}
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: labels}},
+				cd: withSpec(map[string]interface{}{"field": "old"}, named, func(r *runtimecomposed.Unstructured) {
+					r.SetFinalizers([]string{"example.org/protect"})
+					r.Object["status"] = map[string]interface{}{"atProvider": map[string]interface{}{"id": "cool"}}
 				}),
-				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchInteger", FieldPath: "spec.someNum", MatchInteger: 5}}},
+				t: v1alpha1.ComposedTemplate{Base: runtime.RawExtension{Raw: sparse}},
 			},
 			want: want{
-				ready: false,
+				cd: withSpec(map[string]interface{}{"field": "new"}, configured, func(r *runtimecomposed.Unstructured) {
+					r.SetFinalizers([]string{"example.org/protect"})
+					r.Object["status"] = map[string]interface{}{"atProvider": map[string]interface{}{"id": "cool"}}
+				}),
 			},
 		},
-		"MatchIntegerTrue": {
-			reason: "If the value of the field does match, it should return true",
+		"TemplateFinalizersAndStatus": {
+			reason: "Finalizers specified by the template should be kept alongside existing ones, while a status specified by the template should not replace the existing status",
 			args: args{
-				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
-					r.Object = map[string]interface{}{
-						"spec": map[string]interface{}{
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: labels}},
+				cd: withSpec(map[string]interface{}{"field": "old"}, named, func(r *runtimecomposed.Unstructured) {
+					r.SetFinalizers([]string{"example.org/protect"})
+				}),
+				t: v1alpha1.ComposedTemplate{Base: runtime.RawExtension{Raw: []byte(`{"apiVersion":"example.org/v1","kind":"Thing","metadata":{"finalizers":["example.org/template"]},"spec":{"field":"new"},"status":{"phase":"Fake"}}`)}},
+			},
+			want: want{
+				cd: withSpec(map[string]interface{}{"field": "new"}, configured, func(r *runtimecomposed.Unstructured) {
+					r.SetFinalizers([]string{"example.org/template", "example.org/protect"})
+				}),
+			},
+		},
+		"MergeFinalizers": {
+			reason: "Finalizers specified by the template should not replace existing finalizers in merge mode",
+			args: args{
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: labels}},
+				cd: withSpec(map[string]interface{}{"field": "old"}, named, func(r *runtimecomposed.Unstructured) {
+					r.SetFinalizers([]string{"example.org/protect"})
+				}),
+				t: v1alpha1.ComposedTemplate{Base: runtime.RawExtension{Raw: []byte(`{"apiVersion":"example.org/v1","kind":"Thing","metadata":{"finalizers":["example.org/template"]},"spec":{"field":"new"}}`)}, BaseMergeMode: &merge},
+			},
+			want: want{
+				cd: withSpec(map[string]interface{}{"field": "new"}, configured, func(r *runtimecomposed.Unstructured) {
+					r.SetFinalizers([]string{"example.org/template", "example.org/protect"})
+				}),
+			},
+		},
+		"ExplicitReplaceBase": {
+			reason: "The base template should replace the existing content of the composed resource in replace mode",
+			args: args{
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: labels}},
+				cd: withSpec(map[string]interface{}{"default": "provider", "field": "old"}, named),
+				t:  v1alpha1.ComposedTemplate{Base: runtime.RawExtension{Raw: sparse}, BaseMergeMode: &replace},
+			},
+			want: want{
+				cd: withSpec(map[string]interface{}{"field": "new"}, configured),
+			},
+		},
+		"MergeInvalidBase": {
+			reason: "An invalid base template should not be merged",
+			args: args{
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: labels}},
+				cd: withSpec(map[string]interface{}{"default": "provider"}, named),
+				t:  v1alpha1.ComposedTemplate{Base: runtime.RawExtension{Raw: []byte("olala")}, BaseMergeMode: &merge},
+			},
+			want: want{
+				cd:  withSpec(map[string]interface{}{"default": "provider"}, named),
+				err: errors.Wrap(errors.New("Invalid JSON Patch"), errMergeBase),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := NewDefaultConfigurator().Configure(tc.args.cp, tc.args.cd, tc.args.t)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nConfigure(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.cd, tc.args.cd); diff != "" {
+				t.Errorf("\n%s\nConfigure(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestConfigureForceRecreate(t *testing.T) {
+	withTrigger := func(v string) map[string]interface{} {
+		return map[string]interface{}{
+			"apiVersion": "example.org/v1",
+			"kind":       "Thing",
+			"metadata":   map[string]interface{}{"annotations": map[string]interface{}{AnnotationKeyForceRecreate: v}},
+		}
+	}
+	base := func(o map[string]interface{}) runtime.RawExtension {
+		raw, _ := json.Marshal(o)
+		return runtime.RawExtension{Raw: raw}
+	}
+	composite := func(v ...string) *fake.Composite {
+		cp := &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{LabelKeyNamePrefixForComposed: "ola"}}}
+		if len(v) > 0 {
+			cp.SetAnnotations(map[string]string{AnnotationKeyForceRecreate: v[0]})
+		}
+		return cp
+	}
+
+	cases := map[string]struct {
+		reason string
+		cp     []resource.Composite
+		t      v1alpha1.ComposedTemplate
+		want   []string
+	}{
+		"NoTrigger": {
+			reason: "Composed resources should not be annotated if neither the composite nor the template has a trigger",
+			cp:     []resource.Composite{composite()},
+			t:      v1alpha1.ComposedTemplate{Base: base(map[string]interface{}{"apiVersion": "example.org/v1", "kind": "Thing"})},
+			want:   []string{""},
+		},
+		"TemplateTrigger": {
+			reason: "The trigger of the template should be propagated",
+			cp:     []resource.Composite{composite()},
+			t:      v1alpha1.ComposedTemplate{Base: base(withTrigger("1"))},
+			want:   []string{"1"},
+		},
+		"CompositeTrigger": {
+			reason: "The trigger of the composite should be propagated, taking precedence over the template",
+			cp:     []resource.Composite{composite("2")},
+			t:      v1alpha1.ComposedTemplate{Base: base(withTrigger("1"))},
+			want:   []string{"2"},
+		},
+		"CompositeTriggerBumped": {
+			reason: "Bumping the trigger of the composite should change the trigger of the composed resource",
+			cp:     []resource.Composite{composite("1"), composite("2")},
+			t:      v1alpha1.ComposedTemplate{Base: base(map[string]interface{}{"apiVersion": "example.org/v1", "kind": "Thing"})},
+			want:   []string{"1", "2"},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := &DefaultConfigurator{}
+			cd := runtimecomposed.New()
+			got := make([]string, len(tc.cp))
+			for i, cp := range tc.cp {
+				if err := c.Configure(cp, cd, tc.t); err != nil {
+					t.Fatalf("\n%s\nConfigure(...): %s", tc.reason, err)
+				}
+				got[i] = cd.GetAnnotations()[AnnotationKeyForceRecreate]
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nConfigure(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestConfigureSpecTemplate(t *testing.T) {
+	raw, _ := json.Marshal(map[string]interface{}{
+		"apiVersion": "example.org/v1",
+		"kind":       "Thing",
+		"spec":       map[string]interface{}{"region": "us-east-1", "size": "medium"},
+	})
+	base := runtime.RawExtension{Raw: raw}
+	cp := func(labels map[string]string) resource.Composite {
+		labels[LabelKeyNamePrefixForComposed] = "ola"
+		cp := composite.New()
+		cp.SetLabels(labels)
+		return cp
+	}
+	conditional := `{"size": {{ if .metadata.labels.large }}"large"{{ else }}"small"{{ end }}}`
+
+	type want struct {
+		spec map[string]interface{}
+		err  error
+	}
+	cases := map[string]struct {
+		reason string
+		cp     resource.Composite
+		t      v1alpha1.ComposedTemplate
+		want   want
+	}{
+		"NoTemplate": {
+			reason: "The spec of the base template should be unchanged if there is no spec template",
+			cp:     cp(map[string]string{}),
+			t:      v1alpha1.ComposedTemplate{Base: base},
+			want:   want{spec: map[string]interface{}{"region": "us-east-1", "size": "medium"}},
+		},
+		"ConditionTrue": {
+			reason: "The rendered spec template should be merged into the spec of the base template",
+			cp:     cp(map[string]string{"large": "true"}),
+			t:      v1alpha1.ComposedTemplate{Base: base, SpecTemplate: pointer.StringPtr(conditional)},
+			want:   want{spec: map[string]interface{}{"region": "us-east-1", "size": "large"}},
+		},
+		"ConditionFalse": {
+			reason: "Fields the composite resource does not have should evaluate to false in conditionals",
+			cp:     cp(map[string]string{}),
+			t:      v1alpha1.ComposedTemplate{Base: base, SpecTemplate: pointer.StringPtr(conditional)},
+			want:   want{spec: map[string]interface{}{"region": "us-east-1", "size": "small"}},
+		},
+		"BadSyntax": {
+			reason: "An error should be returned if the spec template cannot be parsed",
+			cp:     cp(map[string]string{}),
+			t:      v1alpha1.ComposedTemplate{Base: base, SpecTemplate: pointer.StringPtr(`{"size": {{ if }}"large"{{ end }}}`)},
+			want:   want{err: errors.Wrap(errors.New("template: spec:1: missing value for if"), errParseSpecTemplate)},
+		},
+		"NotAnObject": {
+			reason: "An error should be returned if the spec template does not render a JSON object",
+			cp:     cp(map[string]string{}),
+			t:      v1alpha1.ComposedTemplate{Base: base, SpecTemplate: pointer.StringPtr(`["{{ .kind }}"]`)},
+			want:   want{err: errors.Wrap(errors.New("json: cannot unmarshal array into Go value of type map[string]interface {}"), errSpecTemplateObject)},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cd := runtimecomposed.New()
+			err := NewDefaultConfigurator().Configure(tc.cp, cd, tc.t)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nConfigure(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.want.spec, cd.Object["spec"]); diff != "" {
+				t.Errorf("\n%s\nConfigure(...): -want spec, +got spec:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestConfigureLabelTags(t *testing.T) {
+	base := func(tags map[string]interface{}) runtime.RawExtension {
+		o := map[string]interface{}{"apiVersion": "example.org/v1", "kind": "Thing"}
+		if tags != nil {
+			o["spec"] = map[string]interface{}{"forProvider": map[string]interface{}{"tags": tags}}
+		}
+		raw, _ := json.Marshal(o)
+		return runtime.RawExtension{Raw: raw}
+	}
+	cp := &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+		LabelKeyNamePrefixForComposed: "ola",
+		"team":                        "platform",
+		"environment":                 "prod",
+	}}}
+
+	type want struct {
+		tags map[string]string
+		err  error
+	}
+	cases := map[string]struct {
+		reason string
+		o      []ConfiguratorOption
+		t      v1alpha1.ComposedTemplate
+		want   want
+	}{
+		"Disabled": {
+			reason: "Tags should not be set unless a tags path is configured",
+			t:      v1alpha1.ComposedTemplate{Base: base(nil)},
+			want:   want{},
+		},
+		"AllLabels": {
+			reason: "All labels should be mapped to tags if no keys are configured",
+			o:      []ConfiguratorOption{WithLabelTags("spec.forProvider.tags")},
+			t:      v1alpha1.ComposedTemplate{Base: base(nil)},
+			want: want{tags: map[string]string{
+				LabelKeyNamePrefixForComposed: "ola",
+				"team":                        "platform",
+				"environment":                 "prod",
+			}},
+		},
+		"SelectedLabels": {
+			reason: "Only the configured labels should be mapped to tags",
+			o:      []ConfiguratorOption{WithLabelTags("spec.forProvider.tags", "team", "environment", "missing")},
+			t:      v1alpha1.ComposedTemplate{Base: base(nil)},
+			want:   want{tags: map[string]string{"team": "platform", "environment": "prod"}},
+		},
+		"MergeExisting": {
+			reason: "Labels should be merged with existing tags, which take precedence",
+			o:      []ConfiguratorOption{WithLabelTags("spec.forProvider.tags", "team", "environment")},
+			t:      v1alpha1.ComposedTemplate{Base: base(map[string]interface{}{"environment": "staging", "cost-center": "42"})},
+			want:   want{tags: map[string]string{"team": "platform", "environment": "staging", "cost-center": "42"}},
+		},
+		"NotAnObject": {
+			reason: "An error should be returned if the tags path is not a string map",
+			o:      []ConfiguratorOption{WithLabelTags("kind", "team")},
+			t:      v1alpha1.ComposedTemplate{Base: base(nil)},
+			want:   want{err: errors.Wrapf(errors.New("kind: not an object"), errFmtLabelTags, "kind")},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := NewDefaultConfigurator(tc.o...)
+			cd := runtimecomposed.New()
+			err := c.Configure(cp, cd, tc.t)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nConfigure(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if err != nil {
+				return
+			}
+			tags, _ := fieldpath.Pave(cd.Object).GetStringObject("spec.forProvider.tags")
+			if diff := cmp.Diff(tc.want.tags, tags); diff != "" {
+				t.Errorf("\n%s\nConfigure(...): -want tags, +got tags:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestConfigureIndexed(t *testing.T) {
+	tmpl, _ := json.Marshal(&fake.Managed{})
+	cp := &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{LabelKeyNamePrefixForComposed: "ola"}}}
+	bucket := v1alpha1.ComposedTemplate{Name: pointer.StringPtr("bucket"), Base: runtime.RawExtension{Raw: tmpl}}
+	database := v1alpha1.ComposedTemplate{Name: pointer.StringPtr("database"), Base: runtime.RawExtension{Raw: tmpl}}
+	cache := v1alpha1.ComposedTemplate{NamePrefixOverride: pointer.StringPtr("cool-cache"), Base: runtime.RawExtension{Raw: tmpl}}
+
+	type instances struct {
+		t        v1alpha1.ComposedTemplate
+		existing []string
+		n        int
+	}
+	type want struct {
+		names [][]string
+		err   error
+	}
+	cases := map[string]struct {
+		reason    string
+		templates []instances
+		want      want
+	}{
+		"Initial": {
+			reason: "New instances should be named sequentially, distinctly from the instances of other templates",
+			templates: []instances{
+				{t: bucket, n: 2},
+				{t: database, n: 2},
+			},
+			want: want{names: [][]string{
+				{"ola-bucket-0", "ola-bucket-1"},
+				{"ola-database-0", "ola-database-1"},
+			}},
+		},
+		"GrowAndShrink": {
+			reason: "Existing instances should keep their names as the number of instances of each template grows or shrinks",
+			templates: []instances{
+				{t: bucket, existing: []string{"ola-bucket-0", "ola-bucket-1"}, n: 4},
+				{t: database, existing: []string{"ola-database-0", "ola-database-1"}, n: 1},
+			},
+			want: want{names: [][]string{
+				{"ola-bucket-0", "ola-bucket-1", "ola-bucket-2", "ola-bucket-3"},
+				{"ola-database-0"},
+			}},
+		},
+		"NamePrefixOverride": {
+			reason: "Instances of a template that overrides its name prefix should be named using it",
+			templates: []instances{
+				{t: cache, n: 2},
+			},
+			want: want{names: [][]string{
+				{"cool-cache-0", "cool-cache-1"},
+			}},
+		},
+		"ExistingName": {
+			reason: "An instance that is already named should not be renamed",
+			templates: []instances{
+				{t: bucket, existing: []string{"cool"}, n: 2},
+			},
+			want: want{names: [][]string{
+				{"cool", "ola-bucket-1"},
+			}},
+		},
+		"UnnamedTemplate": {
+			reason: "Instances of a template that is unnamed and doesn't override its name prefix could collide with those of other templates",
+			templates: []instances{
+				{t: v1alpha1.ComposedTemplate{Base: runtime.RawExtension{Raw: tmpl}}, n: 1},
+			},
+			want: want{err: errors.New(errIndexedUnnamed)},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := &DefaultConfigurator{}
+			got := make([][]string, len(tc.templates))
+			for j, in := range tc.templates {
+				got[j] = make([]string, in.n)
+				for i := 0; i < in.n; i++ {
+					cd := &fake.Composed{}
+					if i < len(in.existing) {
+						cd.SetName(in.existing[i])
+					}
+					err := c.ConfigureIndexed(cp, cd, in.t, i)
+					if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+						t.Fatalf("\n%s\nConfigureIndexed(...): -want error, +got error:\n%s", tc.reason, diff)
+					}
+					if err != nil {
+						return
+					}
+					got[j][i] = cd.GetName()
+				}
+			}
+			if diff := cmp.Diff(tc.want.names, got); diff != "" {
+				t.Errorf("\n%s\nConfigureIndexed(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	setIfEmpty := v1alpha1.ToFieldPathPolicySetIfEmpty
+	degrade := v1alpha1.ErrorPolicyDegrade
+	fail := v1alpha1.ErrorPolicyFail
+	required := v1alpha1.FromFieldPathPolicyRequired
+	cp := composite.New()
+	cp.SetLabels(map[string]string{"app": "cool"})
+	tiered := composite.New()
+	tiered.SetLabels(map[string]string{"app": "cool", "tier": "web"})
+	annotated := composite.New()
+	annotated.SetAnnotations(map[string]string{
+		"example.org/config": `{"network":{"region":"us-east-1","cidrs":["10.0.0.0/16"]}}`,
+		"example.org/bad":    `{oops`,
+	})
+	withSpec := func(spec map[string]interface{}) *runtimecomposed.Unstructured {
+		return runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+			r.Object = map[string]interface{}{"spec": spec}
+		})
+	}
+
+	type args struct {
+		cp resource.Composite
+		cd *runtimecomposed.Unstructured
+		t  v1alpha1.ComposedTemplate
+	}
+	type want struct {
+		cd  *runtimecomposed.Unstructured
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		args
+		want
+	}{
+		"PatchFailed": {
+			reason: "A patch that fails to apply should return an error",
+			args: args{
+				cp: cp,
+				cd: withSpec(map[string]interface{}{}),
+				t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+					{FromFieldPath: "metadata..labels"},
+				}},
+			},
+			want: want{
+				cd:  withSpec(map[string]interface{}{}),
+				err: errors.Wrapf(errors.Wrapf(errors.New("unexpected '.' at position 9"), "cannot parse path %q", "metadata..labels"), errFmtPatch, 0),
+			},
+		},
+		"Replace": {
+			reason: "By default a patch should replace the existing value",
+			args: args{
+				cp: cp,
+				cd: withSpec(map[string]interface{}{"app": "existing"}),
+				t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+					{FromFieldPath: "metadata.labels[app]", ToFieldPath: "spec.app"},
+				}},
+			},
+			want: want{
+				cd: withSpec(map[string]interface{}{"app": "cool"}),
+			},
+		},
+		"SetIfEmptyWrites": {
+			reason: "A SetIfEmpty patch should write the value if the destination is absent or empty",
+			args: args{
+				cp: cp,
+				cd: withSpec(map[string]interface{}{"name": ""}),
+				t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+					{FromFieldPath: "metadata.labels[app]", ToFieldPath: "spec.app", Policy: &v1alpha1.PatchPolicy{ToFieldPath: &setIfEmpty}},
+					{FromFieldPath: "metadata.labels[app]", ToFieldPath: "spec.name", Policy: &v1alpha1.PatchPolicy{ToFieldPath: &setIfEmpty}},
+				}},
+			},
+			want: want{
+				cd: withSpec(map[string]interface{}{"app": "cool", "name": "cool"}),
+			},
+		},
+		"JSONAnnotationNested": {
+			reason: "A patch should be able to extract a nested field from a JSON annotation",
+			args: args{
+				cp: annotated,
+				cd: withSpec(map[string]interface{}{}),
+				t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+					{FromJSONAnnotation: &v1alpha1.JSONAnnotationSource{Key: "example.org/config", FieldPath: "network.region"}, ToFieldPath: "spec.region"},
+					{FromJSONAnnotation: &v1alpha1.JSONAnnotationSource{Key: "example.org/config", FieldPath: "network.cidrs[0]"}, ToFieldPath: "spec.cidr"},
+				}},
+			},
+			want: want{
+				cd: withSpec(map[string]interface{}{"region": "us-east-1", "cidr": "10.0.0.0/16"}),
+			},
+		},
+		"JSONAnnotationMissing": {
+			reason: "A patch from an annotation that does not exist should be skipped",
+			args: args{
+				cp: cp,
+				cd: withSpec(map[string]interface{}{}),
+				t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+					{FromJSONAnnotation: &v1alpha1.JSONAnnotationSource{Key: "example.org/config", FieldPath: "network.region"}, ToFieldPath: "spec.region"},
+				}},
+			},
+			want: want{
+				cd: withSpec(map[string]interface{}{}),
+			},
+		},
+		"JSONAnnotationMalformed": {
+			reason: "A patch from an annotation that is not valid JSON should return an error naming the annotation",
+			args: args{
+				cp: annotated,
+				cd: withSpec(map[string]interface{}{}),
+				t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+					{FromJSONAnnotation: &v1alpha1.JSONAnnotationSource{Key: "example.org/bad", FieldPath: "network.region"}, ToFieldPath: "spec.region"},
+				}},
+			},
+			want: want{
+				cd:  withSpec(map[string]interface{}{}),
+				err: errors.Wrapf(errors.Wrap(errors.New("invalid character 'o' looking for beginning of object key string"), `cannot parse annotation "example.org/bad" as JSON`), errFmtPatch, 0),
+			},
+		},
+		"DeclaredOrder": {
+			reason: "Patches should be applied after the patches their order declares they follow, regardless of slice order",
+			args: args{
+				cp: tiered,
+				cd: withSpec(map[string]interface{}{}),
+				t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+					{FromFieldPath: "metadata.labels[app]", ToFieldPath: "spec.value", Order: &v1alpha1.PatchOrder{Name: "override", After: []string{"default"}}},
+					{FromFieldPath: "metadata.labels[tier]", ToFieldPath: "spec.value", Order: &v1alpha1.PatchOrder{Name: "default"}},
+				}},
+			},
+			want: want{
+				cd: withSpec(map[string]interface{}{"value": "cool"}),
+			},
+		},
+		"OrderCycle": {
+			reason: "Patches whose declared order forms a cycle should return an error without being applied",
+			args: args{
+				cp: cp,
+				cd: withSpec(map[string]interface{}{}),
+				t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+					{FromFieldPath: "metadata.labels[app]", ToFieldPath: "spec.a", Order: &v1alpha1.PatchOrder{Name: "a", After: []string{"b"}}},
+					{FromFieldPath: "metadata.labels[app]", ToFieldPath: "spec.b", Order: &v1alpha1.PatchOrder{Name: "b", After: []string{"a"}}},
+				}},
+			},
+			want: want{
+				cd:  withSpec(map[string]interface{}{}),
+				err: errors.Wrap(errors.New(errPatchCycle), errSortPatches),
+			},
+		},
+		"ErrorPolicyFail": {
+			reason: "A failed patch whose error policy is Fail should return an error without applying subsequent patches",
+			args: args{
+				cp: annotated,
+				cd: withSpec(map[string]interface{}{}),
+				t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+					{FromJSONAnnotation: &v1alpha1.JSONAnnotationSource{Key: "example.org/bad"}, ToFieldPath: "spec.bad", Policy: &v1alpha1.PatchPolicy{Error: &fail}},
+					{FromJSONAnnotation: &v1alpha1.JSONAnnotationSource{Key: "example.org/config", FieldPath: "network.region"}, ToFieldPath: "spec.region"},
+				}},
+			},
+			want: want{
+				cd:  withSpec(map[string]interface{}{}),
+				err: errors.Wrapf(errors.Wrap(errors.New("invalid character 'o' looking for beginning of object key string"), `cannot parse annotation "example.org/bad" as JSON`), errFmtPatch, 0),
+			},
+		},
+		"ToComposite": {
+			reason: "Patches of type ToCompositeFieldPath should be skipped, since the composed resource has yet to be applied and observed",
+			args: args{
+				cp: composite.New(),
+				cd: withSpec(map[string]interface{}{"address": "10.0.0.1"}),
+				t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+					{Type: v1alpha1.PatchTypeToCompositeFieldPath, FromFieldPath: "spec.address", ToFieldPath: "spec.app"},
+					{Type: v1alpha1.PatchTypeToCompositeFieldPath, FromFieldPath: "status.atProvider.address", ToFieldPath: "status.address", Policy: &v1alpha1.PatchPolicy{FromFieldPath: &required}},
+					{FromFieldPath: "spec.app", ToFieldPath: "spec.app"},
+				}},
+			},
+			want: want{
+				cd: withSpec(map[string]interface{}{"address": "10.0.0.1"}),
+			},
+		},
+		"OptionalFieldMissing": {
+			reason: "A patch whose source field does not exist should be skipped, and subsequent patches applied",
+			args: args{
+				cp: cp,
+				cd: withSpec(map[string]interface{}{}),
+				t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+					{FromFieldPath: "metadata.labels[missing]", ToFieldPath: "spec.missing"},
+					{FromFieldPath: "metadata.labels[app]", ToFieldPath: "spec.app"},
+				}},
+			},
+			want: want{
+				cd: withSpec(map[string]interface{}{"app": "cool"}),
+			},
+		},
+		"RequiredFieldMissing": {
+			reason: "A patch whose source field does not exist should fail if its source is required",
+			args: args{
+				cp: cp,
+				cd: withSpec(map[string]interface{}{}),
+				t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+					{FromFieldPath: "metadata.labels[missing]", ToFieldPath: "spec.missing", Policy: &v1alpha1.PatchPolicy{FromFieldPath: &required}},
+					{FromFieldPath: "metadata.labels[app]", ToFieldPath: "spec.app"},
+				}},
+			},
+			want: want{
+				cd:  withSpec(map[string]interface{}{}),
+				err: errors.Wrapf(errors.Wrap(errors.New("metadata.labels.missing: no such field"), "cannot read the required source field of the patch"), errFmtPatch, 0),
+			},
+		},
+		"ErrorPolicyDegrade": {
+			reason: "A failed patch whose error policy is Degrade should be reported as a DegradedError after subsequent patches are applied",
+			args: args{
+				cp: annotated,
+				cd: withSpec(map[string]interface{}{}),
+				t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+					{FromJSONAnnotation: &v1alpha1.JSONAnnotationSource{Key: "example.org/bad"}, ToFieldPath: "spec.bad", Policy: &v1alpha1.PatchPolicy{Error: &degrade}},
+					{FromJSONAnnotation: &v1alpha1.JSONAnnotationSource{Key: "example.org/config", FieldPath: "network.region"}, ToFieldPath: "spec.region"},
+				}},
+			},
+			want: want{
+				cd: withSpec(map[string]interface{}{"region": "us-east-1"}),
+				err: &DegradedError{Errors: []error{
+					errors.Wrapf(errors.Wrap(errors.New("invalid character 'o' looking for beginning of object key string"), `cannot parse annotation "example.org/bad" as JSON`), errFmtPatch, 0),
+				}},
+			},
+		},
+		"SetIfEmptySkips": {
+			reason: "A SetIfEmpty patch should not overwrite an existing value",
+			args: args{
+				cp: cp,
+				cd: withSpec(map[string]interface{}{"app": "existing"}),
+				t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+					{FromFieldPath: "metadata.labels[app]", ToFieldPath: "spec.app", Policy: &v1alpha1.PatchPolicy{ToFieldPath: &setIfEmpty}},
+				}},
+			},
+			want: want{
+				cd: withSpec(map[string]interface{}{"app": "existing"}),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			o := &DefaultOverlayApplicator{}
+			err := o.Overlay(tc.args.cp, tc.args.cd, tc.args.t)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nOverlay(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.cd, tc.args.cd); diff != "" {
+				t.Errorf("\n%s\nOverlay(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestOverlayWithSiblings(t *testing.T) {
+	cp := composite.New()
+	cp.SetLabels(map[string]string{"app": "cool"})
+	withSpec := func(spec map[string]interface{}) *runtimecomposed.Unstructured {
+		return runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+			r.Object = map[string]interface{}{"spec": spec}
+		})
+	}
+	network := runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+		r.Object = map[string]interface{}{"status": map[string]interface{}{"atProvider": map[string]interface{}{"id": "vpc-1234"}}}
+	})
+	fromNetwork := v1alpha1.Patch{FromComposed: pointer.StringPtr("network"), FromFieldPath: "status.atProvider.id", ToFieldPath: "spec.forProvider.vpcId"}
+
+	type args struct {
+		cd *runtimecomposed.Unstructured
+		t  v1alpha1.ComposedTemplate
+		s  Siblings
+	}
+	type want struct {
+		cd  *runtimecomposed.Unstructured
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		args
+		want
+	}{
+		"FromSibling": {
+			reason: "A patch should read from the named sibling rather than the composite resource",
+			args: args{
+				cd: withSpec(map[string]interface{}{}),
+				t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+					fromNetwork,
+					{FromFieldPath: "metadata.labels[app]", ToFieldPath: "spec.app"},
+				}},
+				s: Siblings{"network": network},
+			},
+			want: want{
+				cd: withSpec(map[string]interface{}{
+					"forProvider": map[string]interface{}{"vpcId": "vpc-1234"},
+					"app":         "cool",
+				}),
+			},
+		},
+		"SiblingNotObserved": {
+			reason: "A patch should read nothing from a sibling that has not yet observed the field",
+			args: args{
+				cd: withSpec(map[string]interface{}{}),
+				t:  v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{fromNetwork}},
+				s:  Siblings{"network": runtimecomposed.New()},
+			},
+			want: want{
+				cd: withSpec(map[string]interface{}{}),
+			},
+		},
+		"UnknownSibling": {
+			reason: "A patch that reads from a sibling that has not been composed should return an error",
+			args: args{
+				cd: withSpec(map[string]interface{}{}),
+				t:  v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{fromNetwork}},
+			},
+			want: want{
+				cd:  withSpec(map[string]interface{}{}),
+				err: errors.Wrapf(errors.Errorf(errFmtNoSibling, "network"), errFmtPatch, 0),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			o := &DefaultOverlayApplicator{}
+			err := o.OverlayWithSiblings(cp, tc.args.cd, tc.args.t, tc.args.s)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nOverlayWithSiblings(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.cd, tc.args.cd); diff != "" {
+				t.Errorf("\n%s\nOverlayWithSiblings(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestOverlayCollectPatchErrors(t *testing.T) {
+	cp := composite.New()
+	cp.SetLabels(map[string]string{"app": "cool"})
+	withSpec := func(spec map[string]interface{}) *runtimecomposed.Unstructured {
+		return runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+			r.Object = map[string]interface{}{"spec": spec}
+		})
+	}
+	degrade := v1alpha1.ErrorPolicyDegrade
+	tmpl := v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+		{FromFieldPath: "metadata..labels"},
+		{FromFieldPath: "metadata.labels[app]", ToFieldPath: "spec.app"},
+		{FromComposed: pointer.StringPtr("network"), FromFieldPath: "status.id", ToFieldPath: "spec.id"},
+		{FromComposed: pointer.StringPtr("subnet"), FromFieldPath: "status.id", ToFieldPath: "spec.subnet", Policy: &v1alpha1.PatchPolicy{Error: &degrade}},
+	}}
+
+	type want struct {
+		cd  *runtimecomposed.Unstructured
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		o      []OverlayApplicatorOption
+		want   want
+	}{
+		"FailFast": {
+			reason: "By default only the first failed patch should be reported, and subsequent patches should not be applied",
+			want: want{
+				cd:  withSpec(map[string]interface{}{}),
+				err: errors.Wrapf(errors.Wrapf(errors.New("unexpected '.' at position 9"), "cannot parse path %q", "metadata..labels"), errFmtPatch, 0),
+			},
+		},
+		"Collect": {
+			reason: "Every failed patch should be reported, and every valid patch applied, when patch errors are collected",
+			o:      []OverlayApplicatorOption{WithCollectedPatchErrors()},
+			want: want{
+				cd: withSpec(map[string]interface{}{"app": "cool"}),
+				err: utilerrors.NewAggregate([]error{
+					errors.Wrapf(errors.Wrapf(errors.New("unexpected '.' at position 9"), "cannot parse path %q", "metadata..labels"), errFmtPatch, 0),
+					errors.Wrapf(errors.Errorf(errFmtNoSibling, "network"), errFmtPatch, 2),
+				}),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cd := withSpec(map[string]interface{}{})
+			err := NewDefaultOverlayApplicator(tc.o...).Overlay(cp, cd, tmpl)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nOverlay(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.cd, cd); diff != "" {
+				t.Errorf("\n%s\nOverlay(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+// A recordingLogger records the messages and structured data it is asked to
+// log at debug level.
+type recordingLogger struct {
+	values []interface{}
+	debug  *[]string
+}
+
+func (l recordingLogger) Info(_ string, _ ...interface{}) {}
+
+func (l recordingLogger) Debug(msg string, keysAndValues ...interface{}) {
+	*l.debug = append(*l.debug, fmt.Sprint(msg, append(l.values, keysAndValues...)))
+}
+
+func (l recordingLogger) WithValues(keysAndValues ...interface{}) logging.Logger {
+	return recordingLogger{values: append(append([]interface{}{}, l.values...), keysAndValues...), debug: l.debug}
+}
+
+func TestOverlayLogging(t *testing.T) {
+	cp := composite.New()
+	cp.SetLabels(map[string]string{"app": "cool"})
+	cd := runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+		r.SetAPIVersion("example.org/v1")
+		r.SetKind("Bucket")
+	})
+	tmpl := v1alpha1.ComposedTemplate{Name: pointer.StringPtr("bucket"), Patches: []v1alpha1.Patch{
+		{FromFieldPath: "metadata.labels[app]", ToFieldPath: "spec.app"},
+		{FromFieldPath: "metadata..labels"},
+	}}
+
+	got := []string{}
+	a := NewDefaultOverlayApplicator(WithCollectedPatchErrors(), WithOverlayApplicatorLogger(recordingLogger{debug: &got}))
+	_ = a.Overlay(cp, cd, tmpl)
+
+	errPath := errors.Wrapf(errors.New("unexpected '.' at position 9"), "cannot parse path %q", "metadata..labels")
+	want := []string{
+		fmt.Sprint("Applied patch", []interface{}{"kind", "example.org/v1, Kind=Bucket", "template", "bucket", "index", 0, "type", v1alpha1.PatchType("")}),
+		fmt.Sprint("Cannot apply patch", []interface{}{"kind", "example.org/v1, Kind=Bucket", "template", "bucket", "index", 1, "type", v1alpha1.PatchType(""), "error", errPath}),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Overlay(...): each patch should be logged with the kind, template, and index: -want, +got:\n%s", diff)
+	}
+}
+
+func TestPatchComposite(t *testing.T) {
+	cd := runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+		r.Object = map[string]interface{}{"status": map[string]interface{}{"atProvider": map[string]interface{}{"address": "10.0.0.1"}}}
+	})
+
+	type want struct {
+		cp  map[string]interface{}
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		t      v1alpha1.ComposedTemplate
+		want   want
+	}{
+		"ToComposite": {
+			reason: "Patches of type ToCompositeFieldPath should patch the composite resource using the composed resource",
+			t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+				{Type: v1alpha1.PatchTypeToCompositeFieldPath, FromFieldPath: "status.atProvider.address", ToFieldPath: "status.address"},
+			}},
+			want: want{
+				cp: map[string]interface{}{"status": map[string]interface{}{"address": "10.0.0.1"}},
+			},
+		},
+		"SkipFromComposite": {
+			reason: "Patches of other types should be skipped",
+			t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+				{FromFieldPath: "metadata..labels"},
+				{Type: v1alpha1.PatchTypeFromCompositeFieldPath, FromFieldPath: "status.address", ToFieldPath: "spec.address"},
+			}},
+			want: want{
+				cp: map[string]interface{}{},
+			},
+		},
+		"FromComposed": {
+			reason: "Patches of type ToCompositeFieldPath should not read from other composed resources",
+			t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+				{Type: v1alpha1.PatchTypeToCompositeFieldPath, FromComposed: pointer.StringPtr("network"), FromFieldPath: "status.id", ToFieldPath: "status.id"},
+			}},
+			want: want{
+				cp:  map[string]interface{}{},
+				err: errors.Wrapf(errors.Errorf(errFmtToCompositeFromComposed, "network"), errFmtPatch, 0),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cp := composite.New()
+			cp.Object = map[string]interface{}{}
+			err := PatchComposite(cp, cd, tc.t)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nPatchComposite(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.cp, cp.Object); diff != "" {
+				t.Errorf("\n%s\nPatchComposite(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	cp := composite.New()
+	cp.SetLabels(map[string]string{"app": "cool"})
+	withSpec := func(spec map[string]interface{}) *runtimecomposed.Unstructured {
+		return runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+			r.Object = map[string]interface{}{"spec": spec}
+		})
+	}
+
+	type args struct {
+		cd *runtimecomposed.Unstructured
+		t  v1alpha1.ComposedTemplate
+	}
+	cases := map[string]struct {
+		reason string
+		args
+		want error
+	}{
+		"Valid": {
+			reason: "No error should be returned if every patch can be applied",
+			args: args{
+				cd: withSpec(map[string]interface{}{}),
+				t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+					{FromFieldPath: "metadata.labels[app]", ToFieldPath: "spec.app"},
+				}},
+			},
+		},
+		"EveryInvalidPatch": {
+			reason: "Every patch that cannot be applied should be reported, not only the first",
+			args: args{
+				cd: withSpec(map[string]interface{}{}),
+				t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+					{FromFieldPath: "metadata..labels"},
+					{FromFieldPath: "metadata.labels[app]", ToFieldPath: "spec.app"},
+					{FromComposed: pointer.StringPtr("network"), FromFieldPath: "status.id", ToFieldPath: "spec.id"},
+				}},
+			},
+			want: utilerrors.NewAggregate([]error{
+				errors.Wrapf(errors.Wrapf(errors.New("unexpected '.' at position 9"), "cannot parse path %q", "metadata..labels"), errFmtPatch, 0),
+				errors.Wrapf(errors.Errorf(errFmtNoSibling, "network"), errFmtPatch, 2),
+			}),
+		},
+		"OrderCycle": {
+			reason: "Patches whose declared order forms a cycle should return an error",
+			args: args{
+				cd: withSpec(map[string]interface{}{}),
+				t: v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+					{FromFieldPath: "metadata.labels[app]", ToFieldPath: "spec.a", Order: &v1alpha1.PatchOrder{Name: "a", After: []string{"b"}}},
+					{FromFieldPath: "metadata.labels[app]", ToFieldPath: "spec.b", Order: &v1alpha1.PatchOrder{Name: "b", After: []string{"a"}}},
+				}},
+			},
+			want: errors.Wrap(errors.New(errPatchCycle), errSortPatches),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			o := &DefaultOverlayApplicator{}
+			err := o.DryRun(cp, tc.args.cd, tc.args.t, nil)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nDryRun(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(withSpec(map[string]interface{}{}), tc.args.cd); diff != "" {
+				t.Errorf("\n%s\nDryRun(...): the composed resource should not be changed: -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSortPatches(t *testing.T) {
+	named := func(name string, after ...string) v1alpha1.Patch {
+		return v1alpha1.Patch{Order: &v1alpha1.PatchOrder{Name: name, After: after}}
+	}
+
+	type want struct {
+		order []int
+		err   error
+	}
+	cases := map[string]struct {
+		reason string
+		ps     []v1alpha1.Patch
+		want   want
+	}{
+		"SliceOrder": {
+			reason: "Patches that declare no order should be applied in slice order",
+			ps:     []v1alpha1.Patch{{}, {}, {}},
+			want:   want{order: []int{0, 1, 2}},
+		},
+		"Reordered": {
+			reason: "Patches should be moved after the patches they declare they follow",
+			ps:     []v1alpha1.Patch{named("c", "b"), {}, named("b", "a"), named("a")},
+			want:   want{order: []int{1, 3, 2, 0}},
+		},
+		"MultipleDependencies": {
+			reason: "A patch should not be applied until all the patches it follows have been",
+			ps:     []v1alpha1.Patch{named("c", "a", "b"), named("a"), named("b")},
+			want:   want{order: []int{1, 2, 0}},
+		},
+		"DuplicateName": {
+			reason: "Patch names must be unique",
+			ps:     []v1alpha1.Patch{named("a"), named("a")},
+			want:   want{err: errors.Errorf(errFmtDuplicatePatch, "a")},
+		},
+		"UnknownDependency": {
+			reason: "A patch may not follow a patch that does not exist",
+			ps:     []v1alpha1.Patch{named("a", "b")},
+			want:   want{err: errors.Errorf(errFmtUnknownPatch, 0, "b")},
+		},
+		"Cycle": {
+			reason: "Patches that depend on each other in a cycle should return an error",
+			ps:     []v1alpha1.Patch{{}, named("a", "c"), named("b", "a"), named("c", "b")},
+			want:   want{err: errors.New(errPatchCycle)},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := SortPatches(tc.ps)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nSortPatches(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.order, got); diff != "" {
+				t.Errorf("\n%s\nSortPatches(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestFetch(t *testing.T) {
+
+	sref := &runtimev1alpha1.SecretReference{Name: "foo", Namespace: "bar"}
+	urlQuery := v1alpha1.StringEscapeURLQuery
+	s := &v1.Secret{
+		Data: map[string][]byte{
+			"foo": []byte("a"),
+			"bar": []byte("b"),
+		},
+	}
+
+	type args struct {
+		kube client.Client
+		cd   resource.Composed
+		t    v1alpha1.ComposedTemplate
+	}
+	type want struct {
+		conn managed.ConnectionDetails
+		err  error
+	}
+	cases := map[string]struct {
+		reason string
+		args
+		want
+	}{
+		"DoesNotPublish": {
+			reason: "Should not fail if composed resource doesn't publish a connection secret",
+			args: args{
+				cd: &fake.Composed{},
+			},
+		},
+		"SecretNotPublishedYet": {
+			reason: "Should not fail if composed resource has yet to publish the secret",
+			args: args{
+				kube: &test.MockClient{MockGet: test.NewMockGetFn(kerrors.NewNotFound(schema.GroupResource{}, ""))},
+				cd: &fake.Composed{
+					ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: sref},
+				},
+				t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+					{
+						FromConnectionSecretKey: pointer.StringPtr("bar"),
+					},
+					{
+						Name:  pointer.StringPtr("fixed"),
+						Value: pointer.StringPtr("value"),
+					},
+				}},
+			},
+			want: want{
+				conn: managed.ConnectionDetails{
+					"fixed": []byte("value"),
+				},
+			},
+		},
+		"NoConnectionDetails": {
+			reason: "Should not get the connection secret if the template has no connection details",
+			args: args{
+				kube: &test.MockClient{MockGet: test.NewMockGetFn(errBoom)},
+				cd: &fake.Composed{
+					ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: sref},
+				},
+			},
+		},
+		"SecretGetFailed": {
+			reason: "Should fail if secret retrieval results in some error other than NotFound",
+			args: args{
+				kube: &test.MockClient{MockGet: test.NewMockGetFn(errBoom)},
+				cd: &fake.Composed{
+					ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: sref},
+				},
+				t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{{FromConnectionSecretKey: pointer.StringPtr("bar")}}},
+			},
+			want: want{
+				err: errors.Wrap(errBoom, errGetSecret),
+			},
+		},
+		"Success": {
+			reason: "Should publish only the selected set of secret keys",
+			args: args{
+				kube: &test.MockClient{MockGet: func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+					if sobj, ok := obj.(*v1.Secret); ok {
+						if key.Name == sref.Name && key.Namespace == sref.Namespace {
+							s.DeepCopyInto(sobj)
+							return nil
+						}
+					}
+					t.Errorf("wrong secret is queried")
+					return errBoom
+				}},
+				cd: &fake.Composed{
+					ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: sref},
+				},
+				t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+					{
+						FromConnectionSecretKey: pointer.StringPtr("bar"),
+					},
+					{
+						FromConnectionSecretKey: pointer.StringPtr("none"),
+					},
+					{
+						Name:                    pointer.StringPtr("convfoo"),
+						FromConnectionSecretKey: pointer.StringPtr("foo"),
+					},
+					{
+						Name:  pointer.StringPtr("fixed"),
+						Value: pointer.StringPtr("value"),
+					},
+					{
+						// Entries with only a name are silently ignored.
+						Name: pointer.StringPtr("missingvalue"),
+					},
+					{
+						// Entries with only a value are silently ignored.
+						Value: pointer.StringPtr("missingname"),
+					},
+				}},
+			},
+			want: want{
+				conn: managed.ConnectionDetails{
+					"convfoo": s.Data["foo"],
+					"bar":     s.Data["bar"],
+					"fixed":   []byte("value"),
+				},
+			},
+		},
+		"DecodeBase64": {
+			reason: "Should base64 decode values of connection details that ask for it",
+			args: args{
+				kube: &test.MockClient{MockGet: test.NewMockGetFn(nil, func(obj runtime.Object) error {
+					obj.(*v1.Secret).Data = map[string][]byte{"cert": []byte("Y29vbA==")}
+					return nil
+				})},
+				cd: &fake.Composed{
+					ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: sref},
+				},
+				t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+					{
+						FromConnectionSecretKey: pointer.StringPtr("cert"),
+						DecodeBase64:            true,
+					},
+				}},
+			},
+			want: want{
+				conn: managed.ConnectionDetails{
+					"cert": []byte("cool"),
+				},
+			},
+		},
+		"Escape": {
+			reason: "Should escape values of connection details that ask for it",
+			args: args{
+				kube: &test.MockClient{MockGet: test.NewMockGetFn(nil, func(obj runtime.Object) error {
+					obj.(*v1.Secret).Data = map[string][]byte{"password": []byte("p@ss w/rd&?=")}
+					return nil
+				})},
+				cd: &fake.Composed{
+					ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: sref},
+				},
+				t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+					{
+						FromConnectionSecretKey: pointer.StringPtr("password"),
+						Escape:                  &urlQuery,
+					},
+				}},
+			},
+			want: want{
+				conn: managed.ConnectionDetails{
+					"password": []byte("p%40ss+w%2Frd%26%3F%3D"),
+				},
+			},
+		},
+		"Transform": {
+			reason: "Should apply the transforms of connection details to their values",
+			args: args{
+				kube: &test.MockClient{MockGet: test.NewMockGetFn(nil, func(obj runtime.Object) error {
+					obj.(*v1.Secret).Data = map[string][]byte{"host": []byte("db.example.org")}
+					return nil
+				})},
+				cd: &fake.Composed{
+					ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: sref},
+				},
+				t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+					{
+						Name:                    pointer.StringPtr("url"),
+						FromConnectionSecretKey: pointer.StringPtr("host"),
+						Transforms: []v1alpha1.Transform{{
+							Type:   v1alpha1.TransformTypeString,
+							String: &v1alpha1.StringTransform{Format: "postgres://%s:5432"},
+						}},
+					},
+				}},
+			},
+			want: want{
+				conn: managed.ConnectionDetails{
+					"url": []byte("postgres://db.example.org:5432"),
+				},
+			},
+		},
+		"AdditionalSecrets": {
+			reason: "Should merge the keys of additional connection secrets in order, skipping secrets that don't exist",
+			args: args{
+				kube: &test.MockClient{MockGet: func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+					switch key.Name {
+					case "foo":
+						obj.(*v1.Secret).Data = map[string][]byte{"username": []byte("admin"), "password": []byte("old")}
+					case "creds":
+						obj.(*v1.Secret).Data = map[string][]byte{"password": []byte("new")}
+					default:
+						return kerrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, key.Name)
+					}
+					return nil
+				}},
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.SetWriteConnectionSecretToReference(sref)
+					r.Object["status"] = map[string]interface{}{"credentials": "creds", "missing": "nope", "namespace": "bar"}
+				}),
+				t: v1alpha1.ComposedTemplate{
+					AdditionalConnectionSecretRefs: []v1alpha1.ConnectionSecretRef{
+						{NamePath: "status.credentials", NamespacePath: "status.namespace"},
+						{NamePath: "status.missing", NamespacePath: "status.namespace"},
+					},
+					ConnectionDetails: []v1alpha1.ConnectionDetail{
+						{FromConnectionSecretKey: pointer.StringPtr("username")},
+						{FromConnectionSecretKey: pointer.StringPtr("password")},
+					},
+				},
+			},
+			want: want{
+				conn: managed.ConnectionDetails{
+					"username": []byte("admin"),
+					"password": []byte("new"),
+				},
+			},
+		},
+		"ConnectionConfigMaps": {
+			reason: "Should merge the keys of connection ConfigMaps, skipping ConfigMaps that don't exist, with the keys of secrets taking precedence",
+			args: args{
+				kube: &test.MockClient{MockGet: func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+					switch o := obj.(type) {
+					case *v1.Secret:
+						o.Data = map[string][]byte{"password": []byte("secret")}
+					case *v1.ConfigMap:
+						if key.Name != "endpoints" {
+							return kerrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, key.Name)
+						}
+						o.Data = map[string]string{"endpoint": "db.example.org", "password": "nope"}
+						o.BinaryData = map[string][]byte{"ca": []byte("cool")}
+					}
+					return nil
+				}},
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.SetWriteConnectionSecretToReference(sref)
+					r.Object["status"] = map[string]interface{}{"endpoints": "endpoints", "missing": "nope", "namespace": "bar"}
+				}),
+				t: v1alpha1.ComposedTemplate{
+					ConnectionConfigMapRefs: []v1alpha1.ConnectionSecretRef{
+						{NamePath: "status.endpoints", NamespacePath: "status.namespace"},
+						{NamePath: "status.missing", NamespacePath: "status.namespace"},
+					},
+					ConnectionDetails: []v1alpha1.ConnectionDetail{
+						{FromConnectionSecretKey: pointer.StringPtr("endpoint")},
+						{FromConnectionSecretKey: pointer.StringPtr("ca")},
+						{FromConnectionSecretKey: pointer.StringPtr("password")},
+					},
+				},
+			},
+			want: want{
+				conn: managed.ConnectionDetails{
+					"endpoint": []byte("db.example.org"),
+					"ca":       []byte("cool"),
+					"password": []byte("secret"),
+				},
+			},
+		},
+		"GetConnectionConfigMapError": {
+			reason: "Should return errors encountered getting a connection ConfigMap",
+			args: args{
+				kube: &test.MockClient{MockGet: test.NewMockGetFn(errBoom)},
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object["status"] = map[string]interface{}{"endpoints": "endpoints", "namespace": "bar"}
+				}),
+				t: v1alpha1.ComposedTemplate{
+					ConnectionConfigMapRefs: []v1alpha1.ConnectionSecretRef{
+						{NamePath: "status.endpoints", NamespacePath: "status.namespace"},
+					},
+					ConnectionDetails: []v1alpha1.ConnectionDetail{
+						{FromConnectionSecretKey: pointer.StringPtr("endpoint")},
+					},
+				},
+			},
+			want: want{
+				err: errors.Wrap(errBoom, errGetConfigMap),
+			},
+		},
+		"AdditionalSecretNotSet": {
+			reason: "Should return the details that could be fetched along with an error if a connection secret reference is not yet set",
+			args: args{
+				kube: &test.MockClient{MockGet: test.NewMockGetFn(nil, func(obj runtime.Object) error {
+					obj.(*v1.Secret).Data = map[string][]byte{"username": []byte("admin")}
+					return nil
+				})},
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.SetWriteConnectionSecretToReference(sref)
+					r.Object["status"] = map[string]interface{}{"credentials": "", "namespace": "bar"}
+				}),
+				t: v1alpha1.ComposedTemplate{
+					AdditionalConnectionSecretRefs: []v1alpha1.ConnectionSecretRef{
+						{NamePath: "status.credentials", NamespacePath: "status.namespace"},
+					},
+					ConnectionDetails: []v1alpha1.ConnectionDetail{
+						{FromConnectionSecretKey: pointer.StringPtr("username")},
+					},
+				},
+			},
+			want: want{
+				conn: managed.ConnectionDetails{
+					"username": []byte("admin"),
+				},
+				err: &SecretReferenceNotSetError{NamePath: "status.credentials", NamespacePath: "status.namespace"},
+			},
+		},
+		"KeyPrefix": {
+			reason: "Should prepend the key prefix of connection details to their keys, including those of literal values",
+			args: args{
+				kube: &test.MockClient{MockGet: test.NewMockGetFn(nil, func(obj runtime.Object) error {
+					s.DeepCopyInto(obj.(*v1.Secret))
+					return nil
+				})},
+				cd: &fake.Composed{
+					ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: sref},
+				},
+				t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+					{
+						FromConnectionSecretKey: pointer.StringPtr("foo"),
+						KeyPrefix:               "db-",
+					},
+					{
+						Name:                    pointer.StringPtr("renamed"),
+						FromConnectionSecretKey: pointer.StringPtr("bar"),
+						KeyPrefix:               "db-",
+					},
+					{
+						Name:      pointer.StringPtr("port"),
+						Value:     pointer.StringPtr("5432"),
+						KeyPrefix: "db-",
+					},
+				}},
+			},
+			want: want{
+				conn: managed.ConnectionDetails{
+					"db-foo":     []byte("a"),
+					"db-renamed": []byte("b"),
+					"db-port":    []byte("5432"),
+				},
+			},
+		},
+		"EncodeBase64": {
+			reason: "Should base64 encode the values of connection details that are configured to be encoded",
+			args: args{
+				kube: &test.MockClient{MockGet: test.NewMockGetFn(nil, func(obj runtime.Object) error {
+					obj.(*v1.Secret).Data = map[string][]byte{"cert": []byte("cool!")}
+					return nil
+				})},
+				cd: &fake.Composed{
+					ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: sref},
+				},
+				t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+					{
+						FromConnectionSecretKey: pointer.StringPtr("cert"),
+						EncodeBase64:            true,
+					},
+				}},
+			},
+			want: want{
+				conn: managed.ConnectionDetails{
+					"cert": []byte(base64.StdEncoding.EncodeToString([]byte("cool!"))),
+				},
+			},
+		},
+		"DecodeBase64Failed": {
+			reason: "Should fail naming the key if a value cannot be base64 decoded",
+			args: args{
+				kube: &test.MockClient{MockGet: test.NewMockGetFn(nil, func(obj runtime.Object) error {
+					obj.(*v1.Secret).Data = map[string][]byte{"cert": []byte("cool!")}
+					return nil
+				})},
+				cd: &fake.Composed{
+					ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: sref},
+				},
+				t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+					{
+						FromConnectionSecretKey: pointer.StringPtr("cert"),
+						DecodeBase64:            true,
+					},
+				}},
+			},
+			want: want{
+				err: errors.Wrapf(base64.CorruptInputError(4), errFmtDecodeBase64, "cert"),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := &APIConnectionDetailsFetcher{client: tc.args.kube}
+			conn, err := c.Fetch(context.Background(), tc.args.cd, tc.args.t)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nFetch(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.conn, conn); diff != "" {
+				t.Errorf("\n%s\nFetch(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestFetchFromFieldPath(t *testing.T) {
+	cd := runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+		r.Object = map[string]interface{}{"status": map[string]interface{}{"atProvider": map[string]interface{}{
+			"endpoint": "db.example.org",
+			"tier":     "gold",
+			"port":     int64(5432),
+			"tags":     map[string]interface{}{"team": "platform"},
+		}}}
+	})
+	multiply := int64(2)
+
+	type want struct {
+		conn managed.ConnectionDetails
+		err  error
+	}
+	cases := map[string]struct {
+		reason string
+		t      v1alpha1.ComposedTemplate
+		want   want
+	}{
+		"TransformChain": {
+			reason: "Values read from field paths should be piped through the transforms of the connection detail",
+			t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+				{
+					Name:          pointer.StringPtr("endpoint"),
+					FromFieldPath: pointer.StringPtr("status.atProvider.endpoint"),
+				},
+				{
+					Name:          pointer.StringPtr("size"),
+					FromFieldPath: pointer.StringPtr("status.atProvider.tier"),
+					Transforms: []v1alpha1.Transform{
+						{Type: v1alpha1.TransformTypeMap, Map: &v1alpha1.MapTransform{Pairs: map[string]string{"gold": "large"}}},
+						{Type: v1alpha1.TransformTypeString, String: &v1alpha1.StringTransform{Format: "db.%s"}},
+					},
+				},
+				{
+					Name:          pointer.StringPtr("port"),
+					FromFieldPath: pointer.StringPtr("status.atProvider.port"),
+					Transforms: []v1alpha1.Transform{
+						{Type: v1alpha1.TransformTypeMath, Math: &v1alpha1.MathTransform{Multiply: &multiply}},
+					},
+				},
+			}},
+			want: want{
+				conn: managed.ConnectionDetails{
+					"endpoint": []byte("db.example.org"),
+					"size":     []byte("db.large"),
+					"port":     []byte("10864"),
+				},
+			},
+		},
+		"MissingField": {
+			reason: "Fields that do not exist should not be published",
+			t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+				{Name: pointer.StringPtr("address"), FromFieldPath: pointer.StringPtr("status.atProvider.address")},
+			}},
+			want: want{
+				conn: managed.ConnectionDetails{},
+			},
+		},
+		"TransformFailed": {
+			reason: "Should fail naming the field path if a transform fails",
+			t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+				{
+					Name:          pointer.StringPtr("endpoint"),
+					FromFieldPath: pointer.StringPtr("status.atProvider.endpoint"),
+					Transforms: []v1alpha1.Transform{
+						{Type: v1alpha1.TransformTypeMath, Math: &v1alpha1.MathTransform{Multiply: &multiply}},
+					},
+				},
+			}},
+			want: want{
+				err: errors.Wrapf(func() error {
+					_, err := v1alpha1.ApplyTransforms([]v1alpha1.Transform{{Type: v1alpha1.TransformTypeMath, Math: &v1alpha1.MathTransform{Multiply: &multiply}}}, "db.example.org")
+					return err
+				}(), errFmtConnectionFieldPath, "status.atProvider.endpoint"),
+			},
+		},
+		"NotScalar": {
+			reason: "Should fail if the value of the field is not a string, number, or boolean",
+			t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+				{Name: pointer.StringPtr("tags"), FromFieldPath: pointer.StringPtr("status.atProvider.tags")},
+			}},
+			want: want{
+				err: errors.Wrapf(errors.Errorf(errFmtConnectionValue, map[string]interface{}{}), errFmtConnectionFieldPath, "status.atProvider.tags"),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := NewAPIConnectionDetailsFetcher(&test.MockClient{MockGet: test.NewMockGetFn(errBoom)})
+			conn, err := c.Fetch(context.Background(), cd, tc.t)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nFetch(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.conn, conn); diff != "" {
+				t.Errorf("\n%s\nFetch(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestFetchFromComposite(t *testing.T) {
+	cp := composite.New()
+	cp.SetAnnotations(map[string]string{"region": "us-west-2"})
+	cd := runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+		r.Object = map[string]interface{}{"status": map[string]interface{}{"atProvider": map[string]interface{}{
+			"endpoint": "db.example.org",
+		}}}
+	})
+	tmpl := v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+		{
+			Name:          pointer.StringPtr("endpoint"),
+			FromFieldPath: pointer.StringPtr("status.atProvider.endpoint"),
+		},
+		{
+			Name:                   pointer.StringPtr("region"),
+			FromCompositeFieldPath: pointer.StringPtr("metadata.annotations.region"),
+			Transforms: []v1alpha1.Transform{
+				{Type: v1alpha1.TransformTypeString, String: &v1alpha1.StringTransform{Format: "aws-%s"}},
+			},
+		},
+		{
+			Name:                   pointer.StringPtr("zone"),
+			FromCompositeFieldPath: pointer.StringPtr("metadata.annotations.zone"),
+		},
+	}}
+
+	type args struct {
+		cp resource.Composite
+	}
+	type want struct {
+		conn managed.ConnectionDetails
+		err  error
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"ReadFromComposite": {
+			reason: "Values should be read from the composite resource's field paths, omitting fields that do not exist",
+			args:   args{cp: cp},
+			want: want{
+				conn: managed.ConnectionDetails{
+					"endpoint": []byte("db.example.org"),
+					"region":   []byte("aws-us-west-2"),
+				},
+			},
+		},
+		"NoComposite": {
+			reason: "Values read from the composite resource should be omitted when there is no composite resource",
+			want: want{
+				conn: managed.ConnectionDetails{
+					"endpoint": []byte("db.example.org"),
+				},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := NewAPIConnectionDetailsFetcher(&test.MockClient{MockGet: test.NewMockGetFn(errBoom)})
+			conn, err := c.FetchFromComposite(context.Background(), tc.args.cp, cd, tmpl)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nFetchFromComposite(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.conn, conn); diff != "" {
+				t.Errorf("\n%s\nFetchFromComposite(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestFetchExternalName(t *testing.T) {
+	sref := &runtimev1alpha1.SecretReference{Name: "foo", Namespace: "bar"}
+	withExternalName := func(name string, ref *runtimev1alpha1.SecretReference) resource.Composed {
+		cd := &fake.Composed{ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: ref}}
+		if name != "" {
+			meta.SetExternalName(cd, name)
+		}
+		return cd
+	}
+	kube := &test.MockClient{MockGet: test.NewMockGetFn(nil, func(obj runtime.Object) error {
+		obj.(*v1.Secret).Data = map[string][]byte{"id": []byte("explicit")}
+		return nil
+	})}
+
+	cases := map[string]struct {
+		reason string
+		o      []FetcherOption
+		cd     resource.Composed
+		t      v1alpha1.ComposedTemplate
+		want   managed.ConnectionDetails
+	}{
+		"Disabled": {
+			reason: "The external name should not be published unless a key is configured",
+			cd:     withExternalName("cool-bucket", nil),
+		},
+		"Present": {
+			reason: "The external name should be published under the configured key",
+			o:      []FetcherOption{WithExternalNameKey("id")},
+			cd:     withExternalName("cool-bucket", nil),
+			want:   managed.ConnectionDetails{"id": []byte("cool-bucket")},
+		},
+		"Absent": {
+			reason: "Nothing should be published if the composed resource has no external name",
+			o:      []FetcherOption{WithExternalNameKey("id")},
+			cd:     withExternalName("", nil),
+		},
+		"MergedWithSecret": {
+			reason: "The external name should be published alongside connection details from the secret",
+			o:      []FetcherOption{WithExternalNameKey("id")},
+			cd:     withExternalName("cool-bucket", sref),
+			t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+				{Name: pointer.StringPtr("port"), Value: pointer.StringPtr("5432")},
+			}},
+			want: managed.ConnectionDetails{"id": []byte("cool-bucket"), "port": []byte("5432")},
+		},
+		"ExplicitTakesPrecedence": {
+			reason: "An explicitly configured connection detail with the same key should take precedence",
+			o:      []FetcherOption{WithExternalNameKey("id")},
+			cd:     withExternalName("cool-bucket", sref),
+			t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+				{FromConnectionSecretKey: pointer.StringPtr("id")},
+			}},
+			want: managed.ConnectionDetails{"id": []byte("explicit")},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := NewAPIConnectionDetailsFetcher(kube, tc.o...)
+			conn, err := c.Fetch(context.Background(), tc.cd, tc.t)
+			if err != nil {
+				t.Fatalf("\n%s\nFetch(...): %s", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, conn); diff != "" {
+				t.Errorf("\n%s\nFetch(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestFetchKeyFilter(t *testing.T) {
+	kube := &test.MockClient{MockGet: test.NewMockGetFn(nil, func(obj runtime.Object) error {
+		obj.(*v1.Secret).Data = map[string][]byte{
+			"username": []byte("a"),
+			"password": []byte("b"),
+			"token":    []byte("c"),
+		}
+		return nil
+	})}
+	cd := &fake.Composed{
+		ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: &runtimev1alpha1.SecretReference{Name: "foo", Namespace: "bar"}},
+	}
+	details := []v1alpha1.ConnectionDetail{
+		{FromConnectionSecretKey: pointer.StringPtr("username")},
+		{FromConnectionSecretKey: pointer.StringPtr("password")},
+		{FromConnectionSecretKey: pointer.StringPtr("token")},
+	}
+
+	cases := map[string]struct {
+		reason string
+		filter *v1alpha1.ConnectionSecretKeyFilter
+		want   managed.ConnectionDetails
+	}{
+		"GlobalDeny": {
+			reason: "Keys that are denied globally should not be propagated",
+			want:   managed.ConnectionDetails{"username": []byte("a")},
+		},
+		"TemplateAllow": {
+			reason: "Keys that are allowed by the template should be propagated even if they are denied globally",
+			filter: &v1alpha1.ConnectionSecretKeyFilter{Allow: []string{"password"}},
+			want:   managed.ConnectionDetails{"username": []byte("a"), "password": []byte("b")},
+		},
+		"TemplateDeny": {
+			reason: "Keys that are denied by the template should not be propagated even if they are not denied globally",
+			filter: &v1alpha1.ConnectionSecretKeyFilter{Deny: []string{"username"}},
+			want:   managed.ConnectionDetails{},
+		},
+		"TemplateDenyTakesPrecedence": {
+			reason: "Keys that are both allowed and denied by the template should not be propagated",
+			filter: &v1alpha1.ConnectionSecretKeyFilter{Allow: []string{"token"}, Deny: []string{"token"}},
+			want:   managed.ConnectionDetails{"username": []byte("a")},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := NewAPIConnectionDetailsFetcher(kube, WithDeniedConnectionSecretKeys("password", "token"))
+			conn, err := c.Fetch(context.Background(), cd, v1alpha1.ComposedTemplate{ConnectionDetails: details, ConnectionSecretKeyFilter: tc.filter})
+			if err != nil {
+				t.Fatalf("\n%s\nFetch(...): %s", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, conn); diff != "" {
+				t.Errorf("\n%s\nFetch(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestFetchWithSecretReader(t *testing.T) {
+	errBoom := errors.New("boom")
+	kube := &test.MockClient{MockGet: test.NewMockGetFn(errBoom)}
+	secrets := &test.MockClient{MockGet: test.NewMockGetFn(nil, func(obj runtime.Object) error {
+		obj.(*v1.Secret).Data = map[string][]byte{"username": []byte("a")}
+		return nil
+	})}
+	cd := &fake.Composed{
+		ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: &runtimev1alpha1.SecretReference{Name: "foo", Namespace: "bar"}},
+	}
+	tmpl := v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{{FromConnectionSecretKey: pointer.StringPtr("username")}}}
+	want := managed.ConnectionDetails{"username": []byte("a")}
+
+	cases := map[string]struct {
+		reason string
+		ctx    context.Context
+	}{
+		"Uncached": {
+			reason: "Connection secrets should be got using the secret reader rather than the client",
+			ctx:    context.Background(),
+		},
+		"SecretCache": {
+			reason: "Connection secrets should be got using the secret reader when the context carries a secret cache",
+			ctx:    WithSecretCache(context.Background()),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			conn, err := NewAPIConnectionDetailsFetcher(kube, WithSecretReader(secrets)).Fetch(tc.ctx, cd, tmpl)
+			if err != nil {
+				t.Fatalf("\n%s\nFetch(...): %s", tc.reason, err)
+			}
+			if diff := cmp.Diff(want, conn); diff != "" {
+				t.Errorf("\n%s\nFetch(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetWriteConnectionSecretToReference(t *testing.T) {
+	paths := &v1alpha1.ConnectionSecretRef{NamePath: "status.secretName", NamespacePath: "status.secretNamespace"}
+	withSecret := func(name, namespace interface{}) resource.Composed {
+		return runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+			r.Object = map[string]interface{}{"status": map[string]interface{}{"secretName": name, "secretNamespace": namespace}}
+		})
+	}
+	invalid := func(format, value, path string, msgs []string) error {
+		return errors.Errorf(format, value, path, strings.Join(msgs, "; "))
+	}
+
+	type want struct {
+		ref *runtimev1alpha1.SecretReference
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		cd     resource.Composed
+		paths  *v1alpha1.ConnectionSecretRef
+		want   want
+	}{
+		"Valid": {
+			reason: "A valid name and namespace should be resolved",
+			cd:     withSecret("cool-secret", "coolns"),
+			want: want{
+				ref: &runtimev1alpha1.SecretReference{Name: "cool-secret", Namespace: "coolns"},
+			},
+		},
+		"Normalized": {
+			reason: "Leading and trailing whitespace should be removed from the name and namespace",
+			cd:     withSecret(" cool-secret\n", "coolns "),
+			want: want{
+				ref: &runtimev1alpha1.SecretReference{Name: "cool-secret", Namespace: "coolns"},
+			},
+		},
+		"NotYetSet": {
+			reason: "An empty name or namespace should not be resolved, and should return an error naming the paths",
+			cd:     withSecret("", "coolns"),
+			want: want{
+				err: &SecretReferenceNotSetError{NamePath: "status.secretName", NamespacePath: "status.secretNamespace"},
+			},
+		},
+		"InvalidName": {
+			reason: "An invalid name should return an error naming the path that produced it",
+			cd:     withSecret("Cool_Secret", "coolns"),
+			want: want{
+				err: invalid(errFmtInvalidSecretName, "Cool_Secret", "status.secretName", validation.IsDNS1123Subdomain("Cool_Secret")),
+			},
+		},
+		"InvalidNamespace": {
+			reason: "An invalid namespace should return an error naming the path that produced it",
+			cd:     withSecret("cool-secret", "cool.ns"),
+			want: want{
+				err: invalid(errFmtInvalidSecretNamespace, "cool.ns", "status.secretNamespace", validation.IsDNS1123Label("cool.ns")),
+			},
+		},
+		"ImpliedNamespace": {
+			reason: "The namespace of the composed resource should be implied if no namespace path is configured",
+			cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+				r.SetNamespace("coolns")
+				r.Object["status"] = map[string]interface{}{"secretName": "cool-secret", "secretNamespace": "otherns"}
+			}),
+			paths: &v1alpha1.ConnectionSecretRef{NamePath: "status.secretName"},
+			want: want{
+				ref: &runtimev1alpha1.SecretReference{Name: "cool-secret", Namespace: "coolns"},
+			},
+		},
+		"ImpliedClaimNamespace": {
+			reason: "The namespace of the claim should be implied in preference to that of the composed resource if no namespace path is configured",
+			cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+				r.SetNamespace("coolns")
+				r.SetLabels(map[string]string{LabelKeyClaimNamespace: "claimns"})
+				r.Object["status"] = map[string]interface{}{"secretName": "cool-secret"}
+			}),
+			paths: &v1alpha1.ConnectionSecretRef{NamePath: "status.secretName"},
+			want: want{
+				ref: &runtimev1alpha1.SecretReference{Name: "cool-secret", Namespace: "claimns"},
+			},
+		},
+		"NoImpliedNamespace": {
+			reason: "A composed resource that is cluster scoped and belongs to no claim should not imply a namespace",
+			cd:     withSecret("cool-secret", "coolns"),
+			paths:  &v1alpha1.ConnectionSecretRef{NamePath: "status.secretName"},
+			want: want{
+				err: &SecretReferenceNotSetError{NamePath: "status.secretName"},
+			},
+		},
+		"ScalarName": {
+			reason: "A name that is a number should be formatted as a string",
+			cd:     withSecret(int64(42), "coolns"),
+			want: want{
+				ref: &runtimev1alpha1.SecretReference{Name: "42", Namespace: "coolns"},
+			},
+		},
+		"ObjectName": {
+			reason: "A name that is not a scalar value should return an error naming its path and type",
+			cd:     withSecret(map[string]interface{}{"name": "cool-secret"}, "coolns"),
+			want: want{
+				err: errors.Errorf(errFmtSecretRefNotScalar, "status.secretName", "object"),
+			},
+		},
+		"ArrayNamespace": {
+			reason: "A namespace that is not a scalar value should return an error naming its path and type",
+			cd:     withSecret("cool-secret", []interface{}{"coolns"}),
+			want: want{
+				err: errors.Errorf(errFmtSecretRefNotScalar, "status.secretNamespace", "array"),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			p := paths
+			if tc.paths != nil {
+				p = tc.paths
+			}
+			ref, err := getWriteConnectionSecretToReference(PaveUnstructured, tc.cd, v1alpha1.ComposedTemplate{ConnectionSecretRef: p}, "")
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\ngetWriteConnectionSecretToReference(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ref, ref); diff != "" {
+				t.Errorf("\n%s\ngetWriteConnectionSecretToReference(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestFetchDefaultSecretNamespace(t *testing.T) {
+	withRef := func(namespace string, labels map[string]string) resource.Composed {
+		return &fake.Composed{
+			ObjectMeta:               metav1.ObjectMeta{Namespace: "cdns", Labels: labels},
+			ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: &runtimev1alpha1.SecretReference{Name: "cool-secret", Namespace: namespace}},
+		}
+	}
+	withStatus := func(status map[string]interface{}) resource.Composed {
+		return runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+			r.Object = map[string]interface{}{"status": status}
+			r.SetLabels(map[string]string{LabelKeyClaimNamespace: "claimns"})
+		})
+	}
+	details := []v1alpha1.ConnectionDetail{{FromConnectionSecretKey: pointer.StringPtr("key")}}
+	plain := v1alpha1.ComposedTemplate{ConnectionDetails: details}
+	custom := v1alpha1.ComposedTemplate{ConnectionDetails: details, ConnectionSecretRef: &v1alpha1.ConnectionSecretRef{NamePath: "status.secretName", NamespacePath: "status.secretNamespace"}}
+	claim := map[string]string{LabelKeyClaimNamespace: "claimns"}
+
+	cases := map[string]struct {
+		reason string
+		o      []FetcherOption
+		cd     resource.Composed
+		t      v1alpha1.ComposedTemplate
+		want   string
+	}{
+		"Disabled": {
+			reason: "The namespace should not be defaulted unless configured to do so",
+			cd:     withRef("", claim),
+			t:      plain,
+			want:   "",
+		},
+		"ClaimNamespace": {
+			reason: "An omitted namespace should default to the claim namespace",
+			o:      []FetcherOption{WithDefaultSecretNamespace()},
+			cd:     withRef("", claim),
+			t:      plain,
+			want:   "claimns",
+		},
+		"ComposedNamespace": {
+			reason: "An omitted namespace should default to the namespace of the composed resource if there is no claim",
+			o:      []FetcherOption{WithDefaultSecretNamespace()},
+			cd:     withRef("", nil),
+			t:      plain,
+			want:   "cdns",
+		},
+		"ExplicitNamespace": {
+			reason: "An explicit namespace should take precedence over the default",
+			o:      []FetcherOption{WithDefaultSecretNamespace()},
+			cd:     withRef("coolns", claim),
+			t:      plain,
+			want:   "coolns",
+		},
+		"CustomPathOmitted": {
+			reason: "A namespace omitted from a custom connection secret path should default to the claim namespace",
+			o:      []FetcherOption{WithDefaultSecretNamespace()},
+			cd:     withStatus(map[string]interface{}{"secretName": "cool-secret"}),
+			t:      custom,
+			want:   "claimns",
+		},
+		"CustomPathExplicit": {
+			reason: "A namespace at a custom connection secret path should take precedence over the default",
+			o:      []FetcherOption{WithDefaultSecretNamespace()},
+			cd:     withStatus(map[string]interface{}{"secretName": "cool-secret", "secretNamespace": "coolns"}),
+			t:      custom,
+			want:   "coolns",
+		},
+		"Override": {
+			reason: "An overridden namespace should take precedence over an explicit namespace",
+			o:      []FetcherOption{WithDefaultSecretNamespace(), WithSecretNamespaceOverride("operatorns")},
+			cd:     withRef("coolns", claim),
+			t:      plain,
+			want:   "operatorns",
+		},
+		"OverrideCustomPath": {
+			reason: "An overridden namespace should take precedence over the namespace at a custom connection secret path",
+			o:      []FetcherOption{WithSecretNamespaceOverride("operatorns")},
+			cd:     withStatus(map[string]interface{}{"secretName": "cool-secret", "secretNamespace": "coolns"}),
+			t:      custom,
+			want:   "operatorns",
+		},
+		"OverrideCustomPathOmitted": {
+			reason: "A namespace omitted from a custom connection secret path should not be an error if the namespace is overridden",
+			o:      []FetcherOption{WithSecretNamespaceOverride("operatorns")},
+			cd:     withStatus(map[string]interface{}{"secretName": "cool-secret"}),
+			t:      custom,
+			want:   "operatorns",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var got string
+			kube := &test.MockClient{MockGet: func(_ context.Context, key client.ObjectKey, _ runtime.Object) error {
+				got = key.Namespace
+				return nil
+			}}
+			if _, err := NewAPIConnectionDetailsFetcher(kube, tc.o...).Fetch(context.Background(), tc.cd, tc.t); err != nil {
+				t.Fatalf("\n%s\nFetch(...): %s", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nFetch(...): -want namespace, +got namespace:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestResolveConnectionSecretReferences(t *testing.T) {
+	withRef := func(name string) resource.Composed {
+		return &fake.Composed{
+			ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: &runtimev1alpha1.SecretReference{Name: name, Namespace: "coolns"}},
+		}
+	}
+	withStatus := func(status map[string]interface{}) resource.Composed {
+		return runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+			r.Object = map[string]interface{}{"status": status}
+		})
+	}
+	custom := v1alpha1.ComposedTemplate{ConnectionSecretRef: &v1alpha1.ConnectionSecretRef{NamePath: "status.secretName", NamespacePath: "status.secretNamespace"}}
+
+	cases := map[string]struct {
+		reason string
+		cds    []resource.Composed
+		ts     []v1alpha1.ComposedTemplate
+		want   ConnectionSecretReferences
+	}{
+		"AllResolved": {
+			reason: "References of composed resources should be resolved, omitting resources that don't publish a secret and duplicates",
+			cds:    []resource.Composed{withRef("a"), &fake.Composed{}, withRef("a"), withStatus(map[string]interface{}{"secretName": "b", "secretNamespace": "coolns"})},
+			ts:     []v1alpha1.ComposedTemplate{{}, {}, {}, custom},
+			want: ConnectionSecretReferences{
+				Resolved: []runtimev1alpha1.SecretReference{{Name: "a", Namespace: "coolns"}, {Name: "b", Namespace: "coolns"}},
+			},
+		},
+		"MixedResolvedAndPending": {
+			reason: "References that can't yet be resolved should be returned as pending",
+			cds:    []resource.Composed{withRef("a"), withStatus(map[string]interface{}{}), withStatus(map[string]interface{}{"secretName": "", "secretNamespace": ""})},
+			ts:     []v1alpha1.ComposedTemplate{{}, custom, custom, {}},
+			want: ConnectionSecretReferences{
+				Resolved: []runtimev1alpha1.SecretReference{{Name: "a", Namespace: "coolns"}},
+				Pending:  []int{1, 2, 3},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := ResolveConnectionSecretReferences(tc.cds, tc.ts)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nResolveConnectionSecretReferences(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestFetchPublishWhenReady(t *testing.T) {
+	kube := &test.MockClient{MockGet: test.NewMockGetFn(nil, func(obj runtime.Object) error {
+		obj.(*v1.Secret).Data = map[string][]byte{"endpoint": []byte("example.org")}
+		return nil
+	})}
+	cd := &fake.Composed{
+		ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: &runtimev1alpha1.SecretReference{Name: "foo", Namespace: "bar"}},
+	}
+	tmpl := v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+		{FromConnectionSecretKey: pointer.StringPtr("endpoint"), PublishWhenReady: true},
+		{Name: pointer.StringPtr("port"), Value: pointer.StringPtr("5432"), PublishWhenReady: true},
+		{Name: pointer.StringPtr("region"), Value: pointer.StringPtr("us-east-1")},
+	}}
+	readiness := func(ready bool, err error) ReadinessProber {
+		return IsReadyFn(func(_ context.Context, _ resource.Composed, _ v1alpha1.ComposedTemplate) (bool, error) {
+			return ready, err
+		})
+	}
+
+	type want struct {
+		conn managed.ConnectionDetails
+		err  error
+	}
+	cases := map[string]struct {
+		reason    string
+		readiness ReadinessProber
+		want      want
+	}{
+		"NotReady": {
+			reason:    "Gated connection details should be withheld until the composed resource is ready",
+			readiness: readiness(false, nil),
+			want: want{
+				conn: managed.ConnectionDetails{"region": []byte("us-east-1")},
+			},
+		},
+		"Ready": {
+			reason:    "Gated connection details should be published once the composed resource is ready",
+			readiness: readiness(true, nil),
+			want: want{
+				conn: managed.ConnectionDetails{
+					"endpoint": []byte("example.org"),
+					"port":     []byte("5432"),
+					"region":   []byte("us-east-1"),
+				},
+			},
+		},
+		"ReadinessError": {
+			reason:    "Errors determining whether the composed resource is ready should be returned",
+			readiness: readiness(false, errBoom),
+			want: want{
+				err: errors.Wrap(errBoom, errReadinessGate),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := NewAPIConnectionDetailsFetcher(kube, WithReadinessGate(tc.readiness))
+			conn, err := c.Fetch(context.Background(), cd, tmpl)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nFetch(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.conn, conn); diff != "" {
+				t.Errorf("\n%s\nFetch(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestFetchAnnotations(t *testing.T) {
+	sref := &runtimev1alpha1.SecretReference{Name: "foo", Namespace: "bar"}
+	s := &v1.Secret{}
+	s.SetAnnotations(map[string]string{
+		"example.org/encrypted": "true",
+		"example.org/ignored":   "true",
+	})
+
+	type args struct {
+		kube        client.Client
+		annotations []string
+		cd          resource.Composed
+	}
+	type want struct {
+		annotations map[string]string
+		err         error
+	}
+	cases := map[string]struct {
+		reason string
+		args
+		want
+	}{
+		"NoAnnotationsConfigured": {
+			reason: "Should not fetch the secret if no annotations are configured to be propagated",
+			args: args{
+				cd: &fake.Composed{
+					ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: sref},
+				},
+			},
+		},
+		"DoesNotPublish": {
+			reason: "Should not fail if composed resource doesn't publish a connection secret",
+			args: args{
+				annotations: []string{"example.org/encrypted"},
+				cd:          &fake.Composed{},
+			},
+		},
+		"SecretGetFailed": {
+			reason: "Should fail if secret retrieval results in some error other than NotFound",
+			args: args{
+				kube:        &test.MockClient{MockGet: test.NewMockGetFn(errBoom)},
+				annotations: []string{"example.org/encrypted"},
+				cd: &fake.Composed{
+					ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: sref},
+				},
+			},
+			want: want{
+				err: errors.Wrap(errBoom, errGetSecret),
+			},
+		},
+		"Success": {
+			reason: "Should return only the configured annotations of the connection secret",
+			args: args{
+				kube: &test.MockClient{MockGet: test.NewMockGetFn(nil, func(obj runtime.Object) error {
+					s.DeepCopyInto(obj.(*v1.Secret))
+					return nil
+				})},
+				annotations: []string{"example.org/encrypted", "example.org/missing"},
+				cd: &fake.Composed{
+					ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: sref},
+				},
+			},
+			want: want{
+				annotations: map[string]string{"example.org/encrypted": "true"},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := NewAPIConnectionDetailsFetcher(tc.args.kube, WithPropagatedAnnotations(tc.args.annotations...))
+			got, err := c.FetchAnnotations(context.Background(), tc.args.cd, v1alpha1.ComposedTemplate{})
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nFetchAnnotations(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.annotations, got); diff != "" {
+				t.Errorf("\n%s\nFetchAnnotations(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRenderConnectionSecretKeys(t *testing.T) {
+	cp := composite.New()
+	cp.SetLabels(map[string]string{"region": "us-east-1"})
+
+	type want struct {
+		t   v1alpha1.ComposedTemplate
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		t      v1alpha1.ComposedTemplate
+		want   want
+	}{
+		"StaticKey": {
+			reason: "Static keys should be left unchanged",
+			t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+				{FromConnectionSecretKey: pointer.StringPtr("password")},
+			}},
+			want: want{
+				t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+					{FromConnectionSecretKey: pointer.StringPtr("password")},
+				}},
+			},
+		},
+		"TemplatedKey": {
+			reason: "Templated keys should be rendered using the composite resource",
+			t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+				{Name: pointer.StringPtr("password"), FromConnectionSecretKey: pointer.StringPtr("password-{{ .metadata.labels.region }}")},
+				{Name: pointer.StringPtr("port"), Value: pointer.StringPtr("5432")},
+			}},
+			want: want{
+				t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+					{Name: pointer.StringPtr("password"), FromConnectionSecretKey: pointer.StringPtr("password-us-east-1")},
+					{Name: pointer.StringPtr("port"), Value: pointer.StringPtr("5432")},
+				}},
+			},
+		},
+		"MissingField": {
+			reason: "Templates referencing fields the composite resource does not have should return an error",
+			t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+				{FromConnectionSecretKey: pointer.StringPtr("password-{{ .metadata.labels.zone }}")},
+			}},
+			want: want{
+				t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{
+					{FromConnectionSecretKey: pointer.StringPtr("password-{{ .metadata.labels.zone }}")},
+				}},
+				err: errors.Wrapf(errors.New(`template: key:1:21: executing "key" at <.metadata.labels.zone>: map has no entry for key "zone"`), errFmtRenderKey, "password-{{ .metadata.labels.zone }}"),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := RenderConnectionSecretKeys(cp, tc.t)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nRenderConnectionSecretKeys(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.t, got); diff != "" {
+				t.Errorf("\n%s\nRenderConnectionSecretKeys(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRenderSelectedConnectionDetails(t *testing.T) {
+	withAnnotations := func(a map[string]string) resource.Composite {
+		cp := composite.New()
+		cp.SetName("cool")
+		cp.SetAnnotations(a)
+		return cp
+	}
+
+	type args struct {
+		cp resource.Composite
+		t  v1alpha1.ComposedTemplate
+	}
+	type want struct {
+		t   v1alpha1.ComposedTemplate
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"Selected": {
+			reason: "Connection details selected by the composite resource should be published in addition to those of the template",
+			args: args{
+				cp: withAnnotations(map[string]string{"db-user": "username", "db-password": "password"}),
+				t: v1alpha1.ComposedTemplate{
+					ConnectionDetailsFromCompositeFieldPath: pointer.StringPtr("metadata.annotations"),
+					ConnectionDetails: []v1alpha1.ConnectionDetail{
+						{FromConnectionSecretKey: pointer.StringPtr("endpoint")},
+					},
+				},
+			},
+			want: want{
+				t: v1alpha1.ComposedTemplate{
+					ConnectionDetailsFromCompositeFieldPath: pointer.StringPtr("metadata.annotations"),
+					ConnectionDetails: []v1alpha1.ConnectionDetail{
+						{FromConnectionSecretKey: pointer.StringPtr("endpoint")},
+						{Name: pointer.StringPtr("db-password"), FromConnectionSecretKey: pointer.StringPtr("password")},
+						{Name: pointer.StringPtr("db-user"), FromConnectionSecretKey: pointer.StringPtr("username")},
+					},
+				},
+			},
+		},
+		"TemplateTakesPrecedence": {
+			reason: "Connection details of the template should take precedence over selected keys of the same name",
+			args: args{
+				cp: withAnnotations(map[string]string{"endpoint": "address"}),
+				t: v1alpha1.ComposedTemplate{
+					ConnectionDetailsFromCompositeFieldPath: pointer.StringPtr("metadata.annotations"),
+					ConnectionDetails: []v1alpha1.ConnectionDetail{
+						{FromConnectionSecretKey: pointer.StringPtr("endpoint")},
+					},
+				},
+			},
+			want: want{
+				t: v1alpha1.ComposedTemplate{
+					ConnectionDetailsFromCompositeFieldPath: pointer.StringPtr("metadata.annotations"),
+					ConnectionDetails: []v1alpha1.ConnectionDetail{
+						{FromConnectionSecretKey: pointer.StringPtr("endpoint")},
+					},
+				},
+			},
+		},
+		"NotSelected": {
+			reason: "Nothing should be selected if the composite resource does not have the field",
+			args: args{
+				cp: withAnnotations(nil),
+				t:  v1alpha1.ComposedTemplate{ConnectionDetailsFromCompositeFieldPath: pointer.StringPtr("metadata.annotations")},
+			},
+			want: want{
+				t: v1alpha1.ComposedTemplate{ConnectionDetailsFromCompositeFieldPath: pointer.StringPtr("metadata.annotations")},
+			},
+		},
+		"NotStrings": {
+			reason: "A field that does not map names to keys should return an error",
+			args: args{
+				cp: withAnnotations(nil),
+				t:  v1alpha1.ComposedTemplate{ConnectionDetailsFromCompositeFieldPath: pointer.StringPtr("metadata.name")},
+			},
+			want: want{
+				t:   v1alpha1.ComposedTemplate{ConnectionDetailsFromCompositeFieldPath: pointer.StringPtr("metadata.name")},
+				err: errors.Wrapf(errors.New("metadata.name: not an object"), errFmtSelectConnection, "metadata.name"),
+			},
+		},
+		"InvalidKey": {
+			reason: "A selected name that is not a valid connection secret key should return an error",
+			args: args{
+				cp: withAnnotations(map[string]string{"example.org/password": "password"}),
+				t:  v1alpha1.ComposedTemplate{ConnectionDetailsFromCompositeFieldPath: pointer.StringPtr("metadata.annotations")},
+			},
+			want: want{
+				t: v1alpha1.ComposedTemplate{ConnectionDetailsFromCompositeFieldPath: pointer.StringPtr("metadata.annotations")},
+				err: errors.Wrapf(errors.Errorf(errFmtInvalidConnectionKey, "example.org/password", strings.Join(validation.IsConfigMapKey("example.org/password"), ", ")),
+					errFmtSelectConnection, "metadata.annotations"),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := RenderConnectionSecretKeys(tc.args.cp, tc.args.t)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nRenderConnectionSecretKeys(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.t, got); diff != "" {
+				t.Errorf("\n%s\nRenderConnectionSecretKeys(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRenderReadinessChecks(t *testing.T) {
+	cp := composite.New()
+	cp.SetFinalizers([]string{"a", "b"})
+	cp.SetAnnotations(map[string]string{AnnotationKeyCompositionRevision: "3"})
+
+	type want struct {
+		t   v1alpha1.ComposedTemplate
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		t      v1alpha1.ComposedTemplate
+		want   want
+	}{
+		"StaticMatchStrings": {
+			reason: "Checks that do not read match strings from the composite resource should be left unchanged",
+			t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+				{Type: "MatchString", FieldPath: "status.zone", MatchStrings: []string{"a"}},
+			}},
+			want: want{
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+					{Type: "MatchString", FieldPath: "status.zone", MatchStrings: []string{"a"}},
+				}},
+			},
+		},
+		"CompositeMatchStrings": {
+			reason: "Match strings should be read from the composite resource",
+			t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+				{Type: "MatchString", FieldPath: "status.zone", MatchStringsFromCompositeFieldPath: "metadata.finalizers"},
+			}},
+			want: want{
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+					{Type: "MatchString", FieldPath: "status.zone", MatchStringsFromCompositeFieldPath: "metadata.finalizers", MatchStrings: []string{"a", "b"}},
+				}},
+			},
+		},
+		"MissingCompositeField": {
+			reason: "A missing composite resource field should result in an empty set of match strings",
+			t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+				{Type: "MatchString", FieldPath: "status.zone", MatchStringsFromCompositeFieldPath: "spec.zones"},
+			}},
+			want: want{
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+					{Type: "MatchString", FieldPath: "status.zone", MatchStringsFromCompositeFieldPath: "spec.zones", MatchStrings: []string{}},
+				}},
+			},
+		},
+		"CompositionRevision": {
+			reason: "The composition revision should be read from the composite resource",
+			t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+				{Type: "MatchCompositionRevision", FieldPath: "metadata.annotations[crossplane.io/composition-revision]"},
+			}},
+			want: want{
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+					{Type: "MatchCompositionRevision", FieldPath: "metadata.annotations[crossplane.io/composition-revision]", MatchString: "3"},
+				}},
+			},
+		},
+		"NotAnArray": {
+			reason: "A composite resource field that is not a string array should return an error",
+			t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+				{Type: "MatchString", FieldPath: "status.zone", MatchStringsFromCompositeFieldPath: "metadata"},
+			}},
+			want: want{
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+					{Type: "MatchString", FieldPath: "status.zone", MatchStringsFromCompositeFieldPath: "metadata"},
+				}},
+				err: errors.Wrapf(errors.New("metadata: not an array"), errFmtMatchStrings, 0),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := RenderReadinessChecks(cp, tc.t)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nRenderReadinessChecks(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.t, got); diff != "" {
+				t.Errorf("\n%s\nRenderReadinessChecks(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestIsReady(t *testing.T) {
+	withUID := func(r *runtimecomposed.Unstructured) { r.SetUID("olala") }
+	withRevision := func(rev string) runtimecomposed.Option {
+		return func(r *runtimecomposed.Unstructured) {
+			r.SetAnnotations(map[string]string{AnnotationKeyCompositionRevision: rev})
+		}
+	}
+	revisionPath := "metadata.annotations[crossplane.io/composition-revision]"
+	withFinalizers := func(f ...string) runtimecomposed.Option {
+		return func(r *runtimecomposed.Unstructured) { r.SetFinalizers(f) }
+	}
+
+	type args struct {
+		cd *runtimecomposed.Unstructured
+		t  v1alpha1.ComposedTemplate
+	}
+	type want struct {
+		ready bool
+		err   error
+	}
+	cases := map[string]struct {
+		reason string
+		args
+		want
+	}{
+		"NoCustomCheck": {
+			reason: "If no custom check is given, Ready condition should be used",
+			args: args{
+				cd: runtimecomposed.New(runtimecomposed.WithConditions(runtimev1alpha1.Available())),
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"NonEmptyErr": {
+			reason: "If the value cannot be fetched due to fieldPath being misconfigured, error should be returned",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "NonEmpty", FieldPath: "metadata..uid"}}},
+			},
+			want: want{
+				err: errors.Wrapf(errors.New("unexpected '.' at position 9"), "cannot parse path %q", "metadata..uid"),
+			},
+		},
+		"NonEmptyFalse": {
+			reason: "If the field does not have value, NonEmpty check should return false",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "NonEmpty", FieldPath: "metadata.uid"}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"NonEmptyTrue": {
+			reason: "If the field does have a value, NonEmpty check should return true",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.SetUID("olala")
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "NonEmpty", FieldPath: "metadata.uid"}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"ReadyAndNonEmptyTrue": {
+			reason: "If the Ready condition is True and the field has a value, ReadyAndNonEmpty check should return true",
+			args: args{
+				cd: runtimecomposed.New(runtimecomposed.WithConditions(runtimev1alpha1.Available()), withUID),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "ReadyAndNonEmpty", FieldPath: "metadata.uid"}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"ReadyAndNonEmptyNotReady": {
+			reason: "If the Ready condition is not True, ReadyAndNonEmpty check should return false",
+			args: args{
+				cd: runtimecomposed.New(runtimecomposed.WithConditions(runtimev1alpha1.Creating()), withUID),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "ReadyAndNonEmpty", FieldPath: "metadata.uid"}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"ReadyAndNonEmptyEmpty": {
+			reason: "If the field does not have a value, ReadyAndNonEmpty check should return false",
+			args: args{
+				cd: runtimecomposed.New(runtimecomposed.WithConditions(runtimev1alpha1.Available())),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "ReadyAndNonEmpty", FieldPath: "metadata.uid"}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"ReadyAndNonEmptyNeither": {
+			reason: "If the Ready condition is missing and the field does not have a value, ReadyAndNonEmpty check should return false",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "ReadyAndNonEmpty", FieldPath: "metadata.uid"}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchFieldPathTrue": {
+			reason: "If the status subtree matches the spec subtree, MatchFieldPath check should return true",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"spec": map[string]interface{}{
+							"forProvider": map[string]interface{}{"size": int64(10), "tags": []interface{}{"a"}},
+						},
+						"status": map[string]interface{}{
+							"atProvider": map[string]interface{}{"size": int64(10), "tags": []interface{}{"a"}},
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchFieldPath", FieldPath: "status.atProvider", MatchFieldPath: "spec.forProvider"}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"MatchFieldPathFalse": {
+			reason: "If the status subtree diverges from the spec subtree, MatchFieldPath check should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"spec": map[string]interface{}{
+							"forProvider": map[string]interface{}{"size": int64(10), "tags": []interface{}{"a"}},
+						},
+						"status": map[string]interface{}{
+							"atProvider": map[string]interface{}{"size": int64(5), "tags": []interface{}{"a"}},
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchFieldPath", FieldPath: "status.atProvider", MatchFieldPath: "spec.forProvider"}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchFieldPathMissing": {
+			reason: "If the status subtree does not exist, MatchFieldPath check should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"spec": map[string]interface{}{
+							"forProvider": map[string]interface{}{"size": int64(10), "tags": []interface{}{"a"}},
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchFieldPath", FieldPath: "status.atProvider", MatchFieldPath: "spec.forProvider"}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchBoolTrue": {
+			reason: "If the boolean value of the field does match, it should return true",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{"status": map[string]interface{}{"atProvider": map[string]interface{}{"available": true}}}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchBool", FieldPath: "status.atProvider.available", MatchBool: true}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"MatchBoolFalse": {
+			reason: "If the boolean value of the field does not match, it should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{"status": map[string]interface{}{"atProvider": map[string]interface{}{"available": false}}}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchBool", FieldPath: "status.atProvider.available", MatchBool: true}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchBoolMissing": {
+			reason: "If the field does not exist, it should return false rather than an error",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchBool", FieldPath: "status.atProvider.available", MatchBool: false}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchBoolNotBool": {
+			reason: "If the value of the field is not a boolean, error should be returned",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{"status": map[string]interface{}{"atProvider": map[string]interface{}{"available": "true"}}}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchBool", FieldPath: "status.atProvider.available", MatchBool: true}}},
+			},
+			want: want{
+				err: errors.New("status.atProvider.available: not a bool"),
+			},
+		},
+		"MatchRegexTrue": {
+			reason: "If the value of the field matches the regular expression, it should return true",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{"status": map[string]interface{}{"phase": "RunningStable"}}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchRegex", FieldPath: "status.phase", MatchRegex: "^Running"}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"MatchRegexFalse": {
+			reason: "If the value of the field does not match the regular expression, it should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{"status": map[string]interface{}{"phase": "Pending"}}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchRegex", FieldPath: "status.phase", MatchRegex: "^Running"}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchRegexMissing": {
+			reason: "If the field does not exist, it should return false rather than an error",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchRegex", FieldPath: "status.phase", MatchRegex: ".*"}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchRegexInvalid": {
+			reason: "If the regular expression cannot be compiled, error should be returned",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchRegex", FieldPath: "status.phase", MatchRegex: "Running("}}},
+			},
+			want: want{
+				err: errors.Wrapf(func() error { _, err := regexp.Compile("Running("); return err }(), errFmtCompileRegex, 0, "Running("),
+			},
+		},
+		"MatchConditionTrue": {
+			reason: "If the condition has the default status True, it should return true",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.SetConditions(runtimev1alpha1.Condition{Type: "Synced", Status: v1.ConditionTrue})
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{
+					Type:           "MatchCondition",
+					MatchCondition: &v1alpha1.MatchConditionReadinessCheck{Type: "Synced"},
+				}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"MatchConditionStatus": {
+			reason: "If the condition has the expected status, it should return true",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.SetConditions(runtimev1alpha1.Condition{Type: "Validated", Status: v1.ConditionFalse})
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{
+					Type:           "MatchCondition",
+					MatchCondition: &v1alpha1.MatchConditionReadinessCheck{Type: "Validated", Status: v1.ConditionFalse},
+				}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"MatchConditionMismatch": {
+			reason: "If the condition does not have the expected status, it should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.SetConditions(runtimev1alpha1.Condition{Type: "Synced", Status: v1.ConditionFalse})
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{
+					Type:           "MatchCondition",
+					MatchCondition: &v1alpha1.MatchConditionReadinessCheck{Type: "Synced"},
+				}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchConditionMissing": {
+			reason: "A condition the composed resource does not have should be considered to have status Unknown",
+			args: args{
+				cd: runtimecomposed.New(),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{
+					Type:           "MatchCondition",
+					MatchCondition: &v1alpha1.MatchConditionReadinessCheck{Type: "Synced", Status: v1.ConditionUnknown},
+				}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"MatchConditionNotSpecified": {
+			reason: "If no condition to match is specified, error should be returned",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchCondition"}}},
+			},
+			want: want{
+				err: errors.Errorf(errFmtNoMatchCondition, 0),
+			},
+		},
+		"MatchStringErr": {
+			reason: "If the value cannot be fetched due to fieldPath being misconfigured, error should be returned",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchString", FieldPath: "metadata..uid"}}},
+			},
+			want: want{
+				err: errors.Wrapf(errors.New("unexpected '.' at position 9"), "cannot parse path %q", "metadata..uid"),
+			},
+		},
+		"MatchStringFalse": {
+			reason: "If the value of the field does not match, it should return false",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchString", FieldPath: "metadata.uid", MatchString: "olala"}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchStringTrue": {
+			reason: "If the value of the field does match, it should return true",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.SetUID("olala")
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchString", FieldPath: "metadata.uid", MatchString: "olala"}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"MatchStringsTrue": {
+			reason: "If the value of the field matches any of the match strings, it should return true",
+			args: args{
+				cd: runtimecomposed.New(withUID),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchString", FieldPath: "metadata.uid", MatchStrings: []string{"cool", "olala"}}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"MatchStringsFalse": {
+			reason: "If the value of the field matches none of the match strings, it should return false",
+			args: args{
+				cd: runtimecomposed.New(withUID),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchString", FieldPath: "metadata.uid", MatchStrings: []string{"cool"}}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchStringsEmpty": {
+			reason: "If match strings are read from the composite resource but none were found, it should return false",
+			args: args{
+				cd: runtimecomposed.New(withUID),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchString", FieldPath: "metadata.uid", MatchStringsFromCompositeFieldPath: "spec.zones"}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchCompositionRevisionTrue": {
+			reason: "If the composed resource has been updated to the composition revision, it should return true",
+			args: args{
+				cd: runtimecomposed.New(withRevision("3")),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchCompositionRevision", FieldPath: revisionPath, MatchString: "3"}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"MatchCompositionRevisionStale": {
+			reason: "If the composed resource has yet to be updated to the composition revision, it should return false",
+			args: args{
+				cd: runtimecomposed.New(withRevision("2")),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchCompositionRevision", FieldPath: revisionPath, MatchString: "3"}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchCompositionRevisionMissing": {
+			reason: "If the composed resource has no revision, it should return false",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchCompositionRevision", FieldPath: revisionPath, MatchString: "3"}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchCompositionRevisionUnused": {
+			reason: "If the composite resource has no revision, it should return true",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchCompositionRevision", FieldPath: revisionPath}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"NoFinalizersPresent": {
+			reason: "If a watched finalizer is present, it should return false",
+			args: args{
+				cd: runtimecomposed.New(withFinalizers("finalizer.managedresource.crossplane.io", "example.org/updating")),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "NoFinalizers", Finalizers: []string{"example.org/updating"}}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"NoFinalizersAbsent": {
+			reason: "If no watched finalizer is present, it should return true",
+			args: args{
+				cd: runtimecomposed.New(withFinalizers("finalizer.managedresource.crossplane.io")),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "NoFinalizers", Finalizers: []string{"example.org/updating"}}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"NoFinalizersNone": {
+			reason: "If the composed resource has no finalizers, it should return true",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "NoFinalizers", Finalizers: []string{"example.org/updating"}}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"MatchIntegerErr": {
+			reason: "If the value cannot be fetched due to fieldPath being misconfigured, error should be returned",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchInteger", FieldPath: "metadata..uid"}}},
+			},
+			want: want{
+				err: errors.Wrapf(errors.New("unexpected '.' at position 9"), "cannot parse path %q", "metadata..uid"),
+			},
+		},
+		"MatchIntegerFalse": {
+			reason: "If the value of the field does not match, it should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"spec": map[string]interface{}{
+							"someNum": int64(6),
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchInteger", FieldPath: "spec.someNum", MatchInteger: 5}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchIntegerMissing": {
+			reason: "If the field is missing, it should return false",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchInteger", FieldPath: "spec.someNum", MatchInteger: 5}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchIntegerQuoted": {
+			reason: "If the value of the field is a quoted integer, an error suggesting to parse it as a quantity should be returned",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"spec": map[string]interface{}{
+							"someNum": "5",
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchInteger", FieldPath: "spec.someNum", MatchInteger: 5}}},
+			},
+			want: want{
+				err: errors.Errorf(errFmtQuotedInteger, "spec.someNum"),
+			},
+		},
+		"MatchIntegerWrongType": {
+			reason: "If the value of the field is not an integer, an error naming its type should be returned",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"spec": map[string]interface{}{
+							"someNum": true,
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchInteger", FieldPath: "spec.someNum", MatchInteger: 5}}},
+			},
+			want: want{
+				err: errors.Errorf(errFmtNotInteger, "spec.someNum", "boolean"),
+			},
+		},
+		"MatchIntegerTrue": {
+			reason: "If the value of the field does match, it should return true",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"spec": map[string]interface{}{
 							"someNum": int64(5),
 						},
 					}
 				}),
-				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchInteger", FieldPath: "spec.someNum", MatchInteger: 5}}},
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchInteger", FieldPath: "spec.someNum", MatchInteger: 5}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"GreaterThanTrue": {
+			reason: "If the value of the field is greater than the operand, it should return true",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"readyReplicas": int64(3),
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "GreaterThan", FieldPath: "status.readyReplicas", MatchInteger: 2}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"GreaterThanFalse": {
+			reason: "If the value of the field is equal to the operand, it should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"readyReplicas": int64(2),
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "GreaterThan", FieldPath: "status.readyReplicas", MatchInteger: 2}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"LessThanTrue": {
+			reason: "If the value of the field is less than the operand, it should return true",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"readyReplicas": int64(1),
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "LessThan", FieldPath: "status.readyReplicas", MatchInteger: 2}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"LessThanFalse": {
+			reason: "If the value of the field is greater than the operand, it should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"readyReplicas": int64(3),
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "LessThan", FieldPath: "status.readyReplicas", MatchInteger: 2}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"GreaterThanNotInteger": {
+			reason: "If the value of the field is not an integer, an error should be returned",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"readyReplicas": "three",
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "GreaterThan", FieldPath: "status.readyReplicas", MatchInteger: 2}}},
+			},
+			want: want{
+				err: errors.Wrapf(errors.Errorf(errFmtNotInteger, "status.readyReplicas", "string"), errFmtCompareInteger, 0, "status.readyReplicas", 2),
+			},
+		},
+		"GreaterThanMissing": {
+			reason: "If the field is missing, it should return false",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "GreaterThan", FieldPath: "status.readyReplicas", MatchInteger: 2}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"GroupOrTrue": {
+			reason: "If any check of an Or group passes, it should return true",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"b": "set",
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "Group", Group: &v1alpha1.GroupReadinessCheck{
+					LogicOp: v1alpha1.LogicOpOr,
+					Checks: []v1alpha1.ReadinessCheck{
+						{Type: "NonEmpty", FieldPath: "status.a"},
+						{Type: "NonEmpty", FieldPath: "status.b"},
+					},
+				}}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"GroupAndFalse": {
+			reason: "If any check of an And group fails, it should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"b": "set",
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "Group", Group: &v1alpha1.GroupReadinessCheck{
+					LogicOp: v1alpha1.LogicOpAnd,
+					Checks: []v1alpha1.ReadinessCheck{
+						{Type: "NonEmpty", FieldPath: "status.a"},
+						{Type: "NonEmpty", FieldPath: "status.b"},
+					},
+				}}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"GroupDefaultsToAnd": {
+			reason: "If a group has no logical operator, all of its checks must pass",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"b": "set",
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "Group", Group: &v1alpha1.GroupReadinessCheck{
+					Checks: []v1alpha1.ReadinessCheck{
+						{Type: "NonEmpty", FieldPath: "status.a"},
+						{Type: "NonEmpty", FieldPath: "status.b"},
+					},
+				}}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"GroupOrFalse": {
+			reason: "If no check of an Or group passes, it should return false",
+			args: args{
+				cd: runtimecomposed.New(),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "Group", Group: &v1alpha1.GroupReadinessCheck{
+					LogicOp: v1alpha1.LogicOpOr,
+					Checks: []v1alpha1.ReadinessCheck{
+						{Type: "NonEmpty", FieldPath: "status.a"},
+						{Type: "NonEmpty", FieldPath: "status.b"},
+					},
+				}}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"GroupEmpty": {
+			reason: "A group without checks should return true",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "Group", Group: &v1alpha1.GroupReadinessCheck{LogicOp: v1alpha1.LogicOpOr}}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"GroupNotSpecified": {
+			reason: "If a group of checks is not specified, an error should be returned",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "Group"}}},
+			},
+			want: want{
+				err: errors.Errorf(errFmtNoGroup, 0),
+			},
+		},
+		"NegateMismatch": {
+			reason: "If a negated check does not match, it should return true",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"phase": "Running",
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchString", FieldPath: "status.phase", MatchString: "Failed", Negate: true}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"NegateMatch": {
+			reason: "If a negated check matches, it should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"phase": "Failed",
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchString", FieldPath: "status.phase", MatchString: "Failed", Negate: true}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"NegateMissing": {
+			reason: "If the field of a negated check is missing, it should return false",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchString", FieldPath: "status.phase", MatchString: "Failed", Negate: true}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"NegateGroupedMissing": {
+			reason: "If the field of a negated check in a group is missing, the check should not pass",
+			args: args{
+				cd: runtimecomposed.New(),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "Group", Group: &v1alpha1.GroupReadinessCheck{
+					LogicOp: v1alpha1.LogicOpOr,
+					Checks:  []v1alpha1.ReadinessCheck{{Type: "MatchString", FieldPath: "status.phase", MatchString: "Failed", Negate: true}},
+				}}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchFloatTrue": {
+			reason: "If the value of the field equals the float, it should return true",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"cpuUtilization": 0.85,
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchFloat", FieldPath: "status.cpuUtilization", MatchFloat: 0.85}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"MatchFloatFalse": {
+			reason: "If the value of the field does not equal the float, it should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"cpuUtilization": 0.8500001,
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchFloat", FieldPath: "status.cpuUtilization", MatchFloat: 0.85}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchFloatTolerance": {
+			reason: "If the value of the field is within the tolerance of the float, it should return true",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"cpuUtilization": 0.8500001,
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchFloat", FieldPath: "status.cpuUtilization", MatchFloat: 0.85, Tolerance: 0.001}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"MatchFloatInteger": {
+			reason: "If the value of the field is an integer, it should be compared as a float",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"cpuUtilization": int64(1),
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchFloat", FieldPath: "status.cpuUtilization", MatchFloat: 0.85, Tolerance: 0.2}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"MatchFloatNotNumber": {
+			reason: "If the value of the field is not a number, an error should be returned",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"cpuUtilization": "high",
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchFloat", FieldPath: "status.cpuUtilization", MatchFloat: 0.85}}},
+			},
+			want: want{
+				err: errors.Wrapf(errors.Errorf(errFmtNotNumber, "status.cpuUtilization"), errFmtMatchFloat, 0, "status.cpuUtilization", 0.85),
+			},
+		},
+		"MatchFloatMissing": {
+			reason: "If the field is missing, it should return false",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchFloat", FieldPath: "status.cpuUtilization", MatchFloat: 0.85}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"NonEmptyCollectionArray": {
+			reason: "If the field is an array with elements, it should return true",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{"status": map[string]interface{}{"endpoints": []interface{}{"10.0.0.1"}}}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "NonEmptyCollection", FieldPath: "status.endpoints"}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"NonEmptyCollectionObject": {
+			reason: "If the field is an object with fields, it should return true",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{"status": map[string]interface{}{"endpoints": map[string]interface{}{"primary": "10.0.0.1"}}}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "NonEmptyCollection", FieldPath: "status.endpoints"}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"NonEmptyCollectionEmptyArray": {
+			reason: "If the field is an empty array, it should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{"status": map[string]interface{}{"endpoints": []interface{}{}}}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "NonEmptyCollection", FieldPath: "status.endpoints"}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"NonEmptyCollectionEmptyObject": {
+			reason: "If the field is an empty object, it should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{"status": map[string]interface{}{"endpoints": map[string]interface{}{}}}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "NonEmptyCollection", FieldPath: "status.endpoints"}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"NonEmptyCollectionMissing": {
+			reason: "If the field is missing, it should return false",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "NonEmptyCollection", FieldPath: "status.endpoints"}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"NonEmptyCollectionScalar": {
+			reason: "If the field is not an array or object, an error naming its type should be returned",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{"status": map[string]interface{}{"endpoints": "10.0.0.1"}}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "NonEmptyCollection", FieldPath: "status.endpoints"}}},
+			},
+			want: want{
+				err: errors.Errorf(errFmtNotCollection, "status.endpoints", "string"),
+			},
+		},
+		"MatchAllTrue": {
+			reason: "If every value the wildcard expands to matches, it should return true",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{"status": map[string]interface{}{"conditions": []interface{}{
+						map[string]interface{}{"type": "Synced", "status": "True"},
+						map[string]interface{}{"type": "Ready", "status": "True"},
+					}}}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchAll", FieldPath: "status.conditions[*].status", MatchString: "True"}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"MatchAllFalse": {
+			reason: "If any value the wildcard expands to does not match, it should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{"status": map[string]interface{}{"conditions": []interface{}{
+						map[string]interface{}{"type": "Synced", "status": "True"},
+						map[string]interface{}{"type": "Ready", "status": "False"},
+					}}}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchAll", FieldPath: "status.conditions[*].status", MatchString: "True"}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchAllNoElements": {
+			reason: "If the wildcard expands to no values, it should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{"status": map[string]interface{}{"conditions": []interface{}{}}}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchAll", FieldPath: "status.conditions[*].status", MatchString: "True"}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchAnyTrue": {
+			reason: "If any value the wildcard expands to matches, it should return true",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{"status": map[string]interface{}{"conditions": []interface{}{
+						map[string]interface{}{"type": "Synced", "status": "True"},
+						map[string]interface{}{"type": "Ready", "status": "False"},
+					}}}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchAny", FieldPath: "status.conditions[*].status", MatchString: "True"}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"MatchAnyNoElements": {
+			reason: "If the wildcard expands to no values, it should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{"status": map[string]interface{}{"conditions": []interface{}{}}}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchAny", FieldPath: "status.conditions[*].status", MatchString: "True"}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchAllNotCollection": {
+			reason: "If a wildcard expands a value that is not an array or object, an error should be returned",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{"status": map[string]interface{}{"conditions": "True"}}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchAll", FieldPath: "status.conditions[*].status", MatchString: "True"}}},
+			},
+			want: want{
+				err: errors.Wrapf(errors.Errorf(errFmtNotCollection, "status.conditions", "string"), errFmtExpandWildcards, "status.conditions[*].status"),
+			},
+		},
+		"MatchIntegerQuantityTrue": {
+			reason: "If the quantity value of the field does match, it should return true regardless of its suffix",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"storage": "102400Mi",
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchInteger", FieldPath: "status.storage", MatchInteger: 100 * 1024 * 1024 * 1024, AsQuantity: true}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"MatchIntegerQuantityFalse": {
+			reason: "If the quantity value of the field does not match, it should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"storage": "100G",
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchInteger", FieldPath: "status.storage", MatchInteger: 100 * 1024 * 1024 * 1024, AsQuantity: true}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchIntegerQuantityNumber": {
+			reason: "A plain number should be accepted as a quantity",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"storage": int64(100),
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchInteger", FieldPath: "status.storage", MatchInteger: 100, AsQuantity: true}}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"MatchIntegerQuantityErr": {
+			reason: "If the value of the field is not a valid quantity, an error should be returned",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"storage": "lots",
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchInteger", FieldPath: "status.storage", AsQuantity: true}}},
+			},
+			want: want{
+				err: errors.Wrapf(kresource.ErrFormatWrong, errFmtParseQuantity, "status.storage"),
+			},
+		},
+		"MatchIntegerQuantityIgnoreErrors": {
+			reason: "If the value of the field is not a valid quantity and errors are ignored, it should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"storage": "lots",
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchInteger", FieldPath: "status.storage", AsQuantity: true, IgnoreErrors: true}}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"MatchStringIgnoreErrors": {
+			reason: "If the value of the field is malformed and errors are ignored, it should return false",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"phase": int64(1),
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+					{Type: "MatchString", FieldPath: "status.phase", MatchString: "Ready", IgnoreErrors: true},
+				}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"UnknownType": {
+			reason: "If unknown type is chosen, it should return an error",
+			args: args{
+				cd: runtimecomposed.New(),
+				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "Olala"}}},
+			},
+			want: want{
+				err: errors.New("readiness check at index 0: an unknown type is chosen"),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := &DefaultReadinessChecker{}
+			ready, err := c.IsReady(context.Background(), tc.args.cd, tc.args.t)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nIsReady(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ready, ready); diff != "" {
+				t.Errorf("\n%s\nIsReady(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRegexpCache(t *testing.T) {
+	c := newRegexpCache()
+	first, err := c.compile("^Running")
+	if err != nil {
+		t.Fatalf("compile(...): %s", err)
+	}
+	second, err := c.compile("^Running")
+	if err != nil {
+		t.Fatalf("compile(...): %s", err)
+	}
+	if first != second {
+		t.Errorf("compile(...): a previously compiled regular expression should be returned from the cache")
+	}
+	if _, err := c.compile("Running("); err == nil {
+		t.Errorf("compile(...): an invalid regular expression should return an error")
+	}
+	if _, ok := c.regexps["Running("]; ok {
+		t.Errorf("compile(...): an invalid regular expression should not be cached")
+	}
+}
+
+func TestTerminalReadinessCheck(t *testing.T) {
+	start := time.Now()
+	withPhase := func(phase string) *runtimecomposed.Unstructured {
+		return runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+			r.SetName("cool")
+			r.SetUID("olala")
+			r.Object["status"] = map[string]interface{}{"phase": phase}
+		})
+	}
+	tmpl := v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{
+		Type:                 "MatchString",
+		FieldPath:            "status.phase",
+		MatchString:          "Failed",
+		Negate:               true,
+		TerminalAfterSeconds: pointer.Int64Ptr(300),
+	}}}
+
+	type observation struct {
+		after time.Duration
+		cd    *runtimecomposed.Unstructured
+	}
+	type want struct {
+		ready bool
+		err   error
+	}
+	cases := map[string]struct {
+		reason string
+		obs    []observation
+		want   []want
+	}{
+		"NegatedCheckPasses": {
+			reason: "A negated check should pass when the failure condition does not hold",
+			obs:    []observation{{after: 0, cd: withPhase("Running")}},
+			want:   []want{{ready: true}},
+		},
+		"TerminalBoundary": {
+			reason: "A check should only fail terminally once it has continuously failed for the timeout",
+			obs: []observation{
+				{after: 0, cd: withPhase("Failed")},
+				{after: 299 * time.Second, cd: withPhase("Failed")},
+				{after: 300 * time.Second, cd: withPhase("Failed")},
+			},
+			want: []want{
+				{ready: false},
+				{ready: false},
+				{ready: false, err: &TerminalError{Composed: "cool", Check: 0, Duration: 300 * time.Second}},
+			},
+		},
+		"RecoveryResetsTimeout": {
+			reason: "A check that passes should restart its timeout if it subsequently fails",
+			obs: []observation{
+				{after: 0, cd: withPhase("Failed")},
+				{after: 200 * time.Second, cd: withPhase("Running")},
+				{after: 250 * time.Second, cd: withPhase("Failed")},
+				{after: 500 * time.Second, cd: withPhase("Failed")},
+				{after: 550 * time.Second, cd: withPhase("Failed")},
+			},
+			want: []want{
+				{ready: false},
+				{ready: true},
+				{ready: false},
+				{ready: false},
+				{ready: false, err: &TerminalError{Composed: "cool", Check: 0, Duration: 300 * time.Second}},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			now := start
+			c := &DefaultReadinessChecker{failures: newFailureTracker(func() time.Time { return now })}
+			for i, o := range tc.obs {
+				now = start.Add(o.after)
+				ready, err := c.IsReady(context.Background(), o.cd, tmpl)
+				if diff := cmp.Diff(tc.want[i].err, err, test.EquateErrors()); diff != "" {
+					t.Errorf("\n%s\nIsReady(...) at %s: -want, +got:\n%s", tc.reason, o.after, diff)
+				}
+				if diff := cmp.Diff(tc.want[i].ready, ready); diff != "" {
+					t.Errorf("\n%s\nIsReady(...) at %s: -want, +got:\n%s", tc.reason, o.after, diff)
+				}
+				if tc.want[i].err != nil && !IsTerminal(err) {
+					t.Errorf("\n%s\nIsTerminal(...) at %s: want true", tc.reason, o.after)
+				}
+			}
+		})
+	}
+}
+
+func TestFailureTrackerForgets(t *testing.T) {
+	start := time.Now()
+	withUID := func(uid types.UID) resource.Composed {
+		cd := &fake.Composed{}
+		cd.SetName("cool")
+		cd.SetUID(uid)
+		return cd
+	}
+	check := v1alpha1.ReadinessCheck{Type: "NonEmpty", FieldPath: "status.ready", TerminalAfterSeconds: pointer.Int64Ptr(300)}
+
+	cases := map[string]struct {
+		reason string
+		others int
+		want   error
+	}{
+		"Tracked": {
+			reason: "A check that has failed for longer than allowed should fail terminally",
+			want:   &TerminalError{Composed: "cool", Check: 0, Duration: 300 * time.Second},
+		},
+		"Forgotten": {
+			reason: "A check that was forgotten because too many checks were tracked should start failing again",
+			others: maxTracked,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			now := start
+			f := newFailureTracker(func() time.Time { return now })
+			_ = f.track(withUID("olala"), 0, check, false)
+			for i := 0; i < tc.others; i++ {
+				_ = f.track(withUID(types.UID(fmt.Sprintf("olala-%d", i))), 0, check, false)
+			}
+			now = start.Add(300 * time.Second)
+			err := f.track(withUID("olala"), 0, check, false)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\ntrack(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestReadinessCheckTimeout(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	withPhase := func(phase string, age time.Duration) *runtimecomposed.Unstructured {
+		return runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+			r.SetName("cool")
+			if age > 0 {
+				r.SetCreationTimestamp(metav1.NewTime(now.Add(-age)))
+			}
+			r.Object["status"] = map[string]interface{}{"phase": phase}
+		})
+	}
+	tmpl := v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{
+		Type:           "MatchString",
+		FieldPath:      "status.phase",
+		MatchString:    "Running",
+		TimeoutSeconds: pointer.Int64Ptr(300),
+	}}}
+
+	type want struct {
+		ready bool
+		err   error
+	}
+	cases := map[string]struct {
+		reason string
+		cd     *runtimecomposed.Unstructured
+		want   want
+	}{
+		"NotYetCreated": {
+			reason: "A composed resource that has not yet been created should not time out",
+			cd:     withPhase("Creating", 0),
+		},
+		"WithinTimeout": {
+			reason: "A check that has not passed should merely not be ready before its timeout elapses",
+			cd:     withPhase("Creating", 299*time.Second),
+		},
+		"PassedAfterTimeout": {
+			reason: "A check that passes should not time out, regardless of the age of the composed resource",
+			cd:     withPhase("Running", time.Hour),
+			want:   want{ready: true},
+		},
+		"TimedOut": {
+			reason: "A check that has not passed once its timeout elapses should fail terminally",
+			cd:     withPhase("Creating", 300*time.Second),
+			want:   want{err: &TerminalError{Composed: "cool", Check: 0, Duration: 300 * time.Second, TimedOut: true}},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := &DefaultReadinessChecker{failures: newFailureTracker(func() time.Time { return now })}
+			ready, err := c.IsReady(context.Background(), tc.cd, tmpl)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nIsReady(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ready, ready); diff != "" {
+				t.Errorf("\n%s\nIsReady(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestConsecutiveSuccesses(t *testing.T) {
+	tmpl := v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+		{Type: "MatchString", FieldPath: "status.phase", MatchString: "Running", ConsecutiveSuccesses: 3},
+	}}
+	uid := types.UID("cool-uid")
+
+	type want struct {
+		ready bool
+		count int
+	}
+	cases := map[string]struct {
+		reason string
+		phases []string
+		want   []want
+	}{
+		"Increment": {
+			reason: "A check should only pass once it has passed the required number of reconciles in a row",
+			phases: []string{"Running", "Running", "Running", "Running"},
+			want: []want{
+				{ready: false, count: 1},
+				{ready: false, count: 2},
+				{ready: true, count: 3},
+				{ready: true, count: 3},
+			},
+		},
+		"Reset": {
+			reason: "Any failure should reset the count",
+			phases: []string{"Running", "Running", "Pending", "Running", "Running", "Running"},
+			want: []want{
+				{ready: false, count: 1},
+				{ready: false, count: 2},
+				{ready: false, count: 0},
+				{ready: false, count: 1},
+				{ready: false, count: 2},
+				{ready: true, count: 3},
+			},
+		},
+		"ResetWhenReady": {
+			reason: "A failure should reset the count even after the check has passed",
+			phases: []string{"Running", "Running", "Running", "Pending", "Running"},
+			want: []want{
+				{ready: false, count: 1},
+				{ready: false, count: 2},
+				{ready: true, count: 3},
+				{ready: false, count: 0},
+				{ready: false, count: 1},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := NewDefaultReadinessChecker()
+			for i, phase := range tc.phases {
+				// A new composed resource is observed at each reconcile, so
+				// that nothing but its UID is carried between reconciles.
+				cd := runtimecomposed.New()
+				cd.SetUID(uid)
+				cd.Object["status"] = map[string]interface{}{"phase": phase}
+				ready, err := c.IsReady(context.Background(), cd, tmpl)
+				if err != nil {
+					t.Fatalf("\n%s\nIsReady(...) at reconcile %d: %s", tc.reason, i, err)
+				}
+				got := want{ready: ready}
+				if n, ok := c.successes.counts.Get(checkKey{uid: uid, check: 0}); ok {
+					got.count = n.(int)
+				}
+				if diff := cmp.Diff(tc.want[i], got, cmp.AllowUnexported(want{})); diff != "" {
+					t.Errorf("\n%s\nIsReady(...) at reconcile %d: -want, +got:\n%s", tc.reason, i, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckReadyWithReason(t *testing.T) {
+	type args struct {
+		cd *runtimecomposed.Unstructured
+		t  v1alpha1.ComposedTemplate
+	}
+	type want struct {
+		ready  bool
+		reason string
+		err    error
+	}
+	cases := map[string]struct {
+		reason string
+		args
+		want
+	}{
+		"NoChecks": {
+			reason: "If there are no readiness checks the reason should describe the Ready condition",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.SetConditions(runtimev1alpha1.Creating())
+				}),
+			},
+			want: want{
+				reason: "condition Ready is False with reason Creating",
+			},
+		},
+		"Mismatch": {
+			reason: "The reason should describe the first check that failed and the value it observed",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"id":    "cool",
+							"phase": "Pending",
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+					{Type: "NonEmpty", FieldPath: "status.id"},
+					{Type: "MatchString", FieldPath: "status.phase", MatchString: "Bound"},
+					{Type: "MatchString", FieldPath: "status.other", MatchString: "Bound"},
+				}},
 			},
 			want: want{
-				ready: true,
+				reason: `readiness check at index 1 (MatchString) expected "Bound" at status.phase but saw "Pending"`,
 			},
 		},
-		"UnknownType": {
-			reason: "If unknown type is chosen, it should return an error",
+		"WildcardMismatch": {
+			reason: "The reason should describe every value a wildcard field path expanded to",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{"status": map[string]interface{}{"conditions": []interface{}{
+						map[string]interface{}{"type": "Synced", "status": "True"},
+						map[string]interface{}{"type": "Ready", "status": "False"},
+					}}}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+					{Type: "MatchAll", FieldPath: "status.conditions[*].status", MatchString: "True"},
+				}},
+			},
+			want: want{
+				reason: `readiness check at index 0 (MatchAll) expected every value to be "True" at status.conditions[*].status but saw ["True","False"]`,
+			},
+		},
+		"NotSet": {
+			reason: "The reason should say when the field a check expected a value at was not set",
 			args: args{
 				cd: runtimecomposed.New(),
-				t:  v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "Olala"}}},
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+					{Type: "GreaterThan", FieldPath: "status.readyReplicas", MatchInteger: 2},
+				}},
 			},
 			want: want{
-				err: errors.New("readiness check at index 0: an unknown type is chosen"),
+				reason: "readiness check at index 0 (GreaterThan) expected a value greater than 2 at status.readyReplicas but it was not set",
+			},
+		},
+		"IgnoredError": {
+			reason: "The reason should include errors that the check was configured to ignore",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"readyReplicas": "three",
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+					{Type: "MatchInteger", FieldPath: "status.readyReplicas", MatchInteger: 3, IgnoreErrors: true},
+				}},
+			},
+			want: want{
+				reason: `readiness check at index 0 (MatchInteger): value of field "status.readyReplicas" is a string, not an integer`,
+			},
+		},
+		"NotEnoughSuccesses": {
+			reason: "The reason should say when a check passed but has not yet passed the required number of reconciles in a row",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"phase": "Bound",
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+					{Type: "MatchString", FieldPath: "status.phase", MatchString: "Bound", ConsecutiveSuccesses: 2},
+				}},
+			},
+			want: want{
+				reason: "readiness check at index 0 (MatchString) passed 1 of 2 required consecutive reconciles",
+			},
+		},
+		"Ready": {
+			reason: "There should be no reason if all checks pass",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.Object = map[string]interface{}{
+						"status": map[string]interface{}{
+							"phase": "Bound",
+						},
+					}
+				}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+					{Type: "MatchString", FieldPath: "status.phase", MatchString: "Bound"},
+				}},
+			},
+			want: want{
+				ready: true,
 			},
 		},
 	}
 	for name, tc := range cases {
 		t.Run(name, func(t *testing.T) {
-			c := &DefaultReadinessChecker{}
-			ready, err := c.IsReady(context.Background(), tc.args.cd, tc.args.t)
+			ready, reason, err := NewDefaultReadinessChecker().CheckReadyWithReason(context.Background(), tc.args.cd, tc.args.t)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nCheckReadyWithReason(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ready, ready); diff != "" {
+				t.Errorf("\n%s\nCheckReadyWithReason(...): -want ready, +got ready:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.reason, reason); diff != "" {
+				t.Errorf("\n%s\nCheckReadyWithReason(...): -want reason, +got reason:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCountPassedChecks(t *testing.T) {
+	cd := func(status map[string]interface{}) *runtimecomposed.Unstructured {
+		return runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+			r.Object = map[string]interface{}{"status": status}
+		})
+	}
+
+	type args struct {
+		cd *runtimecomposed.Unstructured
+		t  v1alpha1.ComposedTemplate
+	}
+	type want struct {
+		passed int
+		total  int
+		err    error
+	}
+	cases := map[string]struct {
+		reason string
+		args
+		want
+	}{
+		"NoChecks": {
+			reason: "If there are no readiness checks the Ready condition should be counted as the only check",
+			args: args{
+				cd: runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+					r.SetConditions(runtimev1alpha1.Available())
+				}),
+			},
+			want: want{passed: 1, total: 1},
+		},
+		"SomePassed": {
+			reason: "Every check should be evaluated, even after one fails",
+			args: args{
+				cd: cd(map[string]interface{}{"id": "cool", "phase": "Pending", "replicas": int64(3)}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+					{Type: "NonEmpty", FieldPath: "status.id"},
+					{Type: "MatchString", FieldPath: "status.phase", MatchString: "Bound"},
+					{Type: "MatchInteger", FieldPath: "status.replicas", MatchInteger: 3},
+					{Type: "MatchString", FieldPath: "status.phase", MatchString: "Pending", Negate: true},
+				}},
+			},
+			want: want{passed: 2, total: 4},
+		},
+		"IgnoredError": {
+			reason: "Checks that fail with an ignored error should be counted as not passed",
+			args: args{
+				cd: cd(map[string]interface{}{"replicas": "three"}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+					{Type: "MatchInteger", FieldPath: "status.replicas", MatchInteger: 3, IgnoreErrors: true},
+				}},
+			},
+			want: want{passed: 0, total: 1},
+		},
+		"Error": {
+			reason: "Errors that are not ignored should be returned",
+			args: args{
+				cd: cd(map[string]interface{}{"replicas": "three"}),
+				t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+					{Type: "MatchInteger", FieldPath: "status.replicas", MatchInteger: 3},
+				}},
+			},
+			want: want{err: errors.Errorf(errFmtNotInteger, "status.replicas", "string")},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			passed, total, err := NewDefaultReadinessChecker().CountPassedChecks(context.Background(), tc.args.cd, tc.args.t)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nCountPassedChecks(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.passed, passed); diff != "" {
+				t.Errorf("\n%s\nCountPassedChecks(...): -want passed, +got passed:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.total, total); diff != "" {
+				t.Errorf("\n%s\nCountPassedChecks(...): -want total, +got total:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestObservedGeneration(t *testing.T) {
+	tmpl := v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+		{Type: "ObservedGeneration", ConsecutiveSuccesses: 2},
+	}}
+
+	type observation struct {
+		generation int64
+		observed   int64
+	}
+	cases := map[string]struct {
+		reason       string
+		observations []observation
+		want         []bool
+	}{
+		"Settles": {
+			reason: "A check should pass once the generation has been observed and has not changed for the required number of reconciles",
+			observations: []observation{
+				{generation: 1, observed: 0},
+				{generation: 2, observed: 1},
+				{generation: 2, observed: 2},
+				{generation: 2, observed: 2},
+				{generation: 2, observed: 2},
+			},
+			want: []bool{false, false, false, true, true},
+		},
+		"NeverStable": {
+			reason: "A check should never pass if the generation keeps changing, even if each generation is observed",
+			observations: []observation{
+				{generation: 1, observed: 1},
+				{generation: 2, observed: 2},
+				{generation: 3, observed: 3},
+				{generation: 4, observed: 4},
+			},
+			want: []bool{false, false, false, false},
+		},
+		"NotObserved": {
+			reason: "A check should not pass if the generation is stable but has not been observed",
+			observations: []observation{
+				{generation: 2, observed: 1},
+				{generation: 2, observed: 1},
+				{generation: 2, observed: 1},
+			},
+			want: []bool{false, false, false},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := NewDefaultReadinessChecker()
+			for i, o := range tc.observations {
+				// A new composed resource is observed at each reconcile, so
+				// that nothing but its UID is carried between reconciles.
+				cd := runtimecomposed.New()
+				cd.SetUID("cool-uid")
+				cd.SetGeneration(o.generation)
+				cd.Object["status"] = map[string]interface{}{"observedGeneration": o.observed}
+				got, err := c.IsReady(context.Background(), cd, tmpl)
+				if err != nil {
+					t.Fatalf("\n%s\nIsReady(...) at reconcile %d: %s", tc.reason, i, err)
+				}
+				if got != tc.want[i] {
+					t.Errorf("\n%s\nIsReady(...) at reconcile %d: want %t, got %t", tc.reason, i, tc.want[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestEventReadinessChecker(t *testing.T) {
+	uid := types.UID("cool-uid")
+	ready := IsReadyFn(func(_ context.Context, _ resource.Composed, _ v1alpha1.ComposedTemplate) (bool, error) {
+		return true, nil
+	})
+	events := func(e ...v1.Event) test.MockListFn {
+		return func(_ context.Context, obj runtime.Object, opts ...client.ListOption) error {
+			lo := &client.ListOptions{}
+			lo.ApplyOptions(opts)
+			if got := lo.FieldSelector.String(); got != "involvedObject.uid="+string(uid) {
+				return errors.Errorf("unexpected field selector %q", got)
+			}
+			obj.(*v1.EventList).Items = e
+			return nil
+		}
+	}
+
+	type args struct {
+		kube    client.Client
+		prober  ReadinessProber
+		reasons []string
+		cd      resource.Composed
+	}
+	type want struct {
+		ready bool
+		err   error
+	}
+	cases := map[string]struct {
+		reason string
+		args
+		want
+	}{
+		"ProberNotReady": {
+			reason: "If the wrapped prober reports not ready, events should not be listed",
+			args: args{
+				prober: IsReadyFn(func(_ context.Context, _ resource.Composed, _ v1alpha1.ComposedTemplate) (bool, error) {
+					return false, nil
+				}),
+				cd: &fake.Composed{},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"NotCreated": {
+			reason: "Events should not be listed for a composed resource that has not been created",
+			args: args{
+				prober: ready,
+				cd:     &fake.Composed{},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"ListError": {
+			reason: "Errors listing events should be returned",
+			args: args{
+				kube:   &test.MockClient{MockList: test.NewMockListFn(errBoom)},
+				prober: ready,
+				cd:     &fake.Composed{ObjectMeta: metav1.ObjectMeta{UID: uid}},
+			},
+			want: want{
+				err: errors.Wrap(errBoom, errListEvents),
+			},
+		},
+		"NoEvents": {
+			reason: "A composed resource without events should be ready",
+			args: args{
+				kube:    &test.MockClient{MockList: events()},
+				prober:  ready,
+				reasons: []string{"FailedCreate"},
+				cd:      &fake.Composed{ObjectMeta: metav1.ObjectMeta{UID: uid}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"IrrelevantEvents": {
+			reason: "Events of other objects, normal events, old events and events with other reasons should be ignored",
+			args: args{
+				kube: &test.MockClient{MockList: events(
+					v1.Event{InvolvedObject: v1.ObjectReference{UID: "other"}, Type: v1.EventTypeWarning, Reason: "FailedCreate", LastTimestamp: metav1.Now()},
+					v1.Event{InvolvedObject: v1.ObjectReference{UID: uid}, Type: v1.EventTypeNormal, Reason: "FailedCreate", LastTimestamp: metav1.Now()},
+					v1.Event{InvolvedObject: v1.ObjectReference{UID: uid}, Type: v1.EventTypeWarning, Reason: "FailedCreate", LastTimestamp: metav1.NewTime(time.Now().Add(-2 * DefaultEventWindow))},
+					v1.Event{InvolvedObject: v1.ObjectReference{UID: uid}, Type: v1.EventTypeWarning, Reason: "SomethingElse", LastTimestamp: metav1.Now()},
+					v1.Event{InvolvedObject: v1.ObjectReference{UID: uid}, Type: v1.EventTypeWarning, Reason: "FailedCreate", EventTime: metav1.NewMicroTime(time.Now().Add(-2 * DefaultEventWindow))},
+				)},
+				prober:  ready,
+				reasons: []string{"FailedCreate"},
+				cd:      &fake.Composed{ObjectMeta: metav1.ObjectMeta{UID: uid}},
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"RecentEventTime": {
+			reason: "A Warning event recorded using the events API should be considered recent according to its event time",
+			args: args{
+				kube: &test.MockClient{MockList: events(
+					v1.Event{InvolvedObject: v1.ObjectReference{UID: uid}, Type: v1.EventTypeWarning, Reason: "FailedCreate", EventTime: metav1.NowMicro()},
+				)},
+				prober:  ready,
+				reasons: []string{"FailedCreate"},
+				cd:      &fake.Composed{ObjectMeta: metav1.ObjectMeta{UID: uid}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"RecurringEvent": {
+			reason: "A Warning event that first occurred long ago but recurred recently should be considered recent",
+			args: args{
+				kube: &test.MockClient{MockList: events(
+					v1.Event{
+						InvolvedObject: v1.ObjectReference{UID: uid},
+						Type:           v1.EventTypeWarning,
+						Reason:         "FailedCreate",
+						EventTime:      metav1.NewMicroTime(time.Now().Add(-2 * DefaultEventWindow)),
+						Series:         &v1.EventSeries{Count: 3, LastObservedTime: metav1.NowMicro()},
+					},
+				)},
+				prober:  ready,
+				reasons: []string{"FailedCreate"},
+				cd:      &fake.Composed{ObjectMeta: metav1.ObjectMeta{UID: uid}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+		"WarningEvent": {
+			reason: "A recent Warning event with a configured reason should make the composed resource not ready",
+			args: args{
+				kube: &test.MockClient{MockList: events(
+					v1.Event{InvolvedObject: v1.ObjectReference{UID: uid}, Type: v1.EventTypeWarning, Reason: "FailedCreate", LastTimestamp: metav1.Now()},
+				)},
+				prober:  ready,
+				reasons: []string{"FailedCreate"},
+				cd:      &fake.Composed{ObjectMeta: metav1.ObjectMeta{UID: uid}},
+			},
+			want: want{
+				ready: false,
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := NewEventReadinessChecker(tc.args.kube, tc.args.prober, tc.args.reasons)
+			ready, err := c.IsReady(context.Background(), tc.args.cd, v1alpha1.ComposedTemplate{})
 			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
 				t.Errorf("\n%s\nIsReady(...): -want, +got:\n%s", tc.reason, diff)
 			}
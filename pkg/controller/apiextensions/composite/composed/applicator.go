@@ -0,0 +1,133 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+)
+
+// AnnotationKeyLastAppliedConfiguration is the key of the annotation in which
+// the configuration most recently applied to a composed resource is recorded.
+const AnnotationKeyLastAppliedConfiguration = "composition.crossplane.io/last-applied-configuration"
+
+const (
+	errObjectMeta     = "cannot access object metadata"
+	errMarshalApplied = "cannot marshal applied configuration"
+	errMarshalLive    = "cannot marshal live object"
+	errThreeWayPatch  = "cannot compute three-way merge patch"
+	errCreateObject   = "cannot create object"
+	errGetObject      = "cannot get object"
+	errPatchObject    = "cannot patch object"
+)
+
+// An APIThreeWayMergeApplicator applies changes to an object by either
+// creating or patching it in a Kubernetes API server. Like kubectl apply, it
+// records the applied configuration in an annotation and computes a three-way
+// merge patch between the previously applied configuration, the desired
+// configuration and the live object. Fields set by other actors are thus
+// preserved unless the desired configuration manages them, while fields that
+// were previously applied but are no longer desired are removed.
+type APIThreeWayMergeApplicator struct {
+	client client.Client
+}
+
+// NewAPIThreeWayMergeApplicator returns an Applicator that applies changes to
+// an object using a three-way merge patch.
+func NewAPIThreeWayMergeApplicator(c client.Client) *APIThreeWayMergeApplicator {
+	return &APIThreeWayMergeApplicator{client: c}
+}
+
+// Apply changes to the supplied object. The object will be created if it does
+// not exist, or patched if it does.
+func (a *APIThreeWayMergeApplicator) Apply(ctx context.Context, o runtime.Object, ao ...resource.ApplyOption) error {
+	m, ok := o.(metav1.Object)
+	if !ok {
+		return errors.New(errObjectMeta)
+	}
+
+	if err := recordAppliedConfiguration(o, m); err != nil {
+		return err
+	}
+
+	if m.GetName() == "" && m.GetGenerateName() != "" {
+		return errors.Wrap(a.client.Create(ctx, o), errCreateObject)
+	}
+
+	desired := o.DeepCopyObject()
+	modified, err := json.Marshal(desired)
+	if err != nil {
+		return errors.Wrap(err, errMarshalApplied)
+	}
+
+	err = a.client.Get(ctx, types.NamespacedName{Name: m.GetName(), Namespace: m.GetNamespace()}, o)
+	if kerrors.IsNotFound(err) {
+		return errors.Wrap(a.client.Create(ctx, o), errCreateObject)
+	}
+	if err != nil {
+		return errors.Wrap(err, errGetObject)
+	}
+
+	for _, fn := range ao {
+		if err := fn(ctx, o, desired); err != nil {
+			return err
+		}
+	}
+
+	current, err := json.Marshal(o)
+	if err != nil {
+		return errors.Wrap(err, errMarshalLive)
+	}
+	original := []byte(m.GetAnnotations()[AnnotationKeyLastAppliedConfiguration])
+
+	patch, err := jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, current)
+	if err != nil {
+		return errors.Wrap(err, errThreeWayPatch)
+	}
+	return errors.Wrap(a.client.Patch(ctx, o, client.RawPatch(types.MergePatchType, patch)), errPatchObject)
+}
+
+// recordAppliedConfiguration annotates the supplied object with its own
+// configuration, excluding any previously recorded configuration.
+func recordAppliedConfiguration(o runtime.Object, m metav1.Object) error {
+	cfg := o.DeepCopyObject()
+	cm, ok := cfg.(metav1.Object)
+	if !ok {
+		return errors.New(errObjectMeta)
+	}
+	meta.RemoveAnnotations(cm, AnnotationKeyLastAppliedConfiguration)
+	if len(cm.GetAnnotations()) == 0 {
+		cm.SetAnnotations(nil)
+	}
+	applied, err := json.Marshal(cfg)
+	if err != nil {
+		return errors.Wrap(err, errMarshalApplied)
+	}
+	meta.AddAnnotations(m, map[string]string{AnnotationKeyLastAppliedConfiguration: string(applied)})
+	return nil
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	runtimecomposed "github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composed"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+)
+
+func TestThreeWayMergeApply(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	object := func(spec map[string]interface{}, annotations map[string]interface{}) *runtimecomposed.Unstructured {
+		md := map[string]interface{}{"name": "cool"}
+		if annotations != nil {
+			md["annotations"] = annotations
+		}
+		return runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+			r.Object = map[string]interface{}{
+				"apiVersion": "example.org/v1",
+				"kind":       "Thing",
+				"metadata":   md,
+				"spec":       spec,
+			}
+		})
+	}
+	applied := func(spec map[string]interface{}) string {
+		j, _ := json.Marshal(object(spec, nil))
+		return string(j)
+	}
+
+	type args struct {
+		get func(obj runtime.Object) error
+		o   *runtimecomposed.Unstructured
+	}
+	type want struct {
+		created map[string]interface{}
+		patch   map[string]interface{}
+		err     error
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"GetError": {
+			reason: "Errors getting the live object should be returned",
+			args: args{
+				get: func(_ runtime.Object) error { return errBoom },
+				o:   object(map[string]interface{}{"a": "new"}, nil),
+			},
+			want: want{
+				err: errors.Wrap(errBoom, errGetObject),
+			},
+		},
+		"Create": {
+			reason: "An object that does not exist should be created with its applied configuration recorded",
+			args: args{
+				get: func(_ runtime.Object) error {
+					return kerrors.NewNotFound(schema.GroupResource{}, "cool")
+				},
+				o: object(map[string]interface{}{"a": "new"}, nil),
+			},
+			want: want{
+				created: object(map[string]interface{}{"a": "new"}, map[string]interface{}{
+					AnnotationKeyLastAppliedConfiguration: applied(map[string]interface{}{"a": "new"}),
+				}).Object,
+			},
+		},
+		"ThreeWayMerge": {
+			reason: "Fields set by other actors should survive while fields no longer applied should be removed",
+			args: args{
+				get: func(obj runtime.Object) error {
+					live := object(
+						map[string]interface{}{"a": "old", "removed": "yes", "external": "keep"},
+						map[string]interface{}{
+							AnnotationKeyLastAppliedConfiguration: applied(map[string]interface{}{"a": "old", "removed": "yes"}),
+						},
+					)
+					live.DeepCopyInto(&obj.(*runtimecomposed.Unstructured).Unstructured)
+					return nil
+				},
+				o: object(map[string]interface{}{"a": "new"}, nil),
+			},
+			want: want{
+				patch: map[string]interface{}{
+					"metadata": map[string]interface{}{
+						"annotations": map[string]interface{}{
+							AnnotationKeyLastAppliedConfiguration: applied(map[string]interface{}{"a": "new"}),
+						},
+					},
+					"spec": map[string]interface{}{"a": "new", "removed": nil},
+				},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var created, patched map[string]interface{}
+			c := &test.MockClient{
+				MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+					return tc.args.get(obj)
+				},
+				MockCreate: func(_ context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+					created = obj.(*runtimecomposed.Unstructured).Object
+					return nil
+				},
+				MockPatch: func(_ context.Context, obj runtime.Object, p client.Patch, _ ...client.PatchOption) error {
+					data, err := p.Data(obj)
+					if err != nil {
+						return err
+					}
+					return json.Unmarshal(data, &patched)
+				},
+			}
+			err := NewAPIThreeWayMergeApplicator(c).Apply(context.Background(), tc.args.o)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nApply(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.created, created); diff != "" {
+				t.Errorf("\n%s\nApply(...): -want created, +got created:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.patch, patched); diff != "" {
+				t.Errorf("\n%s\nApply(...): -want patch, +got patch:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+type cachedSecret struct {
+	secret *corev1.Secret
+	err    error
+}
+
+// A secretCache memoizes the result of getting secrets, including errors such
+// as the secret not being found.
+type secretCache struct {
+	mx      sync.Mutex
+	secrets map[types.NamespacedName]cachedSecret
+}
+
+func newSecretCache() *secretCache {
+	return &secretCache{secrets: map[types.NamespacedName]cachedSecret{}}
+}
+
+// get the secret with the supplied key into the supplied secret, using the
+// supplied reader only if it has not previously been got.
+func (c *secretCache) get(ctx context.Context, kube client.Reader, key types.NamespacedName, s *corev1.Secret) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	cached, ok := c.secrets[key]
+	if !ok {
+		cached = cachedSecret{secret: &corev1.Secret{}}
+		cached.err = kube.Get(ctx, key, cached.secret)
+		c.secrets[key] = cached
+	}
+	if cached.err != nil {
+		return cached.err
+	}
+	cached.secret.DeepCopyInto(s)
+	return nil
+}
+
+type secretCacheKey struct{}
+
+// WithSecretCache returns a copy of the supplied context that carries an empty
+// cache of connection secrets. An APIConnectionDetailsFetcher that is passed
+// the context, or a context derived from it, gets each connection secret at
+// most once. Secrets are never refreshed once cached, so the context should be
+// scoped to a single reconcile.
+func WithSecretCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, secretCacheKey{}, newSecretCache())
+}
+
+// getSecret gets the secret with the supplied key, from the cache carried by
+// the supplied context if any.
+func getSecret(ctx context.Context, kube client.Reader, key types.NamespacedName, s *corev1.Secret) error {
+	if c, ok := ctx.Value(secretCacheKey{}).(*secretCache); ok {
+		return c.get(ctx, kube, key, s)
+	}
+	return kube.Get(ctx, key, s)
+}
+
+// DefaultReadinessCacheSize is the maximum number of composed resources whose
+// readiness a CachingReadinessChecker remembers. The readiness of the least
+// recently evaluated composed resources is forgotten first.
+const DefaultReadinessCacheSize = 4096
+
+// readinessCacheTTL is the time after which a CachingReadinessChecker forgets
+// the readiness of a composed resource, for example because it was deleted.
+const readinessCacheTTL = 1 * time.Hour
+
+// NewCachingReadinessChecker returns a CachingReadinessChecker that caches the
+// results of the supplied ReadinessProber.
+func NewCachingReadinessChecker(rp ReadinessProber) *CachingReadinessChecker {
+	return &CachingReadinessChecker{prober: rp, results: cache.NewLRUExpireCache(DefaultReadinessCacheSize)}
+}
+
+type cachedReadiness struct {
+	resourceVersion string
+	checks          []v1alpha1.ReadinessCheck
+	ready           bool
+	reason          string
+}
+
+// A CachingReadinessChecker skips evaluating the readiness of a composed
+// resource that has not changed since its readiness was last evaluated, and
+// instead returns the result of that evaluation. A composed resource is
+// considered unchanged if both its resource version and the readiness checks
+// of its template are unchanged.
+//
+// Readiness checks whose result may change while the composed resource does
+// not are always evaluated. These include webhook checks, checks of the events
+// of a composed resource, and checks that depend on earlier evaluations or on
+// the time, such as those that must pass several times in a row or that time
+// out.
+type CachingReadinessChecker struct {
+	prober  ReadinessProber
+	results *cache.LRUExpireCache
+}
+
+// IsReady returns whether the composed resource is ready.
+func (c *CachingReadinessChecker) IsReady(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (bool, error) {
+	ready, _, err := c.CheckReadyWithReason(ctx, cd, t)
+	return ready, err
+}
+
+// CheckReadyWithReason returns whether the composed resource is ready and, if
+// the wrapped ReadinessProber supports it, why it is not.
+func (c *CachingReadinessChecker) CheckReadyWithReason(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (bool, string, error) {
+	if !cacheable(cd, t) || volatile(c.prober, cd) {
+		return c.check(ctx, cd, t)
+	}
+
+	if v, ok := c.results.Get(cd.GetUID()); ok {
+		cached := v.(cachedReadiness)
+		if cached.resourceVersion == cd.GetResourceVersion() && reflect.DeepEqual(cached.checks, t.ReadinessChecks) {
+			return cached.ready, cached.reason, nil
+		}
+	}
+
+	ready, reason, err := c.check(ctx, cd, t)
+	if err != nil {
+		// Errors are not cached so that the next evaluation is not skipped.
+		c.results.Remove(cd.GetUID())
+		return false, "", err
+	}
+
+	checks := make([]v1alpha1.ReadinessCheck, len(t.ReadinessChecks))
+	for i := range t.ReadinessChecks {
+		t.ReadinessChecks[i].DeepCopyInto(&checks[i])
+	}
+	c.results.Add(cd.GetUID(), cachedReadiness{resourceVersion: cd.GetResourceVersion(), checks: checks, ready: ready, reason: reason}, readinessCacheTTL)
+	return ready, reason, nil
+}
+
+// check evaluates the readiness of the supplied composed resource using the
+// wrapped ReadinessProber.
+func (c *CachingReadinessChecker) check(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (bool, string, error) {
+	if rp, ok := c.prober.(ReasonedReadinessProber); ok {
+		return rp.CheckReadyWithReason(ctx, cd, t)
+	}
+	ready, err := c.prober.IsReady(ctx, cd, t)
+	return ready, "", err
+}
+
+// cacheable returns true if the readiness of the supplied composed resource
+// depends only on the composed resource and its readiness checks.
+func cacheable(cd resource.Composed, t v1alpha1.ComposedTemplate) bool {
+	if cd.GetUID() == "" || cd.GetResourceVersion() == "" {
+		return false
+	}
+	return cacheableChecks(t.ReadinessChecks)
+}
+
+// cacheableChecks returns true if the results of the supplied readiness
+// checks, including the checks of any groups, depend only on the composed
+// resource they check.
+func cacheableChecks(checks []v1alpha1.ReadinessCheck) bool {
+	for _, check := range checks {
+		switch {
+		case check.Type == v1alpha1.ReadinessCheckWebhook:
+			return false
+		case check.TerminalAfterSeconds != nil, check.TimeoutSeconds != nil:
+			return false
+		case check.ConsecutiveSuccesses > 0, check.Type == v1alpha1.ReadinessCheckObservedGeneration:
+			return false
+		case check.Group != nil && !cacheableChecks(check.Group.Checks):
+			return false
+		}
+	}
+	return true
+}
+
+// volatile returns true if the supplied ReadinessProber may consider the
+// supplied composed resource ready or not while it remains unchanged, for
+// example because it inspects the events of the composed resource.
+func volatile(rp ReadinessProber, cd resource.Composed) bool {
+	switch p := rp.(type) {
+	case *EventReadinessChecker:
+		return true
+	case *ReadinessProberRegistry:
+		return volatile(p.prober(cd), cd)
+	case *CachingReadinessChecker:
+		return volatile(p.prober, cd)
+	}
+	return false
+}
@@ -0,0 +1,427 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/reconciler/managed"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/fake"
+	runtimecomposed "github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composed"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+func TestFetchWithSecretCache(t *testing.T) {
+	withRef := func(name string) resource.Composed {
+		return &fake.Composed{
+			ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: &runtimev1alpha1.SecretReference{Name: name, Namespace: "coolns"}},
+		}
+	}
+	tmpl := v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{{FromConnectionSecretKey: pointer.StringPtr("key")}}}
+
+	type args struct {
+		get func(obj runtime.Object) error
+		cds []resource.Composed
+	}
+	type want struct {
+		conn []managed.ConnectionDetails
+		gets int
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"SecretCached": {
+			reason: "Connection details and annotations of the same secret should be fetched using a single Get",
+			args: args{
+				get: func(obj runtime.Object) error {
+					s := obj.(*corev1.Secret)
+					s.Data = map[string][]byte{"key": []byte("value")}
+					s.SetAnnotations(map[string]string{"example.org/encrypted": "true"})
+					return nil
+				},
+				cds: []resource.Composed{withRef("cool"), withRef("cool")},
+			},
+			want: want{
+				conn: []managed.ConnectionDetails{{"key": []byte("value")}, {"key": []byte("value")}},
+				gets: 1,
+			},
+		},
+		"NotFoundCached": {
+			reason: "A secret that was not found should not be got again",
+			args: args{
+				get: func(_ runtime.Object) error { return kerrors.NewNotFound(schema.GroupResource{}, "cool") },
+				cds: []resource.Composed{withRef("cool"), withRef("cool")},
+			},
+			want: want{
+				conn: []managed.ConnectionDetails{{}, {}},
+				gets: 1,
+			},
+		},
+		"DistinctSecrets": {
+			reason: "Each distinct secret should be got once",
+			args: args{
+				get: func(obj runtime.Object) error {
+					obj.(*corev1.Secret).Data = map[string][]byte{"key": []byte("value")}
+					return nil
+				},
+				cds: []resource.Composed{withRef("cool"), withRef("cooler"), withRef("cool")},
+			},
+			want: want{
+				conn: []managed.ConnectionDetails{{"key": []byte("value")}, {"key": []byte("value")}, {"key": []byte("value")}},
+				gets: 2,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			gets := 0
+			kube := &test.MockClient{MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+				gets++
+				return tc.args.get(obj)
+			}}
+			f := NewAPIConnectionDetailsFetcher(kube, WithPropagatedAnnotations("example.org/encrypted"))
+			ctx := WithSecretCache(context.Background())
+
+			conn := make([]managed.ConnectionDetails, len(tc.args.cds))
+			for i, cd := range tc.args.cds {
+				c, err := f.Fetch(ctx, cd, tmpl)
+				if err != nil {
+					t.Fatalf("\n%s\nFetch(...): %s", tc.reason, err)
+				}
+				if _, err := f.FetchAnnotations(ctx, cd, tmpl); err != nil {
+					t.Fatalf("\n%s\nFetchAnnotations(...): %s", tc.reason, err)
+				}
+				conn[i] = c
+			}
+
+			if diff := cmp.Diff(tc.want.conn, conn); diff != "" {
+				t.Errorf("\n%s\nFetch(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.gets, gets); diff != "" {
+				t.Errorf("\n%s\nGet(...) calls: -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestWithSecretCache(t *testing.T) {
+	withRef := func(name string) resource.Composed {
+		return &fake.Composed{
+			ConnectionSecretWriterTo: fake.ConnectionSecretWriterTo{Ref: &runtimev1alpha1.SecretReference{Name: name, Namespace: "coolns"}},
+		}
+	}
+	tmpl := v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{{FromConnectionSecretKey: pointer.StringPtr("key")}}}
+	cached := WithSecretCache(context.Background())
+
+	cases := map[string]struct {
+		reason string
+		ctx    []context.Context
+		want   int
+	}{
+		"NoCache": {
+			reason: "A secret should be got every time it is fetched if the context carries no cache",
+			ctx:    []context.Context{context.Background(), context.Background()},
+			want:   2,
+		},
+		"SameCache": {
+			reason: "A secret should be got once when fetched using contexts that carry the same cache",
+			ctx:    []context.Context{cached, WithSiblings(cached, Siblings{})},
+			want:   1,
+		},
+		"DistinctCaches": {
+			reason: "A secret should be got once per cache, so that each reconcile observes changes to it",
+			ctx:    []context.Context{WithSecretCache(context.Background()), WithSecretCache(context.Background())},
+			want:   2,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			gets := 0
+			kube := &test.MockClient{MockGet: func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+				gets++
+				obj.(*corev1.Secret).Data = map[string][]byte{"key": []byte("value")}
+				return nil
+			}}
+			f := NewAPIConnectionDetailsFetcher(kube)
+
+			for _, ctx := range tc.ctx {
+				conn, err := f.Fetch(ctx, withRef("cool"), tmpl)
+				if err != nil {
+					t.Fatalf("\n%s\nFetch(...): %s", tc.reason, err)
+				}
+				if diff := cmp.Diff(managed.ConnectionDetails{"key": []byte("value")}, conn); diff != "" {
+					t.Errorf("\n%s\nFetch(...): -want, +got:\n%s", tc.reason, diff)
+				}
+			}
+			if diff := cmp.Diff(tc.want, gets); diff != "" {
+				t.Errorf("\n%s\nGet(...) calls: -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCachingReadinessChecker(t *testing.T) {
+	withVersion := func(uid types.UID, version string) resource.Composed {
+		cd := &fake.Composed{}
+		cd.SetUID(uid)
+		cd.SetResourceVersion(version)
+		return cd
+	}
+	nonEmpty := v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: v1alpha1.ReadinessCheckNonEmpty, FieldPath: "status.ready"}}}
+	matchString := v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: v1alpha1.ReadinessCheckMatchString, FieldPath: "status.ready", MatchString: "yes"}}}
+	webhook := v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: v1alpha1.ReadinessCheckWebhook}}}
+	consecutive := v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: v1alpha1.ReadinessCheckNonEmpty, FieldPath: "status.ready", ConsecutiveSuccesses: 3}}}
+	generation := v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: v1alpha1.ReadinessCheckObservedGeneration}}}
+	groupedWebhook := v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{
+		Type:  v1alpha1.ReadinessCheckGroup,
+		Group: &v1alpha1.GroupReadinessCheck{Checks: []v1alpha1.ReadinessCheck{{Type: v1alpha1.ReadinessCheckWebhook}}},
+	}}}
+
+	type observation struct {
+		cd resource.Composed
+		t  v1alpha1.ComposedTemplate
+	}
+
+	// Evaluate more composed resources than the cache can remember, so that
+	// the readiness of the first is forgotten.
+	evicted := []observation{{cd: withVersion("cool", "1"), t: nonEmpty}}
+	for i := 0; i < DefaultReadinessCacheSize; i++ {
+		evicted = append(evicted, observation{cd: withVersion(types.UID(fmt.Sprintf("cool-%d", i)), "1"), t: nonEmpty})
+	}
+	evicted = append(evicted, observation{cd: withVersion("cool", "1"), t: nonEmpty})
+
+	cases := map[string]struct {
+		reason string
+		obs    []observation
+		events bool
+		err    error
+		want   int
+	}{
+		"Unchanged": {
+			reason: "Readiness of a composed resource that has not changed should be evaluated only once",
+			obs: []observation{
+				{cd: withVersion("cool", "1"), t: nonEmpty},
+				{cd: withVersion("cool", "1"), t: nonEmpty},
+				{cd: withVersion("cool", "1"), t: nonEmpty},
+			},
+			want: 1,
+		},
+		"ResourceChanged": {
+			reason: "Readiness should be evaluated again when the composed resource changes",
+			obs: []observation{
+				{cd: withVersion("cool", "1"), t: nonEmpty},
+				{cd: withVersion("cool", "2"), t: nonEmpty},
+				{cd: withVersion("cool", "2"), t: nonEmpty},
+			},
+			want: 2,
+		},
+		"ChecksChanged": {
+			reason: "Readiness should be evaluated again when the readiness checks change",
+			obs: []observation{
+				{cd: withVersion("cool", "1"), t: nonEmpty},
+				{cd: withVersion("cool", "1"), t: matchString},
+			},
+			want: 2,
+		},
+		"DistinctResources": {
+			reason: "Readiness should be cached separately for each composed resource",
+			obs: []observation{
+				{cd: withVersion("cool", "1"), t: nonEmpty},
+				{cd: withVersion("cooler", "1"), t: nonEmpty},
+				{cd: withVersion("cool", "1"), t: nonEmpty},
+			},
+			want: 2,
+		},
+		"NotYetCreated": {
+			reason: "Readiness of a composed resource without a resource version should always be evaluated",
+			obs: []observation{
+				{cd: withVersion("", ""), t: nonEmpty},
+				{cd: withVersion("", ""), t: nonEmpty},
+			},
+			want: 2,
+		},
+		"Webhook": {
+			reason: "Readiness checks that may change while the composed resource does not should always be evaluated",
+			obs: []observation{
+				{cd: withVersion("cool", "1"), t: webhook},
+				{cd: withVersion("cool", "1"), t: webhook},
+			},
+			want: 2,
+		},
+		"ConsecutiveSuccesses": {
+			reason: "Readiness checks that must pass several times in a row should always be evaluated",
+			obs: []observation{
+				{cd: withVersion("cool", "1"), t: consecutive},
+				{cd: withVersion("cool", "1"), t: consecutive},
+			},
+			want: 2,
+		},
+		"ObservedGeneration": {
+			reason: "Readiness checks that compare the generation with the one they last saw should always be evaluated",
+			obs: []observation{
+				{cd: withVersion("cool", "1"), t: generation},
+				{cd: withVersion("cool", "1"), t: generation},
+			},
+			want: 2,
+		},
+		"GroupedWebhook": {
+			reason: "Groups of readiness checks that may change while the composed resource does not should always be evaluated",
+			obs: []observation{
+				{cd: withVersion("cool", "1"), t: groupedWebhook},
+				{cd: withVersion("cool", "1"), t: groupedWebhook},
+			},
+			want: 2,
+		},
+		"Events": {
+			reason: "Readiness that depends on the events of a composed resource should always be evaluated",
+			obs: []observation{
+				{cd: withVersion("cool", "1"), t: nonEmpty},
+				{cd: withVersion("cool", "1"), t: nonEmpty},
+			},
+			events: true,
+			want:   2,
+		},
+		"Evicted": {
+			reason: "Readiness of the least recently evaluated composed resources should be forgotten once the cache is full",
+			obs:    evicted,
+			want:   DefaultReadinessCacheSize + 2,
+		},
+		"Error": {
+			reason: "Errors should not be cached",
+			obs: []observation{
+				{cd: withVersion("cool", "1"), t: nonEmpty},
+				{cd: withVersion("cool", "1"), t: nonEmpty},
+			},
+			err:  errBoom,
+			want: 2,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			var rp ReadinessProber = IsReadyFn(func(_ context.Context, _ resource.Composed, _ v1alpha1.ComposedTemplate) (bool, error) {
+				calls++
+				return true, tc.err
+			})
+			if tc.events {
+				rp = NewEventReadinessChecker(&test.MockClient{MockList: test.NewMockListFn(nil)}, rp, []string{"CannotCreateExternalResource"})
+			}
+			c := NewCachingReadinessChecker(rp)
+			for _, o := range tc.obs {
+				_, _ = c.IsReady(context.Background(), o.cd, o.t)
+			}
+			if diff := cmp.Diff(tc.want, calls); diff != "" {
+				t.Errorf("\n%s\nIsReady(...) evaluations: -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCachingReadinessCheckTimeout(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	cd := runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+		r.SetName("cool")
+		r.SetUID("cool-uid")
+		r.SetResourceVersion("1")
+		r.SetCreationTimestamp(metav1.NewTime(now.Add(-299 * time.Second)))
+		r.Object["status"] = map[string]interface{}{"phase": "Creating"}
+	})
+	tmpl := v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{
+		Type:           "MatchString",
+		FieldPath:      "status.phase",
+		MatchString:    "Running",
+		TimeoutSeconds: pointer.Int64Ptr(300),
+	}}}
+
+	clock := now
+	c := NewCachingReadinessChecker(&DefaultReadinessChecker{failures: newFailureTracker(func() time.Time { return clock })})
+
+	// The check has not yet timed out, so the composed resource is merely not
+	// ready.
+	ready, err := c.IsReady(context.Background(), cd, tmpl)
+	if diff := cmp.Diff(nil, err, test.EquateErrors()); diff != "" {
+		t.Errorf("\nIsReady(...) before timeout: -want, +got:\n%s", diff)
+	}
+	if ready {
+		t.Errorf("\nIsReady(...) before timeout: want false")
+	}
+
+	// The composed resource is unchanged, but the check should now time out.
+	clock = now.Add(time.Second)
+	want := &TerminalError{Composed: "cool", Check: 0, Duration: 300 * time.Second, TimedOut: true}
+	_, err = c.IsReady(context.Background(), cd, tmpl)
+	if diff := cmp.Diff(want, err, test.EquateErrors()); diff != "" {
+		t.Errorf("\nIsReady(...) after timeout: -want, +got:\n%s", diff)
+	}
+}
+
+func TestCachingReadinessCheckerReason(t *testing.T) {
+	cd := runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+		r.SetName("cool")
+		r.SetUID("cool-uid")
+		r.SetResourceVersion("1")
+		r.Object["status"] = map[string]interface{}{"phase": "Creating"}
+	})
+	tmpl := v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{
+		Type:        "MatchString",
+		FieldPath:   "status.phase",
+		MatchString: "Running",
+	}}}
+
+	_, want, err := NewDefaultReadinessChecker().CheckReadyWithReason(context.Background(), cd, tmpl)
+	if err != nil {
+		t.Fatalf("CheckReadyWithReason(...): %s", err)
+	}
+
+	c := NewCachingReadinessChecker(NewDefaultReadinessChecker())
+
+	// The second evaluation of the unchanged composed resource is cached.
+	for i := 0; i < 2; i++ {
+		ready, reason, err := c.CheckReadyWithReason(context.Background(), cd, tmpl)
+		if diff := cmp.Diff(nil, err, test.EquateErrors()); diff != "" {
+			t.Errorf("\nCheckReadyWithReason(...) at evaluation %d: -want error, +got error:\n%s", i, diff)
+		}
+		if ready {
+			t.Errorf("\nCheckReadyWithReason(...) at evaluation %d: want false", i)
+		}
+		if diff := cmp.Diff(want, reason); diff != "" {
+			t.Errorf("\nCheckReadyWithReason(...) at evaluation %d: the reason of the wrapped checker should be returned: -want, +got:\n%s", i, diff)
+		}
+	}
+}
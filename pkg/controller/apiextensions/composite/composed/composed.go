@@ -21,6 +21,9 @@ import (
 
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/crossplane/crossplane-runtime/pkg/meta"
@@ -33,9 +36,11 @@ import (
 // Error strings
 const (
 	errApply       = "cannot apply composed resource"
+	errCreate      = "cannot create composed resource"
 	errFetchSecret = "cannot fetch connection secret"
 	errOverlay     = "cannot apply overlay"
 	errConfigure   = "cannot configure composed resource"
+	errGetComposed = "cannot get composed resource"
 	errReadiness   = "cannot check whether composed resource is ready"
 )
 
@@ -44,26 +49,91 @@ type Configurator interface {
 	Configure(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error
 }
 
+// A ContextConfigurator configures the Composed resource using the supplied
+// context, for example to bound the time spent fetching its schema.
+type ContextConfigurator interface {
+	ConfigureWithContext(ctx context.Context, cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error
+}
+
+// An IndexedConfigurator configures one of many instances of a composed
+// resource that are composed from the same template. The index of the
+// instance is used to name it deterministically.
+type IndexedConfigurator interface {
+	ConfigureIndexed(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate, i int) error
+}
+
 // OverlayApplicator is used to apply an overlay at each reconcile.
 type OverlayApplicator interface {
 	Overlay(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error
 }
 
+// A SiblingOverlayApplicator applies an overlay that may read from the other
+// resources composed by the same composite resource.
+type SiblingOverlayApplicator interface {
+	OverlayWithSiblings(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate, s Siblings) error
+}
+
 // ConnectionDetailsFetcher fetches the connection details of the Composed resource.
 type ConnectionDetailsFetcher interface {
 	Fetch(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (managed.ConnectionDetails, error)
 }
 
+// A CompositeConnectionDetailsFetcher fetches the connection details of the
+// Composed resource, some of which may be read from the Composite resource.
+type CompositeConnectionDetailsFetcher interface {
+	FetchFromComposite(ctx context.Context, cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) (managed.ConnectionDetails, error)
+}
+
+// A ConnectionAnnotationsFetcher fetches the annotations of the connection
+// secret of the Composed resource that should be propagated to the connection
+// secret of the Composite resource.
+type ConnectionAnnotationsFetcher interface {
+	FetchAnnotations(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (map[string]string, error)
+}
+
+// FetchAnnotationsFn is a function that implements the
+// ConnectionAnnotationsFetcher interface.
+type FetchAnnotationsFn func(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (map[string]string, error)
+
+// FetchAnnotations calls FetchAnnotationsFn.
+func (f FetchAnnotationsFn) FetchAnnotations(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (map[string]string, error) {
+	return f(ctx, cd, t)
+}
+
 // ReadinessProber returns whether composed resource is ready or not.
 type ReadinessProber interface {
 	IsReady(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (bool, error)
 }
 
+// A ReasonedReadinessProber returns whether a composed resource is ready or
+// not and, if it is not, why.
+type ReasonedReadinessProber interface {
+	CheckReadyWithReason(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (bool, string, error)
+}
+
 // Observation is the result of composed reconciliation.
 type Observation struct {
-	Ref               corev1.ObjectReference
-	ConnectionDetails managed.ConnectionDetails
-	Ready             bool
+	Ref                   corev1.ObjectReference
+	ConnectionDetails     managed.ConnectionDetails
+	ConnectionAnnotations map[string]string
+	Ready                 bool
+
+	// Degraded is a *DegradedError describing the patches that could not be
+	// applied to the composed resource, if any.
+	Degraded error
+
+	// SteadyState is true if the composed resource is ready and its desired
+	// state has not changed since it was last composed, for example because
+	// no fields it is patched from have changed.
+	SteadyState bool
+
+	// Reason the composed resource is not ready, if known.
+	Reason string
+
+	// SecretReferenceNotSet is a *SecretReferenceNotSetError if the composed
+	// resource has a configured connection secret reference that is not yet
+	// set, in which case its connection details may be incomplete.
+	SecretReferenceNotSet error
 }
 
 // WithClientApplicator returns a ComposerOption that changes the ClientApplicator of
@@ -74,6 +144,25 @@ func WithClientApplicator(ca resource.ClientApplicator) ComposerOption {
 	}
 }
 
+// WithThreeWayMerge returns a ComposerOption that makes the Composer apply
+// composed resources using a three-way merge between the configuration it
+// last applied, the desired configuration and the live composed resource, so
+// that fields set by other actors are not clobbered.
+func WithThreeWayMerge() ComposerOption {
+	return func(composer *Composer) {
+		composer.client.Applicator = NewAPIThreeWayMergeApplicator(composer.client.Client)
+	}
+}
+
+// WithFieldManager returns a ComposerOption that makes the Composer use
+// server-side apply with the field manager returned by the supplied function
+// when applying composed resources.
+func WithFieldManager(fn FieldManagerFn) ComposerOption {
+	return func(composer *Composer) {
+		composer.fieldManager = fn
+	}
+}
+
 // WithConnectionDetailFetcher returns a ComposerOption that changes the
 // ConnectionDetailsFetcher of Composer.
 func WithConnectionDetailFetcher(cdf ConnectionDetailsFetcher) ComposerOption {
@@ -82,6 +171,14 @@ func WithConnectionDetailFetcher(cdf ConnectionDetailsFetcher) ComposerOption {
 	}
 }
 
+// WithConnectionAnnotationsFetcher returns a ComposerOption that changes the
+// ConnectionAnnotationsFetcher of Composer.
+func WithConnectionAnnotationsFetcher(caf ConnectionAnnotationsFetcher) ComposerOption {
+	return func(composer *Composer) {
+		composer.ConnectionAnnotationsFetcher = caf
+	}
+}
+
 // WithOverlayApplicator returns a ComposerOption that changes the
 // OverlayApplicator of Composer.
 func WithOverlayApplicator(oa OverlayApplicator) ComposerOption {
@@ -90,6 +187,14 @@ func WithOverlayApplicator(oa OverlayApplicator) ComposerOption {
 	}
 }
 
+// WithReadinessProber returns a ComposerOption that changes the
+// ReadinessProber of Composer.
+func WithReadinessProber(rp ReadinessProber) ComposerOption {
+	return func(composer *Composer) {
+		composer.ReadinessProber = rp
+	}
+}
+
 // WithConfigurator returns a ComposerOption that changes the Configurator of
 // Composer.
 func WithConfigurator(c Configurator) ComposerOption {
@@ -98,8 +203,27 @@ func WithConfigurator(c Configurator) ComposerOption {
 	}
 }
 
+// A FieldManagerFn returns the name of the field manager that should be used
+// when applying the composed resources of the supplied composite resource.
+type FieldManagerFn func(cp resource.Composite) string
+
+// CompositionFieldManager returns a FieldManagerFn that derives a distinct
+// field manager for each composition, so that composed resources produced by
+// different compositions don't fight over the same fields. The supplied
+// prefix is used as is if the composite has not yet selected a composition.
+func CompositionFieldManager(prefix string) FieldManagerFn {
+	return func(cp resource.Composite) string {
+		ref := cp.GetCompositionReference()
+		if ref == nil || ref.Name == "" {
+			return prefix
+		}
+		return prefix + "/" + ref.Name
+	}
+}
+
 type connection struct {
 	ConnectionDetailsFetcher
+	ConnectionAnnotationsFetcher
 }
 
 type composed struct {
@@ -119,13 +243,17 @@ func NewComposer(kube client.Client, opts ...ComposerOption) *Composer {
 			Client:     kube,
 			Applicator: resource.NewAPIPatchingApplicator(kube),
 		},
+		changes: newChangeTracker(),
 		composed: composed{
 			Configurator:      &DefaultConfigurator{},
 			OverlayApplicator: &DefaultOverlayApplicator{},
-			ReadinessProber:   &DefaultReadinessChecker{},
+			ReadinessProber:   NewDefaultReadinessChecker(),
 		},
 		connection: connection{
-			ConnectionDetailsFetcher: &APIConnectionDetailsFetcher{client: kube},
+			ConnectionDetailsFetcher: NewAPIConnectionDetailsFetcher(kube),
+			ConnectionAnnotationsFetcher: FetchAnnotationsFn(func(_ context.Context, _ resource.Composed, _ v1alpha1.ComposedTemplate) (map[string]string, error) {
+				return nil, nil
+			}),
 		},
 	}
 
@@ -137,7 +265,9 @@ func NewComposer(kube client.Client, opts ...ComposerOption) *Composer {
 
 // An Composer composes infrastructure resources in a Kubernetes API server.
 type Composer struct {
-	client resource.ClientApplicator
+	client       resource.ClientApplicator
+	fieldManager FieldManagerFn
+	changes      *changeTracker
 	connection
 	composed
 }
@@ -146,23 +276,54 @@ type Composer struct {
 // using the supplied CompositeTemplate.
 func (r *Composer) Compose(ctx context.Context, cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) (Observation, error) {
 
+	if err := r.existing(ctx, cd, t); err != nil {
+		return Observation{}, errors.Wrap(err, errGetComposed)
+	}
+
 	// Doing the configuration only once or continuously is subject to discussion
 	// in https://github.com/crossplane/crossplane/issues/1481
 	// Until it's resolved, it's done in every reconcile.
-	if err := r.composed.Configure(cp, cd, t); err != nil {
+	if err := r.configure(ctx, cp, cd, t); err != nil {
 		return Observation{}, errors.Wrap(err, errConfigure)
 	}
 
 	// Overlay is applied to the Composed resource in all cases so that we can
 	// keep Composed resource up-to-date with the changes in Composite resource.
-	if err := r.composed.Overlay(cp, cd, t); err != nil {
-		return Observation{}, errors.Wrap(err, errOverlay)
+	// Patches that are allowed to degrade rather than fail don't stop us from
+	// composing the resource; we report them in our observation instead.
+	var degraded error
+	if err := r.overlay(ctx, cp, cd, t); err != nil {
+		if !IsDegraded(err) {
+			return Observation{}, errors.Wrap(err, errOverlay)
+		}
+		degraded = err
+	}
+
+	// The desired state of the composed resource is hashed before it is
+	// applied, so that the hash doesn't change when the observed state does.
+	hash, err := Hash(cd)
+	if err != nil {
+		return Observation{}, err
 	}
 
 	// Connection details are fetched in all cases in a best-effort mode, i.e.
 	// it doesn't return error if the secret does not exist or the resource
 	// does not publish a secret at all.
-	conn, err := r.connection.Fetch(ctx, cd, t)
+	rt, err := RenderConnectionSecretKeys(cp, t)
+	if err != nil {
+		return Observation{}, errors.Wrap(err, errFetchSecret)
+	}
+	if rt, err = RenderReadinessChecks(cp, rt); err != nil {
+		return Observation{}, errors.Wrap(err, errReadiness)
+	}
+	// A connection secret reference that is not yet set isn't an error, but
+	// we report it so that it can be distinguished from a composed resource
+	// that genuinely has no connection details.
+	conn, notSet := r.fetch(ctx, cp, cd, rt)
+	if resource.Ignore(IsSecretReferenceNotSet, notSet) != nil {
+		return Observation{}, errors.Wrap(notSet, errFetchSecret)
+	}
+	annotations, err := r.connection.FetchAnnotations(ctx, cd, rt)
 	if err != nil {
 		return Observation{}, errors.Wrap(err, errFetchSecret)
 	}
@@ -174,19 +335,143 @@ func (r *Composer) Compose(ctx context.Context, cp resource.Composite, cd resour
 
 	// Apply should be the last operation of this function so that we can return
 	// the reference to be stored in the Composite resource immediately.
-	if err := r.client.Apply(ctx, cd, resource.MustBeControllableBy(cp.GetUID())); err != nil {
-		return Observation{}, errors.Wrap(err, errApply)
+	if err := r.apply(ctx, cp, cd); err != nil {
+		return Observation{}, err
 	}
 
-	ready, err := r.composed.IsReady(ctx, cd, t)
+	// The observed state of the composed resource is only known once it has
+	// been applied, so we patch the composite resource using it now. The
+	// caller is responsible for persisting the composite resource.
+	if err := PatchComposite(cp, cd, t); err != nil {
+		if !IsDegraded(err) {
+			return Observation{}, errors.Wrap(err, errOverlay)
+		}
+		if degraded == nil {
+			degraded = err
+		}
+	}
+
+	ready, reason, err := r.isReady(ctx, cd, rt)
 	if err != nil {
 		return Observation{}, errors.Wrap(err, errReadiness)
 	}
 
+	// The composed resource only has a UID once it has been applied.
+	changed := r.changes.changed(cd, hash)
+
 	obs := Observation{
-		Ref:               *meta.ReferenceTo(cd, cd.GetObjectKind().GroupVersionKind()),
-		Ready:             ready,
-		ConnectionDetails: conn,
+		Ref:                   *meta.ReferenceTo(cd, cd.GetObjectKind().GroupVersionKind()),
+		Ready:                 ready,
+		ConnectionDetails:     conn,
+		ConnectionAnnotations: annotations,
+		Degraded:              degraded,
+		SteadyState:           ready && !changed,
+		Reason:                reason,
+		SecretReferenceNotSet: notSet,
 	}
 	return obs, nil
 }
+
+// existing reads the live state of the supplied composed resource into it if
+// the base template is to be merged into it, so that fields the base template
+// does not specify are left untouched. Composed resources that do not yet
+// exist are left as they are. Server-side apply leaves fields we don't specify
+// untouched itself, so the live state is not read when it is used.
+func (r *Composer) existing(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) error {
+	if !mergeBase(t) || cd.GetName() == "" || r.fieldManager != nil {
+		return nil
+	}
+	return resource.IgnoreNotFound(r.client.Get(ctx, types.NamespacedName{Namespace: cd.GetNamespace(), Name: cd.GetName()}, cd))
+}
+
+// configure configures the supplied composed resource, using the supplied
+// context if the Configurator supports it.
+func (r *Composer) configure(ctx context.Context, cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error {
+	if cc, ok := r.composed.Configurator.(ContextConfigurator); ok {
+		return cc.ConfigureWithContext(ctx, cp, cd, t)
+	}
+	return r.composed.Configure(cp, cd, t)
+}
+
+// overlay applies the overlay of the supplied template. Patches may read from
+// the siblings carried by the supplied context if the OverlayApplicator
+// supports it.
+func (r *Composer) overlay(ctx context.Context, cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error {
+	if so, ok := r.composed.OverlayApplicator.(SiblingOverlayApplicator); ok {
+		return so.OverlayWithSiblings(cp, cd, t, SiblingsFrom(ctx))
+	}
+	return r.composed.Overlay(cp, cd, t)
+}
+
+// fetch fetches the connection details of the supplied composed resource,
+// reading from the supplied composite resource if the ConnectionDetailsFetcher
+// supports it.
+func (r *Composer) fetch(ctx context.Context, cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) (managed.ConnectionDetails, error) {
+	if cf, ok := r.connection.ConnectionDetailsFetcher.(CompositeConnectionDetailsFetcher); ok {
+		return cf.FetchFromComposite(ctx, cp, cd, t)
+	}
+	return r.connection.Fetch(ctx, cd, t)
+}
+
+// isReady returns whether the supplied composed resource is ready and, if the
+// ReadinessProber supports it, why it is not.
+func (r *Composer) isReady(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (bool, string, error) {
+	if rp, ok := r.composed.ReadinessProber.(ReasonedReadinessProber); ok {
+		return rp.CheckReadyWithReason(ctx, cd, t)
+	}
+	ready, err := r.composed.IsReady(ctx, cd, t)
+	return ready, "", err
+}
+
+// apply the supplied composed resource. Server-side apply is used if a field
+// manager was configured, otherwise the composed resource is patched.
+func (r *Composer) apply(ctx context.Context, cp resource.Composite, cd resource.Composed) error {
+	if r.fieldManager == nil {
+		return errors.Wrap(r.client.Apply(ctx, cd, resource.MustBeControllableBy(cp.GetUID())), errApply)
+	}
+	owner := client.FieldOwner(r.fieldManager(cp))
+
+	// Server-side apply requires a name, so composed resources that have yet
+	// to be named must be created in order to have their name generated.
+	if cd.GetName() == "" {
+		return errors.Wrap(r.client.Create(ctx, cd, owner), errCreate)
+	}
+	cfg, err := applyConfiguration(cd)
+	if err != nil {
+		return errors.Wrap(err, errApply)
+	}
+	if err := r.client.Patch(ctx, cfg, client.Apply, owner, client.ForceOwnership); err != nil {
+		return errors.Wrap(err, errApply)
+	}
+
+	// The API server returns the live state of the composed resource.
+	if u, ok := cd.(runtime.Unstructured); ok {
+		u.SetUnstructuredContent(cfg.UnstructuredContent())
+		return nil
+	}
+	return errors.Wrap(runtime.DefaultUnstructuredConverter.FromUnstructured(cfg.UnstructuredContent(), cd), errApply)
+}
+
+// applyConfiguration returns a server-side apply configuration containing only
+// the fields of the supplied composed resource that we desire. Fields that are
+// set by the API server, such as the status, resource version and managed
+// fields, are omitted so that we don't take ownership of them.
+func applyConfiguration(cd resource.Composed) (*unstructured.Unstructured, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cd)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &unstructured.Unstructured{Object: make(map[string]interface{}, len(u))}
+	for k, v := range u {
+		if k == "metadata" || k == "status" {
+			continue
+		}
+		cfg.Object[k] = v
+	}
+	cfg.SetName(cd.GetName())
+	cfg.SetNamespace(cd.GetNamespace())
+	cfg.SetLabels(cd.GetLabels())
+	cfg.SetAnnotations(cd.GetAnnotations())
+	cfg.SetOwnerReferences(cd.GetOwnerReferences())
+	return cfg, nil
+}
@@ -22,14 +22,21 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
 	"github.com/crossplane/crossplane-runtime/pkg/meta"
 	"github.com/crossplane/crossplane-runtime/pkg/reconciler/managed"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
 	"github.com/crossplane/crossplane-runtime/pkg/resource/fake"
+	runtimecomposed "github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composed"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composite"
 	"github.com/crossplane/crossplane-runtime/pkg/test"
 
 	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
@@ -67,6 +74,13 @@ func TestCompose(t *testing.T) {
 		"cool": []byte("data"),
 	}
 
+	withSecretRef := func(cd *fake.Composed) *fake.Composed {
+		c := cd.DeepCopyObject().(*fake.Composed)
+		c.SetWriteConnectionSecretToReference(&runtimev1alpha1.SecretReference{Name: "coolsecret", Namespace: "coolns"})
+		return c
+	}
+	merge := v1alpha1.BaseMergeModeMerge
+
 	boundCD := cd.DeepCopyObject().(*fake.Composed)
 	meta.AddOwnerReference(boundCD, meta.AsController(meta.TypedReferenceTo(cp, cp.GetObjectKind().GroupVersionKind())))
 
@@ -100,6 +114,37 @@ func TestCompose(t *testing.T) {
 				err: errors.Wrap(errBoom, errConfigure),
 			},
 		},
+		"GetExistingFailed": {
+			reason: "Failure to get the existing composed resource whose base template is merged should return error",
+			args: args{
+				composer: NewComposer(&test.MockClient{MockGet: test.NewMockGetFn(errBoom)}),
+				cd:       cd.DeepCopyObject().(*fake.Composed),
+				t:        v1alpha1.ComposedTemplate{BaseMergeMode: &merge},
+			},
+			want: want{
+				err: errors.Wrap(errBoom, errGetComposed),
+			},
+		},
+		"MergeIntoExisting": {
+			reason: "The live state of a composed resource should be read before its base template is merged into it",
+			args: args{
+				composer: NewComposer(&test.MockClient{MockGet: test.NewMockGetFn(nil, func(obj runtime.Object) error {
+					meta.AddLabels(obj.(metav1.Object), map[string]string{"live": "true"})
+					return nil
+				})},
+					WithConfigurator(ConfigureFn(func(_ resource.Composite, cd resource.Composed, _ v1alpha1.ComposedTemplate) error {
+						if cd.GetLabels()["live"] == "true" {
+							return errBoom
+						}
+						return nil
+					}))),
+				cd: cd.DeepCopyObject().(*fake.Composed),
+				t:  v1alpha1.ComposedTemplate{BaseMergeMode: &merge},
+			},
+			want: want{
+				err: errors.Wrap(errBoom, errConfigure),
+			},
+		},
 		"OverlayFailed": {
 			reason: "Failure of overlay should return error",
 			args: args{
@@ -149,6 +194,70 @@ func TestCompose(t *testing.T) {
 				err: errors.Wrap(errBoom, errApply),
 			},
 		},
+		"ServerSideApplyFailed": {
+			reason: "Failure of server-side apply should return error",
+			args: args{
+				composer: NewComposer(&test.MockClient{MockPatch: test.NewMockPatchFn(errBoom)},
+					WithConfigurator(NopConfigure),
+					WithOverlayApplicator(NopOverlay),
+					WithConnectionDetailFetcher(NopFetcher),
+					WithFieldManager(CompositionFieldManager("crossplane"))),
+				cd: &fake.Composed{ObjectMeta: metav1.ObjectMeta{Name: "composed"}},
+				cp: &fake.Composite{},
+			},
+			want: want{
+				err: errors.Wrap(errBoom, errApply),
+			},
+		},
+		"ServerSideCreateFailed": {
+			reason: "Failure to create an unnamed composed resource should return error",
+			args: args{
+				composer: NewComposer(&test.MockClient{MockCreate: test.NewMockCreateFn(errBoom)},
+					WithConfigurator(NopConfigure),
+					WithOverlayApplicator(NopOverlay),
+					WithConnectionDetailFetcher(NopFetcher),
+					WithFieldManager(CompositionFieldManager("crossplane"))),
+				cd: &fake.Composed{},
+				cp: &fake.Composite{},
+			},
+			want: want{
+				err: errors.Wrap(errBoom, errCreate),
+			},
+		},
+		"ServerSideApplyFieldManager": {
+			reason: "The field manager of the composition should be passed to the apply call",
+			args: args{
+				composer: NewComposer(&test.MockClient{
+					MockPatch: func(_ context.Context, _ runtime.Object, p client.Patch, opts ...client.PatchOption) error {
+						if p != client.Apply {
+							return errors.Errorf("unexpected patch type %s", p.Type())
+						}
+						want := []client.PatchOption{client.FieldOwner("crossplane/coolcomposition"), client.ForceOwnership}
+						if diff := cmp.Diff(want, opts); diff != "" {
+							return errors.New(diff)
+						}
+						return nil
+					},
+				},
+					WithConfigurator(NopConfigure),
+					WithOverlayApplicator(NopOverlay),
+					WithConnectionDetailFetcher(FetchFn(func(_ context.Context, _ resource.Composed, _ v1alpha1.ComposedTemplate) (managed.ConnectionDetails, error) {
+						return conn, nil
+					})),
+					WithFieldManager(CompositionFieldManager("crossplane"))),
+				cd: cd,
+				cp: &fake.Composite{
+					CompositionReferencer: fake.CompositionReferencer{Ref: &corev1.ObjectReference{Name: "coolcomposition"}},
+				},
+			},
+			want: want{
+				obs: Observation{
+					Ref:               *meta.ReferenceTo(cd, cd.GetObjectKind().GroupVersionKind()),
+					ConnectionDetails: conn,
+					Ready:             true,
+				},
+			},
+		},
 		"Success": {
 			reason: "Observation should include the right information",
 			args: args{
@@ -176,6 +285,127 @@ func TestCompose(t *testing.T) {
 				cd: boundCD,
 			},
 		},
+		"OverlayDegraded": {
+			reason: "Patches that degrade rather than fail should be reported in the observation without failing composition",
+			args: args{
+				composer: NewComposer(nil,
+					WithConfigurator(NopConfigure),
+					WithOverlayApplicator(OverlayFn(func(_ resource.Composite, _ resource.Composed, _ v1alpha1.ComposedTemplate) error {
+						return &DegradedError{Errors: []error{errBoom}}
+					})),
+					WithConnectionDetailFetcher(NopFetcher),
+					WithClientApplicator(resource.ClientApplicator{
+						Client: test.NewMockClient(),
+						Applicator: resource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...resource.ApplyOption) error {
+							return nil
+						}),
+					})),
+				cd: cd.DeepCopyObject().(*fake.Composed),
+				cp: &fake.Composite{},
+			},
+			want: want{
+				obs: Observation{
+					Ref:      *meta.ReferenceTo(cd, cd.GetObjectKind().GroupVersionKind()),
+					Ready:    true,
+					Degraded: &DegradedError{Errors: []error{errBoom}},
+				},
+			},
+		},
+		"SecretReferenceNotSet": {
+			reason: "A connection secret reference that is not yet set should be reported in the observation without failing composition",
+			args: args{
+				composer: NewComposer(nil,
+					WithConfigurator(NopConfigure),
+					WithOverlayApplicator(NopOverlay),
+					WithConnectionDetailFetcher(FetchFn(func(_ context.Context, _ resource.Composed, _ v1alpha1.ComposedTemplate) (managed.ConnectionDetails, error) {
+						return conn, &SecretReferenceNotSetError{NamePath: "status.secretName"}
+					})),
+					WithClientApplicator(resource.ClientApplicator{
+						Client: test.NewMockClient(),
+						Applicator: resource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...resource.ApplyOption) error {
+							return nil
+						}),
+					})),
+				cd: cd.DeepCopyObject().(*fake.Composed),
+				cp: &fake.Composite{},
+			},
+			want: want{
+				obs: Observation{
+					Ref:                   *meta.ReferenceTo(cd, cd.GetObjectKind().GroupVersionKind()),
+					ConnectionDetails:     conn,
+					Ready:                 true,
+					SecretReferenceNotSet: &SecretReferenceNotSetError{NamePath: "status.secretName"},
+				},
+			},
+		},
+		"TemplatedConnectionSecretKey": {
+			reason: "Templated connection secret keys should be rendered using the composite resource before fetching",
+			args: args{
+				composer: NewComposer(nil,
+					WithConfigurator(NopConfigure),
+					WithOverlayApplicator(NopOverlay),
+					WithConnectionDetailFetcher(NewAPIConnectionDetailsFetcher(&test.MockClient{
+						MockGet: test.NewMockGetFn(nil, func(obj runtime.Object) error {
+							obj.(*corev1.Secret).Data = map[string][]byte{"password-us-east-1": []byte("secret")}
+							return nil
+						}),
+					})),
+					WithClientApplicator(resource.ClientApplicator{
+						Client: test.NewMockClient(),
+						Applicator: resource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...resource.ApplyOption) error {
+							return nil
+						}),
+					})),
+				cd: withSecretRef(cd),
+				cp: func() resource.Composite {
+					cp := composite.New()
+					cp.SetLabels(map[string]string{"region": "us-east-1"})
+					return cp
+				}(),
+				t: v1alpha1.ComposedTemplate{ConnectionDetails: []v1alpha1.ConnectionDetail{{
+					Name:                    pointer.StringPtr("password"),
+					FromConnectionSecretKey: pointer.StringPtr("password-{{ .metadata.labels.region }}"),
+				}}},
+			},
+			want: want{
+				obs: Observation{
+					Ref:               *meta.ReferenceTo(cd, cd.GetObjectKind().GroupVersionKind()),
+					ConnectionDetails: managed.ConnectionDetails{"password": []byte("secret")},
+					Ready:             true,
+				},
+			},
+		},
+		"SuccessWithConnectionAnnotations": {
+			reason: "Observation should include the propagated connection secret annotations",
+			args: args{
+				composer: NewComposer(nil,
+					WithConfigurator(NopConfigure),
+					WithOverlayApplicator(NopOverlay),
+					WithConnectionDetailFetcher(FetchFn(func(_ context.Context, _ resource.Composed, _ v1alpha1.ComposedTemplate) (managed.ConnectionDetails, error) {
+						return conn, nil
+					})),
+					WithConnectionAnnotationsFetcher(FetchAnnotationsFn(func(_ context.Context, _ resource.Composed, _ v1alpha1.ComposedTemplate) (map[string]string, error) {
+						return map[string]string{"example.org/encrypted": "true"}, nil
+					})),
+					WithClientApplicator(resource.ClientApplicator{
+						Client: test.NewMockClient(),
+						Applicator: resource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...resource.ApplyOption) error {
+							return nil
+						}),
+					})),
+				cd: cd,
+				cp: &fake.Composite{},
+			},
+			want: want{
+				obs: Observation{
+					Ref:                   *meta.ReferenceTo(cd, cd.GetObjectKind().GroupVersionKind()),
+					ConnectionDetails:     conn,
+					ConnectionAnnotations: map[string]string{"example.org/encrypted": "true"},
+					Ready:                 true,
+				},
+				cd: boundCD,
+			},
+		},
 	}
 
 	for name, tc := range cases {
@@ -184,10 +414,247 @@ func TestCompose(t *testing.T) {
 			if diff := cmp.Diff(tc.err, err, test.EquateErrors()); diff != "" {
 				t.Errorf("\n%s\nCompose(...): -want, +got:\n%s", tc.reason, diff)
 			}
-			if diff := cmp.Diff(tc.obs, obs); diff != "" {
+			if diff := cmp.Diff(tc.obs, obs, test.EquateErrors()); diff != "" {
 				t.Errorf("\n%s\nCompose(...): -want, +got:\n%s", tc.reason, diff)
 			}
 		})
 	}
 
 }
+
+func TestComposeSiblings(t *testing.T) {
+	network := runtimecomposed.New()
+	network.SetAnnotations(map[string]string{"example.org/id": "vpc-1234"})
+	tmpl := v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{{
+		FromComposed:  pointer.StringPtr("network"),
+		FromFieldPath: "metadata.annotations[example.org/id]",
+		ToFieldPath:   "metadata.annotations[example.org/vpc-id]",
+	}}}
+	c := NewComposer(nil,
+		WithConfigurator(NopConfigure),
+		WithConnectionDetailFetcher(NopFetcher),
+		WithClientApplicator(resource.ClientApplicator{
+			Applicator: resource.ApplyFn(func(_ context.Context, _ runtime.Object, _ ...resource.ApplyOption) error {
+				return nil
+			}),
+		}))
+
+	cd := runtimecomposed.New()
+	ctx := WithSiblings(context.Background(), Siblings{"network": network})
+	if _, err := c.Compose(ctx, &fake.Composite{}, cd, tmpl); err != nil {
+		t.Fatalf("Compose(...): %s", err)
+	}
+	want := map[string]string{"example.org/vpc-id": "vpc-1234"}
+	if diff := cmp.Diff(want, cd.GetAnnotations()); diff != "" {
+		t.Errorf("Compose(...): patches should read from the siblings carried by the context: -want, +got:\n%s", diff)
+	}
+}
+
+func TestComposePatchComposite(t *testing.T) {
+	required := v1alpha1.FromFieldPathPolicyRequired
+	degrade := v1alpha1.ErrorPolicyDegrade
+	tmpl := v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{{
+		Type:          v1alpha1.PatchTypeToCompositeFieldPath,
+		FromFieldPath: "status.atProvider.address",
+		ToFieldPath:   "status.address",
+		Policy:        &v1alpha1.PatchPolicy{FromFieldPath: &required, Error: &degrade},
+	}}}
+	c := NewComposer(nil,
+		WithConfigurator(NopConfigure),
+		WithConnectionDetailFetcher(NopFetcher),
+		WithClientApplicator(resource.ClientApplicator{
+			Applicator: resource.ApplyFn(func(_ context.Context, o runtime.Object, _ ...resource.ApplyOption) error {
+				// Simulate the API server returning the observed state of the
+				// composed resource.
+				o.(*runtimecomposed.Unstructured).Object["status"] = map[string]interface{}{
+					"atProvider": map[string]interface{}{"address": "10.0.0.1"},
+				}
+				return nil
+			}),
+		}))
+
+	cp := composite.New()
+	obs, err := c.Compose(context.Background(), cp, runtimecomposed.New(), tmpl)
+	if err != nil {
+		t.Fatalf("Compose(...): %s", err)
+	}
+	if obs.Degraded != nil {
+		t.Errorf("Compose(...): patches to the composite resource should only be applied once the composed resource has been observed, got degraded: %s", obs.Degraded)
+	}
+	want := map[string]interface{}{"address": "10.0.0.1"}
+	if diff := cmp.Diff(want, cp.Object["status"]); diff != "" {
+		t.Errorf("Compose(...): the composite resource should be patched using the observed composed resource: -want, +got:\n%s", diff)
+	}
+}
+
+func TestComposeConsecutiveSuccesses(t *testing.T) {
+	tmpl := v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+		{Type: "MatchString", FieldPath: "status.phase", MatchString: "Running", ConsecutiveSuccesses: 3},
+	}}
+	c := NewComposer(&test.MockClient{
+		MockPatch: func(_ context.Context, o runtime.Object, _ client.Patch, _ ...client.PatchOption) error {
+			// Simulate server-side apply returning the live state of the
+			// composed resource, which carries only the fields we applied.
+			cd := o.(*unstructured.Unstructured)
+			cd.SetUID("cool-uid")
+			cd.Object["status"] = map[string]interface{}{"phase": "Running"}
+			return nil
+		},
+	},
+		WithConfigurator(NopConfigure),
+		WithOverlayApplicator(NopOverlay),
+		WithConnectionDetailFetcher(NopFetcher),
+		WithFieldManager(CompositionFieldManager("crossplane")))
+
+	cp := composite.New()
+	cp.SetCompositionReference(&corev1.ObjectReference{Name: "coolcomposition"})
+	want := []bool{false, false, true, true}
+	got := make([]bool, len(want))
+	for i := range want {
+		cd := runtimecomposed.New()
+		cd.SetName("cool-composed")
+		obs, err := c.Compose(context.Background(), cp, cd, tmpl)
+		if err != nil {
+			t.Fatalf("Compose(...) at reconcile %d: %s", i, err)
+		}
+		got[i] = obs.Ready
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Compose(...): a composed resource should be ready once it has passed its readiness check the required number of reconciles in a row: -want ready, +got ready:\n%s", diff)
+	}
+}
+
+func TestComposeServerSideApply(t *testing.T) {
+	// The composed resource carries its live state, as if it had been read
+	// from the API server.
+	cd := runtimecomposed.New()
+	cd.SetAPIVersion("example.org/v1")
+	cd.SetKind("Cool")
+	cd.SetName("cool-composed")
+	cd.SetLabels(map[string]string{"cool": "very"})
+	cd.SetResourceVersion("42")
+	cd.SetUID("cool-uid")
+	cd.SetManagedFields([]metav1.ManagedFieldsEntry{{Manager: "someone-else"}})
+	cd.Object["spec"] = map[string]interface{}{"size": "large"}
+	cd.Object["status"] = map[string]interface{}{"phase": "Running"}
+
+	var applied map[string]interface{}
+	c := NewComposer(&test.MockClient{
+		MockPatch: func(_ context.Context, o runtime.Object, _ client.Patch, _ ...client.PatchOption) error {
+			u := o.(*unstructured.Unstructured)
+			applied = u.DeepCopy().Object
+
+			// Simulate server-side apply returning the live state.
+			u.SetResourceVersion("43")
+			u.Object["status"] = map[string]interface{}{"phase": "Running"}
+			return nil
+		},
+	},
+		WithConfigurator(NopConfigure),
+		WithOverlayApplicator(NopOverlay),
+		WithConnectionDetailFetcher(NopFetcher),
+		WithFieldManager(CompositionFieldManager("crossplane")))
+
+	cp := composite.New(composite.WithGroupVersionKind(schema.GroupVersionKind{Group: "example.org", Version: "v1", Kind: "XCool"}))
+	cp.SetName("cool-xr")
+	cp.SetUID("cool-xr-uid")
+	cp.SetCompositionReference(&corev1.ObjectReference{Name: "coolcomposition"})
+	if _, err := c.Compose(context.Background(), cp, cd, v1alpha1.ComposedTemplate{}); err != nil {
+		t.Fatalf("Compose(...): %s", err)
+	}
+
+	want := map[string]interface{}{
+		"apiVersion": "example.org/v1",
+		"kind":       "Cool",
+		"metadata": map[string]interface{}{
+			"name":   "cool-composed",
+			"labels": map[string]interface{}{"cool": "very"},
+			"ownerReferences": []interface{}{map[string]interface{}{
+				"apiVersion": "example.org/v1",
+				"kind":       "XCool",
+				"name":       "cool-xr",
+				"uid":        "cool-xr-uid",
+				"controller": true,
+			}},
+		},
+		"spec": map[string]interface{}{"size": "large"},
+	}
+	if diff := cmp.Diff(want, applied); diff != "" {
+		t.Errorf("Compose(...): only the desired fields should be applied: -want, +got:\n%s", diff)
+	}
+	if diff := cmp.Diff("43", cd.GetResourceVersion()); diff != "" {
+		t.Errorf("Compose(...): the composed resource should carry the applied live state: -want, +got:\n%s", diff)
+	}
+}
+
+func TestComposeSteadyState(t *testing.T) {
+	ready := IsReadyFn(func(_ context.Context, _ resource.Composed, _ v1alpha1.ComposedTemplate) (bool, error) {
+		return true, nil
+	})
+	notReady := IsReadyFn(func(_ context.Context, _ resource.Composed, _ v1alpha1.ComposedTemplate) (bool, error) {
+		return false, nil
+	})
+	overlay := func(value string) OverlayFn {
+		return OverlayFn(func(_ resource.Composite, cd resource.Composed, _ v1alpha1.ComposedTemplate) error {
+			meta.AddAnnotations(cd, map[string]string{"example.org/source": value})
+			return nil
+		})
+	}
+	applicator := resource.ClientApplicator{
+		Applicator: resource.ApplyFn(func(_ context.Context, o runtime.Object, _ ...resource.ApplyOption) error {
+			// Simulate the API server setting the UID of the composed resource.
+			o.(*fake.Composed).SetUID("cool-uid")
+			return nil
+		}),
+	}
+
+	type compose struct {
+		overlay OverlayFn
+		ready   ReadinessProber
+	}
+	cases := map[string]struct {
+		reason   string
+		composes []compose
+		want     []bool
+	}{
+		"Unchanged": {
+			reason:   "A ready composed resource should be in a steady state once it has been composed again without changes",
+			composes: []compose{{overlay("a"), ready}, {overlay("a"), ready}, {overlay("a"), ready}},
+			want:     []bool{false, true, true},
+		},
+		"PendingUpdate": {
+			reason:   "A ready composed resource should not be in a steady state when a field it is patched from changed",
+			composes: []compose{{overlay("a"), ready}, {overlay("a"), ready}, {overlay("b"), ready}, {overlay("b"), ready}},
+			want:     []bool{false, true, false, true},
+		},
+		"NotReady": {
+			reason:   "An unchanged composed resource should not be in a steady state until it is ready",
+			composes: []compose{{overlay("a"), notReady}, {overlay("a"), notReady}, {overlay("a"), ready}},
+			want:     []bool{false, false, true},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			changes := newChangeTracker()
+			got := make([]bool, len(tc.composes))
+			for i, c := range tc.composes {
+				composer := NewComposer(nil,
+					WithConfigurator(NopConfigure),
+					WithOverlayApplicator(c.overlay),
+					WithConnectionDetailFetcher(NopFetcher),
+					WithReadinessProber(c.ready),
+					WithClientApplicator(applicator))
+				composer.changes = changes
+
+				obs, err := composer.Compose(context.Background(), &fake.Composite{}, &fake.Composed{}, v1alpha1.ComposedTemplate{})
+				if err != nil {
+					t.Fatalf("\n%s\nCompose(...): %s", tc.reason, err)
+				}
+				got[i] = obs.SteadyState
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nCompose(...): -want steady state, +got steady state:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
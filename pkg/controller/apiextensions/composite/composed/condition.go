@@ -0,0 +1,97 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+)
+
+// MaxConditionMessageLength is the maximum length of a condition message that
+// the Kubernetes API server will accept.
+const MaxConditionMessageLength = 32768
+
+const truncated = "..."
+
+// A ReadinessDetail describes whether a composed resource is ready and, if it
+// is not, why.
+type ReadinessDetail struct {
+	// Name of the composed resource.
+	Name string
+
+	// Ready is true if the composed resource is ready.
+	Ready bool
+
+	// Reason the composed resource is not ready, if known.
+	Reason string
+}
+
+// ReadinessCondition merges the supplied readiness details of the resources a
+// composite resource composes into a single condition. The composite resource
+// is available if all composed resources are ready, and creating otherwise.
+// The message of a creating condition summarizes the first n composed
+// resources that are not ready, and is truncated to at most max bytes.
+func ReadinessCondition(details []ReadinessDetail, n, max int) runtimev1alpha1.Condition {
+	blocking := make([]string, 0, len(details))
+	for _, d := range details {
+		if d.Ready {
+			continue
+		}
+		b := d.Name
+		if d.Reason != "" {
+			b = fmt.Sprintf("%s (%s)", d.Name, d.Reason)
+		}
+		blocking = append(blocking, b)
+	}
+	if len(blocking) == 0 {
+		return runtimev1alpha1.Available()
+	}
+
+	msg := fmt.Sprintf("%d of %d composed resources are not ready", len(blocking), len(details))
+	if n > 0 {
+		shown := blocking
+		if len(shown) > n {
+			shown = shown[:n]
+		}
+		msg = fmt.Sprintf("%s: %s", msg, strings.Join(shown, "; "))
+		if more := len(blocking) - len(shown); more > 0 {
+			msg = fmt.Sprintf("%s; and %d more", msg, more)
+		}
+	}
+	return runtimev1alpha1.Creating().WithMessage(truncate(msg, max))
+}
+
+// truncate the supplied message to at most max bytes, without splitting a
+// multi-byte character. Truncated messages end in an ellipsis.
+func truncate(msg string, max int) string {
+	switch {
+	case len(msg) <= max:
+		return msg
+	case max <= 0:
+		return ""
+	case max <= len(truncated):
+		return truncated[:max]
+	}
+	i := max - len(truncated)
+	for i > 0 && !utf8.RuneStart(msg[i]) {
+		i--
+	}
+	return msg[:i] + truncated
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+)
+
+func TestReadinessCondition(t *testing.T) {
+	type args struct {
+		details []ReadinessDetail
+		n       int
+		max     int
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   runtimev1alpha1.Condition
+	}{
+		"NoBlockers": {
+			reason: "A composite resource whose composed resources are all ready should be available",
+			args: args{
+				details: []ReadinessDetail{{Name: "a", Ready: true}, {Name: "b", Ready: true}},
+				n:       3,
+				max:     MaxConditionMessageLength,
+			},
+			want: runtimev1alpha1.Available(),
+		},
+		"NoResources": {
+			reason: "A composite resource that composes no resources should be available",
+			args:   args{n: 3, max: MaxConditionMessageLength},
+			want:   runtimev1alpha1.Available(),
+		},
+		"Blockers": {
+			reason: "The composed resources that are not ready should be summarized",
+			args: args{
+				details: []ReadinessDetail{{Name: "a", Ready: true}, {Name: "b", Reason: "waiting for endpoint"}, {Name: "c"}},
+				n:       3,
+				max:     MaxConditionMessageLength,
+			},
+			want: runtimev1alpha1.Creating().WithMessage("2 of 3 composed resources are not ready: b (waiting for endpoint); c"),
+		},
+		"TopBlockers": {
+			reason: "Only the first n composed resources that are not ready should be summarized",
+			args: args{
+				details: []ReadinessDetail{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}},
+				n:       2,
+				max:     MaxConditionMessageLength,
+			},
+			want: runtimev1alpha1.Creating().WithMessage("4 of 4 composed resources are not ready: a; b; and 2 more"),
+		},
+		"NoSummary": {
+			reason: "No composed resources should be summarized if n is zero",
+			args: args{
+				details: []ReadinessDetail{{Name: "a"}},
+				max:     MaxConditionMessageLength,
+			},
+			want: runtimev1alpha1.Creating().WithMessage("1 of 1 composed resources are not ready"),
+		},
+		"AtBoundary": {
+			reason: "A message that is exactly the maximum length should not be truncated",
+			args: args{
+				details: []ReadinessDetail{{Name: "a"}},
+				n:       1,
+				max:     len("1 of 1 composed resources are not ready: a"),
+			},
+			want: runtimev1alpha1.Creating().WithMessage("1 of 1 composed resources are not ready: a"),
+		},
+		"PastBoundary": {
+			reason: "A message that is one byte longer than the maximum length should be truncated",
+			args: args{
+				details: []ReadinessDetail{{Name: "ab"}},
+				n:       1,
+				max:     len("1 of 1 composed resources are not ready: a"),
+			},
+			want: runtimev1alpha1.Creating().WithMessage("1 of 1 composed resources are not ready..."),
+		},
+		"MultiByte": {
+			reason: "Truncation should not split a multi-byte character",
+			args: args{
+				details: []ReadinessDetail{{Name: "aé", Reason: "waiting"}},
+				n:       1,
+				max:     len("1 of 1 composed resources are not ready: aé") + 2,
+			},
+			want: runtimev1alpha1.Creating().WithMessage("1 of 1 composed resources are not ready: a..."),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := ReadinessCondition(tc.args.details, tc.args.n, tc.args.max)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nReadinessCondition(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if len(got.Message) > tc.args.max {
+				t.Errorf("\n%s\nReadinessCondition(...): message is %d bytes, want at most %d", tc.reason, len(got.Message), tc.args.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os/exec"
+
+	"github.com/pkg/errors"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+const (
+	errRunFunction       = "cannot run composition function"
+	errMarshalFnInput    = "cannot marshal composition function input"
+	errUnmarshalFnOutput = "cannot unmarshal composition function output"
+	errFmtUnnamedDesired = "desired resource at index %d has no name"
+	errFmtDuplicateName  = "desired resources at index %d and %d have the same name %q"
+)
+
+// A CompositionFunction computes the desired composed resources of the
+// supplied composite resource, given its currently observed composed resources.
+// The desired composed resources are expressed as templates so that they can
+// be processed by the same Configure and Overlay pipeline as the templates of
+// a Composition.
+type CompositionFunction interface {
+	Run(ctx context.Context, cp resource.Composite, observed []resource.Composed) ([]v1alpha1.ComposedTemplate, error)
+}
+
+// A CompositionFunctionFn is a function that implements the CompositionFunction
+// interface.
+type CompositionFunctionFn func(ctx context.Context, cp resource.Composite, observed []resource.Composed) ([]v1alpha1.ComposedTemplate, error)
+
+// Run calls CompositionFunctionFn.
+func (fn CompositionFunctionFn) Run(ctx context.Context, cp resource.Composite, observed []resource.Composed) ([]v1alpha1.ComposedTemplate, error) {
+	return fn(ctx, cp, observed)
+}
+
+// A FunctionInput is written to the stdin of an ExecCompositionFunction.
+type FunctionInput struct {
+	// Composite is the composite resource.
+	Composite resource.Composite `json:"composite"`
+
+	// Observed is the observed composed resources of the composite resource.
+	Observed []resource.Composed `json:"observed,omitempty"`
+}
+
+// A FunctionOutput is read from the stdout of an ExecCompositionFunction.
+type FunctionOutput struct {
+	// Desired is the desired composed resources of the composite resource.
+	// Each must be named, so that it can be matched to the observed composed
+	// resource that was previously composed from it.
+	Desired []v1alpha1.ComposedTemplate `json:"desired,omitempty"`
+}
+
+// NewExecCompositionFunction returns a CompositionFunction that runs the
+// supplied command.
+func NewExecCompositionFunction(command string, args ...string) *ExecCompositionFunction {
+	return &ExecCompositionFunction{command: command, args: args}
+}
+
+// An ExecCompositionFunction runs an executable in order to compute the desired
+// composed resources. A FunctionInput is written to the executable's stdin as
+// JSON, and a FunctionOutput is expected to be written to its stdout.
+type ExecCompositionFunction struct {
+	command string
+	args    []string
+}
+
+// Run the executable.
+func (f *ExecCompositionFunction) Run(ctx context.Context, cp resource.Composite, observed []resource.Composed) ([]v1alpha1.ComposedTemplate, error) {
+	in, err := json.Marshal(&FunctionInput{Composite: cp, Observed: observed})
+	if err != nil {
+		return nil, errors.Wrap(err, errMarshalFnInput)
+	}
+
+	// The command is supplied by the operator of this controller, not read
+	// from an untrusted source.
+	cmd := exec.CommandContext(ctx, f.command, f.args...) // nolint:gosec
+	cmd.Stdin = bytes.NewReader(in)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrap(err, errRunFunction)
+	}
+
+	fo := &FunctionOutput{}
+	if err := json.Unmarshal(out, fo); err != nil {
+		return nil, errors.Wrap(err, errUnmarshalFnOutput)
+	}
+	return fo.Desired, nil
+}
+
+// NewFunctionRunner returns a FunctionRunner that computes the desired
+// composed resources using the supplied CompositionFunction.
+func NewFunctionRunner(fn CompositionFunction) *FunctionRunner {
+	return &FunctionRunner{fn: fn}
+}
+
+// A FunctionRunner computes the desired composed resources using templates
+// that are computed by a CompositionFunction rather than read from a
+// Composition. The templates are composed, and their readiness and connection
+// details handled, just as they would be for the templates of a Composition.
+type FunctionRunner struct {
+	fn CompositionFunction
+}
+
+// Desired runs the CompositionFunction and returns the desired resources it
+// returns, along with the observed resource each should be composed into, or
+// nil if it has not yet been composed. Desired resources are matched to the
+// observed resources by the AnnotationKeyCompositionResourceName annotation,
+// so each desired resource must be named. Observed resources that don't match
+// any desired resource are no longer desired.
+func (r *FunctionRunner) Desired(ctx context.Context, cp resource.Composite, observed []resource.Composed) ([]v1alpha1.ComposedTemplate, []resource.Composed, error) {
+	desired, err := r.fn.Run(ctx, cp, observed)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, errRunFunction)
+	}
+
+	byName := make(map[string]resource.Composed, len(observed))
+	for _, cd := range observed {
+		if name, ok := cd.GetAnnotations()[AnnotationKeyCompositionResourceName]; ok {
+			byName[name] = cd
+		}
+	}
+
+	index := make(map[string]int, len(desired))
+	cds := make([]resource.Composed, len(desired))
+	for i, t := range desired {
+		if t.Name == nil {
+			return nil, nil, errors.Errorf(errFmtUnnamedDesired, i)
+		}
+		if j, ok := index[*t.Name]; ok {
+			return nil, nil, errors.Errorf(errFmtDuplicateName, j, i, *t.Name)
+		}
+		index[*t.Name] = i
+		cds[i] = byName[*t.Name]
+	}
+	return desired, cds, nil
+}
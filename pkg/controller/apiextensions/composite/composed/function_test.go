@@ -0,0 +1,148 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	runtimecomposed "github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composed"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composite"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+func TestFunctionRunner(t *testing.T) {
+	cp := composite.New()
+	cp.SetLabels(map[string]string{
+		LabelKeyNamePrefixForComposed: "cool",
+		"size":                        "large",
+	})
+	desired := []v1alpha1.ComposedTemplate{
+		{
+			Name:    pointer.StringPtr("cool"),
+			Base:    runtime.RawExtension{Raw: []byte(`{"apiVersion":"example.org/v1","kind":"Cool","spec":{"size":"small"}}`)},
+			Patches: []v1alpha1.Patch{{FromFieldPath: "metadata.labels[size]", ToFieldPath: "spec.size"}},
+		},
+	}
+	composedFrom := func(name, template string) resource.Composed {
+		return runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+			r.SetName(name)
+			r.SetAnnotations(map[string]string{AnnotationKeyCompositionResourceName: template})
+		})
+	}
+	returns := func(ts ...v1alpha1.ComposedTemplate) CompositionFunction {
+		return CompositionFunctionFn(func(_ context.Context, _ resource.Composite, _ []resource.Composed) ([]v1alpha1.ComposedTemplate, error) {
+			return ts, nil
+		})
+	}
+
+	type args struct {
+		fn       CompositionFunction
+		observed []resource.Composed
+	}
+	type want struct {
+		desired int
+		names   []string
+		err     error
+	}
+	cases := map[string]struct {
+		reason string
+		args
+		want
+	}{
+		"FunctionFailed": {
+			reason: "Failure to run the composition function should return an error",
+			args: args{
+				fn: CompositionFunctionFn(func(_ context.Context, _ resource.Composite, _ []resource.Composed) ([]v1alpha1.ComposedTemplate, error) {
+					return nil, errBoom
+				}),
+			},
+			want: want{
+				err: errors.Wrap(errBoom, errRunFunction),
+			},
+		},
+		"UnnamedDesired": {
+			reason: "Desired resources that can't be matched to observed resources because they have no name should return an error",
+			args: args{
+				fn: returns(v1alpha1.ComposedTemplate{}),
+			},
+			want: want{
+				err: errors.Errorf(errFmtUnnamedDesired, 0),
+			},
+		},
+		"DuplicateDesired": {
+			reason: "Desired resources that can't be matched to observed resources because they have the same name should return an error",
+			args: args{
+				fn: returns(desired[0], desired[0]),
+			},
+			want: want{
+				err: errors.Errorf(errFmtDuplicateName, 0, 1, "cool"),
+			},
+		},
+		"NotYetComposed": {
+			reason: "Desired resources that have not yet been composed should not be matched to an observed resource",
+			args: args{
+				fn: returns(desired...),
+			},
+			want: want{
+				desired: 1,
+				names:   []string{""},
+			},
+		},
+		"MatchedByName": {
+			reason: "Desired resources should be matched to the observed resource composed from the template of the same name, regardless of order",
+			args: args{
+				fn:       returns(desired...),
+				observed: []resource.Composed{composedFrom("cool-other", "other"), composedFrom("cool-abcde", "cool")},
+			},
+			want: want{
+				desired: 1,
+				names:   []string{"cool-abcde"},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ts, cds, err := NewFunctionRunner(tc.args.fn).Desired(context.Background(), cp, tc.args.observed)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nDesired(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.desired, len(ts)); diff != "" {
+				t.Errorf("\n%s\nDesired(...): -want desired resources, +got desired resources:\n%s", tc.reason, diff)
+			}
+			var names []string
+			for _, cd := range cds {
+				n := ""
+				if cd != nil {
+					n = cd.GetName()
+				}
+				names = append(names, n)
+			}
+			if diff := cmp.Diff(tc.want.names, names); diff != "" {
+				t.Errorf("\n%s\nDesired(...): -want matched names, +got matched names:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
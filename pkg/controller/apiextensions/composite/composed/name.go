@@ -0,0 +1,170 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+const errFmtInvalidName = "cannot name composed resource %q: %s"
+
+const (
+	// nameHashLength is the number of hexadecimal characters of the hash
+	// that is appended to shortened names.
+	nameHashLength = 8
+
+	// generatedNameSuffixLength is the number of random characters the API
+	// server appends to the generateName of a resource to name it.
+	generatedNameSuffixLength = 5
+)
+
+// A NameGenerator names a composed resource, either by setting its name or by
+// setting the prefix from which the API server generates its name. Composed
+// resources that are already named keep their name.
+type NameGenerator interface {
+	GenerateName(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error
+}
+
+// A NameGeneratorFn is a function that satisfies the NameGenerator interface.
+type NameGeneratorFn func(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error
+
+// GenerateName calls NameGeneratorFn.
+func (fn NameGeneratorFn) GenerateName(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error {
+	return fn(cp, cd, t)
+}
+
+// GeneratePrefixedName has the API server generate the name of the composed
+// resource from the name prefix of the composite resource, or the name prefix
+// override of the template. It is the default NameGenerator.
+var GeneratePrefixedName = NameGeneratorFn(func(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error {
+	cd.SetGenerateName(namePrefix(cp, t) + "-")
+	return nil
+})
+
+// NameFromTemplate names the composed resource deterministically after the
+// composite resource and the template it is composed from, for example
+// "mycomposite-database-1a2b3c4d". Template names are unique within a
+// composition, so composed resources of the same composite resource never
+// collide even if their templates share a base kind. The name ends with the
+// first 8 hexadecimal characters of the SHA-256 hash of the UID of the
+// composite resource, or of its name if it has no UID, so that the resources
+// of different composite resources don't collide either, for example those of
+// composite "a" composed from template "b-c" and of composite "a-b" composed
+// from template "c". Resources composed from unnamed templates are named by
+// GeneratePrefixedName.
+var NameFromTemplate = NameGeneratorFn(func(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error {
+	if t.Name == nil || *t.Name == "" {
+		return GeneratePrefixedName(cp, cd, t)
+	}
+	if cd.GetName() != "" {
+		return nil
+	}
+	id := string(cp.GetUID())
+	if id == "" {
+		id = cp.GetName()
+	}
+	name := fmt.Sprintf("%s-%s-%s", cp.GetName(), *t.Name, nameHash(id))
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return errors.Errorf(errFmtInvalidName, name, strings.Join(errs, ", "))
+	}
+	cd.SetName(name)
+	return nil
+})
+
+// WithNameGenerator configures a DefaultConfigurator to name composed resources
+// using the supplied NameGenerator, rather than by GeneratePrefixedName.
+func WithNameGenerator(n NameGenerator) ConfiguratorOption {
+	return func(c *DefaultConfigurator) {
+		c.names = n
+	}
+}
+
+// WithMaxNameLength configures a DefaultConfigurator to shorten the names, and
+// the generateNames, of newly named composed resources so that they are no
+// longer than the supplied number of characters, for example 63 for composed
+// resources whose provider limits names to a DNS label. A generateName is
+// shortened so that the name the API server generates from it, by appending 5
+// random characters, fits within the limit. Names are shortened as described
+// by ShortenName. Composed resources that are already named keep their name.
+func WithMaxNameLength(n int) ConfiguratorOption {
+	return func(c *DefaultConfigurator) {
+		c.maxNameLength = n
+	}
+}
+
+// ShortenName returns the supplied name unchanged if it is no longer than max
+// characters. Otherwise it truncates the name, then appends a hyphen and the
+// first 8 hexadecimal characters of the SHA-256 hash of the whole, untruncated
+// name, such that the result is max characters long. Any hyphens or dots that
+// end the truncated name are trimmed, so the result may be shorter. Names that
+// share a truncated prefix thus remain distinct, and the same name is always
+// shortened the same way. If max is too short to keep any of the name only as
+// many characters of the hash as fit are returned.
+func ShortenName(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+	hash := nameHash(name)
+	keep := max - nameHashLength - 1
+	switch {
+	case keep > 0:
+		return strings.TrimRight(name[:keep], "-.") + "-" + hash
+	case max <= 0:
+		return ""
+	case max < nameHashLength:
+		return hash[:max]
+	}
+	return hash
+}
+
+// nameHash returns the first 8 hexadecimal characters of the SHA-256 hash of
+// the supplied string.
+func nameHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:nameHashLength]
+}
+
+// shortenName shortens the supplied name so that it and the supplied number
+// of reserved characters fit within the maximum name length, if any.
+func (c *DefaultConfigurator) shortenName(name string, reserved int) string {
+	if c.maxNameLength <= 0 {
+		return name
+	}
+	return ShortenName(name, c.maxNameLength-reserved)
+}
+
+// shortenNames shortens the name or generateName set by the NameGenerator of
+// a composed resource that was not already named. The supplied number of
+// characters is reserved for a suffix that will be appended to the name.
+func (c *DefaultConfigurator) shortenNames(cd resource.Composed, reserved int) {
+	if n := cd.GetName(); n != "" {
+		cd.SetName(c.shortenName(n, reserved))
+	}
+	if gn := cd.GetGenerateName(); gn != "" {
+		cd.SetGenerateName(c.shortenName(strings.TrimSuffix(gn, "-"), generatedNameSuffixLength+1) + "-")
+	}
+}
@@ -0,0 +1,260 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/pointer"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/fake"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+func TestNameFromTemplate(t *testing.T) {
+	cp := &fake.Composite{ObjectMeta: metav1.ObjectMeta{
+		Name:   "cool-composite",
+		UID:    "cool-uid",
+		Labels: map[string]string{LabelKeyNamePrefixForComposed: "ola"},
+	}}
+
+	type args struct {
+		cp resource.Composite
+		cd resource.Composed
+		t  v1alpha1.ComposedTemplate
+	}
+	type want struct {
+		name         string
+		generateName string
+		err          error
+	}
+	cases := map[string]struct {
+		reason string
+		args
+		want
+	}{
+		"NamedTemplate": {
+			reason: "Resources composed from a named template should be named after the composite, the template, and a hash of the composite's UID",
+			args: args{
+				cp: cp,
+				cd: &fake.Composed{},
+				t:  v1alpha1.ComposedTemplate{Name: pointer.StringPtr("database")},
+			},
+			want: want{
+				name: "cool-composite-database-" + nameHash("cool-uid"),
+			},
+		},
+		"NoUID": {
+			reason: "Resources of a composite without a UID should be named using a hash of the composite's name",
+			args: args{
+				cp: &fake.Composite{ObjectMeta: metav1.ObjectMeta{Name: "cool-composite"}},
+				cd: &fake.Composed{},
+				t:  v1alpha1.ComposedTemplate{Name: pointer.StringPtr("database")},
+			},
+			want: want{
+				name: "cool-composite-database-" + nameHash("cool-composite"),
+			},
+		},
+		"AlreadyNamed": {
+			reason: "Resources that are already named should keep their name",
+			args: args{
+				cp: cp,
+				cd: &fake.Composed{ObjectMeta: metav1.ObjectMeta{Name: "cool"}},
+				t:  v1alpha1.ComposedTemplate{Name: pointer.StringPtr("database")},
+			},
+			want: want{
+				name: "cool",
+			},
+		},
+		"UnnamedTemplate": {
+			reason: "Resources composed from an unnamed template should have their name generated from the name prefix",
+			args: args{
+				cp: cp,
+				cd: &fake.Composed{},
+			},
+			want: want{
+				generateName: "ola-",
+			},
+		},
+		"InvalidName": {
+			reason: "An error should be returned if the derived name is not a valid name",
+			args: args{
+				cp: cp,
+				cd: &fake.Composed{},
+				t:  v1alpha1.ComposedTemplate{Name: pointer.StringPtr("Database")},
+			},
+			want: want{
+				err: errors.Errorf(errFmtInvalidName, "cool-composite-Database-"+nameHash("cool-uid"), strings.Join(validation.IsDNS1123Subdomain("cool-composite-Database-"+nameHash("cool-uid")), ", ")),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := NameFromTemplate.GenerateName(tc.args.cp, tc.args.cd, tc.args.t)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nGenerateName(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.name, tc.args.cd.GetName()); diff != "" {
+				t.Errorf("\n%s\nGenerateName(...): -want name, +got name:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.generateName, tc.args.cd.GetGenerateName()); diff != "" {
+				t.Errorf("\n%s\nGenerateName(...): -want generateName, +got generateName:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestConfigureWithNameGenerator(t *testing.T) {
+	tmpl, _ := json.Marshal(&fake.Managed{})
+	cp := &fake.Composite{ObjectMeta: metav1.ObjectMeta{
+		Name:   "cool-composite",
+		Labels: map[string]string{LabelKeyNamePrefixForComposed: "ola"},
+	}}
+	database := v1alpha1.ComposedTemplate{Name: pointer.StringPtr("database"), Base: runtime.RawExtension{Raw: tmpl}}
+	cache := v1alpha1.ComposedTemplate{Name: pointer.StringPtr("cache"), Base: runtime.RawExtension{Raw: tmpl}}
+
+	c := NewDefaultConfigurator(WithNameGenerator(NameFromTemplate))
+
+	got := []string{}
+	for _, ct := range []v1alpha1.ComposedTemplate{database, cache} {
+		cd := &fake.Composed{}
+		if err := c.Configure(cp, cd, ct); err != nil {
+			t.Fatalf("Configure(...): %s", err)
+		}
+		got = append(got, cd.GetName())
+	}
+	for i := 0; i < 2; i++ {
+		cd := &fake.Composed{}
+		if err := c.ConfigureIndexed(cp, cd, database, i); err != nil {
+			t.Fatalf("ConfigureIndexed(...): %s", err)
+		}
+		got = append(got, cd.GetName())
+	}
+
+	h := nameHash("cool-composite")
+	want := []string{"cool-composite-database-" + h, "cool-composite-cache-" + h, "cool-composite-database-" + h + "-0", "cool-composite-database-" + h + "-1"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Templates of the same kind should be named distinctly: -want, +got:\n%s", diff)
+	}
+}
+
+func TestNameFromTemplateDistinct(t *testing.T) {
+	a := &fake.Composite{ObjectMeta: metav1.ObjectMeta{Name: "a", UID: "a-uid"}}
+	ab := &fake.Composite{ObjectMeta: metav1.ObjectMeta{Name: "a-b", UID: "a-b-uid"}}
+
+	cd1 := &fake.Composed{}
+	if err := NameFromTemplate.GenerateName(a, cd1, v1alpha1.ComposedTemplate{Name: pointer.StringPtr("b-c")}); err != nil {
+		t.Fatalf("GenerateName(...): %s", err)
+	}
+	cd2 := &fake.Composed{}
+	if err := NameFromTemplate.GenerateName(ab, cd2, v1alpha1.ComposedTemplate{Name: pointer.StringPtr("c")}); err != nil {
+		t.Fatalf("GenerateName(...): %s", err)
+	}
+	if cd1.GetName() == cd2.GetName() {
+		t.Errorf("GenerateName(...): resources of different composites should not collide, but both were named %q", cd1.GetName())
+	}
+}
+
+func TestShortenName(t *testing.T) {
+	long := "a-very-long-composite-resource-name-prefix"
+
+	cases := map[string]struct {
+		reason string
+		name   string
+		max    int
+		want   string
+	}{
+		"ShortEnough": {
+			reason: "A name that is no longer than the maximum should be returned unchanged",
+			name:   "cool",
+			max:    4,
+			want:   "cool",
+		},
+		"Truncated": {
+			reason: "A name that is too long should be truncated and suffixed with a hash of the whole name",
+			name:   long,
+			max:    20,
+			want:   "a-very-long-a387032c",
+		},
+		"TrailingHyphenTrimmed": {
+			reason: "Hyphens that end the truncated name should be trimmed",
+			name:   long,
+			max:    21,
+			want:   "a-very-long-a387032c",
+		},
+		"OnlyHash": {
+			reason: "Only as much of the hash as fits should be returned if none of the name fits",
+			name:   long,
+			max:    5,
+			want:   "a3870",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := ShortenName(tc.name, tc.max)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nShortenName(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestConfigureWithMaxNameLength(t *testing.T) {
+	tmpl, _ := json.Marshal(&fake.Managed{})
+	prefix := strings.Repeat("p", 70)
+	cp := &fake.Composite{ObjectMeta: metav1.ObjectMeta{
+		Name:   "cool-composite",
+		Labels: map[string]string{LabelKeyNamePrefixForComposed: prefix},
+	}}
+	ct := v1alpha1.ComposedTemplate{Base: runtime.RawExtension{Raw: tmpl}}
+	c := NewDefaultConfigurator(WithMaxNameLength(63))
+
+	cd := &fake.Composed{}
+	if err := c.Configure(cp, cd, ct); err != nil {
+		t.Fatalf("Configure(...): %s", err)
+	}
+	if diff := cmp.Diff(ShortenName(prefix, 57)+"-", cd.GetGenerateName()); diff != "" {
+		t.Errorf("A generateName should leave room for the generated suffix: -want, +got:\n%s", diff)
+	}
+
+	cd = &fake.Composed{}
+	named := v1alpha1.ComposedTemplate{Name: pointer.StringPtr("database"), Base: runtime.RawExtension{Raw: tmpl}}
+	if err := c.ConfigureIndexed(cp, cd, named, 10); err != nil {
+		t.Fatalf("ConfigureIndexed(...): %s", err)
+	}
+	if diff := cmp.Diff(ShortenName(prefix+"-database", 60)+"-10", cd.GetName()); diff != "" {
+		t.Errorf("An indexed name should leave room for its index: -want, +got:\n%s", diff)
+	}
+
+	cd = &fake.Composed{ObjectMeta: metav1.ObjectMeta{Name: prefix}}
+	if err := c.Configure(cp, cd, ct); err != nil {
+		t.Fatalf("Configure(...): %s", err)
+	}
+	if diff := cmp.Diff(prefix, cd.GetName()); diff != "" {
+		t.Errorf("An existing name should not be shortened: -want, +got:\n%s", diff)
+	}
+}
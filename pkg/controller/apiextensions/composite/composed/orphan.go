@@ -0,0 +1,55 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+const errFmtOrphanUnnamed = "cannot find orphaned composed resources: the template at index %d is unnamed"
+
+// FindOrphans returns the supplied composed resources that are no longer
+// backed by any of the supplied templates, for example because their template
+// was removed from the composition, so that they can be garbage collected.
+// Composed resources are matched to templates by the template name recorded in
+// their AnnotationKeyCompositionResourceName annotation. Unnamed templates
+// can't be matched reliably, so an error is returned if any template is
+// unnamed. Composed resources without the annotation were composed from an
+// unnamed template, so they are never considered orphaned.
+func FindOrphans(ts []v1alpha1.ComposedTemplate, cds []resource.Composed) ([]resource.Composed, error) {
+	names := make(map[string]bool, len(ts))
+	for i, t := range ts {
+		if templateName(t) == "" {
+			return nil, errors.Errorf(errFmtOrphanUnnamed, i)
+		}
+		names[*t.Name] = true
+	}
+
+	var orphans []resource.Composed
+	for _, cd := range cds {
+		name, ok := cd.GetAnnotations()[AnnotationKeyCompositionResourceName]
+		if !ok || names[name] {
+			continue
+		}
+		orphans = append(orphans, cd)
+	}
+	return orphans, nil
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/fake"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+func TestFindOrphans(t *testing.T) {
+	composedFrom := func(name, template string) *fake.Composed {
+		cd := &fake.Composed{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if template != "" {
+			cd.SetAnnotations(map[string]string{AnnotationKeyCompositionResourceName: template})
+		}
+		return cd
+	}
+	db := composedFrom("cool-db", "database")
+	cache := composedFrom("cool-cache", "cache")
+	unnamed := composedFrom("cool-network", "")
+
+	type args struct {
+		ts  []v1alpha1.ComposedTemplate
+		cds []resource.Composed
+	}
+	type want struct {
+		orphans []resource.Composed
+		err     error
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"AllBacked": {
+			reason: "Composed resources whose templates still exist should not be orphaned",
+			args: args{
+				ts:  []v1alpha1.ComposedTemplate{{Name: pointer.StringPtr("database")}, {Name: pointer.StringPtr("cache")}},
+				cds: []resource.Composed{db, cache},
+			},
+		},
+		"Reordered": {
+			reason: "Composed resources should be matched to templates by name, regardless of order",
+			args: args{
+				ts:  []v1alpha1.ComposedTemplate{{Name: pointer.StringPtr("cache")}, {Name: pointer.StringPtr("database")}},
+				cds: []resource.Composed{db, cache},
+			},
+		},
+		"TemplateRemoved": {
+			reason: "Composed resources whose template was removed should be orphaned",
+			args: args{
+				ts:  []v1alpha1.ComposedTemplate{{Name: pointer.StringPtr("database")}},
+				cds: []resource.Composed{db, cache},
+			},
+			want: want{orphans: []resource.Composed{cache}},
+		},
+		"AllTemplatesRemoved": {
+			reason: "All composed resources should be orphaned if the composition has no templates",
+			args: args{
+				cds: []resource.Composed{db, cache},
+			},
+			want: want{orphans: []resource.Composed{db, cache}},
+		},
+		"UnnamedTemplate": {
+			reason: "An error should be returned if a template is unnamed, because composed resources can't be reliably matched to it",
+			args: args{
+				ts:  []v1alpha1.ComposedTemplate{{Name: pointer.StringPtr("database")}, {}},
+				cds: []resource.Composed{db, cache},
+			},
+			want: want{err: errors.Errorf(errFmtOrphanUnnamed, 1)},
+		},
+		"Unannotated": {
+			reason: "Composed resources that don't record the template they were composed from should never be orphaned",
+			args: args{
+				ts:  []v1alpha1.ComposedTemplate{{Name: pointer.StringPtr("database")}},
+				cds: []resource.Composed{db, unnamed},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := FindOrphans(tc.args.ts, tc.args.cds)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nFindOrphans(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.orphans, got); diff != "" {
+				t.Errorf("\n%s\nFindOrphans(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	runtimecomposed "github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composed"
+)
+
+const errNotUnstructured = "composed resource has to be Unstructured type"
+
+// A Paver paves a composed resource, making it possible to get its values by
+// field path. A Paver may return a view of the composed resource that differs
+// from its in-memory content, for example a normalized or converted view.
+type Paver interface {
+	Pave(cd resource.Composed) (*fieldpath.Paved, error)
+}
+
+// A PaverFn is a function that implements the Paver interface.
+type PaverFn func(cd resource.Composed) (*fieldpath.Paved, error)
+
+// Pave calls PaverFn.
+func (fn PaverFn) Pave(cd resource.Composed) (*fieldpath.Paved, error) {
+	return fn(cd)
+}
+
+// PaveUnstructured paves the in-memory content of the supplied composed
+// resource, which must be Unstructured. It is the default Paver.
+var PaveUnstructured = PaverFn(func(cd resource.Composed) (*fieldpath.Paved, error) {
+	// TODO(muvaf): We can probably get rid of resource.Composed interface and fake.Composed
+	// structs and use *runtimecomposed.Unstructured everywhere including tests.
+	u, ok := cd.(*runtimecomposed.Unstructured)
+	if !ok {
+		return nil, errors.New(errNotUnstructured)
+	}
+	return fieldpath.Pave(u.UnstructuredContent()), nil
+})
@@ -0,0 +1,118 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/reconciler/managed"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/fake"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+func TestPaverIsReady(t *testing.T) {
+	// A computed view of a composed resource that need not be Unstructured.
+	computed := PaverFn(func(_ resource.Composed) (*fieldpath.Paved, error) {
+		return fieldpath.Pave(map[string]interface{}{"status": map[string]interface{}{"phase": "Running"}}), nil
+	})
+	tmpl := v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: "MatchString", FieldPath: "status.phase", MatchString: "Running"}}}
+
+	type want struct {
+		ready bool
+		err   error
+	}
+	cases := map[string]struct {
+		reason string
+		o      []ReadinessCheckerOption
+		want   want
+	}{
+		"DefaultPaver": {
+			reason: "The default paver should only support Unstructured composed resources",
+			want: want{
+				err: errors.New(errNotUnstructured),
+			},
+		},
+		"CustomPaver": {
+			reason: "Readiness checks should be evaluated against the view returned by a custom paver",
+			o:      []ReadinessCheckerOption{WithReadinessPaver(computed)},
+			want: want{
+				ready: true,
+			},
+		},
+		"CustomPaverError": {
+			reason: "Errors paving the composed resource should be returned",
+			o: []ReadinessCheckerOption{WithReadinessPaver(PaverFn(func(_ resource.Composed) (*fieldpath.Paved, error) {
+				return nil, errBoom
+			}))},
+			want: want{
+				err: errBoom,
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ready, err := NewDefaultReadinessChecker(tc.o...).IsReady(context.Background(), &fake.Composed{}, tmpl)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nIsReady(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ready, ready); diff != "" {
+				t.Errorf("\n%s\nIsReady(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestPaverFetch(t *testing.T) {
+	computed := PaverFn(func(_ resource.Composed) (*fieldpath.Paved, error) {
+		return fieldpath.Pave(map[string]interface{}{"status": map[string]interface{}{"secret": map[string]interface{}{
+			"name":      "cool",
+			"namespace": "coolns",
+		}}}), nil
+	})
+	kube := &test.MockClient{MockGet: func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+		if key.Name != "cool" || key.Namespace != "coolns" {
+			return errors.Errorf("unexpected secret %s", key)
+		}
+		obj.(*corev1.Secret).Data = map[string][]byte{"password": []byte("secret")}
+		return nil
+	}}
+	tmpl := v1alpha1.ComposedTemplate{
+		ConnectionSecretRef: &v1alpha1.ConnectionSecretRef{NamePath: "status.secret.name", NamespacePath: "status.secret.namespace"},
+		ConnectionDetails:   []v1alpha1.ConnectionDetail{{FromConnectionSecretKey: pointer.StringPtr("password")}},
+	}
+
+	f := NewAPIConnectionDetailsFetcher(kube, WithPaver(computed))
+	got, err := f.Fetch(context.Background(), &fake.Composed{}, tmpl)
+	if err != nil {
+		t.Fatalf("Fetch(...): %s", err)
+	}
+	if diff := cmp.Diff(managed.ConnectionDetails{"password": []byte("secret")}, got); diff != "" {
+		t.Errorf("Fetch(...): -want, +got:\n%s", diff)
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+)
+
+const (
+	errListCRDs      = "cannot list CustomResourceDefinitions"
+	errFmtGetSchema  = "cannot get the schema of composed resource kind %s"
+	errFmtPrunedKeys = "pruned fields that are not in the schema of composed resource kind %s: %s"
+)
+
+// Event reasons.
+const (
+	reasonPruneFields event.Reason = "PruneUnknownFields"
+)
+
+// A SchemaFetcher fetches the OpenAPI schema of a kind of composed resource.
+type SchemaFetcher interface {
+	// FetchSchema returns the schema of the supplied kind, or nil if the kind
+	// has no known schema.
+	FetchSchema(ctx context.Context, gvk schema.GroupVersionKind) (*v1beta1.JSONSchemaProps, error)
+}
+
+// A SchemaFetcherFn is a function that satisfies the SchemaFetcher interface.
+type SchemaFetcherFn func(ctx context.Context, gvk schema.GroupVersionKind) (*v1beta1.JSONSchemaProps, error)
+
+// FetchSchema calls SchemaFetcherFn.
+func (fn SchemaFetcherFn) FetchSchema(ctx context.Context, gvk schema.GroupVersionKind) (*v1beta1.JSONSchemaProps, error) {
+	return fn(ctx, gvk)
+}
+
+// schemaTTL is the time for which an APISchemaFetcher caches the schemas of
+// composed resources, so that changes to a CustomResourceDefinition are
+// eventually observed.
+const schemaTTL = 1 * time.Minute
+
+// maxSchemas is the maximum number of kinds whose schema an APISchemaFetcher
+// caches.
+const maxSchemas = 1024
+
+// NewAPISchemaFetcher returns a SchemaFetcher that reads the schemas of
+// composed resources from the CustomResourceDefinitions in an API server.
+func NewAPISchemaFetcher(c client.Reader) *APISchemaFetcher {
+	return &APISchemaFetcher{client: c, schemas: cache.NewLRUExpireCache(maxSchemas)}
+}
+
+// An APISchemaFetcher reads the schemas of composed resources from the
+// CustomResourceDefinitions in an API server. The schemas of every kind
+// defined by the CustomResourceDefinitions are cached for a short time each
+// time they are read, so that they are not read for every composed resource.
+type APISchemaFetcher struct {
+	client  client.Reader
+	schemas *cache.LRUExpireCache
+}
+
+// FetchSchema returns the schema of the supplied kind, or nil if the kind is
+// not defined by a CustomResourceDefinition or the definition has no schema,
+// for example because the kind is built into Kubernetes.
+func (f *APISchemaFetcher) FetchSchema(ctx context.Context, gvk schema.GroupVersionKind) (*v1beta1.JSONSchemaProps, error) {
+	if s, ok := f.schemas.Get(gvk); ok {
+		return s.(*v1beta1.JSONSchemaProps), nil
+	}
+
+	l := &v1beta1.CustomResourceDefinitionList{}
+	if err := f.client.List(ctx, l); err != nil {
+		return nil, errors.Wrap(err, errListCRDs)
+	}
+	for _, crd := range l.Items {
+		for _, v := range crd.Spec.Versions {
+			f.schemas.Add(schema.GroupVersionKind{Group: crd.Spec.Group, Version: v.Name, Kind: crd.Spec.Names.Kind}, crdSchema(crd, v), schemaTTL)
+		}
+	}
+
+	// Kinds that are not defined by a CustomResourceDefinition are cached too,
+	// so that we don't read every CustomResourceDefinition to find out again.
+	s, ok := f.schemas.Get(gvk)
+	if !ok {
+		f.schemas.Add(gvk, (*v1beta1.JSONSchemaProps)(nil), schemaTTL)
+		return nil, nil
+	}
+	return s.(*v1beta1.JSONSchemaProps), nil
+}
+
+// crdSchema returns the schema of the supplied version of the supplied
+// CustomResourceDefinition, falling back to its top-level validation schema.
+func crdSchema(crd v1beta1.CustomResourceDefinition, v v1beta1.CustomResourceDefinitionVersion) *v1beta1.JSONSchemaProps {
+	if v.Schema != nil {
+		return v.Schema.OpenAPIV3Schema
+	}
+	if crd.Spec.Validation != nil {
+		return crd.Spec.Validation.OpenAPIV3Schema
+	}
+	return nil
+}
+
+// WithUnknownFieldPruning configures a DefaultConfigurator to prune fields
+// that are not in the schema of each composed resource, for example stray
+// fields of a base template, before the composed resource is applied. Pruned
+// fields are recorded as a Warning event on the composite resource. Fetching
+// schemas can be costly, so pruning is disabled by default.
+func WithUnknownFieldPruning(s SchemaFetcher, r event.Recorder) ConfiguratorOption {
+	return func(c *DefaultConfigurator) {
+		c.schemas = s
+		c.record = r
+	}
+}
+
+// prune the fields of the supplied composed resource that are not in its
+// schema. Only unstructured composed resources are pruned; typed composed
+// resources can't have unknown fields.
+func (c *DefaultConfigurator) prune(ctx context.Context, cp resource.Composite, cd resource.Composed) error {
+	if c.schemas == nil {
+		return nil
+	}
+	u, ok := cd.(interface{ UnstructuredContent() map[string]interface{} })
+	if !ok {
+		return nil
+	}
+	gvk := cd.GetObjectKind().GroupVersionKind()
+	s, err := c.schemas.FetchSchema(ctx, gvk)
+	if err != nil {
+		return errors.Wrapf(err, errFmtGetSchema, gvk)
+	}
+	pruned := PruneUnknownFields(u.UnstructuredContent(), s)
+	if len(pruned) > 0 && c.record != nil {
+		c.record.Event(cp, event.Warning(reasonPruneFields, errors.Errorf(errFmtPrunedKeys, gvk, strings.Join(pruned, ", "))))
+	}
+	return nil
+}
+
+// PruneUnknownFields removes the fields of the supplied object that are not in
+// the supplied schema, and returns the sorted paths of the removed fields. The
+// apiVersion, kind, and metadata of the object and any embedded resources are
+// never pruned. Objects whose schema specifies no properties, or that preserve
+// unknown fields, are not pruned either.
+func PruneUnknownFields(obj map[string]interface{}, s *v1beta1.JSONSchemaProps) []string {
+	if s == nil {
+		return nil
+	}
+	pruned := pruneObject(obj, s, nil, true)
+	sort.Strings(pruned)
+	return pruned
+}
+
+func pruneValue(v interface{}, s *v1beta1.JSONSchemaProps, path fieldpath.Segments) []string {
+	if s == nil {
+		return nil
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return pruneObject(v, s, path, s.XEmbeddedResource)
+	case []interface{}:
+		if s.Items == nil || s.Items.Schema == nil {
+			return nil
+		}
+		var pruned []string
+		for i, e := range v {
+			pruned = append(pruned, pruneValue(e, s.Items.Schema, append(path[:len(path):len(path)], fieldpath.Segment{Type: fieldpath.SegmentIndex, Index: uint(i)}))...)
+		}
+		return pruned
+	default:
+		return nil
+	}
+}
+
+func pruneObject(obj map[string]interface{}, s *v1beta1.JSONSchemaProps, path fieldpath.Segments, embedded bool) []string {
+	var pruned []string
+	for k, v := range obj {
+		if embedded && (k == "apiVersion" || k == "kind" || k == "metadata") {
+			continue
+		}
+		p := append(path[:len(path):len(path)], fieldpath.Field(k))
+		if ps, ok := s.Properties[k]; ok {
+			ps := ps
+			pruned = append(pruned, pruneValue(v, &ps, p)...)
+			continue
+		}
+		if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+			pruned = append(pruned, pruneValue(v, s.AdditionalProperties.Schema, p)...)
+			continue
+		}
+		if len(s.Properties) == 0 || (s.XPreserveUnknownFields != nil && *s.XPreserveUnknownFields) || (s.AdditionalProperties != nil && s.AdditionalProperties.Allows) {
+			continue
+		}
+		delete(obj, k)
+		pruned = append(pruned, p.String())
+	}
+	return pruned
+}
@@ -0,0 +1,349 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/json"
+
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/fake"
+	runtimecomposed "github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composed"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+var bucketSchema = &v1beta1.JSONSchemaProps{
+	Type: "object",
+	Properties: map[string]v1beta1.JSONSchemaProps{
+		"apiVersion": {Type: "string"},
+		"kind":       {Type: "string"},
+		"metadata":   {Type: "object"},
+		"spec": {
+			Type: "object",
+			Properties: map[string]v1beta1.JSONSchemaProps{
+				"forProvider": {
+					Type: "object",
+					Properties: map[string]v1beta1.JSONSchemaProps{
+						"region": {Type: "string"},
+						"tags": {
+							Type:                 "object",
+							AdditionalProperties: &v1beta1.JSONSchemaPropsOrBool{Allows: true, Schema: &v1beta1.JSONSchemaProps{Type: "string"}},
+						},
+						"rules": {
+							Type: "array",
+							Items: &v1beta1.JSONSchemaPropsOrArray{Schema: &v1beta1.JSONSchemaProps{
+								Type:       "object",
+								Properties: map[string]v1beta1.JSONSchemaProps{"name": {Type: "string"}},
+							}},
+						},
+						"raw": {
+							Type:                   "object",
+							Properties:             map[string]v1beta1.JSONSchemaProps{"known": {Type: "string"}},
+							XPreserveUnknownFields: func() *bool { t := true; return &t }(),
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+func TestPruneUnknownFields(t *testing.T) {
+	type want struct {
+		obj    map[string]interface{}
+		pruned []string
+	}
+	cases := map[string]struct {
+		reason string
+		obj    map[string]interface{}
+		s      *v1beta1.JSONSchemaProps
+		want   want
+	}{
+		"NoSchema": {
+			reason: "Nothing should be pruned if there is no schema",
+			obj:    map[string]interface{}{"spec": map[string]interface{}{"extra": "field"}},
+			want: want{
+				obj: map[string]interface{}{"spec": map[string]interface{}{"extra": "field"}},
+			},
+		},
+		"ExtraField": {
+			reason: "Fields that are not in the schema should be pruned",
+			obj: map[string]interface{}{
+				"apiVersion": "example.org/v1",
+				"kind":       "Bucket",
+				"metadata":   map[string]interface{}{"name": "cool-bucket"},
+				"spec": map[string]interface{}{
+					"forProvider": map[string]interface{}{"region": "us-east-1", "extra": "field"},
+					"stray":       true,
+				},
+			},
+			s: bucketSchema,
+			want: want{
+				obj: map[string]interface{}{
+					"apiVersion": "example.org/v1",
+					"kind":       "Bucket",
+					"metadata":   map[string]interface{}{"name": "cool-bucket"},
+					"spec": map[string]interface{}{
+						"forProvider": map[string]interface{}{"region": "us-east-1"},
+					},
+				},
+				pruned: []string{"spec.forProvider.extra", "spec.stray"},
+			},
+		},
+		"ArrayItems": {
+			reason: "Fields of array items that are not in the schema should be pruned",
+			obj: map[string]interface{}{"spec": map[string]interface{}{"forProvider": map[string]interface{}{
+				"rules": []interface{}{
+					map[string]interface{}{"name": "a"},
+					map[string]interface{}{"name": "b", "bogus": "field"},
+				},
+			}}},
+			s: bucketSchema,
+			want: want{
+				obj: map[string]interface{}{"spec": map[string]interface{}{"forProvider": map[string]interface{}{
+					"rules": []interface{}{
+						map[string]interface{}{"name": "a"},
+						map[string]interface{}{"name": "b"},
+					},
+				}}},
+				pruned: []string{"spec.forProvider.rules[1].bogus"},
+			},
+		},
+		"AdditionalProperties": {
+			reason: "Fields of objects that allow additional properties should not be pruned",
+			obj: map[string]interface{}{"spec": map[string]interface{}{"forProvider": map[string]interface{}{
+				"tags": map[string]interface{}{"team": "platform"},
+			}}},
+			s: bucketSchema,
+			want: want{
+				obj: map[string]interface{}{"spec": map[string]interface{}{"forProvider": map[string]interface{}{
+					"tags": map[string]interface{}{"team": "platform"},
+				}}},
+			},
+		},
+		"PreserveUnknownFields": {
+			reason: "Fields of objects that preserve unknown fields should not be pruned",
+			obj: map[string]interface{}{"spec": map[string]interface{}{"forProvider": map[string]interface{}{
+				"raw": map[string]interface{}{"known": "a", "unknown": "b"},
+			}}},
+			s: bucketSchema,
+			want: want{
+				obj: map[string]interface{}{"spec": map[string]interface{}{"forProvider": map[string]interface{}{
+					"raw": map[string]interface{}{"known": "a", "unknown": "b"},
+				}}},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			pruned := PruneUnknownFields(tc.obj, tc.s)
+			if diff := cmp.Diff(tc.want.pruned, pruned); diff != "" {
+				t.Errorf("\n%s\nPruneUnknownFields(...): -want pruned, +got pruned:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.obj, tc.obj); diff != "" {
+				t.Errorf("\n%s\nPruneUnknownFields(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+type eventRecorder struct {
+	events []event.Event
+}
+
+func (r *eventRecorder) Event(_ runtime.Object, e event.Event) {
+	r.events = append(r.events, e)
+}
+
+func (r *eventRecorder) WithAnnotations(_ ...string) event.Recorder {
+	return r
+}
+
+func TestConfigurePruneUnknownFields(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "example.org", Version: "v1", Kind: "Bucket"}
+	raw, _ := json.Marshal(map[string]interface{}{
+		"apiVersion": "example.org/v1",
+		"kind":       "Bucket",
+		"spec":       map[string]interface{}{"forProvider": map[string]interface{}{"region": "us-east-1", "extra": "field"}},
+	})
+	cp := &fake.Composite{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{LabelKeyNamePrefixForComposed: "ola"}}}
+
+	type want struct {
+		spec   interface{}
+		events []event.Event
+		err    error
+	}
+	cases := map[string]struct {
+		reason string
+		s      SchemaFetcher
+		want   want
+	}{
+		"Pruned": {
+			reason: "Fields that are not in the schema should be pruned and recorded as a warning",
+			s: SchemaFetcherFn(func(_ context.Context, _ schema.GroupVersionKind) (*v1beta1.JSONSchemaProps, error) {
+				return bucketSchema, nil
+			}),
+			want: want{
+				spec: map[string]interface{}{"forProvider": map[string]interface{}{"region": "us-east-1"}},
+				events: []event.Event{
+					event.Warning(reasonPruneFields, errors.Errorf(errFmtPrunedKeys, gvk, "spec.forProvider.extra")),
+				},
+			},
+		},
+		"UnknownKind": {
+			reason: "Nothing should be pruned if the kind has no known schema",
+			s: SchemaFetcherFn(func(_ context.Context, _ schema.GroupVersionKind) (*v1beta1.JSONSchemaProps, error) {
+				return nil, nil
+			}),
+			want: want{
+				spec: map[string]interface{}{"forProvider": map[string]interface{}{"region": "us-east-1", "extra": "field"}},
+			},
+		},
+		"FetchSchemaError": {
+			reason: "Errors fetching the schema should be returned",
+			s: SchemaFetcherFn(func(_ context.Context, _ schema.GroupVersionKind) (*v1beta1.JSONSchemaProps, error) {
+				return nil, errBoom
+			}),
+			want: want{
+				err: errors.Wrapf(errBoom, errFmtGetSchema, gvk),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := &eventRecorder{}
+			cd := runtimecomposed.New()
+			c := NewDefaultConfigurator(WithUnknownFieldPruning(tc.s, r))
+			err := c.Configure(cp, cd, v1alpha1.ComposedTemplate{Base: runtime.RawExtension{Raw: raw}})
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nConfigure(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.want.spec, cd.Object["spec"]); diff != "" {
+				t.Errorf("\n%s\nConfigure(...): -want spec, +got spec:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.events, r.events); diff != "" {
+				t.Errorf("\n%s\nConfigure(...): -want events, +got events:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestAPISchemaFetcher(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "example.org", Version: "v1", Kind: "Bucket"}
+	crd := func(group, kind string) v1beta1.CustomResourceDefinition {
+		return v1beta1.CustomResourceDefinition{Spec: v1beta1.CustomResourceDefinitionSpec{
+			Group:    group,
+			Names:    v1beta1.CustomResourceDefinitionNames{Kind: kind},
+			Versions: []v1beta1.CustomResourceDefinitionVersion{{Name: "v1", Schema: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: bucketSchema}}},
+		}}
+	}
+
+	type want struct {
+		s   *v1beta1.JSONSchemaProps
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		kube   *test.MockClient
+		want   want
+	}{
+		"ListError": {
+			reason: "Errors listing CustomResourceDefinitions should be returned",
+			kube:   &test.MockClient{MockList: test.NewMockListFn(errBoom)},
+			want:   want{err: errors.Wrap(errBoom, errListCRDs)},
+		},
+		"Found": {
+			reason: "The schema of the version of the matching CustomResourceDefinition should be returned",
+			kube: &test.MockClient{MockList: test.NewMockListFn(nil, func(obj runtime.Object) error {
+				obj.(*v1beta1.CustomResourceDefinitionList).Items = []v1beta1.CustomResourceDefinition{crd("example.org", "Queue"), crd("example.org", "Bucket")}
+				return nil
+			})},
+			want: want{s: bucketSchema},
+		},
+		"NotFound": {
+			reason: "No schema should be returned if no CustomResourceDefinition defines the kind",
+			kube: &test.MockClient{MockList: test.NewMockListFn(nil, func(obj runtime.Object) error {
+				obj.(*v1beta1.CustomResourceDefinitionList).Items = []v1beta1.CustomResourceDefinition{crd("other.org", "Bucket")}
+				return nil
+			})},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s, err := NewAPISchemaFetcher(tc.kube).FetchSchema(context.Background(), gvk)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nFetchSchema(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.s, s); diff != "" {
+				t.Errorf("\n%s\nFetchSchema(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestAPISchemaFetcherCache(t *testing.T) {
+	crd := v1beta1.CustomResourceDefinition{Spec: v1beta1.CustomResourceDefinitionSpec{
+		Group:    "example.org",
+		Names:    v1beta1.CustomResourceDefinitionNames{Kind: "Bucket"},
+		Versions: []v1beta1.CustomResourceDefinitionVersion{{Name: "v1", Schema: &v1beta1.CustomResourceValidation{OpenAPIV3Schema: bucketSchema}}},
+	}}
+	lists := 0
+	kube := &test.MockClient{MockList: test.NewMockListFn(nil, func(obj runtime.Object) error {
+		lists++
+		obj.(*v1beta1.CustomResourceDefinitionList).Items = []v1beta1.CustomResourceDefinition{crd}
+		return nil
+	})}
+
+	f := NewAPISchemaFetcher(kube)
+	fetches := []struct {
+		gvk  schema.GroupVersionKind
+		want *v1beta1.JSONSchemaProps
+	}{
+		{gvk: schema.GroupVersionKind{Group: "example.org", Version: "v1", Kind: "Bucket"}, want: bucketSchema},
+		{gvk: schema.GroupVersionKind{Group: "example.org", Version: "v1", Kind: "Bucket"}, want: bucketSchema},
+		{gvk: schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}},
+		{gvk: schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}},
+	}
+	for _, fe := range fetches {
+		s, err := f.FetchSchema(context.Background(), fe.gvk)
+		if err != nil {
+			t.Errorf("FetchSchema(%s): %s", fe.gvk, err)
+		}
+		if diff := cmp.Diff(fe.want, s); diff != "" {
+			t.Errorf("FetchSchema(%s): -want, +got:\n%s", fe.gvk, diff)
+		}
+	}
+
+	// The CustomResourceDefinitions should be listed once to find the schema
+	// of Bucket, and once to find that ConfigMap has none.
+	if diff := cmp.Diff(2, lists); diff != "" {
+		t.Errorf("List(...) calls: -want, +got:\n%s", diff)
+	}
+}
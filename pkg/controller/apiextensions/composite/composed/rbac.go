@@ -0,0 +1,119 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	rbacv1 "k8s.io/api/rbac/v1"
+	kmeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/json"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+const (
+	errFmtParseTemplate = "cannot parse the base of the resource template at index %d"
+	errFmtNoKind        = "the base of the resource template at index %d has no apiVersion or kind"
+)
+
+var (
+	// Composed resources are created, patched and, when the composite is
+	// deleted, garbage collected.
+	verbsComposed = []string{"get", "list", "watch", "create", "update", "patch", "delete"}
+
+	// Connection secrets and ConfigMaps of composed resources are only ever
+	// read.
+	verbsConnectionSecret = []string{"get", "list", "watch"}
+)
+
+// RenderPolicyRules returns the RBAC rules required to compose resources using
+// the supplied templates. The rules are derived statically from the kinds of
+// the templates' base resources and their connection details, and may be used
+// to generate least-privilege ClusterRoles. Resource names are derived from
+// kinds using the conventional pluralisation; kinds that don't follow it must
+// be accounted for separately.
+func RenderPolicyRules(ts []v1alpha1.ComposedTemplate) ([]rbacv1.PolicyRule, error) {
+	resources := map[string]map[string]bool{}
+	secrets, configMaps := false, false
+	for i, t := range ts {
+		tm := metav1.TypeMeta{}
+		if err := json.Unmarshal(t.Base.Raw, &tm); err != nil {
+			return nil, errors.Wrapf(err, errFmtParseTemplate, i)
+		}
+		if tm.APIVersion == "" || tm.Kind == "" {
+			return nil, errors.Errorf(errFmtNoKind, i)
+		}
+		gv, err := schema.ParseGroupVersion(tm.APIVersion)
+		if err != nil {
+			return nil, errors.Wrapf(err, errFmtParseTemplate, i)
+		}
+		plural, _ := kmeta.UnsafeGuessKindToResource(gv.WithKind(tm.Kind))
+		if resources[gv.Group] == nil {
+			resources[gv.Group] = map[string]bool{}
+		}
+		resources[gv.Group][plural.Resource] = true
+
+		// The connection secret of a composed resource is read whenever its
+		// template lists any connection details.
+		if len(t.ConnectionDetails) > 0 {
+			secrets = true
+			configMaps = configMaps || len(t.ConnectionConfigMapRefs) > 0
+		}
+	}
+
+	groups := make([]string, 0, len(resources))
+	for g := range resources {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+
+	rules := make([]rbacv1.PolicyRule, 0, len(groups)+1)
+	for _, g := range groups {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{g},
+			Resources: sortedKeys(resources[g]),
+			Verbs:     verbsComposed,
+		})
+	}
+
+	if secrets {
+		r := []string{"secrets"}
+		if configMaps {
+			r = []string{"configmaps", "secrets"}
+		}
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: r,
+			Verbs:     verbsConnectionSecret,
+		})
+	}
+
+	return rules, nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+func TestRenderPolicyRules(t *testing.T) {
+	base := func(s string) runtime.RawExtension { return runtime.RawExtension{Raw: []byte(s)} }
+
+	type want struct {
+		rules []rbacv1.PolicyRule
+		err   error
+	}
+	cases := map[string]struct {
+		reason string
+		ts     []v1alpha1.ComposedTemplate
+		want
+	}{
+		"InvalidTemplate": {
+			reason: "A template whose base cannot be parsed should return an error",
+			ts:     []v1alpha1.ComposedTemplate{{Base: base("olala")}},
+			want: want{
+				err: errors.Wrapf(errors.New("invalid character 'o' looking for beginning of value"), errFmtParseTemplate, 0),
+			},
+		},
+		"NoKind": {
+			reason: "A template whose base has no kind should return an error",
+			ts:     []v1alpha1.ComposedTemplate{{Base: base(`{"apiVersion":"database.example.org/v1alpha1"}`)}},
+			want: want{
+				err: errors.Errorf(errFmtNoKind, 0),
+			},
+		},
+		"Success": {
+			reason: "Rules should be grouped by API group and include secrets if connection details are propagated",
+			ts: []v1alpha1.ComposedTemplate{
+				{
+					Base: base(`{"apiVersion":"database.gcp.crossplane.io/v1beta1","kind":"CloudSQLInstance"}`),
+					ConnectionDetails: []v1alpha1.ConnectionDetail{
+						{FromConnectionSecretKey: pointer.StringPtr("username")},
+					},
+				},
+				{Base: base(`{"apiVersion":"compute.gcp.crossplane.io/v1beta1","kind":"Network"}`)},
+				{Base: base(`{"apiVersion":"compute.gcp.crossplane.io/v1beta1","kind":"Subnetwork"}`)},
+				{Base: base(`{"apiVersion":"compute.gcp.crossplane.io/v1beta1","kind":"Network"}`)},
+				{Base: base(`{"apiVersion":"v1","kind":"ConfigMap"}`)},
+			},
+			want: want{
+				rules: []rbacv1.PolicyRule{
+					{
+						APIGroups: []string{""},
+						Resources: []string{"configmaps"},
+						Verbs:     verbsComposed,
+					},
+					{
+						APIGroups: []string{"compute.gcp.crossplane.io"},
+						Resources: []string{"networks", "subnetworks"},
+						Verbs:     verbsComposed,
+					},
+					{
+						APIGroups: []string{"database.gcp.crossplane.io"},
+						Resources: []string{"cloudsqlinstances"},
+						Verbs:     verbsComposed,
+					},
+					{
+						APIGroups: []string{""},
+						Resources: []string{"secrets"},
+						Verbs:     verbsConnectionSecret,
+					},
+				},
+			},
+		},
+		"ConnectionConfigMaps": {
+			reason: "Rules should include ConfigMaps if connection details are propagated from them",
+			ts: []v1alpha1.ComposedTemplate{
+				{
+					Base: base(`{"apiVersion":"compute.gcp.crossplane.io/v1beta1","kind":"Network"}`),
+					ConnectionDetails: []v1alpha1.ConnectionDetail{
+						{FromConnectionSecretKey: pointer.StringPtr("endpoint")},
+					},
+					ConnectionConfigMapRefs: []v1alpha1.ConnectionSecretRef{{NamePath: "status.configMapName"}},
+				},
+			},
+			want: want{
+				rules: []rbacv1.PolicyRule{
+					{
+						APIGroups: []string{"compute.gcp.crossplane.io"},
+						Resources: []string{"networks"},
+						Verbs:     verbsComposed,
+					},
+					{
+						APIGroups: []string{""},
+						Resources: []string{"configmaps", "secrets"},
+						Verbs:     verbsConnectionSecret,
+					},
+				},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rules, err := RenderPolicyRules(tc.ts)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nRenderPolicyRules(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.rules, rules); diff != "" {
+				t.Errorf("\n%s\nRenderPolicyRules(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+// A ReadinessProberRegistryOption configures a ReadinessProberRegistry.
+type ReadinessProberRegistryOption func(*ReadinessProberRegistry)
+
+// WithKindReadinessProber returns a ReadinessProberRegistryOption that
+// registers the supplied ReadinessProber for composed resources of the
+// supplied kind. A kind may have only one ReadinessProber; registering another
+// replaces it.
+func WithKindReadinessProber(gvk schema.GroupVersionKind, rp ReadinessProber) ReadinessProberRegistryOption {
+	return func(r *ReadinessProberRegistry) {
+		r.probers[gvk] = rp
+	}
+}
+
+// NewReadinessProberRegistry returns a ReadinessProberRegistry that uses the
+// supplied ReadinessProber for composed resources of kinds that have no
+// ReadinessProber registered.
+func NewReadinessProberRegistry(fallback ReadinessProber, o ...ReadinessProberRegistryOption) *ReadinessProberRegistry {
+	r := &ReadinessProberRegistry{fallback: fallback, probers: map[schema.GroupVersionKind]ReadinessProber{}}
+	for _, fn := range o {
+		fn(r)
+	}
+	return r
+}
+
+// A ReadinessProberRegistry determines whether a composed resource is ready
+// using the ReadinessProber registered for its kind, if any, or else its
+// fallback ReadinessProber. This allows kinds of composed resource with
+// bespoke readiness semantics, for example kinds whose readiness must be
+// queried from an external API, to be supported without replacing the
+// readiness checks of every other kind.
+type ReadinessProberRegistry struct {
+	fallback ReadinessProber
+	probers  map[schema.GroupVersionKind]ReadinessProber
+}
+
+// IsReady returns whether the composed resource is ready.
+func (r *ReadinessProberRegistry) IsReady(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (bool, error) {
+	return r.prober(cd).IsReady(ctx, cd, t)
+}
+
+// CheckReadyWithReason returns whether the composed resource is ready and, if
+// the ReadinessProber for its kind supports it, why it is not.
+func (r *ReadinessProberRegistry) CheckReadyWithReason(ctx context.Context, cd resource.Composed, t v1alpha1.ComposedTemplate) (bool, string, error) {
+	rp := r.prober(cd)
+	if rrp, ok := rp.(ReasonedReadinessProber); ok {
+		return rrp.CheckReadyWithReason(ctx, cd, t)
+	}
+	ready, err := rp.IsReady(ctx, cd, t)
+	return ready, "", err
+}
+
+// prober returns the ReadinessProber for the kind of the supplied composed
+// resource.
+func (r *ReadinessProberRegistry) prober(cd resource.Composed) ReadinessProber {
+	if rp, ok := r.probers[cd.GetObjectKind().GroupVersionKind()]; ok {
+		return rp
+	}
+	return r.fallback
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	runtimecomposed "github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composed"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+func TestReadinessProberRegistry(t *testing.T) {
+	errBoom := errors.New("boom")
+	bucket := schema.GroupVersionKind{Group: "storage.example.org", Version: "v1", Kind: "Bucket"}
+	database := schema.GroupVersionKind{Group: "database.example.org", Version: "v1", Kind: "Database"}
+
+	ofKind := func(gvk schema.GroupVersionKind) *runtimecomposed.Unstructured {
+		return runtimecomposed.New(func(r *runtimecomposed.Unstructured) {
+			r.SetGroupVersionKind(gvk)
+			r.SetConditions(runtimev1alpha1.Creating())
+		})
+	}
+	external := IsReadyFn(func(_ context.Context, _ resource.Composed, _ v1alpha1.ComposedTemplate) (bool, error) {
+		return true, nil
+	})
+
+	type args struct {
+		r  *ReadinessProberRegistry
+		cd *runtimecomposed.Unstructured
+	}
+	type want struct {
+		ready  bool
+		reason string
+		err    error
+	}
+	cases := map[string]struct {
+		reason string
+		args
+		want
+	}{
+		"RegisteredKind": {
+			reason: "The ReadinessProber registered for the kind of the composed resource should be used",
+			args: args{
+				r:  NewReadinessProberRegistry(NewDefaultReadinessChecker(), WithKindReadinessProber(bucket, external)),
+				cd: ofKind(bucket),
+			},
+			want: want{
+				ready: true,
+			},
+		},
+		"UnregisteredKind": {
+			reason: "The fallback ReadinessProber should be used for kinds without a registered ReadinessProber, including its reason",
+			args: args{
+				r:  NewReadinessProberRegistry(NewDefaultReadinessChecker(), WithKindReadinessProber(bucket, external)),
+				cd: ofKind(database),
+			},
+			want: want{
+				reason: "condition Ready is False with reason Creating",
+			},
+		},
+		"RegisteredKindError": {
+			reason: "Errors returned by the registered ReadinessProber should be returned",
+			args: args{
+				r: NewReadinessProberRegistry(NewDefaultReadinessChecker(), WithKindReadinessProber(bucket, IsReadyFn(func(_ context.Context, _ resource.Composed, _ v1alpha1.ComposedTemplate) (bool, error) {
+					return false, errBoom
+				}))),
+				cd: ofKind(bucket),
+			},
+			want: want{
+				err: errBoom,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ready, reason, err := tc.args.r.CheckReadyWithReason(context.Background(), tc.args.cd, v1alpha1.ComposedTemplate{})
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nCheckReadyWithReason(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ready, ready); diff != "" {
+				t.Errorf("\n%s\nCheckReadyWithReason(...): -want ready, +got ready:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.reason, reason); diff != "" {
+				t.Errorf("\n%s\nCheckReadyWithReason(...): -want reason, +got reason:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
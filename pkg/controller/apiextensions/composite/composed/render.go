@@ -0,0 +1,137 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"io"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	runtimecomposed "github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composed"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+const (
+	errFmtRenderConfigure = "cannot configure the composed resource at index %d"
+	errFmtRenderOverlay   = "cannot apply overlay to the composed resource at index %d"
+	errFmtRenderMarshal   = "cannot marshal the composed resource at index %d"
+	errRenderWrite        = "cannot write rendered composed resources"
+)
+
+// yamlSeparator separates the documents of a multi-document YAML stream.
+const yamlSeparator = "---\n"
+
+// A RenderOption configures how composed resources are rendered.
+type RenderOption func(*renderer)
+
+// WithRenderConfigurator configures the Configurator used to render composed
+// resources. Composed resources are named as the first instance of their
+// template if it is also an IndexedConfigurator and WithIndexedNames is
+// supplied.
+func WithRenderConfigurator(c Configurator) RenderOption {
+	return func(r *renderer) {
+		r.configurator = c
+	}
+}
+
+// WithRenderOverlayApplicator configures the OverlayApplicator used to render
+// composed resources.
+func WithRenderOverlayApplicator(o OverlayApplicator) RenderOption {
+	return func(r *renderer) {
+		r.overlay = o
+	}
+}
+
+// WithIndexedNames names each rendered composed resource as the first instance
+// of its template, for example "prefix-database-0". By default composed
+// resources are rendered with only a generateName, as they would be before
+// being created.
+func WithIndexedNames() RenderOption {
+	return func(r *renderer) {
+		r.indexed = true
+	}
+}
+
+type renderer struct {
+	configurator Configurator
+	overlay      OverlayApplicator
+	indexed      bool
+}
+
+// Render the composed resources that would be composed from the supplied
+// templates for the supplied composite resource, without reading from or
+// writing to an API server. The composed resources are written to the supplied
+// writer as a multi-document YAML stream, in the order of their templates.
+// Patches may read from the composed resources of named templates that were
+// rendered before them, which have not been observed and so carry only their
+// desired state. Rendering is deterministic; the same inputs always produce the
+// same output.
+func Render(w io.Writer, cp resource.Composite, ts []v1alpha1.ComposedTemplate, o ...RenderOption) error {
+	r := &renderer{configurator: &DefaultConfigurator{}, overlay: &DefaultOverlayApplicator{}}
+	for _, fn := range o {
+		fn(r)
+	}
+
+	docs := make([][]byte, len(ts))
+	siblings := Siblings{}
+	for i, t := range ts {
+		cd := runtimecomposed.New()
+		if err := r.configure(cp, cd, t); err != nil {
+			return errors.Wrapf(err, errFmtRenderConfigure, i)
+		}
+		if err := r.applyOverlay(cp, cd, t, siblings); err != nil {
+			return errors.Wrapf(err, errFmtRenderOverlay, i)
+		}
+		if t.Name != nil {
+			siblings[*t.Name] = cd
+		}
+		y, err := yaml.Marshal(cd)
+		if err != nil {
+			return errors.Wrapf(err, errFmtRenderMarshal, i)
+		}
+		docs[i] = y
+	}
+
+	for _, doc := range docs {
+		if _, err := io.WriteString(w, yamlSeparator); err != nil {
+			return errors.Wrap(err, errRenderWrite)
+		}
+		if _, err := w.Write(doc); err != nil {
+			return errors.Wrap(err, errRenderWrite)
+		}
+	}
+	return nil
+}
+
+func (r *renderer) configure(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) error {
+	if ic, ok := r.configurator.(IndexedConfigurator); ok && r.indexed {
+		return ic.ConfigureIndexed(cp, cd, t, 0)
+	}
+	return r.configurator.Configure(cp, cd, t)
+}
+
+// applyOverlay applies the overlay of the supplied template. Patches may read
+// from the supplied siblings if the OverlayApplicator supports it.
+func (r *renderer) applyOverlay(cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate, s Siblings) error {
+	if so, ok := r.overlay.(SiblingOverlayApplicator); ok {
+		return so.OverlayWithSiblings(cp, cd, t, s)
+	}
+	return r.overlay.Overlay(cp, cd, t)
+}
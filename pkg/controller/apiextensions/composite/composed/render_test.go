@@ -0,0 +1,173 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/utils/pointer"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/fake"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composite"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+func TestRender(t *testing.T) {
+	cp := composite.New()
+	cp.SetLabels(map[string]string{
+		LabelKeyNamePrefixForComposed: "cool-xr",
+		LabelKeyClaimName:             "cool",
+		LabelKeyClaimNamespace:        "default",
+	})
+	base := func(kind string, forProvider map[string]interface{}) runtime.RawExtension {
+		raw, _ := json.Marshal(map[string]interface{}{
+			"apiVersion": "example.org/v1alpha1",
+			"kind":       kind,
+			"spec":       map[string]interface{}{"forProvider": forProvider},
+		})
+		return runtime.RawExtension{Raw: raw}
+	}
+	ts := []v1alpha1.ComposedTemplate{
+		{
+			Name: pointer.StringPtr("bucket"),
+			Base: base("Bucket", map[string]interface{}{"region": "us-east-1"}),
+			Patches: []v1alpha1.Patch{
+				{FromFieldPath: "metadata.labels[crossplane.io/claim-name]", ToFieldPath: "spec.forProvider.bucketName"},
+			},
+		},
+		{
+			Name: pointer.StringPtr("database"),
+			Base: base("Database", map[string]interface{}{"size": "small"}),
+			Patches: []v1alpha1.Patch{
+				{FromFieldPath: "metadata.labels[crossplane.io/claim-name]", ToFieldPath: "spec.forProvider.owner"},
+			},
+		},
+	}
+
+	siblings := []v1alpha1.ComposedTemplate{
+		ts[0],
+		{
+			Name: pointer.StringPtr("database"),
+			Base: base("Database", map[string]interface{}{"size": "small"}),
+			Patches: []v1alpha1.Patch{
+				{FromComposed: pointer.StringPtr("bucket"), FromFieldPath: "spec.forProvider.bucketName", ToFieldPath: "spec.forProvider.backupBucket"},
+			},
+		},
+	}
+
+	cases := map[string]struct {
+		reason string
+		ts     []v1alpha1.ComposedTemplate
+		o      []RenderOption
+	}{
+		"GeneratedNames": {
+			reason: "Composed resources should be rendered with only a generateName by default",
+		},
+		"IndexedNames": {
+			reason: "Composed resources should be named as the first instance of their template when requested",
+			o:      []RenderOption{WithIndexedNames()},
+		},
+		"Siblings": {
+			reason: "Patches should read from the composed resources rendered before them",
+			ts:     siblings,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if tc.ts == nil {
+				tc.ts = ts
+			}
+			got := &bytes.Buffer{}
+			if err := Render(got, cp, tc.ts, tc.o...); err != nil {
+				t.Fatalf("\n%s\nRender(...): %s", tc.reason, err)
+			}
+
+			golden := filepath.Join("testdata", "render", name+".yaml")
+			if *updateGolden {
+				if err := ioutil.WriteFile(golden, got.Bytes(), 0600); err != nil {
+					t.Fatalf("cannot update golden file: %s", err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("cannot read golden file: %s", err)
+			}
+			if diff := cmp.Diff(string(want), got.String()); diff != "" {
+				t.Errorf("\n%s\nRender(...): -want, +got:\n%s", tc.reason, diff)
+			}
+
+			// Rendering must be deterministic.
+			again := &bytes.Buffer{}
+			if err := Render(again, cp, tc.ts, tc.o...); err != nil {
+				t.Fatalf("\n%s\nRender(...): %s", tc.reason, err)
+			}
+			if diff := cmp.Diff(got.String(), again.String()); diff != "" {
+				t.Errorf("\n%s\nRender(...): -first, +second:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	cp := &fake.Composite{}
+	ts := []v1alpha1.ComposedTemplate{{}}
+
+	cases := map[string]struct {
+		reason string
+		o      []RenderOption
+		want   error
+	}{
+		"ConfigureError": {
+			reason: "Errors configuring a composed resource should be returned",
+			o: []RenderOption{WithRenderConfigurator(ConfigureFn(func(_ resource.Composite, _ resource.Composed, _ v1alpha1.ComposedTemplate) error {
+				return errBoom
+			}))},
+			want: errors.Wrapf(errBoom, errFmtRenderConfigure, 0),
+		},
+		"OverlayError": {
+			reason: "Errors applying overlays to a composed resource should be returned",
+			o: []RenderOption{
+				WithRenderConfigurator(NopConfigure),
+				WithRenderOverlayApplicator(OverlayFn(func(_ resource.Composite, _ resource.Composed, _ v1alpha1.ComposedTemplate) error {
+					return errBoom
+				})),
+			},
+			want: errors.Wrapf(errBoom, errFmtRenderOverlay, 0),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := Render(&bytes.Buffer{}, cp, ts, tc.o...)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nRender(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
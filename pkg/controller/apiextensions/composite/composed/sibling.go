@@ -0,0 +1,44 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"context"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+)
+
+// Siblings are the resources of a composite resource that have been composed
+// so far during a reconcile, keyed by the name of the template each was
+// composed from. Patches may read from them using FromComposed.
+type Siblings map[string]resource.Composed
+
+type siblingsKey struct{}
+
+// WithSiblings returns a copy of the supplied context that carries the
+// supplied siblings. The Composer reads from the siblings carried by the
+// context it is passed when applying patches.
+func WithSiblings(ctx context.Context, s Siblings) context.Context {
+	return context.WithValue(ctx, siblingsKey{}, s)
+}
+
+// SiblingsFrom returns the siblings carried by the supplied context, or nil if
+// it carries none.
+func SiblingsFrom(ctx context.Context) Siblings {
+	s, _ := ctx.Value(siblingsKey{}).(Siblings)
+	return s
+}
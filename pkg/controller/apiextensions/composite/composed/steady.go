@@ -0,0 +1,98 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/cache"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+)
+
+const errHash = "cannot hash the desired state of composed resource"
+
+// Hash returns a hash of the desired state of the supplied composed resource,
+// i.e. its labels, its annotations, and its top-level fields other than its
+// metadata and status, such as its spec. Fields that are set by the API server
+// or by other controllers, such as its status, resource version and managed
+// fields, are not hashed. The hash of a composed resource that has been
+// configured and overlaid therefore changes only when the fields it was
+// composed from change, even if its live state was merged into it.
+func Hash(cd resource.Composed) (string, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cd)
+	if err != nil {
+		return "", errors.Wrap(err, errHash)
+	}
+	desired := map[string]interface{}{
+		"labels":      cd.GetLabels(),
+		"annotations": cd.GetAnnotations(),
+	}
+	for k, v := range u {
+		if k == "metadata" || k == "status" {
+			continue
+		}
+		desired[k] = v
+	}
+
+	// Maps are marshalled with sorted keys, so equal resources always produce
+	// equal JSON.
+	b, err := json.Marshal(desired)
+	if err != nil {
+		return "", errors.Wrap(err, errHash)
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// maxTracked is the maximum number of composed resources whose state is
+// tracked in memory. The state of the least recently tracked composed
+// resources is forgotten first.
+const maxTracked = 4096
+
+// trackedTTL is the time after which the state of a composed resource that is
+// no longer tracked, for example because it was deleted, is forgotten.
+const trackedTTL = 1 * time.Hour
+
+// A changeTracker tracks the hash of the desired state of each composed
+// resource when it was last composed.
+type changeTracker struct {
+	hashes *cache.LRUExpireCache
+}
+
+func newChangeTracker() *changeTracker {
+	return &changeTracker{hashes: cache.NewLRUExpireCache(maxTracked)}
+}
+
+// changed records the supplied hash of the supplied composed resource, and
+// returns true if it differs from the hash recorded when the resource was
+// last composed. Composed resources that were not previously tracked, for
+// example after a restart or once they have been forgotten, are considered
+// changed. Everything is considered changed by a nil changeTracker.
+func (t *changeTracker) changed(cd resource.Composed, hash string) bool {
+	if t == nil {
+		return true
+	}
+	previous, ok := t.hashes.Get(cd.GetUID())
+	t.hashes.Add(cd.GetUID(), hash, trackedTTL)
+	return !ok || previous.(string) != hash
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/fake"
+	runtimecomposed "github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composed"
+)
+
+func TestHash(t *testing.T) {
+	desired := func(fns ...func(cd *runtimecomposed.Unstructured)) *runtimecomposed.Unstructured {
+		cd := runtimecomposed.New()
+		cd.SetLabels(map[string]string{"cool": "very"})
+		cd.Object["spec"] = map[string]interface{}{"size": "large"}
+		for _, fn := range fns {
+			fn(cd)
+		}
+		return cd
+	}
+
+	cases := map[string]struct {
+		reason string
+		cd     resource.Composed
+		same   bool
+	}{
+		"Unchanged": {
+			reason: "Composed resources with the same desired state should have the same hash",
+			cd:     desired(),
+			same:   true,
+		},
+		"LiveStateChanged": {
+			reason: "Fields set by the API server or other controllers should not change the hash",
+			cd: desired(func(cd *runtimecomposed.Unstructured) {
+				cd.SetResourceVersion("42")
+				cd.SetGeneration(2)
+				cd.SetManagedFields([]metav1.ManagedFieldsEntry{{Manager: "someone-else"}})
+				cd.Object["status"] = map[string]interface{}{"phase": "Running"}
+			}),
+			same: true,
+		},
+		"SpecChanged": {
+			reason: "A change to the spec should change the hash",
+			cd: desired(func(cd *runtimecomposed.Unstructured) {
+				cd.Object["spec"] = map[string]interface{}{"size": "small"}
+			}),
+		},
+		"LabelsChanged": {
+			reason: "A change to the labels should change the hash",
+			cd: desired(func(cd *runtimecomposed.Unstructured) {
+				cd.SetLabels(map[string]string{"cool": "somewhat"})
+			}),
+		},
+		"AnnotationsChanged": {
+			reason: "A change to the annotations should change the hash",
+			cd: desired(func(cd *runtimecomposed.Unstructured) {
+				cd.SetAnnotations(map[string]string{"cool": "very"})
+			}),
+		},
+	}
+	want, err := Hash(desired())
+	if err != nil {
+		t.Fatalf("Hash(...): %s", err)
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := Hash(tc.cd)
+			if err != nil {
+				t.Fatalf("\n%s\nHash(...): %s", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.same, got == want); diff != "" {
+				t.Errorf("\n%s\nHash(...): -want same hash, +got same hash:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestChangeTracker(t *testing.T) {
+	withUID := func(uid types.UID) resource.Composed {
+		cd := &fake.Composed{}
+		cd.SetUID(uid)
+		return cd
+	}
+
+	type observation struct {
+		cd   resource.Composed
+		hash string
+	}
+
+	// Track more composed resources than can be tracked, so that the first
+	// is forgotten.
+	evicted := []observation{{cd: withUID("cool"), hash: "a"}}
+	for i := 0; i < maxTracked; i++ {
+		evicted = append(evicted, observation{cd: withUID(types.UID(fmt.Sprintf("cool-%d", i))), hash: "a"})
+	}
+	evicted = append(evicted, observation{cd: withUID("cool"), hash: "a"})
+
+	cases := map[string]struct {
+		reason string
+		obs    []observation
+		want   bool
+	}{
+		"Untracked": {
+			reason: "A composed resource that was not previously tracked should be considered changed",
+			obs:    []observation{{cd: withUID("cool"), hash: "a"}},
+			want:   true,
+		},
+		"Unchanged": {
+			reason: "A composed resource whose hash is unchanged should not be considered changed",
+			obs:    []observation{{cd: withUID("cool"), hash: "a"}, {cd: withUID("cool"), hash: "a"}},
+			want:   false,
+		},
+		"Changed": {
+			reason: "A composed resource whose hash changed should be considered changed",
+			obs:    []observation{{cd: withUID("cool"), hash: "a"}, {cd: withUID("cool"), hash: "b"}},
+			want:   true,
+		},
+		"Evicted": {
+			reason: "A composed resource that was forgotten because too many resources were tracked should be considered changed",
+			obs:    evicted,
+			want:   true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ct := newChangeTracker()
+			got := false
+			for _, o := range tc.obs {
+				got = ct.changed(o.cd, o.hash)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nchanged(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
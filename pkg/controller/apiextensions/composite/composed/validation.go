@@ -0,0 +1,440 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+// ValidateFieldPaths returns an error if any of the field paths used by the
+// patches, readiness checks or connection secret references of the supplied
+// Composition cannot be parsed. The error names every malformed path and where
+// it appears in the Composition, so that it can be fixed before the
+// Composition is used to compose resources.
+func ValidateFieldPaths(comp *v1alpha1.Composition) error {
+	errs := field.ErrorList{}
+	root := field.NewPath("spec", "resources")
+	for i, t := range comp.Spec.Resources {
+		errs = append(errs, validateTemplateFieldPaths(root.Index(i), t)...)
+	}
+	return errs.ToAggregate()
+}
+
+func validateTemplateFieldPaths(p *field.Path, t v1alpha1.ComposedTemplate) field.ErrorList {
+	errs := field.ErrorList{}
+	for i, patch := range t.Patches {
+		pp := p.Child("patches").Index(i)
+		errs = append(errs, validateFieldPath(pp.Child("fromFieldPath"), patch.FromFieldPath)...)
+		errs = append(errs, validateFieldPath(pp.Child("toFieldPath"), patch.ToFieldPath)...)
+		if patch.FromJSONAnnotation != nil {
+			errs = append(errs, validateFieldPath(pp.Child("fromJSONAnnotation", "fieldPath"), patch.FromJSONAnnotation.FieldPath)...)
+		}
+	}
+	for i, check := range t.ReadinessChecks {
+		errs = append(errs, validateCheckFieldPaths(p.Child("readinessChecks").Index(i), check)...)
+	}
+	if t.ConnectionDetailsFromCompositeFieldPath != nil {
+		errs = append(errs, validateFieldPath(p.Child("connectionDetailsFromCompositeFieldPath"), *t.ConnectionDetailsFromCompositeFieldPath)...)
+	}
+	for i, d := range t.ConnectionDetails {
+		if d.FromCompositeFieldPath != nil {
+			errs = append(errs, validateFieldPath(p.Child("connectionDetails").Index(i).Child("fromCompositeFieldPath"), *d.FromCompositeFieldPath)...)
+		}
+	}
+	if ref := t.ConnectionSecretRef; ref != nil {
+		rp := p.Child("connectionSecretRef")
+		errs = append(errs, validateFieldPath(rp.Child("namePath"), ref.NamePath)...)
+		errs = append(errs, validateFieldPath(rp.Child("namespacePath"), ref.NamespacePath)...)
+	}
+	for i, ref := range t.AdditionalConnectionSecretRefs {
+		rp := p.Child("additionalConnectionSecretRefs").Index(i)
+		errs = append(errs, validateFieldPath(rp.Child("namePath"), ref.NamePath)...)
+		errs = append(errs, validateFieldPath(rp.Child("namespacePath"), ref.NamespacePath)...)
+	}
+	return errs
+}
+
+// validateCheckFieldPaths validates the field paths of the supplied readiness
+// check, including those of any checks it groups.
+func validateCheckFieldPaths(p *field.Path, check v1alpha1.ReadinessCheck) field.ErrorList {
+	errs := field.ErrorList{}
+	errs = append(errs, validateFieldPath(p.Child("fieldPath"), check.FieldPath)...)
+	errs = append(errs, validateFieldPath(p.Child("matchFieldPath"), check.MatchFieldPath)...)
+	errs = append(errs, validateFieldPath(p.Child("matchStringsFromCompositeFieldPath"), check.MatchStringsFromCompositeFieldPath)...)
+	if check.Group != nil {
+		for i, c := range check.Group.Checks {
+			errs = append(errs, validateCheckFieldPaths(p.Child("group", "checks").Index(i), c)...)
+		}
+	}
+	return errs
+}
+
+// validateFieldPath returns an error if the supplied field path is set but
+// cannot be parsed. Unset field paths are considered valid; whether they are
+// required is not a concern of this validation.
+func validateFieldPath(p *field.Path, path string) field.ErrorList {
+	if path == "" {
+		return nil
+	}
+	if _, err := fieldpath.Parse(path); err != nil {
+		return field.ErrorList{field.Invalid(p, path, err.Error())}
+	}
+	return nil
+}
+
+// The match fields of a readiness check, named as they are in the API.
+const (
+	fieldMatchString          = "matchString"
+	fieldMatchStrings         = "matchStrings"
+	fieldMatchStringsFromPath = "matchStringsFromCompositeFieldPath"
+	fieldMatchInteger         = "matchInteger"
+	fieldAsQuantity           = "asQuantity"
+	fieldMatchFloat           = "matchFloat"
+	fieldTolerance            = "tolerance"
+	fieldMatchBool            = "matchBool"
+	fieldMatchRegex           = "matchRegex"
+	fieldMatchFieldPath       = "matchFieldPath"
+	fieldFinalizers           = "finalizers"
+	fieldMatchCondition       = "matchCondition"
+	fieldWebhook              = "webhook"
+	fieldGroup                = "group"
+)
+
+// checkMatchFields are the match fields each type of readiness check may use.
+var checkMatchFields = map[v1alpha1.TypeReadinessCheck][]string{
+	v1alpha1.ReadinessCheckNonEmpty:                 nil,
+	v1alpha1.ReadinessCheckNonEmptyCollection:       nil,
+	v1alpha1.ReadinessCheckReadyAndNonEmpty:         nil,
+	v1alpha1.ReadinessCheckObservedGeneration:       nil,
+	v1alpha1.ReadinessCheckMatchString:              {fieldMatchString, fieldMatchStrings, fieldMatchStringsFromPath},
+	v1alpha1.ReadinessCheckMatchAll:                 {fieldMatchString},
+	v1alpha1.ReadinessCheckMatchAny:                 {fieldMatchString},
+	v1alpha1.ReadinessCheckMatchCompositionRevision: {fieldMatchString},
+	v1alpha1.ReadinessCheckMatchInteger:             {fieldMatchInteger, fieldAsQuantity},
+	v1alpha1.ReadinessCheckGreaterThan:              {fieldMatchInteger, fieldAsQuantity},
+	v1alpha1.ReadinessCheckLessThan:                 {fieldMatchInteger, fieldAsQuantity},
+	v1alpha1.ReadinessCheckMatchFloat:               {fieldMatchFloat, fieldTolerance},
+	v1alpha1.ReadinessCheckMatchBool:                {fieldMatchBool},
+	v1alpha1.ReadinessCheckMatchRegex:               {fieldMatchRegex},
+	v1alpha1.ReadinessCheckMatchFieldPath:           {fieldMatchFieldPath},
+	v1alpha1.ReadinessCheckNoFinalizers:             {fieldFinalizers},
+	v1alpha1.ReadinessCheckMatchCondition:           {fieldMatchCondition},
+	v1alpha1.ReadinessCheckWebhook:                  {fieldWebhook},
+	v1alpha1.ReadinessCheckGroup:                    {fieldGroup},
+}
+
+// checkRequiredFields are the match fields that a type of readiness check
+// can't be evaluated without. Match fields whose zero value is meaningful,
+// for example a MatchInteger of 0, are never required.
+var checkRequiredFields = map[v1alpha1.TypeReadinessCheck]string{
+	v1alpha1.ReadinessCheckMatchRegex:     fieldMatchRegex,
+	v1alpha1.ReadinessCheckMatchFieldPath: fieldMatchFieldPath,
+	v1alpha1.ReadinessCheckNoFinalizers:   fieldFinalizers,
+	v1alpha1.ReadinessCheckMatchCondition: fieldMatchCondition,
+	v1alpha1.ReadinessCheckWebhook:        fieldWebhook,
+	v1alpha1.ReadinessCheckGroup:          fieldGroup,
+}
+
+// checkOptionalFieldPath are the types of readiness check that don't read the
+// value at their field path, or that have a default field path.
+var checkOptionalFieldPath = map[v1alpha1.TypeReadinessCheck]bool{
+	v1alpha1.ReadinessCheckNoFinalizers:       true,
+	v1alpha1.ReadinessCheckMatchCondition:     true,
+	v1alpha1.ReadinessCheckObservedGeneration: true,
+	v1alpha1.ReadinessCheckWebhook:            true,
+	v1alpha1.ReadinessCheckGroup:              true,
+}
+
+// ValidateReadinessChecks returns an error if any of the readiness checks of
+// the supplied template, including those it groups, is misconfigured. A check
+// is misconfigured if its type is unknown, if it sets a match field that its
+// type does not use, if it omits a match field that its type requires, or if
+// its field paths or regular expression cannot be parsed. This allows a
+// Composition to be rejected when it is admitted, rather than its readiness
+// checks returning errors when resources are composed.
+func ValidateReadinessChecks(t v1alpha1.ComposedTemplate) error {
+	errs := field.ErrorList{}
+	p := field.NewPath("readinessChecks")
+	for i, check := range t.ReadinessChecks {
+		errs = append(errs, validateReadinessCheck(p.Index(i), check)...)
+	}
+	return errs.ToAggregate()
+}
+
+func validateReadinessCheck(p *field.Path, check v1alpha1.ReadinessCheck) field.ErrorList { // nolint:gocyclo
+	// The cyclomatic complexity of this function comes from checking the
+	// fields of each type of check in turn, which is not really complex.
+	errs := field.ErrorList{}
+	errs = append(errs, validateFieldPath(p.Child("fieldPath"), check.FieldPath)...)
+	errs = append(errs, validateFieldPath(p.Child(fieldMatchFieldPath), check.MatchFieldPath)...)
+	errs = append(errs, validateFieldPath(p.Child(fieldMatchStringsFromPath), check.MatchStringsFromCompositeFieldPath)...)
+
+	allowed, ok := checkMatchFields[check.Type]
+	if !ok {
+		return append(errs, field.NotSupported(p.Child("type"), check.Type, supportedCheckTypes()))
+	}
+
+	set := setMatchFields(check)
+	for _, f := range set {
+		if !contains(allowed, f) {
+			errs = append(errs, field.Forbidden(p.Child(f), fmt.Sprintf("must not be set for %s readiness checks", check.Type)))
+		}
+	}
+	if f, ok := checkRequiredFields[check.Type]; ok && !contains(set, f) {
+		errs = append(errs, field.Required(p.Child(f), fmt.Sprintf("must be set for %s readiness checks", check.Type)))
+	}
+	if check.FieldPath == "" && !checkOptionalFieldPath[check.Type] {
+		errs = append(errs, field.Required(p.Child("fieldPath"), fmt.Sprintf("must be set for %s readiness checks", check.Type)))
+	}
+
+	switch check.Type {
+	case v1alpha1.ReadinessCheckMatchString:
+		n := 0
+		for _, f := range []string{fieldMatchString, fieldMatchStrings, fieldMatchStringsFromPath} {
+			if contains(set, f) {
+				n++
+			}
+		}
+		if n > 1 {
+			errs = append(errs, field.Forbidden(p, fmt.Sprintf("at most one of %s, %s and %s may be set", fieldMatchString, fieldMatchStrings, fieldMatchStringsFromPath)))
+		}
+	case v1alpha1.ReadinessCheckMatchRegex:
+		if _, err := regexp.Compile(check.MatchRegex); err != nil {
+			errs = append(errs, field.Invalid(p.Child(fieldMatchRegex), check.MatchRegex, err.Error()))
+		}
+	case v1alpha1.ReadinessCheckMatchCondition:
+		if check.MatchCondition != nil && check.MatchCondition.Type == "" {
+			errs = append(errs, field.Required(p.Child(fieldMatchCondition, "type"), ""))
+		}
+	case v1alpha1.ReadinessCheckWebhook:
+		if check.Webhook != nil && check.Webhook.URL == "" {
+			errs = append(errs, field.Required(p.Child(fieldWebhook, "url"), ""))
+		}
+	case v1alpha1.ReadinessCheckGroup:
+		if check.Group != nil {
+			for i, c := range check.Group.Checks {
+				errs = append(errs, validateReadinessCheck(p.Child(fieldGroup, "checks").Index(i), c)...)
+			}
+		}
+	}
+	return errs
+}
+
+// setMatchFields returns the names of the match fields of the supplied
+// readiness check that are set to something other than their zero value.
+func setMatchFields(check v1alpha1.ReadinessCheck) []string {
+	fields := []struct {
+		name string
+		set  bool
+	}{
+		{fieldMatchString, check.MatchString != ""},
+		{fieldMatchStrings, len(check.MatchStrings) > 0},
+		{fieldMatchStringsFromPath, check.MatchStringsFromCompositeFieldPath != ""},
+		{fieldMatchInteger, check.MatchInteger != 0},
+		{fieldAsQuantity, check.AsQuantity},
+		{fieldMatchFloat, check.MatchFloat != 0},
+		{fieldTolerance, check.Tolerance != 0},
+		{fieldMatchBool, check.MatchBool},
+		{fieldMatchRegex, check.MatchRegex != ""},
+		{fieldMatchFieldPath, check.MatchFieldPath != ""},
+		{fieldFinalizers, len(check.Finalizers) > 0},
+		{fieldMatchCondition, check.MatchCondition != nil},
+		{fieldWebhook, check.Webhook != nil},
+		{fieldGroup, check.Group != nil},
+	}
+	set := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f.set {
+			set = append(set, f.name)
+		}
+	}
+	return set
+}
+
+// supportedCheckTypes returns the supported types of readiness check, sorted.
+func supportedCheckTypes() []string {
+	types := make([]string, 0, len(checkMatchFields))
+	for t := range checkMatchFields {
+		types = append(types, string(t))
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ValidatePatches returns an error if any of the patches of the supplied
+// template is misconfigured. See ValidatePatch.
+func ValidatePatches(t v1alpha1.ComposedTemplate) error {
+	errs := field.ErrorList{}
+	p := field.NewPath("patches")
+	for i, patch := range t.Patches {
+		errs = append(errs, validatePatch(p.Index(i), patch)...)
+	}
+	return errs.ToAggregate()
+}
+
+// ValidatePatch returns an error if the supplied patch is misconfigured, for
+// example because its field paths cannot be parsed, it omits the field it
+// reads from, its default is not JSON, or one of its transforms is missing the
+// configuration its type requires. This allows a Composition to be rejected
+// when it is admitted, rather than its patches returning errors once a
+// composite resource is composed using it.
+func ValidatePatch(p v1alpha1.Patch) error {
+	return validatePatch(nil, p).ToAggregate()
+}
+
+func validatePatch(p *field.Path, patch v1alpha1.Patch) field.ErrorList { // nolint:gocyclo
+	// The cyclomatic complexity of this function comes from checking each
+	// optional field of the patch in turn, which is not really complex.
+	errs := field.ErrorList{}
+	switch patch.Type {
+	case "", v1alpha1.PatchTypeFromCompositeFieldPath, v1alpha1.PatchTypeToCompositeFieldPath:
+	default:
+		errs = append(errs, field.NotSupported(p.Child("type"), patch.Type, []string{string(v1alpha1.PatchTypeFromCompositeFieldPath), string(v1alpha1.PatchTypeToCompositeFieldPath)}))
+	}
+
+	if patch.FromJSONAnnotation == nil && patch.FromFieldPath == "" {
+		errs = append(errs, field.Required(p.Child("fromFieldPath"), "must be set unless fromJSONAnnotation is set"))
+	}
+	errs = append(errs, validateFieldPath(p.Child("fromFieldPath"), patch.FromFieldPath)...)
+	errs = append(errs, validateFieldPath(p.Child("toFieldPath"), patch.ToFieldPath)...)
+	if a := patch.FromJSONAnnotation; a != nil {
+		if a.Key == "" {
+			errs = append(errs, field.Required(p.Child("fromJSONAnnotation", "key"), ""))
+		}
+		errs = append(errs, validateFieldPath(p.Child("fromJSONAnnotation", "fieldPath"), a.FieldPath)...)
+	}
+
+	if patch.Default != nil {
+		var d interface{}
+		if err := json.Unmarshal(patch.Default.Raw, &d); err != nil {
+			errs = append(errs, field.Invalid(p.Child("default"), string(patch.Default.Raw), err.Error()))
+		}
+	}
+
+	if pol := patch.Policy; pol != nil {
+		if pol.Error != nil && *pol.Error != v1alpha1.ErrorPolicyFail && *pol.Error != v1alpha1.ErrorPolicyDegrade {
+			errs = append(errs, field.NotSupported(p.Child("policy", "error"), *pol.Error, []string{string(v1alpha1.ErrorPolicyFail), string(v1alpha1.ErrorPolicyDegrade)}))
+		}
+		if pol.FromFieldPath != nil && *pol.FromFieldPath != v1alpha1.FromFieldPathPolicyOptional && *pol.FromFieldPath != v1alpha1.FromFieldPathPolicyRequired {
+			errs = append(errs, field.NotSupported(p.Child("policy", "fromFieldPath"), *pol.FromFieldPath, []string{string(v1alpha1.FromFieldPathPolicyOptional), string(v1alpha1.FromFieldPathPolicyRequired)}))
+		}
+		if pol.ToFieldPath != nil && *pol.ToFieldPath != v1alpha1.ToFieldPathPolicyReplace && *pol.ToFieldPath != v1alpha1.ToFieldPathPolicySetIfEmpty {
+			errs = append(errs, field.NotSupported(p.Child("policy", "toFieldPath"), *pol.ToFieldPath, []string{string(v1alpha1.ToFieldPathPolicyReplace), string(v1alpha1.ToFieldPathPolicySetIfEmpty)}))
+		}
+	}
+
+	if patch.Order != nil && patch.Order.Name == "" {
+		errs = append(errs, field.Required(p.Child("order", "name"), ""))
+	}
+
+	for i, t := range patch.Transforms {
+		errs = append(errs, validateTransform(p.Child("transforms").Index(i), t)...)
+	}
+	return errs
+}
+
+// validateTransform validates that the supplied transform has the
+// configuration its type requires, and only that configuration.
+func validateTransform(p *field.Path, t v1alpha1.Transform) field.ErrorList { // nolint:gocyclo
+	// The cyclomatic complexity of this function comes from checking the
+	// configuration of each type of transform in turn.
+	errs := field.ErrorList{}
+	configs := []struct {
+		typ v1alpha1.TransformType
+		set bool
+	}{
+		{v1alpha1.TransformTypeMap, t.Map != nil},
+		{v1alpha1.TransformTypeMath, t.Math != nil},
+		{v1alpha1.TransformTypeString, t.String != nil},
+	}
+	supported := make([]string, 0, len(configs))
+	known := false
+	for _, c := range configs {
+		supported = append(supported, string(c.typ))
+		switch {
+		case c.typ == t.Type:
+			known = true
+			if !c.set {
+				errs = append(errs, field.Required(p.Child(string(c.typ)), fmt.Sprintf("must be set for %s transforms", t.Type)))
+			}
+		case c.set:
+			errs = append(errs, field.Forbidden(p.Child(string(c.typ)), fmt.Sprintf("must not be set for %s transforms", t.Type)))
+		}
+	}
+	if !known {
+		return append(errs, field.NotSupported(p.Child("type"), t.Type, supported))
+	}
+
+	if t.MissingKey != nil {
+		if t.Type != v1alpha1.TransformTypeMap {
+			errs = append(errs, field.Forbidden(p.Child("missingKey"), fmt.Sprintf("must not be set for %s transforms", t.Type)))
+		} else if *t.MissingKey != v1alpha1.MapMissingKeyError && *t.MissingKey != v1alpha1.MapMissingKeyFallthrough {
+			errs = append(errs, field.NotSupported(p.Child("missingKey"), *t.MissingKey, []string{string(v1alpha1.MapMissingKeyError), string(v1alpha1.MapMissingKeyFallthrough)}))
+		}
+	}
+
+	switch {
+	case t.Type == v1alpha1.TransformTypeMath && t.Math != nil:
+		if t.Math.Multiply == nil && t.Math.Add == nil {
+			errs = append(errs, field.Required(p.Child("math"), "must multiply by or add a value"))
+		}
+	case t.Type == v1alpha1.TransformTypeString && t.String != nil:
+		errs = append(errs, validateStringTransform(p.Child("string"), t.String)...)
+	}
+	return errs
+}
+
+// validateStringTransform validates that the supplied string transform has
+// the configuration its type requires.
+func validateStringTransform(p *field.Path, s *v1alpha1.StringTransform) field.ErrorList {
+	errs := field.ErrorList{}
+	if s.Escape != nil && *s.Escape != v1alpha1.StringEscapeURLQuery && *s.Escape != v1alpha1.StringEscapeURLPath {
+		errs = append(errs, field.NotSupported(p.Child("escape"), *s.Escape, []string{string(v1alpha1.StringEscapeURLQuery), string(v1alpha1.StringEscapeURLPath)}))
+	}
+	switch s.Type {
+	case "", v1alpha1.StringTransformFormat:
+		if s.Format == "" {
+			errs = append(errs, field.Required(p.Child("fmt"), "must be set for Format string transforms"))
+		}
+	case v1alpha1.StringTransformPrefix, v1alpha1.StringTransformSuffix:
+	case v1alpha1.StringTransformReplace:
+		if s.Replace == nil {
+			errs = append(errs, field.Required(p.Child("replace"), "must be set for Replace string transforms"))
+			break
+		}
+		if _, err := regexp.Compile(s.Replace.Regexp); err != nil {
+			errs = append(errs, field.Invalid(p.Child("replace", "regexp"), s.Replace.Regexp, err.Error()))
+		}
+	default:
+		errs = append(errs, field.NotSupported(p.Child("type"), s.Type, []string{
+			string(v1alpha1.StringTransformFormat),
+			string(v1alpha1.StringTransformPrefix),
+			string(v1alpha1.StringTransformSuffix),
+			string(v1alpha1.StringTransformReplace),
+		}))
+	}
+	return errs
+}
@@ -0,0 +1,314 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/pointer"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+func TestValidateFieldPaths(t *testing.T) {
+	composition := func(ts ...v1alpha1.ComposedTemplate) *v1alpha1.Composition {
+		return &v1alpha1.Composition{Spec: v1alpha1.CompositionSpec{Resources: ts}}
+	}
+	resources := field.NewPath("spec", "resources")
+
+	cases := map[string]struct {
+		reason string
+		comp   *v1alpha1.Composition
+		want   error
+	}{
+		"Valid": {
+			reason: "Well formed field paths should be valid",
+			comp: composition(v1alpha1.ComposedTemplate{
+				Patches: []v1alpha1.Patch{
+					{FromFieldPath: "metadata.labels[app]", ToFieldPath: "spec.forProvider.tags[0].value"},
+				},
+				ReadinessChecks: []v1alpha1.ReadinessCheck{
+					{Type: v1alpha1.ReadinessCheckWebhook},
+					{Type: v1alpha1.ReadinessCheckMatchString, FieldPath: "status.atProvider.state", MatchString: "Available"},
+				},
+				ConnectionSecretRef: &v1alpha1.ConnectionSecretRef{NamePath: "spec.secret.name", NamespacePath: "spec.secret.namespace"},
+			}),
+		},
+		"UnterminatedBracket": {
+			reason: "A field path with an unterminated bracket should be invalid",
+			comp: composition(v1alpha1.ComposedTemplate{
+				Patches: []v1alpha1.Patch{{FromFieldPath: "metadata.labels[app"}},
+			}),
+			want: field.ErrorList{
+				field.Invalid(resources.Index(0).Child("patches").Index(0).Child("fromFieldPath"), "metadata.labels[app", "unterminated '[' at position 15"),
+			}.ToAggregate(),
+		},
+		"UnexpectedBracket": {
+			reason: "A field path with an unbalanced closing bracket should be invalid",
+			comp: composition(v1alpha1.ComposedTemplate{
+				ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: v1alpha1.ReadinessCheckNonEmpty, FieldPath: "status.ready]"}},
+			}),
+			want: field.ErrorList{
+				field.Invalid(resources.Index(0).Child("readinessChecks").Index(0).Child("fieldPath"), "status.ready]", "unexpected ']' at position 12"),
+			}.ToAggregate(),
+		},
+		"GroupedReadinessCheck": {
+			reason: "An unparseable field path of a grouped readiness check should be invalid",
+			comp: composition(v1alpha1.ComposedTemplate{
+				ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: v1alpha1.ReadinessCheckGroup, Group: &v1alpha1.GroupReadinessCheck{
+					Checks: []v1alpha1.ReadinessCheck{{Type: v1alpha1.ReadinessCheckNonEmpty, FieldPath: "status.ready]"}},
+				}}},
+			}),
+			want: field.ErrorList{
+				field.Invalid(resources.Index(0).Child("readinessChecks").Index(0).Child("group", "checks").Index(0).Child("fieldPath"), "status.ready]", "unexpected ']' at position 12"),
+			}.ToAggregate(),
+		},
+		"EmptyIndex": {
+			reason: "A field path with an empty index should be invalid",
+			comp: composition(v1alpha1.ComposedTemplate{
+				ConnectionSecretRef: &v1alpha1.ConnectionSecretRef{NamePath: "spec.secrets[].name", NamespacePath: "spec.namespace"},
+			}),
+			want: field.ErrorList{
+				field.Invalid(resources.Index(0).Child("connectionSecretRef", "namePath"), "spec.secrets[].name", "unexpected ']' at position 13"),
+			}.ToAggregate(),
+		},
+		"ConnectionDetailsFromCompositeFieldPath": {
+			reason: "A malformed field path selecting connection details should be invalid",
+			comp: composition(v1alpha1.ComposedTemplate{
+				ConnectionDetailsFromCompositeFieldPath: pointer.StringPtr("spec..connectionDetails"),
+			}),
+			want: field.ErrorList{
+				field.Invalid(resources.Index(0).Child("connectionDetailsFromCompositeFieldPath"), "spec..connectionDetails", "unexpected '.' at position 5"),
+			}.ToAggregate(),
+		},
+		"Aggregated": {
+			reason: "Every malformed field path across all resources should be reported",
+			comp: composition(
+				v1alpha1.ComposedTemplate{
+					Patches: []v1alpha1.Patch{{FromFieldPath: "spec.region", ToFieldPath: "spec..region"}},
+				},
+				v1alpha1.ComposedTemplate{
+					Patches: []v1alpha1.Patch{{FromJSONAnnotation: &v1alpha1.JSONAnnotationSource{Key: "example.org/config", FieldPath: ".network"}}},
+				},
+			),
+			want: field.ErrorList{
+				field.Invalid(resources.Index(0).Child("patches").Index(0).Child("toFieldPath"), "spec..region", "unexpected '.' at position 5"),
+				field.Invalid(resources.Index(1).Child("patches").Index(0).Child("fromJSONAnnotation", "fieldPath"), ".network", "unexpected '.' at position 0"),
+			}.ToAggregate(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateFieldPaths(tc.comp)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nValidateFieldPaths(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestValidateReadinessChecks(t *testing.T) {
+	checks := field.NewPath("readinessChecks")
+
+	cases := map[string]struct {
+		reason string
+		t      v1alpha1.ComposedTemplate
+		want   error
+	}{
+		"Valid": {
+			reason: "Readiness checks that set exactly the match fields their types use should be valid",
+			t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+				{Type: v1alpha1.ReadinessCheckMatchString, FieldPath: "status.atProvider.state", MatchString: "Available"},
+				{Type: v1alpha1.ReadinessCheckMatchInteger, FieldPath: "status.atProvider.replicas", MatchInteger: 0},
+				{Type: v1alpha1.ReadinessCheckObservedGeneration},
+				{Type: v1alpha1.ReadinessCheckGroup, Group: &v1alpha1.GroupReadinessCheck{
+					LogicOp: v1alpha1.LogicOpOr,
+					Checks: []v1alpha1.ReadinessCheck{
+						{Type: v1alpha1.ReadinessCheckNonEmpty, FieldPath: "status.atProvider.id"},
+						{Type: v1alpha1.ReadinessCheckMatchRegex, FieldPath: "status.atProvider.state", MatchRegex: "^Running"},
+					},
+				}},
+			}},
+		},
+		"UnknownType": {
+			reason: "A readiness check of an unknown type should be invalid",
+			t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+				{Type: "MatchColour", FieldPath: "status.colour"},
+			}},
+			want: field.ErrorList{
+				field.NotSupported(checks.Index(0).Child("type"), v1alpha1.TypeReadinessCheck("MatchColour"), supportedCheckTypes()),
+			}.ToAggregate(),
+		},
+		"UnusedMatchField": {
+			reason: "A readiness check that sets a match field its type does not use should be invalid",
+			t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+				{Type: v1alpha1.ReadinessCheckMatchInteger, FieldPath: "status.atProvider.replicas", MatchString: "3"},
+			}},
+			want: field.ErrorList{
+				field.Forbidden(checks.Index(0).Child("matchString"), "must not be set for MatchInteger readiness checks"),
+			}.ToAggregate(),
+		},
+		"MissingRequiredFields": {
+			reason: "A readiness check that omits its field path or a match field its type requires should be invalid",
+			t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+				{Type: v1alpha1.ReadinessCheckMatchFieldPath},
+			}},
+			want: field.ErrorList{
+				field.Required(checks.Index(0).Child("matchFieldPath"), "must be set for MatchFieldPath readiness checks"),
+				field.Required(checks.Index(0).Child("fieldPath"), "must be set for MatchFieldPath readiness checks"),
+			}.ToAggregate(),
+		},
+		"ConflictingMatchStrings": {
+			reason: "A MatchString readiness check that sets more than one of its alternative match fields should be invalid",
+			t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+				{Type: v1alpha1.ReadinessCheckMatchString, FieldPath: "status.zone", MatchString: "a", MatchStrings: []string{"b"}},
+			}},
+			want: field.ErrorList{
+				field.Forbidden(checks.Index(0), "at most one of matchString, matchStrings and matchStringsFromCompositeFieldPath may be set"),
+			}.ToAggregate(),
+		},
+		"InvalidRegexAndFieldPath": {
+			reason: "A readiness check with a malformed field path or regular expression should be invalid",
+			t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+				{Type: v1alpha1.ReadinessCheckMatchRegex, FieldPath: "status..state", MatchRegex: "Running("},
+			}},
+			want: field.ErrorList{
+				field.Invalid(checks.Index(0).Child("fieldPath"), "status..state", "unexpected '.' at position 7"),
+				field.Invalid(checks.Index(0).Child("matchRegex"), "Running(", "error parsing regexp: missing closing ): `Running(`"),
+			}.ToAggregate(),
+		},
+		"InvalidGroupedCheck": {
+			reason: "Checks that are grouped should be validated, and reported at their path within the group",
+			t: v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{
+				{Type: v1alpha1.ReadinessCheckGroup, Group: &v1alpha1.GroupReadinessCheck{Checks: []v1alpha1.ReadinessCheck{
+					{Type: v1alpha1.ReadinessCheckMatchCondition, MatchCondition: &v1alpha1.MatchConditionReadinessCheck{}},
+				}}},
+			}},
+			want: field.ErrorList{
+				field.Required(checks.Index(0).Child("group", "checks").Index(0).Child("matchCondition", "type"), ""),
+			}.ToAggregate(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateReadinessChecks(tc.t)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nValidateReadinessChecks(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestValidatePatch(t *testing.T) {
+	degrade := v1alpha1.ErrorPolicyDegrade
+	sometimes := v1alpha1.FromFieldPathPolicy("Sometimes")
+	transforms := field.NewPath("transforms")
+
+	cases := map[string]struct {
+		reason string
+		p      v1alpha1.Patch
+		want   error
+	}{
+		"Valid": {
+			reason: "A well formed patch should be valid",
+			p: v1alpha1.Patch{
+				FromFieldPath: "spec.parameters.size",
+				ToFieldPath:   "spec.forProvider.storageGB",
+				Policy:        &v1alpha1.PatchPolicy{Error: &degrade},
+				Transforms: []v1alpha1.Transform{
+					{Type: v1alpha1.TransformTypeMap, Map: &v1alpha1.MapTransform{Pairs: map[string]string{"small": "10"}}},
+					{Type: v1alpha1.TransformTypeString, String: &v1alpha1.StringTransform{Type: v1alpha1.StringTransformPrefix, Prefix: "gb-"}},
+					{Type: v1alpha1.TransformTypeMath, Math: &v1alpha1.MathTransform{Multiply: pointer.Int64Ptr(2)}},
+				},
+			},
+		},
+		"ValidJSONAnnotation": {
+			reason: "A patch that reads from a JSON annotation should not require a field path to read from",
+			p: v1alpha1.Patch{
+				FromJSONAnnotation: &v1alpha1.JSONAnnotationSource{Key: "example.org/config"},
+				ToFieldPath:        "spec.forProvider.config",
+			},
+		},
+		"MalformedFieldPaths": {
+			reason: "A patch should be invalid if it omits the field path it reads from or its field paths cannot be parsed",
+			p: v1alpha1.Patch{
+				ToFieldPath: "spec..region",
+			},
+			want: field.ErrorList{
+				field.Required(field.NewPath("fromFieldPath"), "must be set unless fromJSONAnnotation is set"),
+				field.Invalid(field.NewPath("toFieldPath"), "spec..region", "unexpected '.' at position 5"),
+			}.ToAggregate(),
+		},
+		"InvalidDefaultAndPolicy": {
+			reason: "A patch should be invalid if its default is not JSON or its policy is not supported",
+			p: v1alpha1.Patch{
+				FromFieldPath: "spec.region",
+				Default:       &apiextensionsv1beta1.JSON{Raw: []byte("us-east-1")},
+				Policy:        &v1alpha1.PatchPolicy{FromFieldPath: &sometimes},
+			},
+			want: field.ErrorList{
+				field.Invalid(field.NewPath("default"), "us-east-1", "invalid character 'u' looking for beginning of value"),
+				field.NotSupported(field.NewPath("policy", "fromFieldPath"), sometimes, []string{"Optional", "Required"}),
+			}.ToAggregate(),
+		},
+		"MisconfiguredTransforms": {
+			reason: "A patch should be invalid if its transforms lack the configuration their types require",
+			p: v1alpha1.Patch{
+				FromFieldPath: "spec.size",
+				Transforms: []v1alpha1.Transform{
+					{Type: v1alpha1.TransformTypeMath, Map: &v1alpha1.MapTransform{Pairs: map[string]string{"small": "10"}}},
+					{Type: v1alpha1.TransformTypeMath, Math: &v1alpha1.MathTransform{}},
+					{Type: v1alpha1.TransformTypeString, String: &v1alpha1.StringTransform{Type: v1alpha1.StringTransformReplace, Replace: &v1alpha1.StringReplace{Regexp: "("}}},
+					{Type: "reverse"},
+				},
+			},
+			want: field.ErrorList{
+				field.Forbidden(transforms.Index(0).Child("map"), "must not be set for math transforms"),
+				field.Required(transforms.Index(0).Child("math"), "must be set for math transforms"),
+				field.Required(transforms.Index(1).Child("math"), "must multiply by or add a value"),
+				field.Invalid(transforms.Index(2).Child("string", "replace", "regexp"), "(", "error parsing regexp: missing closing ): `(`"),
+				field.NotSupported(transforms.Index(3).Child("type"), v1alpha1.TransformType("reverse"), []string{"map", "math", "string"}),
+			}.ToAggregate(),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := ValidatePatch(tc.p)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nValidatePatch(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestValidatePatches(t *testing.T) {
+	tmpl := v1alpha1.ComposedTemplate{Patches: []v1alpha1.Patch{
+		{FromFieldPath: "spec.region", ToFieldPath: "spec.forProvider.region"},
+		{FromFieldPath: "spec.size", Transforms: []v1alpha1.Transform{{Type: v1alpha1.TransformTypeString, String: &v1alpha1.StringTransform{}}}},
+	}}
+	want := field.ErrorList{
+		field.Required(field.NewPath("patches").Index(1).Child("transforms").Index(0).Child("string", "fmt"), "must be set for Format string transforms"),
+	}.ToAggregate()
+	if diff := cmp.Diff(want, ValidatePatches(tmpl), test.EquateErrors()); diff != "" {
+		t.Errorf("\nPatches should be reported at their index within the template\nValidatePatches(...): -want, +got:\n%s", diff)
+	}
+}
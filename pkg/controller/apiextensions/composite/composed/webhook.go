@@ -0,0 +1,176 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/cache"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+const (
+	errWebhookNoConfig  = "webhook readiness check requires configuration"
+	errWebhookCABundle  = "cannot parse webhook CA bundle"
+	errWebhookMarshal   = "cannot marshal composed resource for webhook"
+	errWebhookRequest   = "cannot build webhook request"
+	errWebhookCall      = "cannot call webhook"
+	errWebhookDecode    = "cannot decode webhook response"
+	errFmtWebhookStatus = "webhook responded with unexpected status code %d"
+)
+
+// The default time after which a call to a readiness webhook times out.
+const defaultWebhookTimeout = 10 * time.Second
+
+// The time waited before retrying a failed call to a readiness webhook. It
+// doubles with each subsequent retry, up to maxWebhookBackoff.
+const (
+	webhookBackoff    = 100 * time.Millisecond
+	maxWebhookBackoff = 5 * time.Second
+)
+
+// HTTP clients are cached per CA bundle and timeout, so that connections to
+// readiness webhooks are reused across readiness checks. The clients of
+// webhook configurations that are no longer used are eventually forgotten,
+// and their idle connections closed.
+const (
+	maxWebhookClients = 64
+	webhookClientTTL  = 1 * time.Hour
+)
+
+var webhookClients = cache.NewLRUExpireCache(maxWebhookClients)
+
+type webhookClientKey struct {
+	caBundle string
+	timeout  time.Duration
+}
+
+// A webhookResponse is the response expected from a readiness webhook.
+type webhookResponse struct {
+	Ready bool `json:"ready"`
+}
+
+// webhookReady POSTs the supplied composed resource to the webhook configured
+// by the supplied check, and returns whether the webhook considers it ready.
+// Failed calls are retried up to the configured number of times, waiting
+// longer before each retry.
+func webhookReady(ctx context.Context, cd interface{}, wh *v1alpha1.WebhookReadinessCheck) (bool, error) {
+	if wh == nil {
+		return false, errors.New(errWebhookNoConfig)
+	}
+
+	hc, err := webhookClient(wh)
+	if err != nil {
+		return false, err
+	}
+
+	body, err := json.Marshal(cd)
+	if err != nil {
+		return false, errors.Wrap(err, errWebhookMarshal)
+	}
+
+	attempts := 1
+	if wh.Retries != nil {
+		attempts += int(*wh.Retries)
+	}
+
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(webhookRetryDelay(i)):
+			case <-ctx.Done():
+				return false, err
+			}
+		}
+		var ready bool
+		ready, err = callWebhook(ctx, hc, wh.URL, body)
+		if err == nil || ctx.Err() != nil {
+			return ready, err
+		}
+	}
+	return false, err
+}
+
+// webhookRetryDelay returns the time to wait before the supplied retry of a
+// failed webhook call, starting at 1 for the first retry.
+func webhookRetryDelay(retry int) time.Duration {
+	d := webhookBackoff
+	for i := 1; i < retry && d < maxWebhookBackoff; i++ {
+		d *= 2
+	}
+	if d > maxWebhookBackoff {
+		return maxWebhookBackoff
+	}
+	return d
+}
+
+// webhookClient returns an HTTP client for the supplied webhook. Clients are
+// shared by all webhooks with the same CA bundle and timeout.
+func webhookClient(wh *v1alpha1.WebhookReadinessCheck) (*http.Client, error) {
+	timeout := defaultWebhookTimeout
+	if wh.TimeoutSeconds != nil {
+		timeout = time.Duration(*wh.TimeoutSeconds) * time.Second
+	}
+	k := webhookClientKey{caBundle: string(wh.CABundle), timeout: timeout}
+	if hc, ok := webhookClients.Get(k); ok {
+		return hc.(*http.Client), nil
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if len(wh.CABundle) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(wh.CABundle) {
+			return nil, errors.New(errWebhookCABundle)
+		}
+		t.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	hc := &http.Client{Timeout: timeout, Transport: t}
+	webhookClients.Add(k, hc, webhookClientTTL)
+	return hc, nil
+}
+
+func callWebhook(ctx context.Context, hc *http.Client, url string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.Wrap(err, errWebhookRequest)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp, err := hc.Do(req)
+	if err != nil {
+		return false, errors.Wrap(err, errWebhookCall)
+	}
+	defer rsp.Body.Close() // nolint:errcheck
+
+	if rsp.StatusCode != http.StatusOK {
+		return false, errors.Errorf(errFmtWebhookStatus, rsp.StatusCode)
+	}
+
+	r := &webhookResponse{}
+	if err := json.NewDecoder(rsp.Body).Decode(r); err != nil {
+		return false, errors.Wrap(err, errWebhookDecode)
+	}
+	return r.Ready, nil
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composed
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	runtimecomposed "github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composed"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+)
+
+func TestIsReadyWebhook(t *testing.T) {
+	retries := int32(2)
+
+	type args struct {
+		handler http.HandlerFunc
+		wh      *v1alpha1.WebhookReadinessCheck
+	}
+	type want struct {
+		ready bool
+		err   bool
+		calls int32
+	}
+	cases := map[string]struct {
+		reason string
+		args
+		want
+	}{
+		"Ready": {
+			reason: "The composed resource should be ready if the webhook says so",
+			args: args{
+				handler: func(w http.ResponseWriter, r *http.Request) {
+					u := map[string]interface{}{}
+					if err := json.NewDecoder(r.Body).Decode(&u); err != nil || u["kind"] != "Cool" {
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+					_, _ = w.Write([]byte(`{"ready": true}`))
+				},
+				wh: &v1alpha1.WebhookReadinessCheck{},
+			},
+			want: want{
+				ready: true,
+				calls: 1,
+			},
+		},
+		"NotReady": {
+			reason: "The composed resource should not be ready if the webhook says so",
+			args: args{
+				handler: func(w http.ResponseWriter, _ *http.Request) {
+					_, _ = w.Write([]byte(`{"ready": false}`))
+				},
+				wh: &v1alpha1.WebhookReadinessCheck{},
+			},
+			want: want{
+				ready: false,
+				calls: 1,
+			},
+		},
+		"ErrorAfterRetries": {
+			reason: "An error should be returned once all retries have failed",
+			args: args{
+				handler: func(w http.ResponseWriter, _ *http.Request) {
+					w.WriteHeader(http.StatusInternalServerError)
+				},
+				wh: &v1alpha1.WebhookReadinessCheck{Retries: &retries},
+			},
+			want: want{
+				err:   true,
+				calls: 3,
+			},
+		},
+		"NotReadyOnError": {
+			reason: "The composed resource should not be ready if the webhook fails and errors are to be treated as not ready",
+			args: args{
+				handler: func(w http.ResponseWriter, _ *http.Request) {
+					_, _ = w.Write([]byte(`olala`))
+				},
+				wh: &v1alpha1.WebhookReadinessCheck{NotReadyOnError: true},
+			},
+			want: want{
+				ready: false,
+				calls: 1,
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var calls int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				tc.args.handler(w, r)
+			}))
+			defer srv.Close()
+
+			tc.args.wh.URL = srv.URL
+			cd := runtimecomposed.New(func(r *runtimecomposed.Unstructured) { r.SetKind("Cool") })
+			ct := v1alpha1.ComposedTemplate{ReadinessChecks: []v1alpha1.ReadinessCheck{{Type: v1alpha1.ReadinessCheckWebhook, Webhook: tc.args.wh}}}
+
+			ready, err := (&DefaultReadinessChecker{}).IsReady(context.Background(), cd, ct)
+			if diff := cmp.Diff(tc.want.err, err != nil); diff != "" {
+				t.Errorf("\n%s\nIsReady(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ready, ready); diff != "" {
+				t.Errorf("\n%s\nIsReady(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.calls, atomic.LoadInt32(&calls)); diff != "" {
+				t.Errorf("\n%s\nIsReady(...): -want calls, +got calls:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestWebhookClient(t *testing.T) {
+	short := int32(1)
+
+	a, err := webhookClient(&v1alpha1.WebhookReadinessCheck{})
+	if err != nil {
+		t.Fatalf("webhookClient(...): %s", err)
+	}
+	b, err := webhookClient(&v1alpha1.WebhookReadinessCheck{})
+	if err != nil {
+		t.Fatalf("webhookClient(...): %s", err)
+	}
+	c, err := webhookClient(&v1alpha1.WebhookReadinessCheck{TimeoutSeconds: &short})
+	if err != nil {
+		t.Fatalf("webhookClient(...): %s", err)
+	}
+
+	if a != b {
+		t.Errorf("webhookClient(...): webhooks with the same CA bundle and timeout should share a client")
+	}
+	if a == c {
+		t.Errorf("webhookClient(...): webhooks with different timeouts should not share a client")
+	}
+	if _, err := webhookClient(&v1alpha1.WebhookReadinessCheck{CABundle: []byte("olala")}); err == nil {
+		t.Errorf("webhookClient(...): want error for an invalid CA bundle")
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	cases := map[string]struct {
+		retry int
+		want  time.Duration
+	}{
+		"FirstRetry":  {retry: 1, want: webhookBackoff},
+		"SecondRetry": {retry: 2, want: 2 * webhookBackoff},
+		"ThirdRetry":  {retry: 3, want: 4 * webhookBackoff},
+		"Capped":      {retry: 100, want: maxWebhookBackoff},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, webhookRetryDelay(tc.retry)); diff != "" {
+				t.Errorf("webhookRetryDelay(%d): -want, +got:\n%s", tc.retry, diff)
+			}
+		})
+	}
+}
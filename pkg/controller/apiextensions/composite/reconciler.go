@@ -18,12 +18,16 @@ package composite
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -46,6 +50,10 @@ const (
 	shortWait = 30 * time.Second
 	longWait  = 1 * time.Minute
 	timeout   = 2 * time.Minute
+
+	// notReadyShown is the number of composed resources that are not ready
+	// that are described by the message of the composite's Ready condition.
+	notReadyShown = 3
 )
 
 // Error strings
@@ -56,8 +64,15 @@ const (
 	errSelectComp   = "cannot select Composition"
 	errGetComp      = "cannot get Composition"
 	errConfigure    = "cannot configure composite resource"
+	errValidate     = "invalid composite resource"
+	errValidateComp = "invalid Composition"
 	errReconcile    = "cannot reconcile composed infrastructure resource"
 	errPublish      = "cannot publish connection details"
+	errGetComposed  = "cannot get composed resource"
+	errFunctions    = "cannot compute desired composed resources"
+
+	errFmtDegraded = "cannot apply patches to composed resource at index %d"
+	errFmtNotSet   = "connection details of composed resource at index %d may be incomplete"
 )
 
 // Event reasons.
@@ -91,6 +106,24 @@ type ConnectionPublisher interface {
 	UnpublishConnection(ctx context.Context, o resource.ConnectionSecretOwner, c managed.ConnectionDetails) error
 }
 
+// An AnnotatedConnectionPublisher is a ConnectionPublisher that can also
+// publish annotations propagated from the connection secrets of composed
+// resources, for example markers indicating that a secret is encrypted at rest.
+type AnnotatedConnectionPublisher interface {
+	// PublishAnnotatedConnection publishes the supplied ConnectionDetails and
+	// annotations for the supplied resource.
+	PublishAnnotatedConnection(ctx context.Context, o resource.ConnectionSecretOwner, c managed.ConnectionDetails, annotations map[string]string) error
+}
+
+// A MetadataConnectionPublisher is a ConnectionPublisher that can also
+// publish labels and annotations, for example those specified by the
+// composition so that tools can discover connection secrets.
+type MetadataConnectionPublisher interface {
+	// PublishConnectionWithMetadata publishes the supplied ConnectionDetails,
+	// labels and annotations for the supplied resource.
+	PublishConnectionWithMetadata(ctx context.Context, o resource.ConnectionSecretOwner, c managed.ConnectionDetails, md v1alpha1.ConnectionSecretMetadata) error
+}
+
 // TODO(muvaf): Interface should not depend on composedctrl package but that's
 // the easiest way for now to not have circular dependency.
 
@@ -99,6 +132,12 @@ type Composer interface {
 	Compose(ctx context.Context, cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) (composedctrl.Observation, error)
 }
 
+// A FunctionRunner computes the desired composed resources of a composite
+// resource, and the observed composed resource each should be composed into.
+type FunctionRunner interface {
+	Desired(ctx context.Context, cp resource.Composite, observed []resource.Composed) ([]v1alpha1.ComposedTemplate, []resource.Composed, error)
+}
+
 // CompositionSelector selects a composition reference.
 type CompositionSelector interface {
 	SelectComposition(ctx context.Context, cr resource.Composite) error
@@ -158,6 +197,25 @@ func WithComposer(rc Composer) ReconcilerOption {
 	}
 }
 
+// WithFunctionRunner specifies that the Reconciler should compose the
+// resources computed by the supplied FunctionRunner rather than the resources
+// of the composition. Resources are composed from the composition by default.
+func WithFunctionRunner(fr FunctionRunner) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.functions = fr
+	}
+}
+
+// WithSteadyStatePollInterval specifies how long the Reconciler should wait
+// before reconciling a composite resource again when all of its composed
+// resources are ready and their desired state has not changed since they were
+// last composed.
+func WithSteadyStatePollInterval(after time.Duration) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.steadyWait = after
+	}
+}
+
 type compositeResource struct {
 	CompositionSelector
 	Configurator
@@ -178,11 +236,13 @@ func NewReconciler(mgr manager.Manager, of resource.CompositeKind, opts ...Recon
 		composite: compositeResource{
 			CompositionSelector: NewAPILabelSelectorResolver(kube),
 			Configurator:        NewConfiguratorChain(NewAPINamingConfigurator(kube), NewAPIConfigurator(kube)),
-			ConnectionPublisher: NewAPIFilteredSecretPublisher(kube, []string{}),
+			ConnectionPublisher: NewAPIHashingSecretPublisher(kube, []string{}),
 		},
 
 		resource: composedctrl.NewComposer(kube),
 
+		steadyWait: longWait,
+
 		log:    logging.NewNopLogger(),
 		record: event.NewNopRecorder(),
 	}
@@ -200,6 +260,9 @@ type Reconciler struct {
 
 	composite compositeResource
 	resource  Composer
+	functions FunctionRunner
+
+	steadyWait time.Duration
 
 	log    logging.Logger
 	record event.Recorder
@@ -245,12 +308,28 @@ func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error)
 		return reconcile.Result{RequeueAfter: shortWait}, nil
 	}
 
+	// Malformed field paths would otherwise only be discovered while
+	// composing, possibly after some resources have already been composed.
+	if err := composedctrl.ValidateFieldPaths(comp); err != nil {
+		log.Debug(errValidateComp, "error", err)
+		r.record.Event(cr, event.Warning(reasonCompose, errors.Wrap(err, errValidateComp)))
+		return reconcile.Result{RequeueAfter: shortWait}, nil
+	}
+
 	if err := r.composite.Configure(ctx, cr, comp); err != nil {
 		log.Debug(errConfigure, "error", err)
 		r.record.Event(cr, event.Warning(reasonCompose, err))
 		return reconcile.Result{RequeueAfter: shortWait}, nil
 	}
 
+	// Composed resources can't be named without the name prefix label, so we
+	// make sure it's present before we attempt to compose any of them.
+	if err := composedctrl.ValidateNamePrefix(cr); err != nil {
+		log.Debug(errValidate, "error", err)
+		r.record.Event(cr, event.Warning(reasonCompose, err))
+		return reconcile.Result{RequeueAfter: shortWait}, nil
+	}
+
 	log = log.WithValues(
 		"composition-uid", comp.GetUID(),
 		"composition-version", comp.GetResourceVersion(),
@@ -264,14 +343,66 @@ func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error)
 	// array with the same length. Then copy the already provisioned ones into
 	// that array to not create new ones because composed reconciler assumes that
 	// if the reference is empty, it needs to create the resource.
-	refs := make([]corev1.ObjectReference, len(comp.Spec.Resources))
+	tmpls := comp.Spec.Resources
+	refs := make([]corev1.ObjectReference, len(tmpls))
 	copy(refs, cr.GetResourceReferences())
+
+	// Patches may write to the spec or metadata of the composite resource, so
+	// we note what we last persisted in order to persist any changes.
+	persisted, err := withoutStatus(cr)
+	if err != nil {
+		log.Debug(errUpdate, "error", err)
+		r.record.Event(cr, event.Warning(reasonCompose, errors.Wrap(err, errUpdate)))
+		return reconcile.Result{RequeueAfter: shortWait}, nil
+	}
+
+	// Resources computed by composition functions are composed instead of
+	// those of the composition, if configured. References to resources that
+	// are no longer desired are pruned, and persisted below.
+	if r.functions != nil {
+		if tmpls, refs, err = r.desired(ctx, cr); err != nil {
+			log.Debug(errFunctions, "error", err)
+			r.record.Event(cr, event.Warning(reasonCompose, errors.Wrap(err, errFunctions)))
+			return reconcile.Result{RequeueAfter: shortWait}, nil
+		}
+		cr.SetResourceReferences(refs)
+	}
+
 	conn := managed.ConnectionDetails{}
+	annotations := map[string]string{}
+	degraded := []string{}
 	ready := 0
-	for i, ref := range refs {
-		tmpl := comp.Spec.Resources[i]
+	steady := 0
+	details := make([]composedctrl.ReadinessDetail, 0, len(refs))
+
+	// Resources are composed in the order their templates are listed, so
+	// patches may read from the named resources that were composed before
+	// them.
+	siblings := composedctrl.Siblings{}
 
-		obs, err := r.resource.Compose(ctx, cr, composed.New(composed.FromReference(ref)), tmpl)
+	// Composed resources often share a connection secret, so we get each
+	// secret at most once per reconcile.
+	ctx = composedctrl.WithSecretCache(ctx)
+	for i, ref := range refs {
+		tmpl := tmpls[i]
+
+		cd := composed.New(composed.FromReference(ref))
+		obs, err := r.resource.Compose(composedctrl.WithSiblings(ctx, siblings), cr, cd, tmpl)
+		if composedctrl.IsTerminal(err) {
+			// A composed resource has failed in a way that it is not expected
+			// to recover from, so we report the composite as unavailable
+			// rather than as still being created.
+			log.Debug(errReconcile, "error", err)
+			r.record.Event(cr, event.Warning(reasonCompose, err))
+			cr.SetConditions(runtimev1alpha1.Unavailable().WithMessage(err.Error()))
+			return reconcile.Result{RequeueAfter: longWait}, errors.Wrap(r.client.Status().Update(ctx, cr), errUpdateStatus)
+		}
+		if errors.Is(err, composedctrl.ErrMissingNamePrefix) {
+			// The name prefix label has not yet been applied. This is
+			// expected, so we requeue without reporting an error.
+			log.Debug(errReconcile, "error", err)
+			return reconcile.Result{RequeueAfter: shortWait}, nil
+		}
 		if err != nil {
 			log.Debug(errReconcile, "error", err)
 			r.record.Event(cr, event.Warning(reasonCompose, err))
@@ -281,10 +412,34 @@ func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error)
 		for key, val := range obs.ConnectionDetails {
 			conn[key] = val
 		}
+		for key, val := range obs.ConnectionAnnotations {
+			annotations[key] = val
+		}
+
+		if obs.Degraded != nil {
+			degraded = append(degraded, errors.Wrapf(obs.Degraded, errFmtDegraded, i).Error())
+		}
+
+		if obs.SecretReferenceNotSet != nil {
+			// The composed resource has probably not yet populated its
+			// connection secret reference. We don't requeue for this, but we
+			// report it so it isn't mistaken for a lack of connection details.
+			err := errors.Wrapf(obs.SecretReferenceNotSet, errFmtNotSet, i)
+			log.Debug(err.Error())
+			r.record.Event(cr, event.Warning(reasonPublish, err))
+		}
 
 		if obs.Ready {
 			ready++
 		}
+		details = append(details, composedctrl.ReadinessDetail{Name: cd.GetName(), Ready: obs.Ready, Reason: obs.Reason})
+		if obs.SteadyState {
+			steady++
+		}
+
+		if tmpl.Name != nil {
+			siblings[*tmpl.Name] = cd
+		}
 
 		// We need to update our composite resource with any new or updated
 		// references to the resources it composes. We do this immediately after
@@ -297,31 +452,146 @@ func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error)
 
 		refs[i] = obs.Ref
 		cr.SetResourceReferences(refs)
-		if err := r.client.Update(ctx, cr); err != nil {
+		if persisted, err = r.update(ctx, cr); err != nil {
+			log.Debug(errUpdate, "error", err)
+			r.record.Event(cr, event.Warning(reasonCompose, err))
+			return reconcile.Result{RequeueAfter: shortWait}, nil
+		}
+	}
+
+	// Patches to the composite resource are applied once each composed
+	// resource has been applied, so we persist any they made to its spec or
+	// metadata. Changes to its status are persisted by the status update
+	// below.
+	if current, err := withoutStatus(cr); err != nil || !cmp.Equal(persisted, current) {
+		if _, err := r.update(ctx, cr); err != nil {
 			log.Debug(errUpdate, "error", err)
 			r.record.Event(cr, event.Warning(reasonCompose, err))
 			return reconcile.Result{RequeueAfter: shortWait}, nil
 		}
 	}
 
-	if err := r.composite.PublishConnection(ctx, cr, conn); err != nil {
+	if err := r.publish(ctx, cr, conn, annotations, comp.Spec.ConnectionSecretMetadata); err != nil {
 		log.Debug(errPublish, "error", err)
 		r.record.Event(cr, event.Warning(reasonPublish, err))
 		return reconcile.Result{RequeueAfter: shortWait}, nil
 	}
 
-	// TODO(muvaf): Report which resources are not ready.
-
 	// TODO(muvaf): If a resource becomes Unavailable at some point, should we still
 	// report it as Creating?
 	wait := longWait
-	cr.SetConditions(runtimev1alpha1.Available())
+	cr.SetConditions(composedctrl.ReadinessCondition(details, notReadyShown, composedctrl.MaxConditionMessageLength))
 	if ready != len(refs) {
-		cr.SetConditions(runtimev1alpha1.Creating())
 		wait = shortWait
 	}
+	if steady == len(refs) {
+		wait = r.steadyWait
+	}
+
+	// Patches that were allowed to degrade rather than fail the reconcile are
+	// surfaced as a condition so that they don't go unnoticed.
+	switch {
+	case len(degraded) > 0:
+		msg := strings.Join(degraded, "; ")
+		r.record.Event(cr, event.Warning(reasonCompose, errors.New(msg)))
+		cr.SetConditions(v1alpha1.Degraded().WithMessage(msg))
+	case cr.GetCondition(v1alpha1.TypeDegraded).Status == corev1.ConditionTrue:
+		cr.SetConditions(v1alpha1.NotDegraded())
+	}
 
 	r.record.Event(cr, event.Normal(reasonPublish, "Successfully published connection details"))
 	r.record.Event(cr, event.Normal(reasonCompose, "Successfully composed resources"))
 	return reconcile.Result{RequeueAfter: wait}, errors.Wrap(r.client.Status().Update(ctx, cr), errUpdateStatus)
 }
+
+// update persists the spec and metadata of the supplied composite resource,
+// returning its persisted content. The API server responds with the status it
+// has persisted, so the status set during the current reconcile, for example
+// by patches, is restored in order to be persisted by a later status update.
+func (r *Reconciler) update(ctx context.Context, cr resource.Composite) (map[string]interface{}, error) {
+	u, ok := cr.(runtime.Unstructured)
+	if !ok {
+		if err := r.client.Update(ctx, cr); err != nil {
+			return nil, err
+		}
+		return withoutStatus(cr)
+	}
+	status, set := u.UnstructuredContent()["status"]
+	if err := r.client.Update(ctx, cr); err != nil {
+		return nil, err
+	}
+	persisted, err := withoutStatus(cr)
+	if set {
+		u.UnstructuredContent()["status"] = status
+	}
+	return persisted, err
+}
+
+// withoutStatus returns the content of the supplied composite resource other
+// than its status, i.e. the content that is persisted by an update.
+func withoutStatus(cr resource.Composite) (map[string]interface{}, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cr)
+	if err != nil {
+		return nil, err
+	}
+	// The content of unstructured resources is returned as is, so we copy it.
+	c := make(map[string]interface{}, len(u))
+	for k, v := range u {
+		if k != "status" {
+			c[k] = v
+		}
+	}
+	return runtime.DeepCopyJSON(c), nil
+}
+
+// desired returns the templates of the resources computed by the
+// FunctionRunner, and a reference to the composed resource each should be
+// composed into. The reference is empty if it has not yet been composed.
+func (r *Reconciler) desired(ctx context.Context, cr resource.Composite) ([]v1alpha1.ComposedTemplate, []corev1.ObjectReference, error) {
+	observed := make([]resource.Composed, 0, len(cr.GetResourceReferences()))
+	for _, ref := range cr.GetResourceReferences() {
+		if ref.Name == "" {
+			continue
+		}
+		cd := composed.New(composed.FromReference(ref))
+		err := r.client.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, cd)
+		if kerrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, errors.Wrap(err, errGetComposed)
+		}
+		observed = append(observed, cd)
+	}
+
+	tmpls, cds, err := r.functions.Desired(ctx, cr, observed)
+	if err != nil {
+		return nil, nil, err
+	}
+	refs := make([]corev1.ObjectReference, len(tmpls))
+	for i, cd := range cds {
+		if cd != nil {
+			refs[i] = *meta.ReferenceTo(cd, cd.GetObjectKind().GroupVersionKind())
+		}
+	}
+	return tmpls, refs, nil
+}
+
+func (r *Reconciler) publish(ctx context.Context, cr resource.Composite, conn managed.ConnectionDetails, annotations map[string]string, md *v1alpha1.ConnectionSecretMetadata) error {
+	if mp, ok := r.composite.ConnectionPublisher.(MetadataConnectionPublisher); ok && md != nil {
+		// Annotations specified by the composition take precedence over those
+		// propagated from composed resources.
+		merged := make(map[string]string, len(annotations)+len(md.Annotations))
+		for k, v := range annotations {
+			merged[k] = v
+		}
+		for k, v := range md.Annotations {
+			merged[k] = v
+		}
+		return mp.PublishConnectionWithMetadata(ctx, cr, conn, v1alpha1.ConnectionSecretMetadata{Labels: md.Labels, Annotations: merged})
+	}
+	if ap, ok := r.composite.ConnectionPublisher.(AnnotatedConnectionPublisher); ok && len(annotations) > 0 {
+		return ap.PublishAnnotatedConnection(ctx, cr, conn, annotations)
+	}
+	return r.composite.PublishConnection(ctx, cr, conn)
+}
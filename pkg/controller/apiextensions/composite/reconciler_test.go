@@ -0,0 +1,232 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composite
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kunstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/reconciler/managed"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/fake"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composed"
+	"github.com/crossplane/crossplane-runtime/pkg/resource/unstructured/composite"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/crossplane/apis/apiextensions/v1alpha1"
+	composedctrl "github.com/crossplane/crossplane/pkg/controller/apiextensions/composite/composed"
+)
+
+type MockSelector struct{}
+
+func (MockSelector) SelectComposition(_ context.Context, _ resource.Composite) error { return nil }
+
+type MockConfigurator struct{}
+
+func (MockConfigurator) Configure(_ context.Context, _ resource.Composite, _ *v1alpha1.Composition) error {
+	return nil
+}
+
+type MockPublisher struct{}
+
+func (MockPublisher) PublishConnection(_ context.Context, _ resource.ConnectionSecretOwner, _ managed.ConnectionDetails) error {
+	return nil
+}
+
+func (MockPublisher) UnpublishConnection(_ context.Context, _ resource.ConnectionSecretOwner, _ managed.ConnectionDetails) error {
+	return nil
+}
+
+type MockComposer struct {
+	MockCompose func(ctx context.Context, cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) (composedctrl.Observation, error)
+}
+
+func (m MockComposer) Compose(ctx context.Context, cp resource.Composite, cd resource.Composed, t v1alpha1.ComposedTemplate) (composedctrl.Observation, error) {
+	return m.MockCompose(ctx, cp, cd, t)
+}
+
+type MockFunctionRunner struct {
+	MockDesired func(ctx context.Context, cp resource.Composite, observed []resource.Composed) ([]v1alpha1.ComposedTemplate, []resource.Composed, error)
+}
+
+func (m MockFunctionRunner) Desired(ctx context.Context, cp resource.Composite, observed []resource.Composed) ([]v1alpha1.ComposedTemplate, []resource.Composed, error) {
+	return m.MockDesired(ctx, cp, observed)
+}
+
+func TestReconcile(t *testing.T) {
+	errBoom := errors.New("boom")
+	of := resource.CompositeKind(schema.GroupVersionKind{Group: "example.org", Version: "v1", Kind: "XCool"})
+	ref := corev1.ObjectReference{APIVersion: "example.org/v1", Kind: "Cool", Name: "cool-xr-1234"}
+	stale := corev1.ObjectReference{APIVersion: "example.org/v1", Kind: "Cool", Name: "cool-xr-5678"}
+
+	// get returns the composite resource with the supplied references. Its
+	// composed resources are not distinguished from it, as they are never read.
+	get := func(refs ...corev1.ObjectReference) test.MockGetFn {
+		return test.NewMockGetFn(nil, func(o runtime.Object) error {
+			switch o := o.(type) {
+			case *kunstructured.Unstructured:
+				cp := composite.New(composite.WithGroupVersionKind(schema.GroupVersionKind(of)))
+				cp.SetName("cool-xr")
+				cp.SetLabels(map[string]string{composedctrl.LabelKeyNamePrefixForComposed: "cool-xr"})
+				cp.SetCompositionReference(&corev1.ObjectReference{Name: "cool-composition"})
+				cp.SetResourceReferences(refs)
+				cp.Unstructured.DeepCopyInto(o)
+			case *v1alpha1.Composition:
+				o.Spec.Resources = []v1alpha1.ComposedTemplate{{
+					Base: runtime.RawExtension{Raw: []byte(`{"apiVersion":"example.org/v1","kind":"Cool"}`)},
+				}}
+			}
+			return nil
+		})
+	}
+	// patch returns a Composer that patches the composite resource using the
+	// supplied value, as a ToCompositeFieldPath patch would.
+	patch := func(value interface{}) MockComposer {
+		return MockComposer{MockCompose: func(_ context.Context, cp resource.Composite, _ resource.Composed, _ v1alpha1.ComposedTemplate) (composedctrl.Observation, error) {
+			if value != nil {
+				if err := fieldpath.Pave(cp.(*composite.Unstructured).Object).SetValue("spec.address", value); err != nil {
+					return composedctrl.Observation{}, err
+				}
+			}
+			return composedctrl.Observation{Ref: ref, Ready: true}, nil
+		}}
+	}
+
+	type args struct {
+		refs      []corev1.ObjectReference
+		composer  Composer
+		functions FunctionRunner
+		update    func(obj runtime.Object) error
+	}
+	type want struct {
+		r       reconcile.Result
+		err     error
+		address interface{}
+		refs    []corev1.ObjectReference
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"PatchedSpecPersisted": {
+			reason: "Changes patches make to the spec of the composite resource should be persisted.",
+			args: args{
+				refs:     []corev1.ObjectReference{ref},
+				composer: patch("10.0.0.1"),
+				update:   func(_ runtime.Object) error { return nil },
+			},
+			want: want{
+				r:       reconcile.Result{RequeueAfter: longWait},
+				address: "10.0.0.1",
+				refs:    []corev1.ObjectReference{ref},
+			},
+		},
+		"UnchangedSpecNotPersisted": {
+			reason: "The composite resource should not be updated if its spec and metadata are unchanged.",
+			args: args{
+				refs:     []corev1.ObjectReference{ref},
+				composer: patch(nil),
+				update:   func(_ runtime.Object) error { return errBoom },
+			},
+			want: want{
+				r: reconcile.Result{RequeueAfter: longWait},
+			},
+		},
+		"UpdateFailed": {
+			reason: "We should requeue if we cannot persist changes patches made to the composite resource.",
+			args: args{
+				refs:     []corev1.ObjectReference{ref},
+				composer: patch("10.0.0.1"),
+				update:   func(_ runtime.Object) error { return errBoom },
+			},
+			want: want{
+				r: reconcile.Result{RequeueAfter: shortWait},
+			},
+		},
+		"StaleFunctionReferencesPruned": {
+			reason: "References to resources that composition functions no longer desire should be pruned, even if no other references changed.",
+			args: args{
+				refs:     []corev1.ObjectReference{ref, stale},
+				composer: patch(nil),
+				functions: MockFunctionRunner{MockDesired: func(_ context.Context, _ resource.Composite, _ []resource.Composed) ([]v1alpha1.ComposedTemplate, []resource.Composed, error) {
+					cd := composed.New(composed.FromReference(ref))
+					return []v1alpha1.ComposedTemplate{{}}, []resource.Composed{cd}, nil
+				}},
+				update: func(_ runtime.Object) error { return nil },
+			},
+			want: want{
+				r:    reconcile.Result{RequeueAfter: longWait},
+				refs: []corev1.ObjectReference{ref},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var address interface{}
+			var refs []corev1.ObjectReference
+			mgr := &fake.Manager{Client: &test.MockClient{
+				MockGet: get(tc.args.refs...),
+				MockUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+					if err := tc.args.update(obj); err != nil {
+						return err
+					}
+					cp := &composite.Unstructured{Unstructured: *obj.(*kunstructured.Unstructured)}
+					address, _ = fieldpath.Pave(cp.Object).GetValue("spec.address")
+					refs = cp.GetResourceReferences()
+					return nil
+				},
+				MockStatusUpdate: test.NewMockStatusUpdateFn(nil),
+			}}
+			o := []ReconcilerOption{
+				WithCompositionSelector(MockSelector{}),
+				WithConfigurator(MockConfigurator{}),
+				WithConnectionPublisher(MockPublisher{}),
+				WithComposer(tc.args.composer),
+			}
+			if tc.args.functions != nil {
+				o = append(o, WithFunctionRunner(tc.args.functions))
+			}
+			r := NewReconciler(mgr, of, o...)
+			got, err := r.Reconcile(reconcile.Request{})
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nr.Reconcile(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.r, got); diff != "" {
+				t.Errorf("\n%s\nr.Reconcile(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.address, address); diff != "" {
+				t.Errorf("\n%s\nr.Reconcile(...): -want persisted spec.address, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.refs, refs); diff != "" {
+				t.Errorf("\n%s\nr.Reconcile(...): -want persisted resource references, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -209,10 +209,10 @@ func TestGetHostPort(t *testing.T) {
 		},
 		"InvalidURL": {
 			args: args{
-				urlHost: string(0x7f),
+				urlHost: string(rune(0x7f)),
 			},
 			want: want{
-				err: errors.Wrap(urlParseError(string(0x7f)), "cannot parse URL"),
+				err: errors.Wrap(urlParseError(string(rune(0x7f))), "cannot parse URL"),
 			},
 		},
 	}
@@ -266,12 +266,12 @@ func TestNewConfigForHost(t *testing.T) {
 		},
 		"ErrorHostedInvalidHost": {
 			args: args{
-				server:                  string(0x7f),
+				server:                  string(rune(0x7f)),
 				hostControllerNamespace: "test-controllers-ns",
 			},
 			want: want{
 				config: nil,
-				err:    errors.Wrap(errors.Wrap(urlParseError(string(0x7f)), "cannot parse URL"), "cannot get host port from tenant kubeconfig"),
+				err:    errors.Wrap(errors.Wrap(urlParseError(string(rune(0x7f))), "cannot parse URL"), "cannot get host port from tenant kubeconfig"),
 			},
 		},
 		"RegularHosted": {